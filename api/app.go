@@ -22,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/app/image"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/cost"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -38,6 +39,7 @@ import (
 	apiTypes "github.com/tsuru/tsuru/types/api"
 	appTypes "github.com/tsuru/tsuru/types/app"
 	permTypes "github.com/tsuru/tsuru/types/permission"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 	"github.com/tsuru/tsuru/types/quota"
 )
 
@@ -123,6 +125,10 @@ func appVersionDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	err = evt.SetOtherCustomData(cost.AppSnapshot(&a))
+	if err != nil {
+		return err
+	}
 	ctx, cancel := evt.CancelableContext(a.Context())
 	defer cancel()
 	a.ReplaceContext(ctx)
@@ -166,6 +172,10 @@ func appDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	err = evt.SetOtherCustomData(cost.AppSnapshot(&a))
+	if err != nil {
+		return err
+	}
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
 	defer keepAliveWriter.Stop()
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
@@ -351,17 +361,18 @@ func appInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 }
 
 type inputApp struct {
-	TeamOwner    string
-	Platform     string
-	Plan         string
-	Name         string
-	Description  string
-	Pool         string
-	Router       string
-	RouterOpts   map[string]string
-	Tags         []string
-	PlanOverride appTypes.PlanOverride
-	Metadata     appTypes.Metadata
+	TeamOwner           string
+	Platform            string
+	Plan                string
+	Name                string
+	Description         string
+	Pool                string
+	Router              string
+	RouterOpts          map[string]string
+	Tags                []string
+	PlanOverride        appTypes.PlanOverride
+	ProcessPlanOverride map[string]appTypes.PlanOverride
+	Metadata            appTypes.Metadata
 }
 
 func autoTeamOwner(ctx stdContext.Context, t auth.Token, perm *permission.PermissionScheme) (string, error) {
@@ -522,7 +533,7 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	imageReset, _ := strconv.ParseBool(InputValue(r, "imageReset"))
 	updateData := app.App{
 		TeamOwner:      ia.TeamOwner,
-		Plan:           appTypes.Plan{Name: ia.Plan, Override: ia.PlanOverride},
+		Plan:           appTypes.Plan{Name: ia.Plan, Override: ia.PlanOverride, ProcessOverride: ia.ProcessPlanOverride},
 		Pool:           ia.Pool,
 		Description:    ia.Description,
 		Router:         ia.Router,
@@ -534,6 +545,7 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	}
 	tags, _ := InputValues(r, "tag")
 	noRestart, _ := strconv.ParseBool(InputValue(r, "noRestart"))
+	dryRun, _ := strconv.ParseBool(InputValue(r, "dryRun"))
 	updateData.Tags = append(updateData.Tags, tags...) // for compatibility
 	appName := r.URL.Query().Get(":app")
 	a, err := getAppFromContext(appName, r)
@@ -553,7 +565,7 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	if updateData.Plan.Name != "" {
 		wantedPerms = append(wantedPerms, permission.PermAppUpdatePlan)
 	}
-	if updateData.Plan.Override != (appTypes.PlanOverride{}) {
+	if updateData.Plan.Override != (appTypes.PlanOverride{}) || len(updateData.Plan.ProcessOverride) > 0 {
 		wantedPerms = append(wantedPerms, permission.PermAppUpdatePlanoverride)
 	}
 	if updateData.Pool != "" {
@@ -599,6 +611,18 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 			return permission.ErrUnauthorized
 		}
 	}
+	if dryRun {
+		var changes []provision.ManifestChange
+		changes, err = a.DryRunUpdate(app.UpdateAppArgs{UpdateData: updateData})
+		if err == appTypes.ErrPlanNotFound || err == appTypes.ErrNoVersionsAvailable {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(changes)
+	}
 	evt, err := event.New(&event.Opts{
 		Target:        appTarget(appName),
 		Kind:          permission.PermAppUpdate,
@@ -860,6 +884,57 @@ func killUnit(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return err
 }
 
+// title: unit events
+// path: /apps/{app}/units/events
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func unitEvents(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	query := r.URL.Query()
+	filter := provTypes.UnitEventFilter{
+		App:   a.Name,
+		Unit:  query.Get("unit"),
+		Kinds: query["kind"],
+	}
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid since, must be a RFC3339 timestamp"}
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid limit, must be a number"}
+		}
+	}
+	events, err := servicemanager.UnitEvent.List(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
 // title: set node status
 // path: /node/status
 // method: POST
@@ -2066,6 +2141,124 @@ func appMetricEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(metricMap)
 }
 
+// title: app network policy
+// path: /apps/{app}/network-policy
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appNetworkPolicy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	policy, err := a.NetworkPolicy()
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(policy)
+}
+
+// title: app drift
+// path: /apps/{app}/drift
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appDrift(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	changes, err := a.Drift()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(changes)
+}
+
+// title: app migrate cluster
+// path: /apps/{app}/migrate
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appMigrateCluster(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	opts := app.MigrateClusterOptions{
+		Pool:    InputValue(r, "pool"),
+		Cluster: InputValue(r, "cluster"),
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateCluster,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if opts.Pool != "" && opts.Pool != a.Pool {
+		allowed = permission.Check(t, permission.PermAppUpdateCluster,
+			permission.Context(permTypes.CtxPool, opts.Pool),
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateCluster,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	evt.SetLogWriter(writer)
+	return a.MigrateCluster(r.Context(), opts, evt)
+}
+
 // compatRebuildRoutesResult is a backward compatible rebuild routes struct
 // used in the handler so that old clients won't break.
 type compatRebuildRoutesResult struct {
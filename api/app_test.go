@@ -47,6 +47,7 @@ import (
 	authTypes "github.com/tsuru/tsuru/types/auth"
 	"github.com/tsuru/tsuru/types/cache"
 	permTypes "github.com/tsuru/tsuru/types/permission"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 	"github.com/tsuru/tsuru/types/quota"
 	check "gopkg.in/check.v1"
 )
@@ -796,6 +797,11 @@ func (s *S) TestDelete(c *check.C) {
 		StartCustomData: []map[string]interface{}{
 			{"name": ":app", "value": myApp.Name},
 		},
+		OtherCustomData: map[string]interface{}{
+			"teamowner": s.team.Name,
+			"pool":      myApp.Pool,
+			"plan":      myApp.Plan.Name,
+		},
 	}, eventtest.HasEvent)
 }
 
@@ -1685,9 +1691,50 @@ func (s *S) TestUpdateAppWithDescriptionOnly(c *check.C) {
 			{"name": ":app", "value": a.Name},
 			{"name": "description", "value": "my app description"},
 		},
+		OtherCustomData: map[string]interface{}{
+			"teamowner": s.team.Name,
+		},
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestUpdateAppDryRun(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		Processes: map[string][]string{"web": {"python web.py"}},
+	})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdate,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	body := strings.NewReader("description=my app description&dryRun=true")
+	request, err := http.NewRequest("PUT", "/apps/myapp", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var changes []provision.ManifestChange
+	err = json.Unmarshal(recorder.Body.Bytes(), &changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []provision.ManifestChange{
+		{Kind: "Deployment", Name: "myapp-web", Operation: provision.ManifestUpdate},
+	})
+	var gotApp app.App
+	err = s.conn.Apps().Find(bson.M{"name": "myapp"}).One(&gotApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(gotApp.Description, check.Equals, "")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Kind:   "app.update",
+	}, check.Not(eventtest.HasEvent))
+}
+
 func (s *S) TestUpdateAppPlatformOnly(c *check.C) {
 	s.setupMockForCreateApp(c, "zend")
 	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
@@ -2128,6 +2175,36 @@ func (s *S) TestUpdateAppPlanOverrideOnly(c *check.C) {
 	}
 }
 
+func (s *S) TestUpdateAppProcessPlanOverride(c *check.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	originalPlan := appTypes.Plan{Name: "hiperplan", Memory: 536870912, Swap: 536870912, CpuShare: 100, CPUMilli: 1000}
+	s.mockService.Plan.OnFindByName = func(name string) (*appTypes.Plan, error) {
+		return &originalPlan, nil
+	}
+	s.mockService.Plan.OnList = func() ([]appTypes.Plan, error) {
+		return []appTypes.Plan{originalPlan}, nil
+	}
+	a := app.App{Name: "someapp", Platform: "zend", TeamOwner: s.team.Name, Plan: originalPlan}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	body := strings.NewReader("processplanoverride.worker.memory=314572800&processplanoverride.worker.cpumilli=200")
+	request, err := http.NewRequest("PUT", "/apps/someapp", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %v", recorder.Body.String()))
+	dbApp, err := app.GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GetProcessMemory("worker"), check.Equals, int64(314572800))
+	c.Assert(dbApp.GetProcessMilliCPU("worker"), check.Equals, 200)
+	c.Assert(dbApp.GetProcessMemory("web"), check.Equals, int64(536870912))
+	c.Assert(dbApp.GetProcessMilliCPU("web"), check.Equals, 1000)
+}
+
 func (s *S) TestUpdateAppPlanNotFound(c *check.C) {
 	s.plan = appTypes.Plan{Name: "superplan", Memory: 268435456, Swap: 268435456, CpuShare: 100}
 	a := app.App{Name: "someapp", Platform: "zend", TeamOwner: s.team.Name, Plan: s.plan}
@@ -6582,6 +6659,248 @@ func (s *S) TestMetricEnvsWhenAppDoesNotExist(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Matches, "^App .* not found.\n$")
 }
 
+func (s *S) TestAppNetworkPolicy(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/network-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var policy provTypes.EffectiveNetworkPolicy
+	err = json.Unmarshal(recorder.Body.Bytes(), &policy)
+	c.Assert(err, check.IsNil)
+	c.Assert(policy, check.DeepEquals, provTypes.EffectiveNetworkPolicy{
+		Mode:    "open",
+		Ingress: provTypes.NetworkPolicyRules{AllowAll: true},
+		Egress:  provTypes.NetworkPolicyRules{AllowAll: true},
+	})
+}
+
+func (s *S) TestAppNetworkPolicyWhenUserDoesNotHaveAccess(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permTypes.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("GET", "/apps/myappx/network-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUnitEvents(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	events := []provTypes.UnitEvent{
+		{App: "myappx", Unit: "myappx-web-1", Process: "web", Kind: provTypes.UnitEventReady, Time: now.Add(-time.Hour)},
+		{App: "myappx", Unit: "myappx-web-1", Process: "web", Kind: provTypes.UnitEventRestarted, Reason: "Error", RestartCount: 1, Time: now.Add(-time.Minute)},
+		{App: "myappx", Unit: "myappx-web-2", Process: "web", Kind: provTypes.UnitEventReady, Time: now},
+		{App: "otherapp", Unit: "otherapp-web-1", Process: "web", Kind: provTypes.UnitEventReady, Time: now},
+	}
+	for _, evt := range events {
+		err = servicemanager.UnitEvent.Add(context.TODO(), evt)
+		c.Assert(err, check.IsNil)
+	}
+	tests := []struct {
+		query    string
+		expected []provTypes.UnitEvent
+	}{
+		{"", []provTypes.UnitEvent{events[2], events[1], events[0]}},
+		{"unit=myappx-web-1", []provTypes.UnitEvent{events[1], events[0]}},
+		{"kind=restarted&kind=oom-killed", []provTypes.UnitEvent{events[1]}},
+		{"since=2022-05-10T11:30:00Z", []provTypes.UnitEvent{events[2], events[1]}},
+		{"limit=1", []provTypes.UnitEvent{events[2]}},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/apps/myappx/units/events?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusOK)
+		c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+		var result []provTypes.UnitEvent
+		err = json.Unmarshal(recorder.Body.Bytes(), &result)
+		c.Assert(err, check.IsNil)
+		for i := range result {
+			result[i].Time = result[i].Time.UTC()
+		}
+		c.Assert(result, check.DeepEquals, tt.expected, check.Commentf("query %q", tt.query))
+	}
+}
+
+func (s *S) TestUnitEventsNoEvents(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/units/events", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestUnitEventsInvalidFilter(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	for _, query := range []string{"since=yesterday", "limit=many"} {
+		request, err := http.NewRequest("GET", "/apps/myappx/units/events?"+query, nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestUnitEventsWhenUserDoesNotHaveAccess(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permTypes.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("GET", "/apps/myappx/units/events", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppDrift(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	changes := []provision.ManifestChange{
+		{Kind: "Deployment", Name: "myappx-web", Operation: provision.ManifestUpdate, Diff: "- replicas: 3\n+ replicas: 1\n"},
+	}
+	s.provisioner.MockDrift(&a, changes)
+	request, err := http.NewRequest("GET", "/apps/myappx/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []provision.ManifestChange
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, changes)
+}
+
+func (s *S) TestAppDriftNoChanges(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAppDriftWhenUserDoesNotHaveAccess(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permTypes.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("GET", "/apps/myappx/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppMigrateCluster(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"migration": app.ClusterMigration{
+		SourcePool:         a.Pool,
+		SourceCluster:      "c1",
+		DestinationPool:    a.Pool,
+		DestinationCluster: "c2",
+		Steps: []string{
+			"migrate-provision-destination",
+			"migrate-deploy-destination",
+			"migrate-wait-destination",
+			"migrate-switch-routes",
+		},
+	}}})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/myappx/migrate", strings.NewReader("cluster=c2"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*App migrated to cluster \\"c2\\".*`)
+	c.Assert(s.provisioner.Provisioned(&a), check.Equals, false)
+	dbApp, err := app.GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Migration, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.cluster",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "cluster", "value": "c2"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppMigrateClusterInvalid(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/myappx/migrate", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "destination cluster is required\n")
+}
+
+func (s *S) TestAppMigrateClusterWhenUserDoesNotHaveAccess(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateCluster,
+		Context: permission.Context(permTypes.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("POST", "/apps/myappx/migrate", strings.NewReader("cluster=c2"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestRebuildRoutes(c *check.C) {
 	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
 	err := app.CreateApp(context.TODO(), &a, s.user)
@@ -0,0 +1,145 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+// title: list app version channels
+// path: /apps/{app}/versions/channels
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appVersionChannelList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	ctx := r.Context()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadInfo,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	versions, err := servicemanager.AppVersion.AppVersions(ctx, &a)
+	if err != nil && err != appTypes.ErrNoVersionsAvailable {
+		return err
+	}
+	if len(versions.Channels) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(versions.Channels)
+}
+
+// title: set app version channel
+// path: /apps/{app}/versions/channels/{channel}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appVersionChannelSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	appName := r.URL.Query().Get(":app")
+	channel := r.URL.Query().Get(":channel")
+	versionStr := InputValue(r, "version")
+	if versionStr == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "you must provide the version"}
+	}
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateVersionChannelSet,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateVersionChannelSet,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	// the version may be referenced by number, image or by another channel,
+	// which allows promoting a version from a channel to another.
+	version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, &a, versionStr)
+	if err != nil {
+		if appTypes.IsInvalidVersionError(err) || err == appTypes.ErrNoVersionsAvailable {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	err = servicemanager.AppVersion.SetVersionChannel(ctx, &a, channel, version.Version())
+	if err == appTypes.ErrInvalidVersionChannel || err == appTypes.ErrVersionMarkedToRemoval {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: unset app version channel
+// path: /apps/{app}/versions/channels/{channel}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or channel not found
+func appVersionChannelUnset(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	appName := r.URL.Query().Get(":app")
+	channel := r.URL.Query().Get(":channel")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateVersionChannelUnset,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateVersionChannelUnset,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = servicemanager.AppVersion.UnsetVersionChannel(ctx, &a, channel)
+	if err == appTypes.ErrVersionChannelNotFound || err == appTypes.ErrNoVersionsAvailable {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: appTypes.ErrVersionChannelNotFound.Error()}
+	}
+	return err
+}
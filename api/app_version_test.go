@@ -0,0 +1,152 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestAppVersionChannelSet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	newSuccessfulAppVersion(c, &a)
+	v := url.Values{}
+	v.Set("version", "1")
+	request, err := http.NewRequest("PUT", "/apps/myapp/versions/channels/stable", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	versions, err := servicemanager.AppVersion.AppVersions(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Channels, check.DeepEquals, map[string]int{"stable": 1})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.version-channel.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": ":channel", "value": "stable"},
+			{"name": "version", "value": "1"},
+		},
+	}, eventtest.HasEvent)
+
+	v.Set("version", "stable")
+	request, err = http.NewRequest("PUT", "/apps/myapp/versions/channels/approved-by-qa", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	versions, err = servicemanager.AppVersion.AppVersions(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Channels, check.DeepEquals, map[string]int{"stable": 1, "approved-by-qa": 1})
+}
+
+func (s *S) TestAppVersionChannelSetInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	tests := []struct {
+		channel string
+		version string
+	}{
+		{channel: "stable", version: ""},
+		{channel: "stable", version: "9"},
+		{channel: "Stable", version: "1"},
+	}
+	for _, tt := range tests {
+		v := url.Values{}
+		v.Set("version", tt.version)
+		request, err := http.NewRequest("PUT", "/apps/myapp/versions/channels/"+tt.channel, strings.NewReader(v.Encode()))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "b "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("%#v", tt))
+	}
+}
+
+func (s *S) TestAppVersionChannelSetForbidden(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateVersionChannelSet,
+		Context: permission.Context(permTypes.CtxApp, "other-app"),
+	})
+	request, err := http.NewRequest("PUT", "/apps/myapp/versions/channels/stable", strings.NewReader("version=1"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppVersionChannelUnset(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	err = servicemanager.AppVersion.SetVersionChannel(context.TODO(), &a, "stable", 1)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/versions/channels/stable", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	versions, err := servicemanager.AppVersion.AppVersions(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Channels, check.DeepEquals, map[string]int{})
+
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAppVersionChannelList(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/versions/channels", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+
+	newSuccessfulAppVersion(c, &a)
+	err = servicemanager.AppVersion.SetVersionChannel(context.TODO(), &a, "candidate", 1)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var channels map[string]int
+	err = json.Unmarshal(recorder.Body.Bytes(), &channels)
+	c.Assert(err, check.IsNil)
+	c.Assert(channels, check.DeepEquals, map[string]int{"candidate": 1})
+}
@@ -237,6 +237,51 @@ func clusterInfo(w http.ResponseWriter, r *http.Request, t auth.Token) (err erro
 	return json.NewEncoder(w).Encode(cluster)
 }
 
+// title: provisioner cluster capacity
+// path: /provisioner/clusters/{name}/capacity
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Provisioner doesn't report capacity
+//   401: Unauthorized
+//   404: Cluster not found
+func clusterCapacity(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	allowed := permission.Check(t, permission.PermClusterRead)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	name := r.URL.Query().Get(":name")
+	cluster, err := servicemanager.Cluster.FindByName(ctx, name)
+	if err != nil {
+		if err == provTypes.ErrClusterNotFound {
+			return &tsuruErrors.HTTP{
+				Code:    http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+	prov, err := provision.Get(cluster.Provisioner)
+	if err != nil {
+		return err
+	}
+	capacityProv, ok := prov.(provision.CapacityProvisioner)
+	if !ok {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: provision.ProvisionerNotSupported{Prov: prov, Action: "cluster capacity"}.Error(),
+		}
+	}
+	capacity, err := capacityProv.ClusterCapacity(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(capacity)
+}
+
 // title: delete provisioner cluster
 // path: /provisioner/clusters/{name}
 // method: DELETE
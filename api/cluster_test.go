@@ -254,6 +254,31 @@ func (s *S) TestClusterInfoNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound, check.Commentf("body: %q", recorder.Body.String()))
 }
 
+func (s *S) TestClusterCapacityNotFound(c *check.C) {
+	s.mockService.Cluster.OnFindByName = func(name string) (*provision.Cluster, error) {
+		return nil, provision.ErrClusterNotFound
+	}
+	request, err := http.NewRequest(http.MethodGet, "/1.13/provisioner/clusters/c1/capacity", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound, check.Commentf("body: %q", recorder.Body.String()))
+}
+
+func (s *S) TestClusterCapacityNotSupported(c *check.C) {
+	s.mockService.Cluster.OnFindByName = func(name string) (*provision.Cluster, error) {
+		return &provision.Cluster{Name: "c1", Provisioner: "fake", Default: true}, nil
+	}
+	request, err := http.NewRequest(http.MethodGet, "/1.13/provisioner/clusters/c1/capacity", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("body: %q", recorder.Body.String()))
+	c.Assert(recorder.Body.String(), check.Equals, "provisioner \"fake\" does not support cluster capacity\n")
+}
+
 func (s *S) TestDeleteClusterNotFound(c *check.C) {
 	s.mockService.Cluster.OnDelete = func(_ provision.Cluster) error {
 		return provision.ErrClusterNotFound
@@ -0,0 +1,201 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/cost"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+)
+
+// title: cost price list
+// path: /costs/prices
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func listCostPrices(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermCostPriceRead) {
+		return permission.ErrUnauthorized
+	}
+	prices, err := servicemanager.CostPrice.List(r.Context())
+	if err != nil {
+		return err
+	}
+	if len(prices) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(prices)
+}
+
+// title: cost price set
+// path: /costs/prices
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func setCostPrice(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermCostPriceUpdate) {
+		return permission.ErrUnauthorized
+	}
+	var price costTypes.Price
+	err = ParseInput(r, &price)
+	if err != nil {
+		return err
+	}
+	if err = price.Validate(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeGlobal},
+		Kind:       permission.PermCostPriceUpdate,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermCostPriceRead),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return servicemanager.CostPrice.Set(r.Context(), price)
+}
+
+// title: cost price remove
+// path: /costs/prices
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Price not found
+func removeCostPrice(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermCostPriceUpdate) {
+		return permission.ErrUnauthorized
+	}
+	query := r.URL.Query()
+	price := costTypes.Price{
+		Kind:    query.Get("kind"),
+		Pool:    query.Get("pool"),
+		Service: query.Get("service"),
+		Plan:    query.Get("plan"),
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeGlobal},
+		Kind:       permission.PermCostPriceUpdate,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermCostPriceRead),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = servicemanager.CostPrice.Remove(r.Context(), price)
+	if err == costTypes.ErrPriceNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: team cost report
+// path: /teams/{name}/costs
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   400: Invalid month or month no longer available
+//   401: Unauthorized
+//   404: Team not found
+func teamCostReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teamName := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamReadCosts, permission.Context(permTypes.CtxTeam, teamName))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	month, err := cost.ParseMonth(r.URL.Query().Get("month"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	_, err = servicemanager.Team.FindByName(r.Context(), teamName)
+	if err == authTypes.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	report, err := cost.TeamReport(r.Context(), teamName, month)
+	if _, ok := err.(*cost.MonthUnavailableError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	return writeCostReport(w, r, teamName, report)
+}
+
+// title: app cost report
+// path: /apps/{app}/costs
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   400: Invalid month or month no longer available
+//   401: Unauthorized
+//   404: App not found
+func appCostReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadCosts,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	month, err := cost.ParseMonth(r.URL.Query().Get("month"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	report, err := cost.AppReport(r.Context(), &a, month)
+	if _, ok := err.(*cost.MonthUnavailableError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	return writeCostReport(w, r, a.Name, report)
+}
+
+// writeCostReport encodes the report as JSON or, when requested by the format
+// query parameter or the Accept header, as CSV.
+func writeCostReport(w http.ResponseWriter, r *http.Request, name string, report *costTypes.Report) error {
+	format := r.URL.Query().Get("format")
+	if format == "csv" || (format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv")) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-costs-%s.csv", name, report.Start.Format("2006-01"))))
+		return cost.WriteCSV(w, report)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestSetCostPrice(c *check.C) {
+	body := strings.NewReader("kind=unit&pool=pool1&plan=small&hourly=0.01&cpuHourly=0.04&memoryHourly=0.005")
+	request, err := http.NewRequest(http.MethodPut, "/1.13/costs/prices", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %q", recorder.Body.String()))
+	request, err = http.NewRequest(http.MethodGet, "/1.13/costs/prices", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var prices costTypes.Prices
+	err = json.Unmarshal(recorder.Body.Bytes(), &prices)
+	c.Assert(err, check.IsNil)
+	c.Assert(prices, check.DeepEquals, costTypes.Prices{
+		{Kind: costTypes.KindUnit, Pool: "pool1", Plan: "small", Hourly: 0.01, CPUHourly: 0.04, MemoryHourly: 0.005},
+	})
+}
+
+func (s *S) TestSetCostPriceInvalid(c *check.C) {
+	body := strings.NewReader("kind=volume&cpuHourly=1")
+	request, err := http.NewRequest(http.MethodPut, "/1.13/costs/prices", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, costTypes.ErrInvalidPrice.Error()+"\n")
+}
+
+func (s *S) TestRemoveCostPrice(c *check.C) {
+	err := servicemanager.CostPrice.Set(context.TODO(), costTypes.Price{Kind: costTypes.KindServiceInstance, Service: "mysql", Hourly: 1})
+	c.Assert(err, check.IsNil)
+	for _, code := range []int{http.StatusOK, http.StatusNotFound} {
+		request, err := http.NewRequest(http.MethodDelete, "/1.13/costs/prices?kind=service-instance&service=mysql", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, code)
+	}
+}
+
+func (s *S) TestAppCostReportCSV(c *check.C) {
+	err := servicemanager.CostPrice.Set(context.TODO(), costTypes.Price{Kind: costTypes.KindUnit, Hourly: 0.5})
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	s.provisioner.AddUnits(context.TODO(), &a, 2, "web", nil, nil)
+	request, err := http.NewRequest(http.MethodGet, "/1.13/apps/myappx/costs", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Accept", "text/csv")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %q", recorder.Body.String()))
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/csv")
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(records, check.HasLen, 3)
+	c.Assert(records[1][:4], check.DeepEquals, []string{"unit", "myappx", s.team.Name, "web"})
+	c.Assert(records[1][7], check.Equals, "2")
+	c.Assert(records[1][9], check.Equals, "0.5000")
+	c.Assert(records[2][0], check.Equals, "total")
+}
+
+func (s *S) TestTeamCostReport(c *check.C) {
+	month := time.Now().UTC().Format("2006-01")
+	request, err := http.NewRequest(http.MethodGet, "/1.13/teams/"+s.team.Name+"/costs?month="+month, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %q", recorder.Body.String()))
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report costTypes.Report
+	err = json.Unmarshal(recorder.Body.Bytes(), &report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Team, check.Equals, s.team.Name)
+	c.Assert(report.Start.Format("2006-01"), check.Equals, month)
+	c.Assert(report.Items, check.HasLen, 0)
+}
+
+func (s *S) TestTeamCostReportMonthUnavailable(c *check.C) {
+	request, err := http.NewRequest(http.MethodGet, "/1.13/teams/"+s.team.Name+"/costs?month=2020-01", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, "no report for 2020-01, unit events are only kept for reports from .* on\n")
+}
+
+func (s *S) TestTeamCostReportInvalidMonth(c *check.C) {
+	request, err := http.NewRequest(http.MethodGet, "/1.13/teams/"+s.team.Name+"/costs?month=january", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestTeamCostReportWhenUserDoesNotHaveAccess(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamReadCosts,
+		Context: permission.Context(permTypes.CtxTeam, "other-team"),
+	})
+	request, err := http.NewRequest(http.MethodGet, "/1.13/teams/"+s.team.Name+"/costs", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
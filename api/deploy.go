@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tsuru/tsuru/app"
@@ -17,6 +18,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
+	appTypes "github.com/tsuru/tsuru/types/app"
 )
 
 const eventIDHeader = "X-Tsuru-Eventid"
@@ -32,9 +34,28 @@ const eventIDHeader = "X-Tsuru-Eventid"
 //   404: Not found
 func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	ctx := r.Context()
-	opts, err := prepareToBuild(r)
-	if err != nil {
-		return err
+	var opts app.DeployOptions
+	dryRun, _ := strconv.ParseBool(InputValue(r, "dry-run"))
+	if version := InputValue(r, "version"); version != "" {
+		// deploying an existing version, either by number or by channel
+		// name, is the same as rolling back to it.
+		opts.Image = version
+		opts.Rollback = true
+	} else if dryRun {
+		// nothing is built in a dry-run, the latest successful version of
+		// the app is deployed instead.
+		if InputValue(r, "image") != "" || InputValue(r, "archive-url") != "" || strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			return &tsuruErrors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "dry-run is only supported when deploying versions already built",
+			}
+		}
+		opts.Rollback = true
+	} else {
+		opts, err = prepareToBuild(r)
+		if err != nil {
+			return err
+		}
 	}
 	if opts.File != nil {
 		defer opts.File.Close()
@@ -43,7 +64,9 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	w.Header().Set("Content-Type", "text")
 	appName := r.URL.Query().Get(":appname")
 	origin := InputValue(r, "origin")
-	if opts.Image != "" {
+	if opts.Rollback {
+		origin = "rollback"
+	} else if opts.Image != "" {
 		origin = "image"
 	}
 	if origin != "" {
@@ -86,6 +109,9 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: "User does not have permission to do this action in this app"}
 		}
 	}
+	if dryRun {
+		return deployDryRun(w, r, opts)
+	}
 	var imageID string
 	evt, err := event.New(&event.Opts{
 		Target:        appTarget(appName),
@@ -116,6 +142,18 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	return err
 }
 
+func deployDryRun(w http.ResponseWriter, r *http.Request, opts app.DeployOptions) error {
+	changes, err := app.DryRunDeploy(r.Context(), opts)
+	if err != nil {
+		if err == appTypes.ErrNoVersionsAvailable || appTypes.IsInvalidVersionError(err) {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(changes)
+}
+
 func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 	switch opts.GetKind() {
 	case app.DeployGit:
@@ -130,6 +168,8 @@ func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 		return permission.PermAppDeployArchiveUrl
 	case app.DeployRollback:
 		return permission.PermAppDeployRollback
+	case app.DeployPromote:
+		return permission.PermAppDeployPromote
 	default:
 		return permission.PermAppDeploy
 	}
@@ -223,6 +263,84 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return nil
 }
 
+// title: promote
+// path: /apps/{app}/deploy/promote
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   400: Invalid data
+//   403: Forbidden
+//   404: Not found
+func deployPromote(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	ctx := r.Context()
+	appName := r.URL.Query().Get(":app")
+	instance, err := app.GetByName(ctx, appName)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	sourceAppName := InputValue(r, "source-app")
+	sourceVersion := InputValue(r, "source-version")
+	if sourceAppName == "" || sourceVersion == "" {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "you must specify both the source-app and the source-version",
+		}
+	}
+	sourceApp, err := app.GetByName(ctx, sourceAppName)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", sourceAppName)}
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	opts := app.DeployOptions{
+		App:           instance,
+		OutputStream:  writer,
+		User:          t.GetUserName(),
+		Origin:        "promote",
+		Message:       InputValue(r, "message"),
+		SourceApp:     sourceApp.Name,
+		SourceVersion: sourceVersion,
+	}
+	opts.NewVersion, _ = strconv.ParseBool(InputValue(r, "new-version"))
+	opts.OverrideVersions, _ = strconv.ParseBool(InputValue(r, "override-versions"))
+	opts.GetKind()
+	canPromote := permission.Check(t, permSchemeForDeploy(opts), contextsForApp(instance)...)
+	if !canPromote {
+		return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+	}
+	canReadSource := permission.Check(t, permission.PermAppReadDeploy, contextsForApp(sourceApp)...)
+	if !canReadSource {
+		return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+	}
+	var imageID string
+	evt, err := event.New(&event.Opts{
+		Target:        appTarget(appName),
+		ExtraTargets:  []event.ExtraTarget{{Target: appTarget(sourceApp.Name)}},
+		Kind:          permission.PermAppDeploy,
+		Owner:         t,
+		RemoteAddr:    r.RemoteAddr,
+		CustomData:    opts,
+		Allowed:       event.Allowed(permission.PermAppReadEvents, contextsForApp(instance)...),
+		AllowedCancel: event.Allowed(permission.PermAppUpdateEvents, contextsForApp(instance)...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	ctx, cancel := evt.CancelableContext(opts.App.Context())
+	defer cancel()
+	opts.App.ReplaceContext(ctx)
+	w.Header().Set(eventIDHeader, evt.UniqueID.Hex())
+	opts.Event = evt
+	imageID, err = app.Deploy(ctx, opts)
+	return err
+}
+
 // title: deploy list
 // path: /deploys
 // method: GET
@@ -311,6 +311,155 @@ func (s *DeploySuite) TestDeployOriginImage(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *DeploySuite) TestDeployVersionChannel(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	newSuccessfulAppVersion(c, &a)
+	err = servicemanager.AppVersion.SetVersionChannel(context.TODO(), &a, "stable", 1)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("version=stable"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, ".*Builder deploy called\nOK\n")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":   a.Name,
+			"commit":     "",
+			"filesize":   0,
+			"kind":       "rollback",
+			"archiveurl": "",
+			"user":       s.token.GetUserName(),
+			"image":      "stable",
+			"origin":     "rollback",
+			"build":      false,
+			"rollback":   true,
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "tsuru/app-" + a.Name + ":v1",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployDryRun(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		Processes: map[string][]string{"web": {"python web.py"}},
+	})
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("dry-run=true"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var changes []provision.ManifestChange
+	err = json.Unmarshal(recorder.Body.Bytes(), &changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []provision.ManifestChange{
+		{Kind: "Deployment", Name: "otherapp-web", Operation: provision.ManifestUpdate},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Kind:   "app.deploy",
+	}, check.Not(eventtest.HasEvent))
+}
+
+func (s *DeploySuite) TestDeployDryRunWithImage(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("dry-run=true&image=tsuru/myimage"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "dry-run is only supported when deploying versions already built\n")
+}
+
+func (s *DeploySuite) TestDeployPromoteHandler(c *check.C) {
+	var buildOpts *builder.BuildOpts
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
+		buildOpts = opts
+		version := newAppVersion(c, app)
+		return version, version.CommitBaseImage()
+	}
+	source := app.App{Name: "otherapp-staging", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &source, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &source)
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err = app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("source-app", source.Name)
+	v.Set("source-version", "1")
+	u := fmt.Sprintf("/apps/%s/deploy/promote", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, "(?s).*Builder deploy called.*")
+	c.Assert(buildOpts.ImageID, check.Equals, "tsuru/app-otherapp-staging:v1")
+	c.Assert(buildOpts.Provenance, check.DeepEquals, &appTypes.AppVersionProvenance{App: source.Name, Version: 1})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":      a.Name,
+			"kind":          "promote",
+			"origin":        "promote",
+			"sourceapp":     source.Name,
+			"sourceversion": "1",
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "tsuru/app-otherapp:v1",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployPromoteHandlerMissingSource(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/promote", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader("source-app=otherapp-staging"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
 func (s *DeploySuite) TestDeployArchiveURL(c *check.C) {
 	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
 		return newAppVersion(c, app), nil
@@ -0,0 +1,206 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const (
+	defaultUnitFileCopyMaxSize = 100 * 1024 * 1024
+
+	// unitFileCopyErrorTrailer reports errors of downloads failing after
+	// part of the tar stream was already sent.
+	unitFileCopyErrorTrailer = "X-Tsuru-Error"
+)
+
+func unitFileCopyMaxSize() int64 {
+	size, err := config.GetInt("server:unit-file-copy-max-size")
+	if err != nil || size <= 0 {
+		return defaultUnitFileCopyMaxSize
+	}
+	return int64(size)
+}
+
+type errFileCopyTooLarge struct {
+	maxSize int64
+}
+
+func (e *errFileCopyTooLarge) Error() string {
+	return fmt.Sprintf("files exceed the maximum size of %d bytes", e.maxSize)
+}
+
+// limitedFileCopyReader fails with errFileCopyTooLarge when more than
+// maxSize bytes are read.
+type limitedFileCopyReader struct {
+	r       io.Reader
+	read    int64
+	maxSize int64
+}
+
+func (l *limitedFileCopyReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.maxSize {
+		return 0, &errFileCopyTooLarge{maxSize: l.maxSize}
+	}
+	return n, err
+}
+
+// limitedFileCopyWriter fails with errFileCopyTooLarge when more than
+// maxSize bytes are written.
+type limitedFileCopyWriter struct {
+	w       io.Writer
+	written int64
+	maxSize int64
+}
+
+func (l *limitedFileCopyWriter) Write(p []byte) (int, error) {
+	if l.written+int64(len(p)) > l.maxSize {
+		return 0, &errFileCopyTooLarge{maxSize: l.maxSize}
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+func unitFileCopyOptions(r *http.Request) (provision.UnitFileCopyOptions, error) {
+	opts := provision.UnitFileCopyOptions{
+		Unit: r.URL.Query().Get(":unit"),
+		Path: r.URL.Query().Get("path"),
+	}
+	if opts.Path == "" {
+		return opts, &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "path is required",
+		}
+	}
+	return opts, nil
+}
+
+func fileCopyError(err error) error {
+	switch err.(type) {
+	case *provision.UnitNotFoundError:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case *errFileCopyTooLarge:
+		return &errors.HTTP{Code: http.StatusRequestEntityTooLarge, Message: err.Error()}
+	}
+	return err
+}
+
+// title: upload files to unit
+// path: /apps/{app}/units/{unit}/files
+// method: PUT
+// consume: application/x-tar
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or unit not found
+//   413: Files too large
+func uploadToUnit(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	opts, err := unitFileCopyOptions(r)
+	if err != nil {
+		return err
+	}
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRunFileUpload, contextsForApp(&a)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	maxSize := unitFileCopyMaxSize()
+	if r.ContentLength > maxSize {
+		return fileCopyError(&errFileCopyTooLarge{maxSize: maxSize})
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppRunFileUpload,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: []map[string]interface{}{
+			{"unit": opts.Unit, "path": opts.Path},
+		},
+		Allowed:     event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		DisableLock: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	body := &limitedFileCopyReader{r: r.Body, maxSize: maxSize}
+	err = a.UploadToUnit(opts, body)
+	if err != nil {
+		return fileCopyError(err)
+	}
+	fmt.Fprintf(evt, "%d bytes uploaded to %s in unit %s\n", body.read, opts.Path, opts.Unit)
+	return nil
+}
+
+// title: download files from unit
+// path: /apps/{app}/units/{unit}/files
+// method: GET
+// produce: application/x-tar
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or unit not found
+//   413: Files too large
+func downloadFromUnit(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	opts, err := unitFileCopyOptions(r)
+	if err != nil {
+		return err
+	}
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRunFileDownload, contextsForApp(&a)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppRunFileDownload,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: []map[string]interface{}{
+			{"unit": opts.Unit, "path": opts.Path},
+		},
+		Allowed:     event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		DisableLock: true,
+	})
+	if err != nil {
+		return err
+	}
+	var copyErr error
+	defer func() { evt.Done(copyErr) }()
+	w.Header().Set("Content-Type", "application/x-tar")
+	output := &limitedFileCopyWriter{w: w, maxSize: unitFileCopyMaxSize()}
+	copyErr = a.DownloadFromUnit(opts, output)
+	if copyErr == nil {
+		fmt.Fprintf(evt, "%d bytes downloaded from %s in unit %s\n", output.written, opts.Path, opts.Unit)
+		return nil
+	}
+	if output.written == 0 {
+		return fileCopyError(copyErr)
+	}
+	// Once data is written the response status can't be changed anymore,
+	// the client learns about the truncated tar stream from the trailer.
+	w.Header().Set(http.TrailerPrefix+unitFileCopyErrorTrailer, copyErr.Error())
+	return nil
+}
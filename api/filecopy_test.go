@@ -0,0 +1,166 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) createAppForFileCopy(c *check.C) (*app.App, provision.Unit) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	return &a, units[0]
+}
+
+func (s *S) TestUploadToUnit(c *check.C) {
+	a, unit := s.createAppForFileCopy(c)
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp", a.Name, unit.ID)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-tar")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	var buf strings.Builder
+	err = s.provisioner.DownloadFromUnit(context.TODO(), a, provision.UnitFileCopyOptions{Unit: unit.ID, Path: "/tmp"}, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "tar data")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.run.file-upload",
+		StartCustomData: []map[string]interface{}{
+			{"unit": unit.ID, "path": "/tmp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUploadToUnitTooLarge(c *check.C) {
+	config.Set("server:unit-file-copy-max-size", 4)
+	defer config.Unset("server:unit-file-copy-max-size")
+	a, unit := s.createAppForFileCopy(c)
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp", a.Name, unit.ID)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-tar")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(recorder.Body.String(), check.Equals, "files exceed the maximum size of 4 bytes\n")
+}
+
+func (s *S) TestUploadToUnitWithoutPath(c *check.C) {
+	a, unit := s.createAppForFileCopy(c)
+	url := fmt.Sprintf("/apps/%s/units/%s/files", a.Name, unit.ID)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-tar")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "path is required\n")
+}
+
+func (s *S) TestUploadToUnitWhenUserDoesNotHaveAccess(c *check.C) {
+	a, unit := s.createAppForFileCopy(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRunFileDownload,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp", a.Name, unit.ID)
+	request, err := http.NewRequest("PUT", url, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-tar")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDownloadFromUnit(c *check.C) {
+	a, unit := s.createAppForFileCopy(c)
+	opts := provision.UnitFileCopyOptions{Unit: unit.ID, Path: "/tmp/heap.hprof"}
+	err := s.provisioner.UploadToUnit(context.TODO(), a, opts, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp/heap.hprof", a.Name, unit.ID)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-tar")
+	c.Assert(recorder.Body.String(), check.Equals, "tar data")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.run.file-download",
+		StartCustomData: []map[string]interface{}{
+			{"unit": unit.ID, "path": "/tmp/heap.hprof"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestDownloadFromUnitTooLarge(c *check.C) {
+	config.Set("server:unit-file-copy-max-size", 4)
+	defer config.Unset("server:unit-file-copy-max-size")
+	a, unit := s.createAppForFileCopy(c)
+	opts := provision.UnitFileCopyOptions{Unit: unit.ID, Path: "/tmp/heap.hprof"}
+	err := s.provisioner.UploadToUnit(context.TODO(), a, opts, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp/heap.hprof", a.Name, unit.ID)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusRequestEntityTooLarge)
+}
+
+func (s *S) TestDownloadFromUnitNotFound(c *check.C) {
+	a, _ := s.createAppForFileCopy(c)
+	url := fmt.Sprintf("/apps/%s/units/myunit/files?path=/tmp", a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestDownloadFromUnitWhenUserDoesNotHaveAccess(c *check.C) {
+	a, unit := s.createAppForFileCopy(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRunFileUpload,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/units/%s/files?path=/tmp", a.Name, unit.ID)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
@@ -0,0 +1,241 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/git/webhook"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+const maxGitWebhookBodySize = 5 * 1024 * 1024
+
+type gitDeployResult struct {
+	App     string `json:"app"`
+	EventID string `json:"eventId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// title: set app git deploy
+// path: /apps/{app}/git-deploy
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func gitDeploySet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateGitDeploySet,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	gitDeploy := appTypes.GitDeploy{
+		Repository: InputValue(r, "repository"),
+		Branch:     InputValue(r, "branch"),
+		Secret:     InputValue(r, "secret"),
+	}
+	if gitDeploy.Repository == "" || gitDeploy.Branch == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "you must provide the repository and the branch"}
+	}
+	if gitDeploy.Secret == "" {
+		gitDeploy.Secret, err = generateGitDeploySecret()
+		if err != nil {
+			return err
+		}
+	}
+	// the secret must never be stored in the event
+	fields := InputFields(r, "secret")
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateGitDeploySet,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(fields),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.SetGitDeploy(gitDeploy)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{
+		"repository": gitDeploy.Repository,
+		"branch":     gitDeploy.Branch,
+		"secret":     gitDeploy.Secret,
+	})
+}
+
+// title: unset app git deploy
+// path: /apps/{app}/git-deploy
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App not found
+func gitDeployUnset(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateGitDeployUnset,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateGitDeployUnset,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetGitDeploy(appTypes.GitDeploy{})
+}
+
+// title: git webhook
+// path: /git/webhook
+// method: POST
+// consume: application/json
+// produce: application/json
+// responses:
+//   200: Ignored event
+//   202: Deploys started
+//   400: Invalid data
+//   401: Invalid signature
+func gitWebhook(w http.ResponseWriter, r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGitWebhookBodySize))
+	if err != nil {
+		return err
+	}
+	push, err := webhook.Parse(r.Header, body)
+	if err == webhook.ErrNotPushEvent {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if push.IsDeletion() {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	apps, err := app.ListByGitDeploy(r.Context(), push.Repository, push.Branch)
+	if err != nil {
+		return err
+	}
+	// Pushes to repositories without any configured app are answered just
+	// like an invalid signature, so the configured repositories and branches
+	// can't be discovered through this unauthenticated endpoint.
+	var results []gitDeployResult
+	for i := range apps {
+		if webhook.Verify(push.Provider, r.Header, body, apps[i].GitDeploy.Secret) != nil {
+			continue
+		}
+		result := gitDeployResult{App: apps[i].Name}
+		evtID, deployErr := startGitDeploy(&apps[i], push, r.RemoteAddr)
+		if deployErr != nil {
+			result.Error = deployErr.Error()
+		} else {
+			result.EventID = evtID
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return &errors.HTTP{Code: http.StatusUnauthorized, Message: webhook.ErrInvalidSignature.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(results)
+}
+
+// startGitDeploy creates the deploy event for the pushed commit and runs the
+// deploy in background, as git providers don't wait for long requests. The
+// commit author comes from the unverified payload, so it's only recorded in
+// the deploy data, the event is owned by the app whose git deploy secret
+// signed the request.
+func startGitDeploy(a *app.App, push *webhook.Push, remoteAddr string) (string, error) {
+	author := push.AuthorEmail
+	if author == "" {
+		author = push.Author
+	}
+	opts := app.DeployOptions{
+		App:          a,
+		Commit:       push.Commit,
+		Message:      push.Message,
+		User:         author,
+		Origin:       "git",
+		ArchiveURL:   push.ArchiveURL,
+		OutputStream: io.Discard,
+	}
+	opts.GetKind()
+	evt, err := event.New(&event.Opts{
+		Target:        appTarget(a.Name),
+		Kind:          permission.PermAppDeploy,
+		RawOwner:      event.Owner{Type: event.OwnerTypeApp, Name: a.Name},
+		RemoteAddr:    remoteAddr,
+		CustomData:    opts,
+		Allowed:       event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+		AllowedCancel: event.Allowed(permission.PermAppUpdateEvents, contextsForApp(a)...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+	opts.Event = evt
+	go func() {
+		var imageID string
+		var err error
+		defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+		ctx, cancel := evt.CancelableContext(context.Background())
+		defer cancel()
+		a.ReplaceContext(ctx)
+		imageID, err = app.Deploy(ctx, opts)
+		if err != nil {
+			log.Errorf("[git-webhook] unable to deploy app %q from commit %s: %v", a.Name, push.Commit, err)
+		}
+	}()
+	return evt.UniqueID.Hex(), nil
+}
+
+func generateGitDeploySecret() (string, error) {
+	var secret [24]byte
+	_, err := rand.Read(secret[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret[:]), nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/builder"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/git/webhook"
+	"github.com/tsuru/tsuru/provision"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	check "gopkg.in/check.v1"
+)
+
+const gitWebhookPushBody = `{
+	"ref": "refs/heads/main",
+	"after": "9f2c1e4b5a",
+	"repository": {"full_name": "tsuru/myapp", "html_url": "https://github.com/tsuru/myapp"},
+	"head_commit": {"id": "9f2c1e4b5a", "message": "fix everything", "author": {"name": "Jane Doe", "email": "jane@example.com"}}
+}`
+
+func newGitWebhookRequest(c *check.C, body, secret string) *http.Request {
+	request, err := http.NewRequest("POST", "/git/webhook", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "push")
+	request.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(webhook.Sign([]byte(body), secret)))
+	return request
+}
+
+func (s *S) TestGitDeploySet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("repository", "tsuru/myapp")
+	v.Set("branch", "main")
+	request, err := http.NewRequest("PUT", "/apps/myapp/git-deploy", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string]string
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["secret"], check.HasLen, 48)
+	dbApp, err := app.GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GitDeploy, check.DeepEquals, appTypes.GitDeploy{
+		Repository: "tsuru/myapp",
+		Branch:     "main",
+		Secret:     result["secret"],
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.git-deploy.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "repository", "value": "tsuru/myapp"},
+			{"name": "branch", "value": "main"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestGitDeploySetMissingBranch(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("PUT", "/apps/myapp/git-deploy", strings.NewReader("repository=tsuru/myapp"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "you must provide the repository and the branch\n")
+}
+
+func (s *S) TestGitDeployUnset(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/myapp", Branch: "main", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/git-deploy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GitDeploy, check.DeepEquals, appTypes.GitDeploy{})
+}
+
+func (s *S) TestGitWebhookIgnoresOtherEvents(c *check.C) {
+	request, err := http.NewRequest("POST", "/git/webhook", strings.NewReader(`{"zen": "hi"}`))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "ping")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *S) TestGitWebhookNoAppConfigured(c *check.C) {
+	request := newGitWebhookRequest(c, gitWebhookPushBody, "abc")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
+func (s *S) TestGitWebhookInvalidSignature(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/myapp", Branch: "main", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	request := newGitWebhookRequest(c, gitWebhookPushBody, "other")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid webhook signature\n")
+}
+
+func (s *DeploySuite) TestGitWebhookDeploy(c *check.C) {
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
+		c.Assert(opts.ArchiveURL, check.Equals, "https://github.com/tsuru/myapp/archive/9f2c1e4b5a.tar.gz")
+		return newAppVersion(c, app), nil
+	}
+	a := app.App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/myapp", Branch: "main", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	request := newGitWebhookRequest(c, gitWebhookPushBody, "abc")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	var results []gitDeployResult
+	err = json.Unmarshal(recorder.Body.Bytes(), &results)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+	c.Assert(results[0].App, check.Equals, a.Name)
+	c.Assert(results[0].Error, check.Equals, "")
+	timeout := time.After(5 * time.Second)
+	for {
+		evt, err := event.GetByID(bson.ObjectIdHex(results[0].EventID))
+		c.Assert(err, check.IsNil)
+		if !evt.Running {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for deploy to finish")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  a.Name,
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":   a.Name,
+			"commit":     "9f2c1e4b5a",
+			"kind":       "archive-url",
+			"archiveurl": "https://github.com/tsuru/myapp/archive/9f2c1e4b5a.tar.gz",
+			"user":       "jane@example.com",
+			"origin":     "git",
+			"message":    "fix everything",
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "tsuru/app-" + a.Name + ":v1",
+		},
+	}, eventtest.HasEvent)
+}
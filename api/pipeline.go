@@ -0,0 +1,386 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+)
+
+func pipelineTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypePipeline, Value: name}
+}
+
+func getPipeline(ctx context.Context, name string) (*appTypes.Pipeline, error) {
+	pipeline, err := servicemanager.Pipeline.Get(ctx, name)
+	if err == appTypes.ErrPipelineNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return pipeline, err
+}
+
+// checkPipelineStages ensures the token is allowed to promote versions into
+// every stage of the pipeline, as the pipeline permissions are used when
+// promoting.
+func checkPipelineStages(ctx context.Context, t auth.Token, pipeline appTypes.Pipeline) error {
+	for i, stage := range pipeline.Stages {
+		a, err := app.GetByName(ctx, stage.App)
+		if err != nil {
+			if err == appTypes.ErrAppNotFound {
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+			}
+			return err
+		}
+		perm := permission.PermAppDeployPromote
+		if i == 0 {
+			perm = permission.PermAppReadDeploy
+		}
+		if !permission.Check(t, perm, contextsForApp(a)...) {
+			return permission.ErrUnauthorized
+		}
+	}
+	return nil
+}
+
+// title: pipeline list
+// path: /pipelines
+// method: GET
+// produce: application/json
+// responses:
+//   200: List pipelines
+//   204: No content
+func pipelineList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	ctxs := permission.ContextsForPermission(t, permission.PermPipelineRead, permTypes.CtxTeam)
+	if len(ctxs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	teams := []string{}
+	for _, c := range ctxs {
+		if c.CtxType == permTypes.CtxGlobal {
+			teams = nil
+			break
+		}
+		teams = append(teams, c.Value)
+	}
+	pipelines, err := servicemanager.Pipeline.List(r.Context(), teams)
+	if err != nil {
+		return err
+	}
+	if len(pipelines) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(pipelines)
+}
+
+// title: pipeline info
+// path: /pipelines/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: Get pipeline
+//   401: Unauthorized
+//   404: Not found
+func pipelineInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pipeline, err := getPipeline(r.Context(), r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	ctx := permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)
+	if !permission.Check(t, permission.PermPipelineRead, ctx) {
+		return permission.ErrUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(pipeline)
+}
+
+// title: pipeline create
+// path: /pipelines
+// method: POST
+// consume: application/json
+// responses:
+//   201: Pipeline created
+//   400: Invalid pipeline
+//   401: Unauthorized
+//   409: Pipeline already exists
+func pipelineCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	var pipeline appTypes.Pipeline
+	err = ParseInput(r, &pipeline)
+	if err != nil {
+		return err
+	}
+	if pipeline.TeamOwner == "" {
+		pipeline.TeamOwner, err = autoTeamOwner(ctx, t, permission.PermPipelineCreate)
+		if err != nil {
+			return err
+		}
+	}
+	permCtx := permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)
+	if !permission.Check(t, permission.PermPipelineCreate, permCtx) {
+		return permission.ErrUnauthorized
+	}
+	err = checkPipelineStages(ctx, t, pipeline)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     pipelineTarget(pipeline.Name),
+		Kind:       permission.PermPipelineCreate,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermPipelineReadEvents, permCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = servicemanager.Pipeline.Create(ctx, pipeline)
+	if err == appTypes.ErrPipelineAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: pipeline update
+// path: /pipelines/{name}
+// method: PUT
+// consume: application/json
+// responses:
+//   200: Pipeline updated
+//   400: Invalid pipeline
+//   401: Unauthorized
+//   404: Not found
+func pipelineUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	existing, err := getPipeline(ctx, r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	var pipeline appTypes.Pipeline
+	err = ParseInput(r, &pipeline)
+	if err != nil {
+		return err
+	}
+	pipeline.Name = existing.Name
+	permCtx := permission.Context(permTypes.CtxTeam, existing.TeamOwner)
+	if !permission.Check(t, permission.PermPipelineUpdate, permCtx) {
+		return permission.ErrUnauthorized
+	}
+	if pipeline.TeamOwner != "" && pipeline.TeamOwner != existing.TeamOwner {
+		if !permission.Check(t, permission.PermPipelineUpdate, permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)) {
+			return permission.ErrUnauthorized
+		}
+	}
+	err = checkPipelineStages(ctx, t, pipeline)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     pipelineTarget(pipeline.Name),
+		Kind:       permission.PermPipelineUpdate,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermPipelineReadEvents, permCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return servicemanager.Pipeline.Update(ctx, pipeline)
+}
+
+// title: pipeline delete
+// path: /pipelines/{name}
+// method: DELETE
+// responses:
+//   200: Pipeline deleted
+//   401: Unauthorized
+//   404: Not found
+func pipelineDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	pipeline, err := getPipeline(ctx, r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	permCtx := permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)
+	if !permission.Check(t, permission.PermPipelineDelete, permCtx) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     pipelineTarget(pipeline.Name),
+		Kind:       permission.PermPipelineDelete,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermPipelineReadEvents, permCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return servicemanager.Pipeline.Remove(ctx, pipeline.Name)
+}
+
+// title: pipeline promote
+// path: /pipelines/{name}/promote
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   202: Promotion awaiting approval
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Not found
+func pipelinePromote(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	pipeline, err := getPipeline(ctx, r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	stageApp := InputValue(r, "stage")
+	if stageApp == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "you must provide the stage receiving the version"}
+	}
+	permCtx := permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)
+	if !permission.Check(t, permission.PermPipelinePromote, permCtx) {
+		return permission.ErrUnauthorized
+	}
+	transition, err := app.NewPipelineTransition(ctx, pipeline, stageApp, InputValue(r, "version"))
+	if err != nil {
+		if err == appTypes.ErrPipelineStageNotFound {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		if _, ok := err.(*errors.ValidationError); ok || appTypes.IsInvalidVersionError(err) {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	opts := transition.DeployOptions()
+	opts.User = t.GetUserName()
+	opts.Message = InputValue(r, "message")
+	if !permission.Check(t, permSchemeForDeploy(opts), contextsForApp(transition.To)...) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+	}
+	if !permission.Check(t, permission.PermAppReadDeploy, contextsForApp(transition.From)...) {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+	}
+	if transition.Stage.ManualApproval {
+		approval, approvalErr := servicemanager.Pipeline.RequestApproval(ctx, pipeline.Name, transition.To.Name, transition.Version, t.GetUserName())
+		if approvalErr != nil {
+			return approvalErr
+		}
+		if !approval.Approved() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			return json.NewEncoder(w).Encode(approval)
+		}
+		err = servicemanager.Pipeline.ConsumeApproval(ctx, pipeline.Name, transition.To.Name, transition.Version)
+		if err != nil {
+			return err
+		}
+		opts.ApprovedBy = approval.ApprovedBy
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	opts.OutputStream = &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	var imageID string
+	evt, err := event.New(&event.Opts{
+		Target: appTarget(transition.To.Name),
+		ExtraTargets: []event.ExtraTarget{
+			{Target: appTarget(transition.From.Name)},
+			{Target: pipelineTarget(pipeline.Name)},
+		},
+		Kind:          permission.PermAppDeploy,
+		Owner:         t,
+		RemoteAddr:    r.RemoteAddr,
+		CustomData:    opts,
+		Allowed:       event.Allowed(permission.PermAppReadEvents, contextsForApp(transition.To)...),
+		AllowedCancel: event.Allowed(permission.PermAppUpdateEvents, contextsForApp(transition.To)...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	ctx, cancel := evt.CancelableContext(opts.App.Context())
+	defer cancel()
+	opts.App.ReplaceContext(ctx)
+	w.Header().Set(eventIDHeader, evt.UniqueID.Hex())
+	opts.Event = evt
+	imageID, err = app.Deploy(ctx, opts)
+	return err
+}
+
+// title: pipeline approve
+// path: /pipelines/{name}/approve
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Promotion approved
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Not found
+func pipelineApprove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	ctx := r.Context()
+	pipeline, err := getPipeline(ctx, r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	stageApp := InputValue(r, "stage")
+	version, err := strconv.Atoi(InputValue(r, "version"))
+	if stageApp == "" || err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "you must provide the stage and the version being approved"}
+	}
+	permCtx := permission.Context(permTypes.CtxTeam, pipeline.TeamOwner)
+	if !permission.Check(t, permission.PermPipelineApprove, permCtx) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     pipelineTarget(pipeline.Name),
+		Kind:       permission.PermPipelineApprove,
+		Owner:      t,
+		RemoteAddr: r.RemoteAddr,
+		CustomData: event.FormToCustomData(InputFields(r)),
+		Allowed:    event.Allowed(permission.PermPipelineReadEvents, permCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = servicemanager.Pipeline.Approve(ctx, pipeline.Name, stageApp, version, t.GetUserName())
+	switch err {
+	case appTypes.ErrPipelineApprovalNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case appTypes.ErrPipelineSelfApproval:
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	}
+	return err
+}
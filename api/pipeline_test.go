@@ -0,0 +1,308 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/builder"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestPipelineCreate(c *check.C) {
+	for _, name := range []string{"myapp-dev", "myapp-prod"} {
+		a := app.App{Name: name, Platform: "zend", TeamOwner: s.team.Name}
+		err := app.CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+	}
+	body := `{"name": "myapp", "teamOwner": "` + s.team.Name + `", "stages": [{"app": "myapp-dev"}, {"app": "myapp-prod", "manualApproval": true}]}`
+	request, err := http.NewRequest("POST", "/pipelines", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	pipeline, err := servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(pipeline, check.DeepEquals, &appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages: []appTypes.PipelineStage{
+			{App: "myapp-dev"},
+			{App: "myapp-prod", ManualApproval: true},
+		},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: pipelineTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "pipeline.create",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestPipelineCreateWithoutPromotePermission(c *check.C) {
+	for _, name := range []string{"myapp-dev", "myapp-prod"} {
+		a := app.App{Name: name, Platform: "zend", TeamOwner: s.team.Name}
+		err := app.CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPipelineCreate,
+		Context: permission.Context(permTypes.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppReadDeploy,
+		Context: permission.Context(permTypes.CtxTeam, s.team.Name),
+	})
+	body := `{"name": "myapp", "teamOwner": "` + s.team.Name + `", "stages": [{"app": "myapp-dev"}, {"app": "myapp-prod"}]}`
+	request, err := http.NewRequest("POST", "/pipelines", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *S) TestPipelineListAndInfo(c *check.C) {
+	for _, name := range []string{"myapp-dev", "myapp-prod"} {
+		a := app.App{Name: name, Platform: "zend", TeamOwner: s.team.Name}
+		err := app.CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+	}
+	pipeline := appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages:    []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-prod"}},
+	}
+	err := servicemanager.Pipeline.Create(context.TODO(), pipeline)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/pipelines", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var pipelines []appTypes.Pipeline
+	err = json.Unmarshal(recorder.Body.Bytes(), &pipelines)
+	c.Assert(err, check.IsNil)
+	c.Assert(pipelines, check.DeepEquals, []appTypes.Pipeline{pipeline})
+	request, err = http.NewRequest("GET", "/pipelines/myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result appTypes.Pipeline
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, pipeline)
+	request, err = http.NewRequest("GET", "/pipelines/unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestPipelineDelete(c *check.C) {
+	for _, name := range []string{"myapp-dev", "myapp-prod"} {
+		a := app.App{Name: name, Platform: "zend", TeamOwner: s.team.Name}
+		err := app.CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+	}
+	err := servicemanager.Pipeline.Create(context.TODO(), appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages:    []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-prod"}},
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/pipelines/myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *DeploySuite) createPipeline(c *check.C, manualApproval bool) {
+	for _, name := range []string{"myapp-dev", "myapp-prod"} {
+		a := app.App{Name: name, Platform: "python", TeamOwner: s.team.Name}
+		err := app.CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+		if name == "myapp-dev" {
+			newSuccessfulAppVersion(c, &a)
+		}
+	}
+	s.mockService.Team.OnFindByName = func(name string) (*authTypes.Team, error) {
+		return &authTypes.Team{Name: name}, nil
+	}
+	err := servicemanager.Pipeline.Create(context.TODO(), appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages: []appTypes.PipelineStage{
+			{App: "myapp-dev"},
+			{App: "myapp-prod", ManualApproval: manualApproval},
+		},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *DeploySuite) newPipelinePromoteRequest(c *check.C, token string) *http.Request {
+	v := url.Values{}
+	v.Set("stage", "myapp-prod")
+	request, err := http.NewRequest("POST", "/pipelines/myapp/promote", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token)
+	return request
+}
+
+func (s *DeploySuite) TestPipelinePromote(c *check.C) {
+	var buildOpts *builder.BuildOpts
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
+		buildOpts = opts
+		version := newAppVersion(c, app)
+		return version, version.CommitBaseImage()
+	}
+	s.createPipeline(c, false)
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, s.newPipelinePromoteRequest(c, s.token.GetValue()))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, "(?s).*Builder deploy called.*")
+	c.Assert(buildOpts.ImageID, check.Equals, "tsuru/app-myapp-dev:v1")
+	c.Assert(eventtest.EventDesc{
+		Target:       appTarget("myapp-prod"),
+		ExtraTargets: []event.ExtraTarget{{Target: appTarget("myapp-dev")}, {Target: pipelineTarget("myapp")}},
+		Owner:        s.token.GetUserName(),
+		Kind:         "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":      "myapp-prod",
+			"kind":          "promote",
+			"origin":        "promote",
+			"sourceapp":     "myapp-dev",
+			"sourceversion": "1",
+			"pipeline":      "myapp",
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "tsuru/app-myapp-prod:v1",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestPipelinePromoteWithoutDeployPermissionOnStage(c *check.C) {
+	s.createPipeline(c, false)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPipelinePromote,
+		Context: permission.Context(permTypes.CtxTeam, s.team.Name),
+	})
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, s.newPipelinePromoteRequest(c, token.GetValue()))
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	versions, err := servicemanager.AppVersion.AppVersions(context.TODO(), &appTypes.MockApp{Name: "myapp-prod"})
+	if err != appTypes.ErrNoVersionsAvailable {
+		c.Assert(err, check.IsNil)
+		c.Assert(versions.Versions, check.HasLen, 0)
+	}
+}
+
+func (s *DeploySuite) TestPipelinePromoteRequiresApproval(c *check.C) {
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
+		version := newAppVersion(c, app)
+		return version, version.CommitBaseImage()
+	}
+	s.createPipeline(c, true)
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, s.newPipelinePromoteRequest(c, s.token.GetValue()))
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	var approval appTypes.PipelineApproval
+	err := json.Unmarshal(recorder.Body.Bytes(), &approval)
+	c.Assert(err, check.IsNil)
+	c.Assert(approval.Stage, check.Equals, "myapp-prod")
+	c.Assert(approval.Version, check.Equals, 1)
+	c.Assert(approval.RequestedBy, check.Equals, s.token.GetUserName())
+	c.Assert(approval.Approved(), check.Equals, false)
+
+	approve := func(token string) *httptest.ResponseRecorder {
+		v := url.Values{}
+		v.Set("stage", "myapp-prod")
+		v.Set("version", "1")
+		request, reqErr := http.NewRequest("POST", "/pipelines/myapp/approve", strings.NewReader(v.Encode()))
+		c.Assert(reqErr, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+token)
+		rec := httptest.NewRecorder()
+		s.testServer.ServeHTTP(rec, request)
+		return rec
+	}
+	recorder = approve(s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, appTypes.ErrPipelineSelfApproval.Error()+"\n")
+
+	approver := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermPipelineApprove,
+		Context: permission.Context(permTypes.CtxTeam, s.team.Name),
+	})
+	recorder = approve(approver.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = approve(approver.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, s.newPipelinePromoteRequest(c, s.token.GetValue()))
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(eventtest.EventDesc{
+		Target:       appTarget("myapp-prod"),
+		ExtraTargets: []event.ExtraTarget{{Target: appTarget("myapp-dev")}, {Target: pipelineTarget("myapp")}},
+		Owner:        s.token.GetUserName(),
+		Kind:         "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":      "myapp-prod",
+			"kind":          "promote",
+			"origin":        "promote",
+			"sourceapp":     "myapp-dev",
+			"sourceversion": "1",
+			"pipeline":      "myapp",
+			"approvedby":    approver.GetUserName(),
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "tsuru/app-myapp-prod:v1",
+		},
+	}, eventtest.HasEvent)
+	pipeline, err := servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(pipeline.Approvals, check.HasLen, 0)
+}
+
+func (s *DeploySuite) TestPipelinePromoteFirstStage(c *check.C) {
+	s.createPipeline(c, false)
+	v := url.Values{}
+	v.Set("stage", "myapp-dev")
+	request, err := http.NewRequest("POST", "/pipelines/myapp/promote", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "the first stage of a pipeline cannot receive promotions\n")
+}
@@ -316,6 +316,7 @@ func poolUpdateHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	if err != nil {
 		return err
 	}
+	oldMode := poolNetworkPolicyMode(ctx, poolName)
 	err = pool.PoolUpdate(ctx, poolName, updateOpts)
 	if err == pool.ErrPoolNotFound {
 		return &terrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
@@ -326,7 +327,22 @@ func poolUpdateHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 			Message: err.Error(),
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if poolNetworkPolicyMode(ctx, poolName) != oldMode {
+		return app.EnsurePoolNetworkPolicies(ctx, poolName)
+	}
+	return nil
+}
+
+func poolNetworkPolicyMode(ctx context.Context, poolName string) string {
+	p, err := pool.GetPoolByName(ctx, poolName)
+	if err != nil {
+		return ""
+	}
+	mode, _ := p.GetNetworkPolicyMode()
+	return mode
 }
 
 // title: pool constraints list
@@ -646,6 +646,27 @@ func (s *S) TestPoolUpdateNotOverwriteDefaultPoolHandler(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, pool.ErrDefaultPoolAlreadyExists.Error()+"\n")
 }
 
+func (s *S) TestPoolUpdateNetworkPolicyEnsuresAppsPolicies(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	update := func(body string) {
+		req, err := http.NewRequest(http.MethodPut, "/pools/test1", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		rec := httptest.NewRecorder()
+		s.testServer.ServeHTTP(rec, req)
+		c.Assert(rec.Code, check.Equals, http.StatusOK)
+	}
+	update(`{"labels": {"network-policy": "deny-all"}}`)
+	c.Assert(s.provisioner.NetworkPolicyUpdates(&a), check.Equals, 1)
+	update(`{"labels": {"network-policy": "deny-all", "other": "label"}}`)
+	c.Assert(s.provisioner.NetworkPolicyUpdates(&a), check.Equals, 1)
+	update(`{"labels": {}}`)
+	c.Assert(s.provisioner.NetworkPolicyUpdates(&a), check.Equals, 2)
+}
+
 func (s *S) TestPoolUpdateNotFound(c *check.C) {
 	b := bytes.NewBufferString("public=true")
 	request, err := http.NewRequest(http.MethodPut, "/pools/not-found", b)
@@ -0,0 +1,186 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// title: app port forward
+// path: /apps/{name}/port-forward
+// method: GET
+// produce: Websocket connection upgrade
+// responses:
+//   101: Switch Protocol to websocket
+func portForwardHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Fprintf(w, "unable to upgrade ws connection: %v", err)
+		return
+	}
+	var httpErr *errors.HTTP
+	defer func() {
+		if httpErr != nil {
+			var msg string
+			switch httpErr.Code {
+			case http.StatusUnauthorized:
+				msg = "no token provided or session expired, please login again\n"
+			default:
+				msg = httpErr.Message + "\n"
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte("Error: "+msg))
+		}
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		ws.Close()
+	}()
+	token := context.GetAuthToken(r)
+	if token == nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusUnauthorized,
+			Message: "no token provided",
+		}
+		return
+	}
+	appName := r.URL.Query().Get(":appname")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTP); ok {
+			httpErr = herr
+		} else {
+			httpErr = &errors.HTTP{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return
+	}
+	allowed := permission.Check(token, permission.PermAppRunShell, contextsForApp(&a)...)
+	if !allowed {
+		httpErr = permission.ErrUnauthorized
+		return
+	}
+	unitID := r.URL.Query().Get("unit")
+	if unitID == "" {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "unit is required",
+		}
+		return
+	}
+	port, err := strconv.Atoi(r.URL.Query().Get("port"))
+	if err != nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "invalid port: " + r.URL.Query().Get("port"),
+		}
+		return
+	}
+	evt, err := event.New(&event.Opts{
+		Target:      appTarget(appName),
+		Kind:        permission.PermAppRunShell,
+		Owner:       token,
+		RemoteAddr:  r.RemoteAddr,
+		CustomData:  event.FormToCustomData(InputFields(r)),
+		Allowed:     event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		DisableLock: true,
+	})
+	if err != nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+		return
+	}
+	defer func() {
+		var finalErr error
+		if httpErr != nil {
+			finalErr = httpErr
+		}
+		evt.Done(finalErr)
+	}()
+	fmt.Fprintf(evt, "forwarding connection to port %d of unit %q\n", port, unitID)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(pingInterval):
+			}
+			ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(2*time.Second))
+		}
+	}()
+	err = a.PortForward(provision.PortForwardOptions{
+		Unit:   unitID,
+		Port:   port,
+		Stream: &wsBinaryReadWriter{Conn: ws},
+	})
+	if err != nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+}
+
+// wsBinaryReadWriter streams raw bytes over a websocket connection, data
+// messages may be split across reads and the connection closing by the
+// client is reported as io.EOF.
+type wsBinaryReadWriter struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+func (c *wsBinaryReadWriter) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			messageType, r, err := c.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *wsBinaryReadWriter) Write(p []byte) (int, error) {
+	err := c.Conn.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/tsurutest"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	"golang.org/x/net/websocket"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestAppPortForward(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("ws://%s/apps/%s/port-forward?unit=%s&port=8080", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	wsConn.PayloadType = websocket.BinaryFrame
+	_, err = wsConn.Write([]byte("ping\x00\x01"))
+	c.Assert(err, check.IsNil)
+	data := make([]byte, 6)
+	wsConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(wsConn, data)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "ping\x00\x01")
+	wsConn.Close()
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.run.shell",
+		StartCustomData: []map[string]interface{}{
+			{"name": "unit", "value": units[0].ID},
+			{"name": "port", "value": "8080"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppPortForwardShellPermission(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRunShell,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	url := fmt.Sprintf("ws://%s/apps/%s/port-forward?unit=%s&port=8080", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	wsConn.PayloadType = websocket.BinaryFrame
+	_, err = wsConn.Write([]byte("ping"))
+	c.Assert(err, check.IsNil)
+	data := make([]byte, 4)
+	wsConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(wsConn, data)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "ping")
+}
+
+func (s *S) TestAppPortForwardInvalidPermission(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRunDebug,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	url := fmt.Sprintf("ws://%s/apps/%s/port-forward?unit=%s&port=8080", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	var result string
+	err = tsurutest.WaitCondition(5*time.Second, func() bool {
+		part, readErr := ioutil.ReadAll(wsConn)
+		if readErr != nil {
+			return false
+		}
+		result += string(part)
+		return result == "Error: You don't have permission to do this action\n"
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAppPortForwardUnitNotFound(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("ws://%s/apps/%s/port-forward?unit=myunit&port=8080", testServerURL.Host, a.Name)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	var result string
+	err = tsurutest.WaitCondition(5*time.Second, func() bool {
+		part, readErr := ioutil.ReadAll(wsConn)
+		if readErr != nil {
+			return false
+		}
+		result += string(part)
+		return result == "Error: unit \"myunit\" not found\n"
+	})
+	c.Assert(err, check.IsNil)
+}
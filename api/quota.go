@@ -9,10 +9,12 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/pool"
 	"github.com/tsuru/tsuru/servicemanager"
 	authTypes "github.com/tsuru/tsuru/types/auth"
 	permTypes "github.com/tsuru/tsuru/types/permission"
@@ -200,8 +202,15 @@ func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
+	usage, err := app.TeamResourceQuotaUsage(r.Context(), team)
+	if err != nil {
+		return err
+	}
 	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(team.Quota)
+	return json.NewEncoder(w).Encode(struct {
+		quota.Quota
+		Resources []quota.ResourceQuotaUsage `json:"resources,omitempty"`
+	}{Quota: team.Quota, Resources: usage})
 }
 
 // title: update team quota
@@ -210,7 +219,7 @@ func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 // consume: application/x-www-form-urlencoded
 // responses:
 //   200: Quota updated
-//   400: Invalid data
+//   400: Invalid data or pool not found
 //   401: Unauthorized
 //   403: Limit lower than allocated value
 //   404: Team not found
@@ -242,6 +251,9 @@ func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	if poolName := InputValue(r, "pool"); poolName != "" {
+		return changeTeamResourceQuota(r, team, poolName)
+	}
 	limit, err := strconv.Atoi(InputValue(r, "limit"))
 	if err != nil {
 		return &errors.HTTP{
@@ -258,3 +270,37 @@ func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 	}
 	return err
 }
+
+// changeTeamResourceQuota updates the resource quota of the team in the pool,
+// limits not present in the request are kept.
+func changeTeamResourceQuota(r *http.Request, team *authTypes.Team, poolName string) error {
+	q := team.ResourceQuota(poolName)
+	for field, value := range map[string]*int64{"cpu": &q.MilliCPU, "memory": &q.Memory} {
+		raw := InputValue(r, field)
+		if raw == "" {
+			continue
+		}
+		var err error
+		*value, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid " + field,
+			}
+		}
+	}
+	err := app.SetTeamResourceQuota(r.Context(), team.Name, q)
+	switch err {
+	case quota.ErrLimitLowerThanAllocated:
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: err.Error(),
+		}
+	case pool.ErrPoolNotFound:
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	return err
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/permission/permissiontest"
+	"github.com/tsuru/tsuru/provision/pool"
 	servicemock "github.com/tsuru/tsuru/servicemanager/mock"
 	_ "github.com/tsuru/tsuru/storage/mongodb"
 	authTypes "github.com/tsuru/tsuru/types/auth"
@@ -464,6 +465,81 @@ func (s *QuotaSuite) TestChangeTeamQuotaTeamNotFound(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, authTypes.ErrTeamNotFound.Error()+"\n")
 }
 
+func (s *QuotaSuite) TestGetTeamQuotaWithResourceQuotas(c *check.C) {
+	team := &authTypes.Team{
+		Name:           "avengers",
+		Quota:          quota.Quota{Limit: 4, InUse: 2},
+		ResourceQuotas: []quota.ResourceQuota{{Pool: "pool1", MilliCPU: 2000, Memory: 1024}},
+	}
+	s.mockService.Team.OnFindByName = func(s string) (*authTypes.Team, error) {
+		return team, nil
+	}
+	request, err := http.NewRequest("GET", "/teams/avengers/quota", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result struct {
+		quota.Quota
+		Resources []quota.ResourceQuotaUsage
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Quota, check.DeepEquals, team.Quota)
+	c.Assert(result.Resources, check.DeepEquals, []quota.ResourceQuotaUsage{
+		{ResourceQuota: quota.ResourceQuota{Pool: "pool1", MilliCPU: 2000, Memory: 1024}},
+	})
+}
+
+func (s *QuotaSuite) TestChangeTeamResourceQuota(c *check.C) {
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer pool.RemovePool("pool1")
+	s.mockService.Team.OnFindByName = func(s string) (*authTypes.Team, error) {
+		return &authTypes.Team{
+			Name:           "avengers",
+			ResourceQuotas: []quota.ResourceQuota{{Pool: "pool1", MilliCPU: 1000, Memory: 1024}},
+		}, nil
+	}
+	var set []quota.ResourceQuota
+	s.mockService.Team.OnSetResourceQuota = func(name string, q quota.ResourceQuota) error {
+		c.Assert(name, check.Equals, "avengers")
+		set = append(set, q)
+		return nil
+	}
+	body := bytes.NewBufferString("pool=pool1&cpu=2000")
+	request, _ := http.NewRequest("PUT", "/teams/avengers/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(set, check.DeepEquals, []quota.ResourceQuota{{Pool: "pool1", MilliCPU: 2000, Memory: 1024}})
+}
+
+func (s *QuotaSuite) TestChangeTeamResourceQuotaInvalidValues(c *check.C) {
+	s.mockService.Team.OnFindByName = func(s string) (*authTypes.Team, error) {
+		return &authTypes.Team{Name: "avengers"}, nil
+	}
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{body: "pool=pool1&memory=lots", expected: "Invalid memory\n"},
+		{body: "pool=unknown&cpu=100", expected: "(?i)pool does not exist.\n"},
+	}
+	for _, tt := range tests {
+		request, _ := http.NewRequest("PUT", "/teams/avengers/quota", bytes.NewBufferString(tt.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(recorder.Body.String(), check.Matches, tt.expected)
+	}
+}
+
 func (s *QuotaSuite) TestGetAppQuota(c *check.C) {
 	s.mockService.AppQuota.OnGet = func(item quota.QuotaItem) (*quota.Quota, error) {
 		c.Assert(item.GetName(), check.Equals, "civil")
@@ -35,12 +35,14 @@ import (
 	"github.com/tsuru/tsuru/app/image"
 	"github.com/tsuru/tsuru/app/image/gc"
 	"github.com/tsuru/tsuru/app/version"
+	"github.com/tsuru/tsuru/app/vpa"
 	"github.com/tsuru/tsuru/applog"
 	"github.com/tsuru/tsuru/auth"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/autoscale"
+	"github.com/tsuru/tsuru/cost"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/webhook"
@@ -51,6 +53,7 @@ import (
 	"github.com/tsuru/tsuru/provision/cluster"
 	"github.com/tsuru/tsuru/provision/nodecontainer"
 	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/unitevent"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/service"
@@ -172,6 +175,18 @@ func setupServices() error {
 	if err != nil {
 		return err
 	}
+	servicemanager.Pipeline, err = app.PipelineService()
+	if err != nil {
+		return err
+	}
+	servicemanager.UnitEvent, err = unitevent.UnitEventService()
+	if err != nil {
+		return err
+	}
+	servicemanager.CostPrice, err = cost.PriceService()
+	if err != nil {
+		return err
+	}
 	servicemanager.AppVersion, err = version.AppVersionService()
 	if err != nil {
 		return err
@@ -263,6 +278,12 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", http.MethodPost, "/apps/{app}/stop", AuthorizationRequiredHandler(stop))
 	m.Add("1.0", http.MethodPost, "/apps/{app}/sleep", AuthorizationRequiredHandler(sleep))
 	m.Add("1.10", http.MethodDelete, "/apps/{app}/versions/{version}", AuthorizationRequiredHandler(appVersionDelete))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/versions/channels", AuthorizationRequiredHandler(appVersionChannelList))
+	m.Add("1.13", http.MethodPut, "/apps/{app}/versions/channels/{channel}", AuthorizationRequiredHandler(appVersionChannelSet))
+	m.Add("1.13", http.MethodDelete, "/apps/{app}/versions/channels/{channel}", AuthorizationRequiredHandler(appVersionChannelUnset))
+	m.Add("1.13", http.MethodPut, "/apps/{app}/git-deploy", AuthorizationRequiredHandler(gitDeploySet))
+	m.Add("1.13", http.MethodDelete, "/apps/{app}/git-deploy", AuthorizationRequiredHandler(gitDeployUnset))
+	m.Add("1.13", http.MethodPost, "/git/webhook", Handler(gitWebhook))
 	m.Add("1.0", http.MethodGet, "/apps/{app}/quota", AuthorizationRequiredHandler(getAppQuota))
 	m.Add("1.0", http.MethodPut, "/apps/{app}/quota", AuthorizationRequiredHandler(changeAppQuota))
 	m.Add("1.0", http.MethodGet, "/apps/{app}/env", AuthorizationRequiredHandler(getEnv))
@@ -274,9 +295,13 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.9", http.MethodGet, "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(autoScaleUnitsInfo))
 	m.Add("1.9", http.MethodPost, "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(addAutoScaleUnits))
 	m.Add("1.9", http.MethodDelete, "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(removeAutoScaleUnits))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/units/events", AuthorizationRequiredHandler(unitEvents))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/costs", AuthorizationRequiredHandler(appCostReport))
 	m.Add("1.0", http.MethodPost, "/apps/{app}/units/register", AuthorizationRequiredHandler(registerUnit))
 	m.Add("1.0", http.MethodPost, "/apps/{app}/units/{unit}", AuthorizationRequiredHandler(setUnitStatus))
 	m.Add("1.12", http.MethodDelete, "/apps/{app}/units/{unit}", AuthorizationRequiredHandler(killUnit))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/units/{unit}/files", AuthorizationRequiredHandler(downloadFromUnit))
+	m.Add("1.13", http.MethodPut, "/apps/{app}/units/{unit}/files", AuthorizationRequiredHandler(uploadToUnit))
 	m.Add("1.0", http.MethodPut, "/apps/{app}/teams/{team}", AuthorizationRequiredHandler(grantAppAccess))
 	m.Add("1.0", http.MethodDelete, "/apps/{app}/teams/{team}", AuthorizationRequiredHandler(revokeAppAccess))
 	m.AddNamed("log-get", "1.0", http.MethodGet, "/apps/{app}/log", AuthorizationRequiredHandler(appLog))
@@ -285,7 +310,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", http.MethodPost, "/apps/{app}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
 	m.Add("1.4", http.MethodPut, "/apps/{app}/deploy/rollback/update", AuthorizationRequiredHandler(deployRollbackUpdate))
 	m.Add("1.3", http.MethodPost, "/apps/{app}/deploy/rebuild", AuthorizationRequiredHandler(deployRebuild))
+	m.Add("1.13", http.MethodPost, "/apps/{app}/deploy/promote", AuthorizationRequiredHandler(deployPromote))
 	m.Add("1.0", http.MethodGet, "/apps/{app}/metric/envs", AuthorizationRequiredHandler(appMetricEnvs))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/network-policy", AuthorizationRequiredHandler(appNetworkPolicy))
+	m.Add("1.13", http.MethodGet, "/apps/{app}/drift", AuthorizationRequiredHandler(appDrift))
+	m.Add("1.13", http.MethodPost, "/apps/{app}/migrate", AuthorizationRequiredHandler(appMigrateCluster))
 	m.Add("1.0", http.MethodPost, "/apps/{app}/routes", AuthorizationRequiredHandler(appRebuildRoutes))
 	m.Add("1.2", http.MethodGet, "/apps/{app}/certificate", AuthorizationRequiredHandler(listCertificates))
 	m.Add("1.2", http.MethodPut, "/apps/{app}/certificate", AuthorizationRequiredHandler(setCertificate))
@@ -316,6 +345,14 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.6", http.MethodPut, "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
 	m.Add("1.6", http.MethodDelete, "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
 
+	m.Add("1.13", http.MethodGet, "/pipelines", AuthorizationRequiredHandler(pipelineList))
+	m.Add("1.13", http.MethodPost, "/pipelines", AuthorizationRequiredHandler(pipelineCreate))
+	m.Add("1.13", http.MethodGet, "/pipelines/{name}", AuthorizationRequiredHandler(pipelineInfo))
+	m.Add("1.13", http.MethodPut, "/pipelines/{name}", AuthorizationRequiredHandler(pipelineUpdate))
+	m.Add("1.13", http.MethodDelete, "/pipelines/{name}", AuthorizationRequiredHandler(pipelineDelete))
+	m.Add("1.13", http.MethodPost, "/pipelines/{name}/promote", AuthorizationRequiredHandler(pipelinePromote))
+	m.Add("1.13", http.MethodPost, "/pipelines/{name}/approve", AuthorizationRequiredHandler(pipelineApprove))
+
 	m.Add("1.0", http.MethodGet, "/platforms", AuthorizationRequiredHandler(platformList))
 	m.Add("1.0", http.MethodPost, "/platforms", AuthorizationRequiredHandler(platformAdd))
 	m.Add("1.0", http.MethodPut, "/platforms/{name}", AuthorizationRequiredHandler(platformUpdate))
@@ -334,6 +371,8 @@ func RunServer(dry bool) http.Handler {
 	// Shell also doesn't use {app} on purpose. Middlewares don't play well
 	// with websocket.
 	m.Add("1.0", http.MethodGet, "/apps/{appname}/shell", http.HandlerFunc(remoteShellHandler))
+	m.Add("1.13", http.MethodGet, "/apps/{appname}/port-forward", http.HandlerFunc(portForwardHandler))
+	m.Add("1.13", http.MethodGet, "/apps/{appname}/debug", http.HandlerFunc(debugUnitHandler))
 
 	m.Add("1.0", http.MethodGet, "/users", AuthorizationRequiredHandler(listUsers))
 	m.Add("1.0", http.MethodPost, "/users", Handler(createUser))
@@ -363,6 +402,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.4", http.MethodGet, "/teams/{name}", AuthorizationRequiredHandler(teamInfo))
 	m.Add("1.12", http.MethodGet, "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
 	m.Add("1.12", http.MethodPut, "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
+	m.Add("1.13", http.MethodGet, "/teams/{name}/costs", AuthorizationRequiredHandler(teamCostReport))
+
+	m.Add("1.13", http.MethodGet, "/costs/prices", AuthorizationRequiredHandler(listCostPrices))
+	m.Add("1.13", http.MethodPut, "/costs/prices", AuthorizationRequiredHandler(setCostPrice))
+	m.Add("1.13", http.MethodDelete, "/costs/prices", AuthorizationRequiredHandler(removeCostPrice))
 
 	m.Add("1.0", http.MethodPost, "/swap", AuthorizationRequiredHandler(swap))
 
@@ -465,6 +509,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.4", http.MethodPost, "/provisioner/clusters/{name}", AuthorizationRequiredHandler(updateCluster))
 	m.Add("1.3", http.MethodGet, "/provisioner/clusters", AuthorizationRequiredHandler(listClusters))
 	m.Add("1.8", http.MethodGet, "/provisioner/clusters/{name}", AuthorizationRequiredHandler(clusterInfo))
+	m.Add("1.13", http.MethodGet, "/provisioner/clusters/{name}/capacity", AuthorizationRequiredHandler(clusterCapacity))
 	m.Add("1.3", http.MethodDelete, "/provisioner/clusters/{name}", AuthorizationRequiredHandler(deleteCluster))
 
 	m.Add("1.4", http.MethodGet, "/volumes", AuthorizationRequiredHandler(volumesList))
@@ -680,6 +725,10 @@ func startServer(handler http.Handler) error {
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize old image gc")
 	}
+	err = vpa.Initialize()
+	if err != nil {
+		return errors.Wrap(err, "unable to initialize vertical autoscaling applier")
+	}
 	err = service.InitializeSync(bindAppsLister)
 	if err != nil {
 		return err
@@ -19,6 +19,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/cost"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
@@ -255,6 +256,10 @@ func removeServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	}
 	evt.SetLogWriter(writer)
 	defer func() { evt.Done(err) }()
+	err = evt.SetOtherCustomData(cost.ServiceInstanceSnapshot(serviceInstance))
+	if err != nil {
+		return err
+	}
 	requestID := requestIDHeader(r)
 	unbindAllBool, _ := strconv.ParseBool(unbindAll)
 	if unbindAllBool {
@@ -1008,6 +1008,9 @@ func (s *ServiceInstanceSuite) TestRemoveServiceServiceInstance(c *check.C) {
 			{"name": ":service", "value": "foo"},
 			{"name": ":instance", "value": "foo-instance"},
 		},
+		OtherCustomData: map[string]interface{}{
+			"service": "foo",
+		},
 	}, eventtest.HasEvent)
 }
 
@@ -0,0 +1,153 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	terminal "golang.org/x/term"
+)
+
+// title: app unit debug
+// path: /apps/{name}/debug
+// method: GET
+// produce: Websocket connection upgrade
+// responses:
+//   101: Switch Protocol to websocket
+func debugUnitHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Fprintf(w, "unable to upgrade ws connection: %v", err)
+		return
+	}
+	var httpErr *errors.HTTP
+	defer func() {
+		if httpErr != nil {
+			var msg string
+			switch httpErr.Code {
+			case http.StatusUnauthorized:
+				msg = "no token provided or session expired, please login again\n"
+			default:
+				msg = httpErr.Message + "\n"
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte("Error: "+msg))
+		}
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		ws.Close()
+	}()
+	token := context.GetAuthToken(r)
+	if token == nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusUnauthorized,
+			Message: "no token provided",
+		}
+		return
+	}
+	appName := r.URL.Query().Get(":appname")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTP); ok {
+			httpErr = herr
+		} else {
+			httpErr = &errors.HTTP{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return
+	}
+	allowed := permission.Check(token, permission.PermAppRunDebug, contextsForApp(&a)...)
+	if !allowed {
+		httpErr = permission.ErrUnauthorized
+		return
+	}
+	unitID := r.URL.Query().Get("unit")
+	image := r.URL.Query().Get("image")
+	if unitID == "" || image == "" {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "unit and image are required",
+		}
+		return
+	}
+	width, _ := strconv.Atoi(r.URL.Query().Get("width"))
+	height, _ := strconv.Atoi(r.URL.Query().Get("height"))
+	evt, err := event.New(&event.Opts{
+		Target:      appTarget(appName),
+		Kind:        permission.PermAppRunDebug,
+		Owner:       token,
+		RemoteAddr:  r.RemoteAddr,
+		CustomData:  event.FormToCustomData(InputFields(r)),
+		Allowed:     event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+		DisableLock: true,
+	})
+	if err != nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+		return
+	}
+	buf := &optionalWriterCloser{}
+	term := terminal.NewTerminal(buf, "")
+	defer func() {
+		var finalErr error
+		if httpErr != nil {
+			finalErr = httpErr
+		}
+		buf.disableWrite = true
+		for {
+			line, readErr := term.ReadLine()
+			if readErr != nil {
+				break
+			}
+			fmt.Fprintf(evt, "> %s\n", line)
+		}
+		evt.Done(finalErr)
+	}()
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(pingInterval):
+			}
+			ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(2*time.Second))
+		}
+	}()
+	conn := &cmdLogger{base: &wsReadWriteCloser{ws}, term: term}
+	err = a.Debug(provision.DebugOptions{
+		Unit:   unitID,
+		Image:  image,
+		Stdout: conn,
+		Stderr: conn,
+		Stdin:  conn,
+		Width:  width,
+		Height: height,
+		Term:   r.URL.Query().Get("term"),
+	})
+	if err != nil {
+		httpErr = &errors.HTTP{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/tsurutest"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	"golang.org/x/net/websocket"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestDebugUnit(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	err = pool.SetPoolConstraint(&pool.PoolConstraint{PoolExpr: a.Pool, Field: pool.ConstraintTypeDebugImage, Values: []string{"busybox"}})
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("ws://%s/apps/%s/debug?unit=%s&image=busybox&width=140&height=38&term=xterm", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	var debugs []provision.DebugOptions
+	err = tsurutest.WaitCondition(5*time.Second, func() bool {
+		debugs = s.provisioner.Debugs(units[0].ID)
+		return len(debugs) == 1
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(debugs[0].Image, check.Equals, "busybox")
+	c.Assert(debugs[0].Width, check.Equals, 140)
+	c.Assert(debugs[0].Height, check.Equals, 38)
+	c.Assert(debugs[0].Term, check.Equals, "xterm")
+}
+
+func (s *S) TestDebugUnitImageNotAllowed(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("ws://%s/apps/%s/debug?unit=%s&image=busybox", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	expected := fmt.Sprintf("Error: debug image \"busybox\" is not allowed in pool %q\n", a.Pool)
+	var result string
+	err = tsurutest.WaitCondition(5*time.Second, func() bool {
+		part, readErr := ioutil.ReadAll(wsConn)
+		if readErr != nil {
+			return false
+		}
+		result += string(part)
+		return result == expected
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Debugs(units[0].ID), check.HasLen, 0)
+}
+
+func (s *S) TestDebugUnitInvalidPermission(c *check.C) {
+	a := app.App{
+		Name:      "someapp",
+		Platform:  "zend",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(context.TODO(), &a, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(s.testServer)
+	defer server.Close()
+	testServerURL, err := url.Parse(server.URL)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRunShell,
+		Context: permission.Context(permTypes.CtxApp, a.Name),
+	})
+	url := fmt.Sprintf("ws://%s/apps/%s/debug?unit=%s&image=busybox", testServerURL.Host, a.Name, units[0].ID)
+	config, err := websocket.NewConfig(url, "ws://localhost/")
+	c.Assert(err, check.IsNil)
+	config.Header.Set("Authorization", "bearer "+token.GetValue())
+	wsConn, err := websocket.DialConfig(config)
+	c.Assert(err, check.IsNil)
+	defer wsConn.Close()
+	var result string
+	err = tsurutest.WaitCondition(5*time.Second, func() bool {
+		part, readErr := ioutil.ReadAll(wsConn)
+		if readErr != nil {
+			return false
+		}
+		result += string(part)
+		return result == "Error: You don't have permission to do this action\n"
+	})
+	c.Assert(err, check.IsNil)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/cost"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
@@ -263,6 +264,10 @@ func volumeDelete(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	err = evt.SetOtherCustomData(cost.VolumeSnapshot(dbVolume))
+	if err != nil {
+		return err
+	}
 	return servicemanager.Volume.Delete(ctx, dbVolume)
 }
 
@@ -116,6 +116,8 @@ type App struct {
 	UpdatePlatform  bool
 	Lock            appTypes.AppLock
 	Pool            string
+	Cluster         string            `json:",omitempty" bson:",omitempty"`
+	Migration       *ClusterMigration `json:",omitempty" bson:",omitempty"`
 	Description     string
 	Router          string
 	RouterOpts      map[string]string
@@ -124,6 +126,7 @@ type App struct {
 	Error           string
 	Routers         []appTypes.AppRouter
 	Metadata        appTypes.Metadata
+	GitDeploy       appTypes.GitDeploy
 
 	// UUID is a v4 UUID lazily generated on the first call to GetUUID()
 	UUID string
@@ -235,14 +238,21 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	if prov != nil {
 		provisionerName := prov.GetName()
 		result["provisioner"] = provisionerName
-		cluster, clusterErr := servicemanager.Cluster.FindByPool(app.ctx, provisionerName, app.Pool)
-		if clusterErr != nil && clusterErr != provisionTypes.ErrNoCluster {
-			errMsgs = append(errMsgs, fmt.Sprintf("unable to get cluster name: %+v", clusterErr))
-		}
-		if cluster != nil {
-			result["cluster"] = cluster.Name
+		if app.Cluster != "" {
+			result["cluster"] = app.Cluster
+		} else {
+			cluster, clusterErr := servicemanager.Cluster.FindByPool(app.ctx, provisionerName, app.Pool)
+			if clusterErr != nil && clusterErr != provisionTypes.ErrNoCluster {
+				errMsgs = append(errMsgs, fmt.Sprintf("unable to get cluster name: %+v", clusterErr))
+			}
+			if cluster != nil {
+				result["cluster"] = cluster.Name
+			}
 		}
 	}
+	if app.Migration != nil {
+		result["migration"] = app.Migration
+	}
 	result["teams"] = app.Teams
 	units, err := app.Units()
 	result["units"] = units
@@ -257,6 +267,9 @@ func (app *App) MarshalJSON() ([]byte, error) {
 		"cpumilli": app.Plan.CPUMilli,
 		"override": app.Plan.Override,
 	}
+	if len(app.Plan.ProcessOverride) > 0 {
+		plan["processOverride"] = app.Plan.ProcessOverride
+	}
 	routers, err := app.GetRoutersWithAddr()
 	if err != nil {
 		errMsgs = append(errMsgs, fmt.Sprintf("unable to get app addresses: %+v", err))
@@ -278,6 +291,9 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["tags"] = app.Tags
 	result["routers"] = routers
 	result["metadata"] = app.Metadata
+	if app.GitDeploy.Repository != "" {
+		result["gitDeploy"] = app.GitDeploy
+	}
 	q, err := app.GetQuota()
 	if err != nil {
 		errMsgs = append(errMsgs, fmt.Sprintf("unable to get app quota: %+v", err))
@@ -461,76 +477,35 @@ type UpdateAppArgs struct {
 
 // Update changes informations of the application.
 func (app *App) Update(args UpdateAppArgs) (err error) {
-	description := args.UpdateData.Description
-	poolName := args.UpdateData.Pool
-	teamOwner := args.UpdateData.TeamOwner
-	platform := args.UpdateData.Platform
-	tags := processTags(args.UpdateData.Tags)
 	oldApp := *app
-
-	if description != "" {
-		app.Description = description
-	}
-	if poolName != "" {
-		app.Pool = poolName
-		app.provisioner = nil
-		_, err = app.getPoolForApp(app.Pool)
-		if err != nil {
-			return err
-		}
+	// Metadata updates change the items in place, the old app must keep the
+	// previous annotations so provisioners can compare them.
+	oldApp.Metadata = appTypes.Metadata{
+		Labels:      append([]appTypes.MetadataItem{}, app.Metadata.Labels...),
+		Annotations: append([]appTypes.MetadataItem{}, app.Metadata.Annotations...),
 	}
-	newProv, err := app.getProvisioner()
-	if err != nil {
-		return err
-	}
-	oldProv, err := oldApp.getProvisioner()
+	team, err := app.applyUpdate(args.UpdateData)
 	if err != nil {
 		return err
 	}
-	if args.UpdateData.Plan.Name != "" {
-		plan, errFind := servicemanager.Plan.FindByName(app.ctx, args.UpdateData.Plan.Name)
-		if errFind != nil {
-			return errFind
-		}
-		app.Plan = *plan
-	}
-	app.Plan.MergeOverride(args.UpdateData.Plan.Override)
-	if teamOwner != "" {
-		team, errTeam := servicemanager.Team.FindByName(app.ctx, teamOwner)
-		if errTeam != nil {
-			return errTeam
-		}
-		app.TeamOwner = team.Name
+	if team != nil {
 		defer func() {
 			if err == nil {
 				app.Grant(team)
 			}
 		}()
 	}
-	if tags != nil {
-		app.Tags = tags
-	}
-	err = args.UpdateData.Metadata.Validate()
-	if err != nil {
-		return err
-	}
-	app.Metadata.Update(args.UpdateData.Metadata)
-	if platform != "" {
-		var p, v string
-		p, v, err = app.getPlatformNameAndVersion(app.ctx, platform)
+	if !reflect.DeepEqual(app.Plan, oldApp.Plan) || app.Pool != oldApp.Pool || app.TeamOwner != oldApp.TeamOwner {
+		err = checkTeamResourceQuotaChange(app.ctx, &oldApp, app, appResourcesOpts{})
 		if err != nil {
 			return err
 		}
-		if app.Platform != p || app.PlatformVersion != v {
-			app.UpdatePlatform = true
-		}
-		app.Platform = p
-		app.PlatformVersion = v
 	}
-	if args.UpdateData.UpdatePlatform {
-		app.UpdatePlatform = true
+	newProv, err := app.getProvisioner()
+	if err != nil {
+		return err
 	}
-	err = app.validate()
+	oldProv, err := oldApp.getProvisioner()
 	if err != nil {
 		return err
 	}
@@ -562,6 +537,111 @@ func (app *App) Update(args UpdateAppArgs) (err error) {
 	return action.NewPipeline(actions...).Execute(app.ctx, app, &oldApp, args.Writer)
 }
 
+// applyUpdate changes the fields of the app set in data, without saving them.
+// The new team owner of the app is returned when it changes.
+func (app *App) applyUpdate(data App) (*authTypes.Team, error) {
+	description := data.Description
+	poolName := data.Pool
+	teamOwner := data.TeamOwner
+	platform := data.Platform
+	tags := processTags(data.Tags)
+	if description != "" {
+		app.Description = description
+	}
+	if poolName != "" {
+		if poolName != app.Pool {
+			if app.Migration != nil {
+				return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("app has an unfinished migration to cluster %q, the pool can't be changed", app.Migration.DestinationCluster)}
+			}
+			// The pinned cluster was chosen for the previous pool, the app
+			// moves to the cluster serving the new one.
+			app.Cluster = ""
+		}
+		app.Pool = poolName
+		app.provisioner = nil
+		_, err := app.getPoolForApp(app.Pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data.Plan.Name != "" {
+		plan, err := servicemanager.Plan.FindByName(app.ctx, data.Plan.Name)
+		if err != nil {
+			return nil, err
+		}
+		app.Plan = *plan
+	}
+	app.Plan.MergeOverride(data.Plan.Override)
+	err := app.validateProcessOverrides(data.Plan.ProcessOverride)
+	if err != nil {
+		return nil, err
+	}
+	for process, po := range data.Plan.ProcessOverride {
+		app.Plan.MergeProcessOverride(process, po)
+	}
+	var team *authTypes.Team
+	if teamOwner != "" {
+		var err error
+		team, err = servicemanager.Team.FindByName(app.ctx, teamOwner)
+		if err != nil {
+			return nil, err
+		}
+		app.TeamOwner = team.Name
+	}
+	if tags != nil {
+		app.Tags = tags
+	}
+	err = data.Metadata.Validate()
+	if err != nil {
+		return nil, err
+	}
+	app.Metadata.Update(data.Metadata)
+	if platform != "" {
+		p, v, err := app.getPlatformNameAndVersion(app.ctx, platform)
+		if err != nil {
+			return nil, err
+		}
+		if app.Platform != p || app.PlatformVersion != v {
+			app.UpdatePlatform = true
+		}
+		app.Platform = p
+		app.PlatformVersion = v
+	}
+	if data.UpdatePlatform {
+		app.UpdatePlatform = true
+	}
+	err = app.validate()
+	if err != nil {
+		return nil, err
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	if validator, ok := prov.(provision.AppValidatorProvisioner); ok {
+		err = validator.ValidateApp(app.ctx, app)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return team, nil
+}
+
+// DryRunUpdate returns the changes that updating the app would apply to its
+// provisioner resources, without saving or applying anything.
+func (app *App) DryRunUpdate(args UpdateAppArgs) ([]provision.ManifestChange, error) {
+	updated := *app
+	updated.Metadata = appTypes.Metadata{
+		Annotations: append([]appTypes.MetadataItem{}, app.Metadata.Annotations...),
+		Labels:      append([]appTypes.MetadataItem{}, app.Metadata.Labels...),
+	}
+	_, err := updated.applyUpdate(args.UpdateData)
+	if err != nil {
+		return nil, err
+	}
+	return dryRun(app.ctx, &updated, provision.DeployArgs{App: &updated})
+}
+
 func validateVolumes(ctx context.Context, app *App) error {
 	volumes, err := servicemanager.Volume.ListByApp(ctx, app.Name)
 	if err != nil {
@@ -898,6 +978,17 @@ func (app *App) AddUnits(n uint, process, versionStr string, w io.Writer) error
 	if err != nil {
 		return err
 	}
+	err = checkTeamResourceQuota(app.ctx, app, func() (quota.Resources, error) {
+		calc, calcErr := newUnitResourcesCalculator(app, version)
+		if calcErr != nil {
+			return quota.Resources{}, calcErr
+		}
+		r, calcErr := calc.unit(process)
+		return quota.Resources{MilliCPU: r.MilliCPU * int64(n), Memory: r.Memory * int64(n)}, calcErr
+	})
+	if err != nil {
+		return err
+	}
 	w = app.withLogWriter(w)
 	err = action.NewPipeline(
 		&reserveUnitsToAdd,
@@ -1625,6 +1716,12 @@ func (app *App) GetPool() string {
 	return app.Pool
 }
 
+// GetCluster returns the cluster the app is pinned to by a cluster
+// migration, it's empty for apps running in the cluster serving their pool.
+func (app *App) GetCluster() string {
+	return app.Cluster
+}
+
 // GetTeamOwner returns the team owner of the app.
 func (app *App) GetTeamOwner() string {
 	return app.TeamOwner
@@ -1637,17 +1734,65 @@ func (app *App) GetTeamsName() []string {
 
 // GetMemory returns the memory limit (in bytes) for the app.
 func (app *App) GetMemory() int64 {
-	if app.Plan.Override.Memory != nil {
-		return *app.Plan.Override.Memory
-	}
-	return app.Plan.Memory
+	return app.Plan.GetMemory("")
 }
 
 func (app *App) GetMilliCPU() int {
-	if app.Plan.Override.CPUMilli != nil {
-		return *app.Plan.Override.CPUMilli
+	return app.Plan.GetMilliCPU("")
+}
+
+// GetProcessMemory returns the memory limit (in bytes) for a process of the
+// app.
+func (app *App) GetProcessMemory(process string) int64 {
+	return app.Plan.GetMemory(process)
+}
+
+func (app *App) GetProcessMilliCPU(process string) int {
+	return app.Plan.GetMilliCPU(process)
+}
+
+// validateProcessOverrides checks that the processes receiving a plan
+// override are declared in the Procfile of the latest successful version.
+// Overrides removing values are accepted for any process, allowing to clean
+// up processes removed from the Procfile.
+func (app *App) validateProcessOverrides(overrides map[string]appTypes.PlanOverride) error {
+	var toSet []string
+	for process, po := range overrides {
+		if (po.Memory != nil && *po.Memory != 0) || (po.CPUMilli != nil && *po.CPUMilli != 0) {
+			toSet = append(toSet, process)
+		}
+	}
+	if len(toSet) == 0 {
+		return nil
 	}
-	return app.Plan.CPUMilli
+	version, err := servicemanager.AppVersion.LatestSuccessfulVersion(app.ctx, app)
+	if err == appTypes.ErrNoVersionsAvailable {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	processes, err := version.Processes()
+	if err != nil {
+		return err
+	}
+	sort.Strings(toSet)
+	for _, process := range toSet {
+		if _, ok := processes[process]; !ok {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("process %q not found in the app Procfile", process)}
+		}
+	}
+	return nil
+}
+
+// GetProcessPlanOverride returns the plan override explicitly set for a
+// process of the app, if any.
+func (app *App) GetProcessPlanOverride(process string) *appTypes.PlanOverride {
+	po, ok := app.Plan.ProcessOverride[process]
+	if !ok {
+		return nil
+	}
+	return &po
 }
 
 // GetSwap returns the swap limit (in bytes) for the app.
@@ -2340,6 +2485,10 @@ func (app *App) Start(ctx context.Context, w io.Writer, process, versionStr stri
 	if err != nil {
 		return err
 	}
+	err = checkTeamResourceQuotaChange(ctx, app, app, appResourcesOpts{start: true, startProcess: process})
+	if err != nil {
+		return err
+	}
 	err = prov.Start(ctx, app, process, version, w)
 	if err != nil {
 		log.Errorf("[start] error on start the app %s - %s", app.Name, err)
@@ -2361,6 +2510,50 @@ func (app *App) SetUpdatePlatform(check bool) error {
 	)
 }
 
+// SetGitDeploy configures the app to be deployed on pushes to the given
+// repository and branch. An empty repository disables push deploys.
+func (app *App) SetGitDeploy(gitDeploy appTypes.GitDeploy) error {
+	if gitDeploy.Repository != "" && (gitDeploy.Branch == "" || gitDeploy.Secret == "") {
+		return &tsuruErrors.ValidationError{Message: "branch and secret are required to enable git deploys"}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"gitdeploy": gitDeploy}},
+	)
+	if err != nil {
+		return err
+	}
+	app.GitDeploy = gitDeploy
+	return nil
+}
+
+// ListByGitDeploy returns the apps configured to be deployed on pushes to the
+// given repository and branch.
+func ListByGitDeploy(ctx context.Context, repository, branch string) ([]App, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{
+		"gitdeploy.repository": repository,
+		"gitdeploy.branch":     branch,
+	}).All(&apps)
+	if err != nil {
+		return nil, err
+	}
+	for i := range apps {
+		apps[i].ctx = ctx
+	}
+	return apps, nil
+}
+
 func (app *App) GetUpdatePlatform() bool {
 	return app.UpdatePlatform
 }
@@ -2645,6 +2838,74 @@ func (app *App) Shell(opts provision.ExecOptions) error {
 	return execProv.ExecuteCommand(app.ctx, opts)
 }
 
+// PortForward forwards a connection to a port of one of the app units.
+func (app *App) PortForward(opts provision.PortForwardOptions) error {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	forwardProv, ok := prov.(provision.PortForwardProvisioner)
+	if !ok {
+		return provision.ProvisionerNotSupported{Prov: prov, Action: "port forwarding"}
+	}
+	return forwardProv.PortForward(app.ctx, app, opts)
+}
+
+// Debug attaches a debug container running the image to one of the app
+// units, the image must be allowed by the app pool.
+func (app *App) Debug(opts provision.DebugOptions) error {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	debugProv, ok := prov.(provision.DebugProvisioner)
+	if !ok {
+		return provision.ProvisionerNotSupported{Prov: prov, Action: "debugging units"}
+	}
+	p, err := pool.GetPoolByName(app.ctx, app.GetPool())
+	if err != nil {
+		return err
+	}
+	allowed, err := p.AllowsDebugImage(opts.Image)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errors.Errorf("debug image %q is not allowed in pool %q", opts.Image, p.Name)
+	}
+	return debugProv.Debug(app.ctx, app, opts)
+}
+
+// UploadToUnit extracts the tar stream into a path of one of the app units.
+func (app *App) UploadToUnit(opts provision.UnitFileCopyOptions, tarStream io.Reader) error {
+	copyProv, err := app.fileCopyProvisioner()
+	if err != nil {
+		return err
+	}
+	return copyProv.UploadToUnit(app.ctx, app, opts, tarStream)
+}
+
+// DownloadFromUnit writes a path of one of the app units as a tar stream.
+func (app *App) DownloadFromUnit(opts provision.UnitFileCopyOptions, tarStream io.Writer) error {
+	copyProv, err := app.fileCopyProvisioner()
+	if err != nil {
+		return err
+	}
+	return copyProv.DownloadFromUnit(app.ctx, app, opts, tarStream)
+}
+
+func (app *App) fileCopyProvisioner() (provision.UnitFileCopyProvisioner, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	copyProv, ok := prov.(provision.UnitFileCopyProvisioner)
+	if !ok {
+		return nil, provision.ProvisionerNotSupported{Prov: prov, Action: "copying files"}
+	}
+	return copyProv, nil
+}
+
 func (app *App) SetCertificate(name, certificate, key string) error {
 	err := app.validateNameForCert(name)
 	if err != nil {
@@ -2968,6 +3229,63 @@ func (app *App) VerticalAutoScaleRecommendations() ([]provision.RecommendedResou
 	return autoscaleProv.GetVerticalAutoScaleRecommendations(app.ctx, app)
 }
 
+// NetworkPolicy returns the network policy enforced for the app units, it
+// returns nil when the app provisioner does not isolate the app traffic.
+func (app *App) NetworkPolicy() (*provisionTypes.EffectiveNetworkPolicy, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	networkProv, ok := prov.(provision.NetworkPolicyProvisioner)
+	if !ok {
+		return nil, nil
+	}
+	return networkProv.NetworkPolicy(app.ctx, app)
+}
+
+// EnsurePoolNetworkPolicies reconciles the network policies of the apps in the
+// pool, it must be called when the default network policy of the pool changes
+// so running apps don't wait for their next deploy to be isolated.
+func EnsurePoolNetworkPolicies(ctx context.Context, pool string) error {
+	apps, err := List(ctx, &Filter{Pool: pool})
+	if err != nil {
+		return err
+	}
+	multi := tsuruErrors.NewMultiError()
+	for i := range apps {
+		a := &apps[i]
+		prov, err := a.getProvisioner()
+		if err != nil {
+			multi.Add(err)
+			continue
+		}
+		networkProv, ok := prov.(provision.NetworkPolicyProvisioner)
+		if !ok {
+			continue
+		}
+		err = networkProv.EnsureNetworkPolicy(ctx, a)
+		if err != nil {
+			multi.Add(errors.Wrapf(err, "unable to update the network policy of app %s", a.Name))
+		}
+	}
+	return multi.ToError()
+}
+
+// Drift returns the changes made to the app resources outside of tsuru, as
+// the changes needed to bring them back to their expected state. It returns
+// nil when the app provisioner does not support drift detection.
+func (app *App) Drift() ([]provision.ManifestChange, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	driftProv, ok := prov.(provision.DriftProvisioner)
+	if !ok {
+		return nil, nil
+	}
+	return driftProv.Drift(app.ctx, app)
+}
+
 func (app *App) UnitsMetrics() ([]provision.UnitMetric, error) {
 	prov, err := app.getProvisioner()
 	if err != nil {
@@ -2989,6 +3307,10 @@ func (app *App) AutoScale(spec provision.AutoScaleSpec) error {
 	if !ok {
 		return errors.Errorf("provisioner %q does not support native autoscaling", prov.GetName())
 	}
+	err = checkTeamResourceQuotaChange(app.ctx, app, app, appResourcesOpts{autoScale: &spec})
+	if err != nil {
+		return err
+	}
 	return autoscaleProv.SetAutoScale(app.ctx, app, spec)
 }
 
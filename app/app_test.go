@@ -4523,6 +4523,48 @@ func (s *S) TestAppSetUpdatePlatform(c *check.C) {
 	c.Assert(app.UpdatePlatform, check.Equals, true)
 }
 
+func (s *S) TestAppSetGitDeploy(c *check.C) {
+	a := App{Name: "someapp", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	gitDeploy := appTypes.GitDeploy{Repository: "tsuru/someapp", Branch: "main", Secret: "abc"}
+	err = a.SetGitDeploy(gitDeploy)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GitDeploy, check.DeepEquals, gitDeploy)
+	err = a.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/someapp"})
+	c.Assert(err, check.ErrorMatches, "branch and secret are required to enable git deploys")
+	err = a.SetGitDeploy(appTypes.GitDeploy{})
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GitDeploy, check.DeepEquals, appTypes.GitDeploy{})
+}
+
+func (s *S) TestListByGitDeploy(c *check.C) {
+	a1 := App{Name: "app1", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "app2", Platform: "django", TeamOwner: s.team.Name}
+	err = CreateApp(context.TODO(), &a2, s.user)
+	c.Assert(err, check.IsNil)
+	a3 := App{Name: "app3", Platform: "django", TeamOwner: s.team.Name}
+	err = CreateApp(context.TODO(), &a3, s.user)
+	c.Assert(err, check.IsNil)
+	err = a1.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/app", Branch: "main", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	err = a2.SetGitDeploy(appTypes.GitDeploy{Repository: "tsuru/app", Branch: "staging", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	apps, err := ListByGitDeploy(context.TODO(), "tsuru/app", "main")
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, "app1")
+	apps, err = ListByGitDeploy(context.TODO(), "tsuru/other", "main")
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 0)
+}
+
 func (s *S) TestAppRegisterUnit(c *check.C) {
 	a := App{Name: "app-name", Platform: "python", TeamOwner: s.team.Name}
 	err := CreateApp(context.TODO(), &a, s.user)
@@ -5063,6 +5105,34 @@ func (s *S) TestUpdateDescription(c *check.C) {
 	c.Assert(dbApp.Description, check.Equals, "bleble")
 }
 
+func (s *S) TestDryRunUpdate(c *check.C) {
+	a := App{Name: "example", Platform: "python", TeamOwner: s.team.Name, Description: "blabla"}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		Processes: map[string][]string{"web": {"python web.py"}},
+	})
+	c.Assert(err, check.IsNil)
+	updateData := App{
+		Description: "bleble",
+		Metadata: appTypes.Metadata{
+			Annotations: []appTypes.MetadataItem{{Name: "a", Value: "b"}},
+		},
+	}
+	changes, err := a.DryRunUpdate(UpdateAppArgs{UpdateData: updateData})
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []provision.ManifestChange{
+		{Kind: "Deployment", Name: "example-web", Operation: provision.ManifestUpdate},
+	})
+	c.Assert(a.Description, check.Equals, "blabla")
+	c.Assert(a.Metadata, check.DeepEquals, appTypes.Metadata{})
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Description, check.Equals, "blabla")
+	c.Assert(dbApp.Metadata, check.DeepEquals, appTypes.Metadata{})
+}
+
 func (s *S) TestUpdateAppPlatform(c *check.C) {
 	app := App{Name: "example", Platform: "python", TeamOwner: s.team.Name}
 	err := CreateApp(context.TODO(), &app, s.user)
@@ -5147,6 +5217,49 @@ func (s *S) TestUpdatePool(c *check.C) {
 	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 1)
 }
 
+func (s *S) TestUpdatePoolUnpinsCluster(c *check.C) {
+	opts := pool.AddPoolOptions{Name: "test"}
+	err := pool.AddPool(context.TODO(), opts)
+	c.Assert(err, check.IsNil)
+	err = pool.AddTeamsToPool("test", []string{s.team.Name})
+	c.Assert(err, check.IsNil)
+	opts = pool.AddPoolOptions{Name: "test2"}
+	err = pool.AddPool(context.TODO(), opts)
+	c.Assert(err, check.IsNil)
+	err = pool.AddTeamsToPool("test2", []string{s.team.Name})
+	c.Assert(err, check.IsNil)
+	app := App{Name: "test", TeamOwner: s.team.Name, Pool: "test"}
+	err = CreateApp(context.TODO(), &app, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &app)
+	app.Cluster = "c1"
+	err = app.Update(UpdateAppArgs{UpdateData: App{Description: "pinned"}, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(context.TODO(), app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Cluster, check.Equals, "c1")
+	err = dbApp.Update(UpdateAppArgs{UpdateData: App{Pool: "test2"}, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(context.TODO(), app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Pool, check.Equals, "test2")
+	c.Assert(dbApp.Cluster, check.Equals, "")
+}
+
+func (s *S) TestUpdatePoolDuringMigration(c *check.C) {
+	opts := pool.AddPoolOptions{Name: "test2"}
+	err := pool.AddPool(context.TODO(), opts)
+	c.Assert(err, check.IsNil)
+	err = pool.AddTeamsToPool("test2", []string{s.team.Name})
+	c.Assert(err, check.IsNil)
+	app := App{Name: "test", TeamOwner: s.team.Name, Pool: s.Pool}
+	err = CreateApp(context.TODO(), &app, s.user)
+	c.Assert(err, check.IsNil)
+	app.Migration = &ClusterMigration{SourcePool: s.Pool, DestinationPool: s.Pool, DestinationCluster: "c2"}
+	err = app.Update(UpdateAppArgs{UpdateData: App{Pool: "test2"}, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.ErrorMatches, `app has an unfinished migration to cluster "c2", the pool can't be changed`)
+}
+
 func (s *S) TestUpdatePoolOtherProv(c *check.C) {
 	p1 := provisiontest.NewFakeProvisioner()
 	p2 := provisiontest.NewFakeProvisioner()
@@ -5316,6 +5429,31 @@ func (s *S) TestUpdatePlan(c *check.C) {
 	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 0)
 }
 
+func (s *S) TestUpdateProcessPlanOverrideUnknownProcess(c *check.C) {
+	a := App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{Processes: map[string][]string{"web": {"python app.py"}}})
+	c.Assert(err, check.IsNil)
+	memory := int64(1024)
+	updateData := App{Plan: appTypes.Plan{ProcessOverride: map[string]appTypes.PlanOverride{
+		"wokrer": {Memory: &memory},
+	}}}
+	err = a.Update(UpdateAppArgs{UpdateData: updateData, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.ErrorMatches, `process "wokrer" not found in the app Procfile`)
+	updateData.Plan.ProcessOverride = map[string]appTypes.PlanOverride{"web": {Memory: &memory}}
+	err = a.Update(UpdateAppArgs{UpdateData: updateData, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GetProcessMemory("web"), check.Equals, memory)
+	zero := int64(0)
+	updateData.Plan.ProcessOverride = map[string]appTypes.PlanOverride{"wokrer": {Memory: &zero}}
+	err = a.Update(UpdateAppArgs{UpdateData: updateData, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.IsNil)
+}
+
 func (s *S) TestUpdatePlanShouldRestart(c *check.C) {
 	s.plan = appTypes.Plan{Name: "something", CpuShare: 100, Memory: 268435456}
 	a := App{Name: "my-test-app", Routers: []appTypes.AppRouter{{Name: "fake"}}, Plan: appTypes.Plan{Memory: 536870912, CpuShare: 50}, TeamOwner: s.team.Name}
@@ -16,6 +16,7 @@ import (
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tsuru/tsuru/builder"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/event"
@@ -28,6 +29,7 @@ import (
 	"github.com/tsuru/tsuru/set"
 	appTypes "github.com/tsuru/tsuru/types/app"
 	permTypes "github.com/tsuru/tsuru/types/permission"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 )
 
 type DeployKind string
@@ -41,10 +43,21 @@ const (
 	DeployUpload       DeployKind = "upload"
 	DeployUploadBuild  DeployKind = "uploadbuild"
 	DeployRebuild      DeployKind = "rebuild"
+	DeployPromote      DeployKind = "promote"
 )
 
 var reImageVersion = regexp.MustCompile(":v([0-9]+)$")
 
+var deployPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "tsuru_deploy_phase_duration_seconds",
+	Help:    "The duration of each deploy phase in seconds.",
+	Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+}, []string{"phase", "pool", "cluster"})
+
+func init() {
+	prometheus.MustRegister(deployPhaseDuration)
+}
+
 type DeployData struct {
 	ID          bson.ObjectId `bson:"_id,omitempty"`
 	App         string
@@ -60,6 +73,7 @@ type DeployData struct {
 	CanRollback bool
 	Diff        string
 	Message     string
+	Phases      []event.Phase `bson:"-"`
 }
 
 func findValidImages(ctx context.Context, appNames []string) (set.Set, error) {
@@ -155,9 +169,13 @@ func eventToDeployData(evt *event.Event, validImages set.Set, full bool) *Deploy
 	}
 	if full {
 		data.Log = evt.Log()
-		var otherData map[string]string
+		var otherData struct {
+			Diff   string
+			Phases []event.Phase
+		}
 		if err = evt.OtherData(&otherData); err == nil {
-			data.Diff = otherData["diff"]
+			data.Diff = otherData.Diff
+			data.Phases = otherData.Phases
 		} else {
 			log.Errorf("cannot decode the event's other custom data value: event %s - %v", evt.UniqueID, err)
 		}
@@ -196,6 +214,10 @@ type DeployOptions struct {
 	Build            bool
 	NewVersion       bool
 	OverrideVersions bool
+	SourceApp        string
+	SourceVersion    string
+	Pipeline         string
+	ApprovedBy       string
 }
 
 func (o *DeployOptions) GetOrigin() string {
@@ -212,6 +234,9 @@ func (o *DeployOptions) GetKind() (kind DeployKind) {
 	defer func() {
 		o.Kind = kind
 	}()
+	if o.SourceApp != "" {
+		return DeployPromote
+	}
 	if o.Rollback {
 		return DeployRollback
 	}
@@ -344,8 +369,18 @@ func Deploy(ctx context.Context, opts DeployOptions) (string, error) {
 	logWriter.Async()
 	defer logWriter.Close()
 	opts.Event.SetLogWriter(io.MultiWriter(&tsuruIo.NoErrorWriter{Writer: opts.OutputStream}, &logWriter))
+	if opts.App.VerticalAutoScaleMode() == VPAApplyOnDeploy {
+		_, vpaErr := opts.App.ApplyVerticalAutoScaleRecommendations(opts.Event)
+		if vpaErr != nil {
+			log.Errorf("unable to apply vertical autoscaling recommendations to app %q: %v", opts.App.Name, vpaErr)
+			fmt.Fprintf(opts.Event, "WARNING: unable to apply vertical autoscaling recommendations: %v\n", vpaErr)
+		}
+	}
 	imageID, err := deployToProvisioner(ctx, &opts, opts.Event)
+	endRouterUpdate := opts.Event.StartPhase(provision.DeployPhaseRouterUpdate)
 	rebuild.RoutesRebuildOrEnqueueWithProgress(opts.App.Name, opts.Event)
+	endRouterUpdate(nil)
+	observeDeployPhases(ctx, opts.App, opts.Event)
 	if err != nil {
 		return "", newErrorWithLog(err, opts.App, "deploy")
 	}
@@ -353,7 +388,7 @@ func Deploy(ctx context.Context, opts DeployOptions) (string, error) {
 	if err != nil {
 		log.Errorf("WARNING: couldn't increment deploy count, deploy opts: %#v", opts)
 	}
-	if opts.Kind == DeployImage || opts.Kind == DeployRollback {
+	if opts.Kind == DeployImage || opts.Kind == DeployRollback || opts.Kind == DeployPromote {
 		if !opts.App.UpdatePlatform {
 			opts.App.SetUpdatePlatform(true)
 		}
@@ -363,6 +398,21 @@ func Deploy(ctx context.Context, opts DeployOptions) (string, error) {
 	return imageID, nil
 }
 
+func observeDeployPhases(ctx context.Context, app *App, evt *event.Event) {
+	clusterName := app.Cluster
+	if prov, err := app.getProvisioner(); err == nil && clusterName == "" {
+		if cluster, err := servicemanager.Cluster.FindByPool(ctx, prov.GetName(), app.Pool); err == nil {
+			clusterName = cluster.Name
+		}
+	}
+	for _, phase := range evt.Phases() {
+		if phase.EndTime.IsZero() {
+			continue
+		}
+		deployPhaseDuration.WithLabelValues(phase.Name, app.Pool, clusterName).Observe(phase.Duration().Seconds())
+	}
+}
+
 func RollbackUpdate(ctx context.Context, app *App, imageID, reason string, disableRollback bool) error {
 	version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, app, imageID)
 	if err != nil {
@@ -379,8 +429,8 @@ func deployToProvisioner(ctx context.Context, opts *DeployOptions, evt *event.Ev
 	if opts.Kind == "" {
 		opts.GetKind()
 	}
-	if opts.App.GetPlatform() == "" && opts.Kind != DeployImage && opts.Kind != DeployRollback {
-		return "", errors.Errorf("can't deploy app without platform, if it's not an image or rollback")
+	if opts.App.GetPlatform() == "" && opts.Kind != DeployImage && opts.Kind != DeployRollback && opts.Kind != DeployPromote {
+		return "", errors.Errorf("can't deploy app without platform, if it's not an image, rollback or promotion")
 	}
 
 	deployer, ok := prov.(provision.BuilderDeploy)
@@ -400,12 +450,21 @@ func deployToProvisioner(ctx context.Context, opts *DeployOptions, evt *event.Ev
 		} else if versionInfo.Disabled {
 			return "", errors.Errorf("the selected version is disabled for rollback: %s", version.VersionInfo().DisabledReason)
 		}
+	} else if opts.Kind == DeployPromote {
+		version, err = promoteDeploy(ctx, deployer, opts, evt)
+		if err != nil {
+			return "", err
+		}
 	} else {
 		version, err = builderDeploy(ctx, deployer, opts, evt)
 		if err != nil {
 			return "", err
 		}
 	}
+	err = checkDeployResourceQuota(ctx, opts, version)
+	if err != nil {
+		return "", err
+	}
 	return deployer.Deploy(ctx, provision.DeployArgs{
 		App:              opts.App,
 		Version:          version,
@@ -415,6 +474,58 @@ func deployToProvisioner(ctx context.Context, opts *DeployOptions, evt *event.Ev
 	})
 }
 
+// checkDeployResourceQuota verifies the team quota allows the units of the
+// version being deployed. Deploys of a new version keep the units of the
+// current versions, other deploys replace them.
+func checkDeployResourceQuota(ctx context.Context, opts *DeployOptions, version appTypes.AppVersion) error {
+	current := opts.App
+	if opts.NewVersion {
+		current = nil
+	}
+	return checkTeamResourceQuotaChange(ctx, current, opts.App, appResourcesOpts{deploy: version})
+}
+
+// DryRunDeploy returns the changes that deploying a version would apply to
+// the provisioner resources of the app, without applying them. Only versions
+// already built can be deployed in a dry-run, opts.Image selects the version
+// and defaults to the latest successful version of the app.
+func DryRunDeploy(ctx context.Context, opts DeployOptions) ([]provision.ManifestChange, error) {
+	err := validateVersions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	args := provision.DeployArgs{
+		App:              opts.App,
+		PreserveVersions: opts.NewVersion,
+		OverrideVersions: opts.OverrideVersions,
+	}
+	if opts.Image != "" {
+		args.Version, err = servicemanager.AppVersion.VersionByImageOrVersion(ctx, opts.App, opts.Image)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dryRun(ctx, opts.App, args)
+}
+
+func dryRun(ctx context.Context, app *App, args provision.DeployArgs) ([]provision.ManifestChange, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	dryRunProv, ok := prov.(provision.DryRunProvisioner)
+	if !ok {
+		return nil, provision.ProvisionerNotSupported{Prov: prov, Action: "dry-run"}
+	}
+	if args.Version == nil {
+		args.Version, err = servicemanager.AppVersion.LatestSuccessfulVersion(ctx, app)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dryRunProv.DryRun(ctx, args)
+}
+
 func builderDeploy(ctx context.Context, prov provision.BuilderDeploy, opts *DeployOptions, evt *event.Event) (appTypes.AppVersion, error) {
 	isRebuild := opts.Kind == DeployRebuild
 	buildOpts := builder.BuildOpts{
@@ -438,8 +549,80 @@ func builderDeploy(ctx context.Context, prov provision.BuilderDeploy, opts *Depl
 	return version, err
 }
 
+// promoteDeploy creates a new version on the target app using the image,
+// processes and tsuru.yaml data from a version of the source app. The image is
+// tagged and pushed to the registry of the target app, no rebuild from source
+// is done.
+func promoteDeploy(ctx context.Context, prov provision.BuilderDeploy, opts *DeployOptions, evt *event.Event) (appTypes.AppVersion, error) {
+	if opts.SourceApp == opts.App.Name {
+		return nil, errors.New("cannot promote a version to the same app, use rollback instead")
+	}
+	source, err := GetByName(ctx, opts.SourceApp)
+	if err != nil {
+		return nil, err
+	}
+	sourceVersion, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, source, opts.SourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	sourceInfo := sourceVersion.VersionInfo()
+	if sourceInfo.MarkedToRemoval {
+		return nil, appTypes.ErrVersionMarkedToRemoval
+	}
+	if !sourceInfo.DeploySuccessful || sourceInfo.DeployImage == "" {
+		return nil, errors.Errorf("version %d of app %q was not successfully deployed", sourceInfo.Version, source.Name)
+	}
+	yamlData, err := sourceVersion.TsuruYamlData()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(evt, "---- Promoting version %d of app %q (%s) ----\n", sourceInfo.Version, source.Name, sourceInfo.DeployImage)
+	buildOpts := builder.BuildOpts{
+		ImageID: sourceInfo.DeployImage,
+		Message: opts.Message,
+		Provenance: &appTypes.AppVersionProvenance{
+			App:     source.Name,
+			Version: sourceInfo.Version,
+		},
+	}
+	appBuilder, err := opts.App.getBuilder()
+	if err != nil {
+		return nil, err
+	}
+	version, err := appBuilder.Build(ctx, prov, opts.App, evt, &buildOpts)
+	if err != nil {
+		return nil, err
+	}
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		Processes:    sourceInfo.Processes,
+		CustomData:   promotedCustomData(sourceInfo.CustomData, yamlData),
+		ExposedPorts: sourceInfo.ExposedPorts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// promotedCustomData rebuilds the raw custom data of a version from its
+// stored form, as the tsuru.yaml entries are kept in a storage specific
+// format.
+func promotedCustomData(stored map[string]interface{}, yamlData provTypes.TsuruYamlData) map[string]interface{} {
+	if len(stored) == 0 {
+		return nil
+	}
+	customData := make(map[string]interface{}, len(stored))
+	for k, v := range stored {
+		customData[k] = v
+	}
+	customData["hooks"] = yamlData.Hooks
+	customData["healthcheck"] = yamlData.Healthcheck
+	customData["kubernetes"] = yamlData.Kubernetes
+	return customData
+}
+
 func ValidateOrigin(origin string) bool {
-	originList := []string{"app-deploy", "git", "rollback", "drag-and-drop", "image", "rebuild"}
+	originList := []string{"app-deploy", "git", "rollback", "drag-and-drop", "image", "rebuild", "promote"}
 	for _, ol := range originList {
 		if ol == origin {
 			return true
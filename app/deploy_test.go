@@ -16,7 +16,9 @@ import (
 
 	"github.com/globalsign/mgo/bson"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/builder"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
@@ -293,6 +295,65 @@ func (s *S) TestGetDeployInvalidHex(c *check.C) {
 	c.Assert(lastDeploy, check.IsNil)
 }
 
+func (s *S) TestDeployAppRecordsPhases(c *check.C) {
+	a := App{
+		Name:      "some-app",
+		Platform:  "django",
+		Teams:     []string{s.team.Name},
+		TeamOwner: s.team.Name,
+		Router:    "fake",
+	}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	observedBefore := deployPhaseObservations(c, provision.DeployPhaseRouterUpdate)
+	buf := strings.NewReader("my file")
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(context.TODO(), DeployOptions{
+		App:          &a,
+		File:         ioutil.NopCloser(buf),
+		FileSize:     int64(buf.Len()),
+		OutputStream: &bytes.Buffer{},
+		Event:        evt,
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	deploy, err := GetDeploy(evt.UniqueID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(deploy.Phases, check.HasLen, 1)
+	c.Assert(deploy.Phases[0].Name, check.Equals, provision.DeployPhaseRouterUpdate)
+	c.Assert(deploy.Phases[0].Error, check.Equals, "")
+	c.Assert(deploy.Phases[0].EndTime.IsZero(), check.Equals, false)
+	c.Assert(deploy.Phases[0].EndTime.Before(deploy.Phases[0].StartTime), check.Equals, false)
+	c.Assert(deployPhaseObservations(c, provision.DeployPhaseRouterUpdate), check.Equals, observedBefore+1)
+}
+
+// deployPhaseObservations returns how many durations of the phase were
+// observed, in any pool or cluster.
+func deployPhaseObservations(c *check.C, phase string) uint64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(deployPhaseDuration)
+	families, err := registry.Gather()
+	c.Assert(err, check.IsNil)
+	var count uint64
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "phase" && label.GetValue() == phase {
+					count += m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return count
+}
+
 func (s *S) TestBuildApp(c *check.C) {
 	a := App{
 		Name:      "some-app",
@@ -1037,6 +1098,98 @@ func (s *S) TestRollbackWithVersionMarkedToRemoved(c *check.C) {
 	c.Assert(err, check.Equals, appTypes.ErrVersionMarkedToRemoval)
 }
 
+func (s *S) TestDeployPromote(c *check.C) {
+	source := App{Name: "myapp-staging", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
+	err := CreateApp(context.TODO(), &source, s.user)
+	c.Assert(err, check.IsNil)
+	sourceVersion := newSuccessfulAppVersion(c, &source)
+	err = sourceVersion.AddData(appTypes.AddVersionDataArgs{
+		Processes: map[string][]string{"web": {"./run.sh"}, "worker": {"./worker.sh"}},
+		CustomData: map[string]interface{}{
+			"healthcheck": map[string]interface{}{"path": "/healthcheck"},
+			"mykey":       "myvalue",
+		},
+		ExposedPorts: []string{"8080/tcp"},
+	})
+	c.Assert(err, check.IsNil)
+	err = servicemanager.AppVersion.SetVersionChannel(context.TODO(), &source, "approved-by-qa", sourceVersion.Version())
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
+	err = CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	var buildOpts *builder.BuildOpts
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
+		buildOpts = opts
+		version, err := servicemanager.AppVersion.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{
+			App:        app,
+			Provenance: opts.Provenance,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return version, version.CommitBaseImage()
+	}
+	writer := &bytes.Buffer{}
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	imgID, err := Deploy(context.TODO(), DeployOptions{
+		App:           &a,
+		OutputStream:  writer,
+		SourceApp:     source.Name,
+		SourceVersion: "approved-by-qa",
+		Event:         evt,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(writer.String(), check.Matches, `(?s).*Promoting version 1 of app "myapp-staging".*Builder deploy called.*`)
+	c.Assert(buildOpts.ImageID, check.Equals, "tsuru/app-myapp-staging:v1")
+	version, err := servicemanager.AppVersion.LatestSuccessfulVersion(context.TODO(), &a)
+	c.Assert(err, check.IsNil)
+	info := version.VersionInfo()
+	c.Assert(info.Provenance, check.DeepEquals, &appTypes.AppVersionProvenance{App: "myapp-staging", Version: 1})
+	c.Assert(info.Processes, check.DeepEquals, map[string][]string{"web": {"./run.sh"}, "worker": {"./worker.sh"}})
+	c.Assert(info.ExposedPorts, check.DeepEquals, []string{"8080/tcp"})
+	c.Assert(info.CustomData["mykey"], check.Equals, "myvalue")
+	yamlData, err := version.TsuruYamlData()
+	c.Assert(err, check.IsNil)
+	c.Assert(yamlData.Healthcheck.Path, check.Equals, "/healthcheck")
+}
+
+func (s *S) TestDeployPromoteUnsuccessfulVersion(c *check.C) {
+	source := App{Name: "myapp-staging", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
+	err := CreateApp(context.TODO(), &source, s.user)
+	c.Assert(err, check.IsNil)
+	version, err := servicemanager.AppVersion.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{
+		App: &source,
+	})
+	c.Assert(err, check.IsNil)
+	err = version.CommitBaseImage()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
+	err = CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(context.TODO(), DeployOptions{
+		App:           &a,
+		OutputStream:  &bytes.Buffer{},
+		SourceApp:     source.Name,
+		SourceVersion: "1",
+		Event:         evt,
+	})
+	c.Assert(err, check.ErrorMatches, `(?s).*version 1 of app "myapp-staging" was not successfully deployed.*`)
+}
+
 func (s *S) TestDeployKind(c *check.C) {
 	var tests = []struct {
 		input    DeployOptions
@@ -1046,6 +1199,10 @@ func (s *S) TestDeployKind(c *check.C) {
 			DeployOptions{Rollback: true},
 			DeployRollback,
 		},
+		{
+			DeployOptions{SourceApp: "staging", SourceVersion: "stable"},
+			DeployPromote,
+		},
 		{
 			DeployOptions{Image: "quay.io/tsuru/python"},
 			DeployImage,
@@ -1155,6 +1312,28 @@ func (s *S) TestRebuild(c *check.C) {
 	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-otherapp:v1")
 }
 
+func (s *S) TestDryRunDeploy(c *check.C) {
+	a := App{Name: "otherapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = DryRunDeploy(context.TODO(), DeployOptions{App: &a})
+	c.Assert(err, check.Equals, appTypes.ErrNoVersionsAvailable)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		Processes: map[string][]string{"web": {"python web.py"}, "worker": {"python worker.py"}},
+	})
+	c.Assert(err, check.IsNil)
+	changes, err := DryRunDeploy(context.TODO(), DeployOptions{App: &a})
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []provision.ManifestChange{
+		{Kind: "Deployment", Name: "otherapp-web", Operation: provision.ManifestUpdate},
+		{Kind: "Deployment", Name: "otherapp-worker", Operation: provision.ManifestUpdate},
+	})
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 0)
+	_, err = DryRunDeploy(context.TODO(), DeployOptions{App: &a, Image: "v9"})
+	c.Assert(err, check.NotNil)
+}
+
 func (s *S) TestRollbackUpdate(c *check.C) {
 	app := App{
 		Name:      "myapp",
@@ -427,7 +427,7 @@ func sweepOldImages() error {
 			continue
 		}
 		for _, version := range appVersions.Versions {
-			if !version.MarkedToRemoval {
+			if !version.MarkedToRemoval || appVersions.IsReferencedByChannel(version.Version) {
 				continue
 			}
 			versionsToRemove[appVersions.AppName] = append(versionsToRemove[appVersions.AppName], version)
@@ -482,7 +482,9 @@ func selectAppVersions(versions appTypes.AppVersions, deployedVersions []int, hi
 	var regularVersions, customTagVersions []appTypes.AppVersionInfo
 	selection := &appVersionsSelection{}
 	for _, v := range versions.Versions {
-		if v.MarkedToRemoval {
+		if v.MarkedToRemoval || versions.IsReferencedByChannel(v.Version) {
+			// versions pointed by a channel are kept untouched, they are
+			// expected to be deployed or rolled back to at any time.
 			continue
 		} else if v.CustomBuildTag != "" {
 			customTagVersions = append(customTagVersions, v)
@@ -909,6 +909,35 @@ func (s *S) TestSelectAppVersions(c *check.C) {
 			expectedVersionsToPruneFromProvisioner: []int{100},
 			expectedUnsuccessfulDeployments:        []int{},
 		},
+
+		{
+			explanation: "must never touch versions referenced by channels",
+			historySize: 5,
+			appVersions: func() appTypes.AppVersions {
+				appVersions := appTypes.AppVersions{
+					LastSuccessfulVersion: 10,
+					Versions:              map[int]appTypes.AppVersionInfo{},
+					Channels: map[string]int{
+						"stable":    2,
+						"candidate": 7,
+						"broken":    11,
+					},
+				}
+
+				for i := 11; i > 0; i-- {
+					appVersions.Versions[i] = appTypes.AppVersionInfo{
+						Version:          i,
+						DeploySuccessful: i != 11,
+						UpdatedAt:        now.Add(time.Minute * time.Duration(i)),
+					}
+				}
+
+				return appVersions
+			},
+			expectedVersionsToRemove:               []int{4, 3, 1},
+			expectedVersionsToPruneFromProvisioner: []int{9, 8, 6, 5},
+			expectedUnsuccessfulDeployments:        []int{},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -0,0 +1,465 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/servicemanager"
+	provisionTypes "github.com/tsuru/tsuru/types/provision"
+)
+
+var (
+	// MigrationReadyTimeout is how long a cluster migration waits for the
+	// units of the app to become ready in the destination cluster.
+	MigrationReadyTimeout = 10 * time.Minute
+
+	migrationPollInterval = 5 * time.Second
+)
+
+// ClusterMigration holds the state of an app being moved between clusters.
+// Steps keeps the name of the completed steps, so an interrupted migration
+// is resumed from where it stopped.
+type ClusterMigration struct {
+	SourcePool         string    `json:"sourcePool"`
+	SourceCluster      string    `json:"sourceCluster"`
+	DestinationPool    string    `json:"destinationPool"`
+	DestinationCluster string    `json:"destinationCluster"`
+	Steps              []string  `json:"steps"`
+	StartTime          time.Time `json:"startTime"`
+}
+
+func (m *ClusterMigration) done(step string) bool {
+	for _, s := range m.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateClusterOptions selects where an app is migrated to, an empty Pool
+// keeps the app in its current pool.
+type MigrateClusterOptions struct {
+	Pool    string
+	Cluster string
+}
+
+// MigrateCluster moves the app to another cluster, provisioning and
+// deploying it in the destination cluster before switching its routes and
+// removing it from the source cluster. Calling it again for an app with an
+// unfinished migration resumes the migration.
+func (app *App) MigrateCluster(ctx context.Context, opts MigrateClusterOptions, w io.Writer) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	migration := app.Migration
+	if migration == nil {
+		var err error
+		migration, err = app.newClusterMigration(ctx, opts)
+		if err != nil {
+			return err
+		}
+		err = app.setMigration(migration)
+		if err != nil {
+			return err
+		}
+	} else {
+		if (opts.Cluster != "" && opts.Cluster != migration.DestinationCluster) ||
+			(opts.Pool != "" && opts.Pool != migration.DestinationPool) {
+			return &tsuruErrors.ValidationError{
+				Message: fmt.Sprintf("app has an unfinished migration to cluster %q in pool %q", migration.DestinationCluster, migration.DestinationPool),
+			}
+		}
+		fmt.Fprintf(w, "---- Resuming migration to cluster %q ----\n", migration.DestinationCluster)
+	}
+	app.Migration = migration
+	err := action.NewPipeline(
+		&migrateProvisionDestination,
+		&migrateDeployDestination,
+		&migrateWaitDestination,
+		&migrateSwitchRoutes,
+		&migrateCleanupSource,
+	).Execute(ctx, app, w)
+	if err != nil {
+		return newErrorWithLog(err, app, "migrate cluster")
+	}
+	err = app.setMigration(nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "---- App migrated to cluster %q ----\n", migration.DestinationCluster)
+	return nil
+}
+
+func (app *App) newClusterMigration(ctx context.Context, opts MigrateClusterOptions) (*ClusterMigration, error) {
+	if opts.Cluster == "" {
+		return nil, &tsuruErrors.ValidationError{Message: "destination cluster is required"}
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	sourceCluster := app.Cluster
+	if sourceCluster == "" {
+		cluster, err := servicemanager.Cluster.FindByPool(ctx, prov.GetName(), app.Pool)
+		if err != nil {
+			if err == provisionTypes.ErrNoCluster {
+				return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("app runs in no cluster of provisioner %q", prov.GetName())}
+			}
+			return nil, err
+		}
+		sourceCluster = cluster.Name
+	}
+	if opts.Cluster == sourceCluster {
+		return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("app already runs in cluster %q", sourceCluster)}
+	}
+	destCluster, err := servicemanager.Cluster.FindByName(ctx, opts.Cluster)
+	if err != nil {
+		if err == provisionTypes.ErrClusterNotFound {
+			return nil, &tsuruErrors.ValidationError{Message: err.Error()}
+		}
+		return nil, err
+	}
+	if destCluster.Provisioner != prov.GetName() {
+		return nil, &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("cluster %q uses provisioner %q, app uses provisioner %q", destCluster.Name, destCluster.Provisioner, prov.GetName()),
+		}
+	}
+	destPool := opts.Pool
+	if destPool == "" {
+		destPool = app.Pool
+	}
+	if destPool != app.Pool {
+		destApp := *app
+		destApp.Pool = destPool
+		destApp.provisioner = nil
+		err = destApp.validatePool()
+		if err != nil {
+			return nil, err
+		}
+		destProv, err := pool.GetProvisionerForPool(ctx, destPool)
+		if err != nil {
+			return nil, err
+		}
+		if destProv.GetName() != prov.GetName() {
+			return nil, &tsuruErrors.ValidationError{
+				Message: fmt.Sprintf("pool %q uses provisioner %q, app uses provisioner %q", destPool, destProv.GetName(), prov.GetName()),
+			}
+		}
+	}
+	volumes, err := servicemanager.Volume.ListByApp(ctx, app.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) > 0 {
+		return nil, &tsuruErrors.ValidationError{Message: "can't migrate an app with binded volumes"}
+	}
+	return &ClusterMigration{
+		SourcePool:         app.Pool,
+		SourceCluster:      sourceCluster,
+		DestinationPool:    destPool,
+		DestinationCluster: destCluster.Name,
+		StartTime:          time.Now().UTC(),
+	}, nil
+}
+
+func (app *App) setMigration(migration *ClusterMigration) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$unset": bson.M{"migration": ""}}
+	if migration != nil {
+		update = bson.M{"$set": bson.M{"migration": migration}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.Migration = migration
+	return nil
+}
+
+// migrationSource returns a copy of the app pinned to the cluster it's being
+// migrated from.
+func (app *App) migrationSource() *App {
+	source := *app
+	source.Pool = app.Migration.SourcePool
+	source.Cluster = app.Migration.SourceCluster
+	source.provisioner = nil
+	return &source
+}
+
+// migrationDestination returns a copy of the app pinned to the cluster it's
+// being migrated to.
+func (app *App) migrationDestination() *App {
+	dest := *app
+	dest.Pool = app.Migration.DestinationPool
+	dest.Cluster = app.Migration.DestinationCluster
+	dest.provisioner = nil
+	return &dest
+}
+
+// migrationStep returns an action running the step of a cluster migration
+// unless the migration of the app already completed it. Steps have no
+// backward, a failed migration is resumed instead of rolled back.
+func migrationStep(name string, step func(ctx context.Context, app *App, w io.Writer) error) action.Action {
+	return action.Action{
+		Name: name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			app, ok := ctx.Params[0].(*App)
+			if !ok {
+				return nil, errors.New("expected app ptr as first arg")
+			}
+			w, _ := ctx.Params[1].(io.Writer)
+			if app.Migration.done(name) {
+				fmt.Fprintf(w, "---- Skipping %s, already done ----\n", name)
+				return nil, nil
+			}
+			fmt.Fprintf(w, "---- Running %s ----\n", name)
+			err := step(ctx.Context, app, w)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := db.Conn()
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+			err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$push": bson.M{"migration.steps": name}})
+			if err != nil {
+				return nil, err
+			}
+			app.Migration.Steps = append(app.Migration.Steps, name)
+			return nil, nil
+		},
+		MinParams: 2,
+	}
+}
+
+type migrationUnitKey struct {
+	process string
+	version int
+}
+
+func countUnits(units []provision.Unit) map[migrationUnitKey]int {
+	count := map[migrationUnitKey]int{}
+	for _, u := range units {
+		count[migrationUnitKey{process: u.ProcessName, version: u.Version}]++
+	}
+	return count
+}
+
+var migrateProvisionDestination = migrationStep("migrate-provision-destination", func(ctx context.Context, app *App, w io.Writer) error {
+	dest := app.migrationDestination()
+	prov, err := dest.getProvisioner()
+	if err != nil {
+		return err
+	}
+	return prov.Provision(ctx, dest)
+})
+
+var migrateDeployDestination = migrationStep("migrate-deploy-destination", func(ctx context.Context, app *App, w io.Writer) error {
+	source := app.migrationSource()
+	dest := app.migrationDestination()
+	prov, err := dest.getProvisioner()
+	if err != nil {
+		return err
+	}
+	sourceUnits, err := prov.Units(ctx, source)
+	if err != nil {
+		return err
+	}
+	destUnits, err := prov.Units(ctx, dest)
+	if err != nil {
+		return err
+	}
+	// Units already added by an interrupted run of this step are discounted,
+	// so the destination ends up with as many units as the source.
+	destCount := countUnits(destUnits)
+	for key, count := range countUnits(sourceUnits) {
+		missing := count - destCount[key]
+		if missing <= 0 {
+			continue
+		}
+		version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, app, strconv.Itoa(key.version))
+		if err != nil {
+			return err
+		}
+		err = prov.AddUnits(ctx, dest, uint(missing), key.process, version, w)
+		if err != nil {
+			return err
+		}
+	}
+	stopped, err := stoppedProcesses(ctx, app, prov, source, sourceUnits)
+	if err != nil {
+		return err
+	}
+	// Stopped processes have no units to count, they're added with a single
+	// unit and stopped again. The units they had before being stopped are
+	// kept in the version and restored when they're started.
+	for _, key := range stopped {
+		version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, app, strconv.Itoa(key.version))
+		if err != nil {
+			return err
+		}
+		if destCount[key] == 0 {
+			err = prov.AddUnits(ctx, dest, 1, key.process, version, w)
+			if err != nil {
+				return err
+			}
+		}
+		err = prov.Stop(ctx, dest, key.process, version, w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+})
+
+// stoppedProcesses returns the processes of the versions deployed in the
+// source cluster without units in it.
+func stoppedProcesses(ctx context.Context, app *App, prov provision.Provisioner, source *App, sourceUnits []provision.Unit) ([]migrationUnitKey, error) {
+	versionsProv, ok := prov.(provision.VersionsProvisioner)
+	if !ok {
+		return nil, nil
+	}
+	deployed, err := versionsProv.DeployedVersions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(deployed)
+	sourceCount := countUnits(sourceUnits)
+	var stopped []migrationUnitKey
+	for _, v := range deployed {
+		version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, app, strconv.Itoa(v))
+		if err != nil {
+			return nil, err
+		}
+		processes, err := version.Processes()
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(processes))
+		for name := range processes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := migrationUnitKey{process: name, version: v}
+			if sourceCount[key] == 0 {
+				stopped = append(stopped, key)
+			}
+		}
+	}
+	return stopped, nil
+}
+
+var migrateWaitDestination = migrationStep("migrate-wait-destination", func(ctx context.Context, app *App, w io.Writer) error {
+	source := app.migrationSource()
+	dest := app.migrationDestination()
+	prov, err := dest.getProvisioner()
+	if err != nil {
+		return err
+	}
+	sourceUnits, err := prov.Units(ctx, source)
+	if err != nil {
+		return err
+	}
+	timeout := time.After(MigrationReadyTimeout)
+	for {
+		destUnits, err := prov.Units(ctx, dest)
+		if err != nil {
+			return err
+		}
+		ready := 0
+		for _, u := range destUnits {
+			if (u.Ready != nil && *u.Ready) || (u.Ready == nil && u.Available()) {
+				ready++
+			}
+		}
+		fmt.Fprintf(w, " ---> %d of %d units ready\n", ready, len(sourceUnits))
+		if ready >= len(sourceUnits) {
+			return nil
+		}
+		select {
+		case <-timeout:
+			return errors.Errorf("timeout after %v waiting for units to be ready in cluster %q", MigrationReadyTimeout, dest.Cluster)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationPollInterval):
+		}
+	}
+})
+
+var migrateSwitchRoutes = migrationStep("migrate-switch-routes", func(ctx context.Context, app *App, w io.Writer) error {
+	dest := app.migrationDestination()
+	prov, err := dest.getProvisioner()
+	if err != nil {
+		return err
+	}
+	// The app is only pinned when the destination cluster does not already
+	// serve the destination pool.
+	cluster := dest.Cluster
+	poolCluster, err := servicemanager.Cluster.FindByPool(ctx, prov.GetName(), dest.Pool)
+	if err != nil && err != provisionTypes.ErrNoCluster {
+		return err
+	}
+	if poolCluster != nil && poolCluster.Name == cluster {
+		cluster = ""
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"pool": dest.Pool, "cluster": cluster}}
+	if cluster == "" {
+		update = bson.M{"$set": bson.M{"pool": dest.Pool}, "$unset": bson.M{"cluster": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.Pool = dest.Pool
+	app.Cluster = cluster
+	app.provisioner = nil
+	_, err = rebuild.RebuildRoutes(ctx, rebuild.RebuildRoutesOpts{
+		App:    app,
+		Writer: w,
+		Wait:   true,
+	})
+	return err
+})
+
+var migrateCleanupSource = migrationStep("migrate-cleanup-source", func(ctx context.Context, app *App, w io.Writer) error {
+	source := app.migrationSource()
+	prov, err := source.getProvisioner()
+	if err != nil {
+		return err
+	}
+	err = prov.Destroy(ctx, source)
+	if errors.Cause(err) == provision.ErrAppNotProvisioned {
+		// removed by an interrupted run of this step
+		return nil
+	}
+	return err
+})
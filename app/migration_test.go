@@ -0,0 +1,272 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/tsuru/tsuru/action"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provisionTypes "github.com/tsuru/tsuru/types/provision"
+	"github.com/tsuru/tsuru/types/quota"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) setupMigrationClusters() {
+	clusters := map[string]*provisionTypes.Cluster{
+		"c1": {Name: "c1", Provisioner: "fake", Pools: []string{s.Pool}},
+		"c2": {Name: "c2", Provisioner: "fake"},
+		"c3": {Name: "c3", Provisioner: "other"},
+	}
+	s.mockService.Cluster.OnFindByName = func(name string) (*provisionTypes.Cluster, error) {
+		if c, ok := clusters[name]; ok {
+			return c, nil
+		}
+		return nil, provisionTypes.ErrClusterNotFound
+	}
+	s.mockService.Cluster.OnFindByPool = func(prov, pool string) (*provisionTypes.Cluster, error) {
+		if pool == s.Pool {
+			return clusters["c1"], nil
+		}
+		return nil, provisionTypes.ErrNoCluster
+	}
+}
+
+func (s *S) TestMigrateClusterValidation(c *check.C) {
+	s.setupMigrationClusters()
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.UnlimitedQuota}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		opts     MigrateClusterOptions
+		expected string
+	}{
+		{opts: MigrateClusterOptions{}, expected: "destination cluster is required"},
+		{opts: MigrateClusterOptions{Cluster: "c1"}, expected: `app already runs in cluster "c1"`},
+		{opts: MigrateClusterOptions{Cluster: "c3"}, expected: `cluster "c3" uses provisioner "other", app uses provisioner "fake"`},
+		{opts: MigrateClusterOptions{Cluster: "unknown"}, expected: "cluster not found"},
+	}
+	for _, tt := range tests {
+		err = a.MigrateCluster(context.TODO(), tt.opts, nil)
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, tt.expected)
+	}
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Migration, check.IsNil)
+}
+
+func (s *S) TestMigrateClusterFailureKeepsMigration(c *check.C) {
+	s.setupMigrationClusters()
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.UnlimitedQuota}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("Provision", errors.New("provision failed"))
+	err = a.MigrateCluster(context.TODO(), MigrateClusterOptions{Cluster: "c2"}, nil)
+	c.Assert(err, check.ErrorMatches, "(?s).*provision failed.*")
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Pool, check.Equals, s.Pool)
+	c.Assert(dbApp.Cluster, check.Equals, "")
+	c.Assert(dbApp.Migration, check.NotNil)
+	c.Assert(dbApp.Migration.SourceCluster, check.Equals, "c1")
+	c.Assert(dbApp.Migration.SourcePool, check.Equals, s.Pool)
+	c.Assert(dbApp.Migration.DestinationCluster, check.Equals, "c2")
+	c.Assert(dbApp.Migration.DestinationPool, check.Equals, s.Pool)
+	c.Assert(dbApp.Migration.Steps, check.HasLen, 0)
+	err = dbApp.MigrateCluster(context.TODO(), MigrateClusterOptions{Cluster: "c1"}, nil)
+	c.Assert(err, check.ErrorMatches, `app has an unfinished migration to cluster "c2" in pool "pool1"`)
+}
+
+func (s *S) TestMigrateClusterResume(c *check.C) {
+	s.setupMigrationClusters()
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.UnlimitedQuota}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setMigration(&ClusterMigration{
+		SourcePool:         s.Pool,
+		SourceCluster:      "c1",
+		DestinationPool:    s.Pool,
+		DestinationCluster: "c2",
+		Steps: []string{
+			"migrate-provision-destination",
+			"migrate-deploy-destination",
+			"migrate-wait-destination",
+			"migrate-switch-routes",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = dbApp.MigrateCluster(context.TODO(), MigrateClusterOptions{}, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s)---- Resuming migration to cluster "c2" ----.*---- Skipping migrate-switch-routes, already done ----.*---- Running migrate-cleanup-source ----.*`)
+	c.Assert(s.provisioner.Provisioned(&a), check.Equals, false)
+	dbApp, err = GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Migration, check.IsNil)
+}
+
+func (s *S) TestMigrateClusterResumeSourceAlreadyDestroyed(c *check.C) {
+	s.setupMigrationClusters()
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.UnlimitedQuota}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setMigration(&ClusterMigration{
+		SourcePool:         s.Pool,
+		SourceCluster:      "c1",
+		DestinationPool:    s.Pool,
+		DestinationCluster: "c2",
+		Steps: []string{
+			"migrate-provision-destination",
+			"migrate-deploy-destination",
+			"migrate-wait-destination",
+			"migrate-switch-routes",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("Destroy", provision.ErrAppNotProvisioned)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	err = dbApp.MigrateCluster(context.TODO(), MigrateClusterOptions{}, nil)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Migration, check.IsNil)
+}
+
+func (s *S) TestMigrateClusterSwitchRoutesPinsApp(c *check.C) {
+	s.setupMigrationClusters()
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.UnlimitedQuota}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setMigration(&ClusterMigration{
+		SourcePool:         s.Pool,
+		SourceCluster:      "c1",
+		DestinationPool:    s.Pool,
+		DestinationCluster: "c2",
+	})
+	c.Assert(err, check.IsNil)
+	_, err = migrateSwitchRoutes.Forward(action.FWContext{
+		Context: context.TODO(),
+		Params:  []interface{}{&a, &bytes.Buffer{}},
+	})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Pool, check.Equals, s.Pool)
+	c.Assert(dbApp.Cluster, check.Equals, "c2")
+	c.Assert(dbApp.Migration.Steps, check.DeepEquals, []string{"migrate-switch-routes"})
+}
+
+// migrationProvisioner keeps the units of each cluster in a separate fake
+// provisioner, like a provisioner running apps in more than one cluster.
+type migrationProvisioner struct {
+	*provisiontest.FakeProvisioner
+	clusters map[string]*provisiontest.FakeProvisioner
+	deployed map[string][]int
+}
+
+func (p *migrationProvisioner) cluster(a provision.App) *provisiontest.FakeProvisioner {
+	return p.clusters[a.GetCluster()]
+}
+
+func (p *migrationProvisioner) GetName() string {
+	return "migrationProv"
+}
+
+func (p *migrationProvisioner) Units(ctx context.Context, apps ...provision.App) ([]provision.Unit, error) {
+	return p.cluster(apps[0]).Units(ctx, apps...)
+}
+
+func (p *migrationProvisioner) AddUnits(ctx context.Context, a provision.App, n uint, process string, version appTypes.AppVersion, w io.Writer) error {
+	return p.cluster(a).AddUnits(ctx, a, n, process, version, w)
+}
+
+func (p *migrationProvisioner) Stop(ctx context.Context, a provision.App, process string, version appTypes.AppVersion, w io.Writer) error {
+	return p.cluster(a).Stop(ctx, a, process, version, w)
+}
+
+func (p *migrationProvisioner) ToggleRoutable(ctx context.Context, a provision.App, version appTypes.AppVersion, routable bool) error {
+	return nil
+}
+
+func (p *migrationProvisioner) DeployedVersions(ctx context.Context, a provision.App) ([]int, error) {
+	return p.deployed[a.GetCluster()], nil
+}
+
+func (s *S) TestMigrateClusterDeployRecreatesStoppedProcesses(c *check.C) {
+	prov := &migrationProvisioner{
+		FakeProvisioner: s.provisioner,
+		clusters: map[string]*provisiontest.FakeProvisioner{
+			"c1": provisiontest.NewFakeProvisioner(),
+			"c2": provisiontest.NewFakeProvisioner(),
+		},
+		deployed: map[string][]int{},
+	}
+	provision.Register("migrationProv", func() (provision.Provisioner, error) {
+		return prov, nil
+	})
+	defer provision.Unregister("migrationProv")
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{Name: "migration-pool", Provisioner: "migrationProv"})
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Pool: "migration-pool", Quota: quota.UnlimitedQuota}
+	err = CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version, err := servicemanager.AppVersion.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: &a})
+	c.Assert(err, check.IsNil)
+	err = version.AddData(appTypes.AddVersionDataArgs{Processes: map[string][]string{
+		"web":    {"python web.py"},
+		"worker": {"python worker.py"},
+	}})
+	c.Assert(err, check.IsNil)
+	err = version.CommitSuccessful()
+	c.Assert(err, check.IsNil)
+	err = version.UpdatePastUnits("worker", 3)
+	c.Assert(err, check.IsNil)
+	err = a.setMigration(&ClusterMigration{
+		SourcePool:         a.Pool,
+		SourceCluster:      "c1",
+		DestinationPool:    a.Pool,
+		DestinationCluster: "c2",
+	})
+	c.Assert(err, check.IsNil)
+	source, dest := a.migrationSource(), a.migrationDestination()
+	for _, p := range prov.clusters {
+		err = p.Provision(context.TODO(), source)
+		c.Assert(err, check.IsNil)
+	}
+	err = prov.clusters["c1"].AddUnits(context.TODO(), source, 2, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	prov.deployed["c1"] = []int{version.Version()}
+	_, err = migrateDeployDestination.Forward(action.FWContext{
+		Context: context.TODO(),
+		Params:  []interface{}{&a, &bytes.Buffer{}},
+	})
+	c.Assert(err, check.IsNil)
+	destUnits, err := prov.Units(context.TODO(), dest)
+	c.Assert(err, check.IsNil)
+	count := countUnits(destUnits)
+	c.Assert(count, check.DeepEquals, map[migrationUnitKey]int{
+		{process: "web", version: version.Version()}:    2,
+		{process: "worker", version: version.Version()}: 1,
+	})
+	c.Assert(prov.clusters["c2"].Stops(dest, "worker"), check.Equals, 1)
+	c.Assert(prov.clusters["c2"].Stops(dest, "web"), check.Equals, 0)
+	c.Assert(prov.clusters["c1"].Stops(source, "worker"), check.Equals, 0)
+	version, err = servicemanager.AppVersion.VersionByImageOrVersion(context.TODO(), &a, strconv.Itoa(version.Version()))
+	c.Assert(err, check.IsNil)
+	c.Assert(version.VersionInfo().PastUnits, check.DeepEquals, map[string]int{"worker": 3})
+}
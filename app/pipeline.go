@@ -0,0 +1,265 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/servicemanager"
+	"github.com/tsuru/tsuru/storage"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"github.com/tsuru/tsuru/validation"
+)
+
+type pipelineService struct {
+	storage appTypes.PipelineStorage
+}
+
+func PipelineService() (appTypes.PipelineService, error) {
+	dbDriver, err := storage.GetCurrentDbDriver()
+	if err != nil {
+		dbDriver, err = storage.GetDefaultDbDriver()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &pipelineService{
+		storage: dbDriver.PipelineStorage,
+	}, nil
+}
+
+func (s *pipelineService) Create(ctx context.Context, pipeline appTypes.Pipeline) error {
+	if !validation.ValidateName(pipeline.Name) {
+		return &tsuruErrors.ValidationError{Message: "invalid pipeline name, should have at most 40 characters, containing only lower case letters, numbers or dashes, starting with a letter"}
+	}
+	err := s.validate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return s.storage.Insert(ctx, pipeline)
+}
+
+func (s *pipelineService) Update(ctx context.Context, pipeline appTypes.Pipeline) error {
+	existing, err := s.storage.Get(ctx, pipeline.Name)
+	if err != nil {
+		return err
+	}
+	if pipeline.TeamOwner == "" {
+		pipeline.TeamOwner = existing.TeamOwner
+	}
+	err = s.validate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return s.storage.Update(ctx, pipeline)
+}
+
+func (s *pipelineService) validate(ctx context.Context, pipeline appTypes.Pipeline) error {
+	if pipeline.TeamOwner == "" {
+		return &tsuruErrors.ValidationError{Message: "pipeline team owner is required"}
+	}
+	_, err := servicemanager.Team.FindByName(ctx, pipeline.TeamOwner)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("unable to find team %q: %v", pipeline.TeamOwner, err)}
+	}
+	if len(pipeline.Stages) < 2 {
+		return &tsuruErrors.ValidationError{Message: "pipeline must have at least two stages"}
+	}
+	seen := map[string]struct{}{}
+	for _, stage := range pipeline.Stages {
+		if _, ok := seen[stage.App]; ok {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("app %q is used in more than one stage", stage.App)}
+		}
+		seen[stage.App] = struct{}{}
+		if stage.Verification.MinAge < 0 {
+			return &tsuruErrors.ValidationError{Message: "verification min age must not be negative"}
+		}
+		_, err = GetByName(ctx, stage.App)
+		if err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("unable to find app %q: %v", stage.App, err)}
+		}
+	}
+	return nil
+}
+
+func (s *pipelineService) Get(ctx context.Context, name string) (*appTypes.Pipeline, error) {
+	return s.storage.Get(ctx, name)
+}
+
+func (s *pipelineService) List(ctx context.Context, teams []string) ([]appTypes.Pipeline, error) {
+	return s.storage.FindByTeams(ctx, teams)
+}
+
+func (s *pipelineService) Remove(ctx context.Context, name string) error {
+	return s.storage.Remove(ctx, name)
+}
+
+// RequestApproval returns the approval for promoting version into the stage,
+// creating a pending one requested by user when there is none yet.
+func (s *pipelineService) RequestApproval(ctx context.Context, name, stage string, version int, user string) (*appTypes.PipelineApproval, error) {
+	pipeline, err := s.storage.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if approval := pipeline.Approval(stage, version); approval != nil {
+		return approval, nil
+	}
+	approval := appTypes.PipelineApproval{
+		Stage:       stage,
+		Version:     version,
+		RequestedBy: user,
+		RequestedAt: time.Now().UTC(),
+	}
+	err = s.storage.AddApproval(ctx, name, approval)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err = s.storage.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if current := pipeline.Approval(stage, version); current != nil {
+		return current, nil
+	}
+	return &approval, nil
+}
+
+// Approve approves a pending promotion. The user requesting a promotion is
+// never allowed to approve it.
+func (s *pipelineService) Approve(ctx context.Context, name, stage string, version int, user string) error {
+	pipeline, err := s.storage.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	approval := pipeline.Approval(stage, version)
+	if approval == nil || approval.Approved() {
+		return appTypes.ErrPipelineApprovalNotFound
+	}
+	if approval.RequestedBy == user {
+		return appTypes.ErrPipelineSelfApproval
+	}
+	return s.storage.Approve(ctx, name, stage, version, user)
+}
+
+// ConsumeApproval removes the approval of a promotion which is being carried
+// out, a new promotion of the same version requires a new approval.
+func (s *pipelineService) ConsumeApproval(ctx context.Context, name, stage string, version int) error {
+	return s.storage.RemoveApproval(ctx, name, stage, version)
+}
+
+// PipelineTransition is the promotion of a version from a pipeline stage to
+// the next one.
+type PipelineTransition struct {
+	Pipeline *appTypes.Pipeline
+	Stage    appTypes.PipelineStage
+	From     *App
+	To       *App
+	Version  int
+}
+
+// DeployOptions returns the options used to promote the version into the
+// destination stage, without rebuilding it.
+func (t *PipelineTransition) DeployOptions() DeployOptions {
+	opts := DeployOptions{
+		App:           t.To,
+		Origin:        "promote",
+		SourceApp:     t.From.Name,
+		SourceVersion: strconv.Itoa(t.Version),
+		Pipeline:      t.Pipeline.Name,
+	}
+	opts.GetKind()
+	return opts
+}
+
+// NewPipelineTransition resolves the promotion of a version into the stage
+// running stageApp. The version is looked up in the previous stage and
+// defaults to its last successfully deployed version. The verification of the
+// stage is checked against the previous stage before returning.
+func NewPipelineTransition(ctx context.Context, pipeline *appTypes.Pipeline, stageApp, version string) (*PipelineTransition, error) {
+	idx := pipeline.StageIndex(stageApp)
+	if idx < 0 {
+		return nil, appTypes.ErrPipelineStageNotFound
+	}
+	if idx == 0 {
+		return nil, &tsuruErrors.ValidationError{Message: "the first stage of a pipeline cannot receive promotions"}
+	}
+	from, err := GetByName(ctx, pipeline.Stages[idx-1].App)
+	if err != nil {
+		return nil, err
+	}
+	to, err := GetByName(ctx, stageApp)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		versions, err := servicemanager.AppVersion.AppVersions(ctx, from)
+		if err != nil {
+			return nil, err
+		}
+		if versions.LastSuccessfulVersion == 0 {
+			return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("app %q has no successfully deployed version to promote", from.Name)}
+		}
+		version = strconv.Itoa(versions.LastSuccessfulVersion)
+	}
+	sourceVersion, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, from, version)
+	if err != nil {
+		return nil, err
+	}
+	transition := &PipelineTransition{
+		Pipeline: pipeline,
+		Stage:    pipeline.Stages[idx],
+		From:     from,
+		To:       to,
+		Version:  sourceVersion.Version(),
+	}
+	err = transition.verify(sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return transition, nil
+}
+
+func (t *PipelineTransition) verify(version appTypes.AppVersion) error {
+	verification := t.Stage.Verification
+	info := version.VersionInfo()
+	if !info.DeploySuccessful {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("version %d of app %q was not successfully deployed", info.Version, t.From.Name)}
+	}
+	if verification.MinAge > 0 {
+		deployedAt := info.DeployedAt
+		if deployedAt.IsZero() {
+			// versions deployed before DeployedAt was recorded
+			deployedAt = info.UpdatedAt
+		}
+		age := time.Since(deployedAt)
+		if age < verification.MinAge {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("version %d of app %q must be deployed for at least %v before being promoted, remaining %v", info.Version, t.From.Name, verification.MinAge, (verification.MinAge - age).Round(time.Second))}
+		}
+	}
+	if verification.HealthyUnits {
+		units, err := t.From.Units()
+		if err != nil {
+			return err
+		}
+		var found bool
+		for _, u := range units {
+			if u.Version != info.Version {
+				continue
+			}
+			found = true
+			if !u.Available() {
+				return &tsuruErrors.ValidationError{Message: fmt.Sprintf("unit %q of app %q is not available: %s", u.ID, t.From.Name, u.Status)}
+			}
+		}
+		if !found {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("no units of app %q are running version %d", t.From.Name, info.Version)}
+		}
+	}
+	return nil
+}
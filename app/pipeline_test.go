@@ -0,0 +1,189 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) createPipelineApps(c *check.C, names ...string) []App {
+	var apps []App
+	for _, name := range names {
+		a := App{Name: name, Platform: "python", TeamOwner: s.team.Name}
+		err := CreateApp(context.TODO(), &a, s.user)
+		c.Assert(err, check.IsNil)
+		apps = append(apps, a)
+	}
+	return apps
+}
+
+func (s *S) TestPipelineServiceCreate(c *check.C) {
+	s.createPipelineApps(c, "myapp-dev", "myapp-prod")
+	pipeline := appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages: []appTypes.PipelineStage{
+			{App: "myapp-dev"},
+			{App: "myapp-prod", ManualApproval: true},
+		},
+	}
+	err := servicemanager.Pipeline.Create(context.TODO(), pipeline)
+	c.Assert(err, check.IsNil)
+	dbPipeline, err := servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline, check.DeepEquals, &pipeline)
+}
+
+func (s *S) TestPipelineServiceCreateInvalid(c *check.C) {
+	s.createPipelineApps(c, "myapp-dev", "myapp-prod")
+	tests := []struct {
+		pipeline appTypes.Pipeline
+		err      string
+	}{
+		{
+			pipeline: appTypes.Pipeline{Name: "My Pipeline", TeamOwner: s.team.Name},
+			err:      "invalid pipeline name.*",
+		},
+		{
+			pipeline: appTypes.Pipeline{Name: "myapp", TeamOwner: "unknown", Stages: []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-prod"}}},
+			err:      `unable to find team "unknown".*`,
+		},
+		{
+			pipeline: appTypes.Pipeline{Name: "myapp", TeamOwner: s.team.Name, Stages: []appTypes.PipelineStage{{App: "myapp-dev"}}},
+			err:      "pipeline must have at least two stages",
+		},
+		{
+			pipeline: appTypes.Pipeline{Name: "myapp", TeamOwner: s.team.Name, Stages: []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-dev"}}},
+			err:      `app "myapp-dev" is used in more than one stage`,
+		},
+		{
+			pipeline: appTypes.Pipeline{Name: "myapp", TeamOwner: s.team.Name, Stages: []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-qa"}}},
+			err:      `unable to find app "myapp-qa".*`,
+		},
+	}
+	for _, tt := range tests {
+		err := servicemanager.Pipeline.Create(context.TODO(), tt.pipeline)
+		c.Check(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestPipelineServiceUpdate(c *check.C) {
+	s.createPipelineApps(c, "myapp-dev", "myapp-qa", "myapp-prod")
+	pipeline := appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages:    []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-prod"}},
+	}
+	err := servicemanager.Pipeline.Create(context.TODO(), pipeline)
+	c.Assert(err, check.IsNil)
+	err = servicemanager.Pipeline.Update(context.TODO(), appTypes.Pipeline{
+		Name:   "myapp",
+		Stages: []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-qa"}, {App: "myapp-prod", ManualApproval: true}},
+	})
+	c.Assert(err, check.IsNil)
+	dbPipeline, err := servicemanager.Pipeline.Get(context.TODO(), "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(dbPipeline.Stages, check.HasLen, 3)
+	err = servicemanager.Pipeline.Update(context.TODO(), appTypes.Pipeline{Name: "other"})
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *S) TestPipelineServiceApproval(c *check.C) {
+	s.createPipelineApps(c, "myapp-dev", "myapp-prod")
+	svc, err := PipelineService()
+	c.Assert(err, check.IsNil)
+	err = svc.Create(context.TODO(), appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages:    []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-prod", ManualApproval: true}},
+	})
+	c.Assert(err, check.IsNil)
+	err = svc.Approve(context.TODO(), "myapp", "myapp-prod", 1, "boss@tsuru.io")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineApprovalNotFound)
+	approval, err := svc.RequestApproval(context.TODO(), "myapp", "myapp-prod", 1, "me@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(approval.RequestedBy, check.Equals, "me@tsuru.io")
+	c.Assert(approval.Approved(), check.Equals, false)
+	approval, err = svc.RequestApproval(context.TODO(), "myapp", "myapp-prod", 1, "other@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(approval.RequestedBy, check.Equals, "me@tsuru.io")
+	err = svc.Approve(context.TODO(), "myapp", "myapp-prod", 1, "me@tsuru.io")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineSelfApproval)
+	err = svc.Approve(context.TODO(), "myapp", "myapp-prod", 1, "boss@tsuru.io")
+	c.Assert(err, check.IsNil)
+	approval, err = svc.RequestApproval(context.TODO(), "myapp", "myapp-prod", 1, "me@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(approval.ApprovedBy, check.Equals, "boss@tsuru.io")
+	err = svc.ConsumeApproval(context.TODO(), "myapp", "myapp-prod", 1)
+	c.Assert(err, check.IsNil)
+	pipeline, err := svc.Get(context.TODO(), "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(pipeline.Approvals, check.HasLen, 0)
+}
+
+func (s *S) TestNewPipelineTransition(c *check.C) {
+	apps := s.createPipelineApps(c, "myapp-dev", "myapp-qa", "myapp-prod")
+	newSuccessfulAppVersion(c, &apps[0])
+	newSuccessfulAppVersion(c, &apps[0])
+	pipeline := &appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages:    []appTypes.PipelineStage{{App: "myapp-dev"}, {App: "myapp-qa"}, {App: "myapp-prod"}},
+	}
+	transition, err := NewPipelineTransition(context.TODO(), pipeline, "myapp-qa", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(transition.From.Name, check.Equals, "myapp-dev")
+	c.Assert(transition.To.Name, check.Equals, "myapp-qa")
+	c.Assert(transition.Version, check.Equals, 2)
+	opts := transition.DeployOptions()
+	c.Assert(opts.SourceApp, check.Equals, "myapp-dev")
+	c.Assert(opts.SourceVersion, check.Equals, "2")
+	c.Assert(opts.Pipeline, check.Equals, "myapp")
+	c.Assert(opts.Kind, check.Equals, DeployPromote)
+	transition, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-qa", "1")
+	c.Assert(err, check.IsNil)
+	c.Assert(transition.Version, check.Equals, 1)
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-prod", "")
+	c.Assert(err, check.ErrorMatches, `app "myapp-qa" has no successfully deployed version to promote`)
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-dev", "")
+	c.Assert(err, check.ErrorMatches, "the first stage of a pipeline cannot receive promotions")
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "other", "")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineStageNotFound)
+}
+
+func (s *S) TestNewPipelineTransitionVerification(c *check.C) {
+	apps := s.createPipelineApps(c, "myapp-dev", "myapp-prod")
+	version := newSuccessfulAppVersion(c, &apps[0])
+	pipeline := &appTypes.Pipeline{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Stages: []appTypes.PipelineStage{
+			{App: "myapp-dev"},
+			{App: "myapp-prod", Verification: appTypes.PipelineVerification{MinAge: time.Hour}},
+		},
+	}
+	_, err := NewPipelineTransition(context.TODO(), pipeline, "myapp-prod", "")
+	c.Assert(err, check.ErrorMatches, `version 1 of app "myapp-dev" must be deployed for at least 1h0m0s before being promoted, remaining .*`)
+	pipeline.Stages[1].Verification = appTypes.PipelineVerification{HealthyUnits: true}
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-prod", "")
+	c.Assert(err, check.ErrorMatches, `no units of app "myapp-dev" are running version 1`)
+	err = s.provisioner.AddUnits(context.TODO(), &apps[0], 2, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-prod", "")
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.Units(context.TODO(), &apps[0])
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.SetUnitStatus(units[0], provision.StatusError)
+	c.Assert(err, check.IsNil)
+	_, err = NewPipelineTransition(context.TODO(), pipeline, "myapp-prod", "")
+	c.Assert(err, check.ErrorMatches, `unit ".*" of app "myapp-dev" is not available: error`)
+}
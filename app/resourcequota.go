@@ -0,0 +1,379 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	"github.com/tsuru/tsuru/types/quota"
+)
+
+// unitResourcesCalculator computes the resources allocated to the units of
+// the app processes, according to the app plan and to the process resources,
+// sidecars and init containers declared in the tsuru.yaml of a version.
+type unitResourcesCalculator struct {
+	app      *App
+	yamlData provTypes.TsuruYamlData
+	bounds   *pool.ResourceBounds
+}
+
+// newUnitResourcesCalculator returns a calculator using the tsuru.yaml of
+// the version, or of the latest successful version of the app when version is
+// nil.
+func newUnitResourcesCalculator(app *App, version appTypes.AppVersion) (*unitResourcesCalculator, error) {
+	calc := &unitResourcesCalculator{app: app}
+	if version == nil {
+		var err error
+		version, err = servicemanager.AppVersion.LatestSuccessfulVersion(app.ctx, app)
+		if err != nil && err != appTypes.ErrNoVersionsAvailable {
+			return nil, err
+		}
+	}
+	if version == nil {
+		return calc, nil
+	}
+	var err error
+	calc.yamlData, err = version.TsuruYamlData()
+	if err != nil {
+		return nil, err
+	}
+	return calc, nil
+}
+
+// unit returns the resources allocated to a unit of the process: the process
+// resources plus its sidecars. Init containers run before the other
+// containers, so a unit only allocates the largest of them when it's bigger
+// than the rest.
+func (c *unitResourcesCalculator) unit(process string) (quota.Resources, error) {
+	planMemory := c.app.GetProcessMemory(process)
+	planCPUMilli := c.app.GetProcessMilliCPU(process)
+	var procConfig *provTypes.TsuruYamlKubernetesProcessConfig
+	if c.yamlData.Kubernetes != nil {
+		procConfig = c.yamlData.Kubernetes.GetProcessConfigs(process)
+	}
+	if procConfig == nil {
+		return quota.Resources{MilliCPU: int64(planCPUMilli), Memory: planMemory}, nil
+	}
+	memory, cpuMilli, err := provision.ProcessResources(c.app, process, procConfig.Resources)
+	if err != nil {
+		return quota.Resources{}, err
+	}
+	r := quota.Resources{MilliCPU: int64(cpuMilli), Memory: memory}
+	if len(procConfig.Sidecars)+len(procConfig.InitContainers) == 0 {
+		return r, nil
+	}
+	if c.bounds == nil {
+		p, err := pool.GetPoolByName(c.app.ctx, c.app.Pool)
+		if err != nil {
+			return r, err
+		}
+		bounds, err := p.GetSidecarBounds()
+		if err != nil {
+			return r, err
+		}
+		c.bounds = &bounds
+	}
+	containerResources := func(container provTypes.TsuruYamlKubernetesContainer) (quota.Resources, error) {
+		memory, cpuMilli, err := c.bounds.ContainerResources(planMemory, planCPUMilli, container.Resources)
+		if err != nil {
+			return quota.Resources{}, errors.Wrapf(err, "invalid resources for container %q", container.Name)
+		}
+		return quota.Resources{MilliCPU: int64(cpuMilli), Memory: memory}, nil
+	}
+	for _, sidecar := range procConfig.Sidecars {
+		sr, err := containerResources(sidecar)
+		if err != nil {
+			return r, err
+		}
+		r = r.Add(sr)
+	}
+	for _, initContainer := range procConfig.InitContainers {
+		ir, err := containerResources(initContainer)
+		if err != nil {
+			return r, err
+		}
+		if ir.MilliCPU > r.MilliCPU {
+			r.MilliCPU = ir.MilliCPU
+		}
+		if ir.Memory > r.Memory {
+			r.Memory = ir.Memory
+		}
+	}
+	return r, nil
+}
+
+// UnitResources returns the resources allocated to a unit of the process of
+// the app, as counted for team resource quotas.
+func UnitResources(app *App, process string) (quota.Resources, error) {
+	calc, err := newUnitResourcesCalculator(app, nil)
+	if err != nil {
+		return quota.Resources{}, err
+	}
+	return calc.unit(process)
+}
+
+// appResourcesOpts changes how appResources counts the units of an app.
+type appResourcesOpts struct {
+	// start counts the stopped and asleep units of startProcess, or of every
+	// process when startProcess is empty, as running.
+	start        bool
+	startProcess string
+	// autoScale replaces the autoscaling spec of its process.
+	autoScale *provision.AutoScaleSpec
+	// deploy counts the processes of the version being deployed: processes
+	// keep their running units and new processes start with one unit.
+	deploy appTypes.AppVersion
+	// unitsOf counts the units and autoscaling specs of another app, priced
+	// with the plan and pool of the app. An app changing pool has no units in
+	// the provisioner of the new pool yet.
+	unitsOf *App
+}
+
+// appResources returns the resources allocated by the running units of the
+// app. Autoscaled processes allocate the resources of their maximum number of
+// units, as the autoscaler adds units without going through tsuru.
+func appResources(app *App, opts appResourcesOpts) (quota.Resources, error) {
+	var allocated quota.Resources
+	unitsOf := app
+	if opts.unitsOf != nil {
+		unitsOf = opts.unitsOf
+	}
+	units, err := unitsOf.Units()
+	if err != nil {
+		return allocated, err
+	}
+	counts := map[string]int{}
+	existing := map[string]bool{}
+	for _, u := range units {
+		existing[u.ProcessName] = true
+		stopped := u.Status == provision.StatusStopped || u.Status == provision.StatusAsleep
+		starting := opts.start && (opts.startProcess == "" || opts.startProcess == u.ProcessName)
+		if stopped && !starting {
+			continue
+		}
+		counts[u.ProcessName]++
+	}
+	if opts.deploy != nil {
+		processes, err := opts.deploy.Processes()
+		if err != nil {
+			return allocated, err
+		}
+		deployCounts := map[string]int{}
+		for process := range processes {
+			deployCounts[process] = counts[process]
+			if !existing[process] {
+				deployCounts[process] = 1
+			}
+		}
+		counts = deployCounts
+	}
+	specs, err := unitsOf.AutoScaleInfo()
+	if err != nil {
+		return allocated, err
+	}
+	maxUnits := map[string]int{}
+	for _, spec := range specs {
+		maxUnits[spec.Process] = int(spec.MaxUnits)
+	}
+	if opts.autoScale != nil {
+		maxUnits[opts.autoScale.Process] = int(opts.autoScale.MaxUnits)
+	}
+	for process, max := range maxUnits {
+		scaling := counts[process] > 0 || (opts.autoScale != nil && opts.autoScale.Process == process)
+		if scaling && max > counts[process] {
+			counts[process] = max
+		}
+	}
+	if len(counts) == 0 {
+		return allocated, nil
+	}
+	calc, err := newUnitResourcesCalculator(app, opts.deploy)
+	if err != nil {
+		return allocated, err
+	}
+	for process, n := range counts {
+		r, err := calc.unit(process)
+		if err != nil {
+			return allocated, err
+		}
+		allocated = allocated.Add(quota.Resources{MilliCPU: r.MilliCPU * int64(n), Memory: r.Memory * int64(n)})
+	}
+	return allocated, nil
+}
+
+func appAllocatedResources(app *App) (quota.Resources, error) {
+	return appResources(app, appResourcesOpts{})
+}
+
+func teamAllocatedResources(ctx context.Context, team, poolName string) (quota.Resources, error) {
+	var allocated quota.Resources
+	apps, err := List(ctx, &Filter{TeamOwner: team, Pool: poolName})
+	if err != nil {
+		return allocated, err
+	}
+	for i := range apps {
+		appResources, err := appAllocatedResources(&apps[i])
+		if err != nil {
+			return allocated, err
+		}
+		allocated = allocated.Add(appResources)
+	}
+	return allocated, nil
+}
+
+// checkTeamResourceQuota verifies that the team owning the app may allocate
+// the requested resources in the pool of the app. The requested resources
+// are only computed when the team has a quota in the pool, resources being
+// released are never refused.
+func checkTeamResourceQuota(ctx context.Context, app *App, requested func() (quota.Resources, error)) error {
+	team, err := servicemanager.Team.FindByName(ctx, app.TeamOwner)
+	if err == authTypes.ErrTeamNotFound || team == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	q := team.ResourceQuota(app.Pool)
+	if q.IsUnlimited() {
+		return nil
+	}
+	wanted, err := requested()
+	if err != nil {
+		return err
+	}
+	allocated, err := teamAllocatedResources(ctx, team.Name, app.Pool)
+	if err != nil {
+		return err
+	}
+	if q.MilliCPU >= 0 && wanted.MilliCPU > 0 && allocated.MilliCPU+wanted.MilliCPU > q.MilliCPU {
+		return &quota.ResourceQuotaExceededError{
+			Pool:      app.Pool,
+			Resource:  "cpu",
+			Requested: wanted.MilliCPU,
+			Available: available(q.MilliCPU, allocated.MilliCPU),
+		}
+	}
+	if q.Memory >= 0 && wanted.Memory > 0 && allocated.Memory+wanted.Memory > q.Memory {
+		return &quota.ResourceQuotaExceededError{
+			Pool:      app.Pool,
+			Resource:  "memory",
+			Requested: wanted.Memory,
+			Available: available(q.Memory, allocated.Memory),
+		}
+	}
+	return nil
+}
+
+// checkTeamResourceQuotaChange verifies that the team owning updated may
+// allocate the resources updated requires in place of the ones allocated by
+// old. Nothing is released when old is nil or belongs to another pool or
+// team, as the quota of old is a different one. The units of old are the ones
+// counted, priced with the plan and pool of updated.
+func checkTeamResourceQuotaChange(ctx context.Context, old, updated *App, opts appResourcesOpts) error {
+	return checkTeamResourceQuota(ctx, updated, func() (quota.Resources, error) {
+		if old != nil && old != updated {
+			opts.unitsOf = old
+		}
+		wanted, err := appResources(updated, opts)
+		if err != nil || old == nil || old.Pool != updated.Pool || old.TeamOwner != updated.TeamOwner {
+			return wanted, err
+		}
+		current, err := appAllocatedResources(old)
+		if err != nil {
+			return wanted, err
+		}
+		return quota.Resources{
+			MilliCPU: wanted.MilliCPU - current.MilliCPU,
+			Memory:   wanted.Memory - current.Memory,
+		}, nil
+	})
+}
+
+func available(limit, allocated int64) int64 {
+	if allocated > limit {
+		return 0
+	}
+	return limit - allocated
+}
+
+// TeamResourceQuotaUsage returns the usage of each resource quota of the
+// team.
+func TeamResourceQuotaUsage(ctx context.Context, team *authTypes.Team) ([]quota.ResourceQuotaUsage, error) {
+	provisioners, err := provision.Registry()
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]quota.ResourceQuotaUsage, 0, len(team.ResourceQuotas))
+	for _, q := range team.ResourceQuotas {
+		allocated, err := teamAllocatedResources(ctx, team.Name, q.Pool)
+		if err != nil {
+			return nil, err
+		}
+		var requested quota.Resources
+		for _, p := range provisioners {
+			quotaProv, ok := p.(provision.TeamResourceQuotaProvisioner)
+			if !ok {
+				continue
+			}
+			provRequested, err := quotaProv.TeamResourceRequests(ctx, team.Name, q.Pool)
+			if err != nil {
+				return nil, err
+			}
+			requested = requested.Add(provRequested)
+		}
+		usage = append(usage, quota.ResourceQuotaUsage{
+			ResourceQuota: q,
+			Allocated:     allocated,
+			Requested:     requested,
+		})
+	}
+	return usage, nil
+}
+
+// SetTeamResourceQuota changes the resource quota of the team in a pool and
+// updates the quotas enforced by the provisioners. The new limits can't be
+// lower than the resources currently allocated by the team.
+func SetTeamResourceQuota(ctx context.Context, teamName string, q quota.ResourceQuota) error {
+	if q.Pool == "" {
+		return &tsuruErrors.ValidationError{Message: "pool is required"}
+	}
+	_, err := pool.GetPoolByName(ctx, q.Pool)
+	if err != nil {
+		return err
+	}
+	allocated, err := teamAllocatedResources(ctx, teamName, q.Pool)
+	if err != nil {
+		return err
+	}
+	if (q.MilliCPU >= 0 && q.MilliCPU < allocated.MilliCPU) || (q.Memory >= 0 && q.Memory < allocated.Memory) {
+		return quota.ErrLimitLowerThanAllocated
+	}
+	err = servicemanager.Team.SetResourceQuota(ctx, teamName, q)
+	if err != nil {
+		return err
+	}
+	provisioners, err := provision.Registry()
+	if err != nil {
+		return err
+	}
+	multiErr := tsuruErrors.NewMultiError()
+	for _, p := range provisioners {
+		if quotaProv, ok := p.(provision.TeamResourceQuotaProvisioner); ok {
+			err = quotaProv.SyncTeamResourceQuotas(ctx, teamName)
+			if err != nil {
+				multiErr.Add(errors.Wrapf(err, "unable to sync team resource quotas in provisioner %q", p.GetName()))
+			}
+		}
+	}
+	return multiErr.ToError()
+}
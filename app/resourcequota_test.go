@@ -0,0 +1,235 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	"github.com/tsuru/tsuru/types/quota"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestAddUnitsTeamResourceQuotaExceeded(c *check.C) {
+	s.mockService.Team.OnFindByName = func(name string) (*authTypes.Team, error) {
+		return &authTypes.Team{
+			Name:           s.team.Name,
+			ResourceQuotas: []quota.ResourceQuota{{Pool: s.Pool, MilliCPU: -1, Memory: 4096}},
+		}, nil
+	}
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	err = a.AddUnits(3, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", "", nil)
+	c.Assert(err, check.DeepEquals, &quota.ResourceQuotaExceededError{
+		Pool:      s.Pool,
+		Resource:  "memory",
+		Requested: 2048,
+		Available: 1024,
+	})
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 3)
+}
+
+func (s *S) TestSetTeamResourceQuota(c *check.C) {
+	var set []quota.ResourceQuota
+	s.mockService.Team.OnSetResourceQuota = func(name string, q quota.ResourceQuota) error {
+		c.Assert(name, check.Equals, s.team.Name)
+		set = append(set, q)
+		return nil
+	}
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	err = a.AddUnits(2, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	err = SetTeamResourceQuota(context.TODO(), s.team.Name, quota.ResourceQuota{Pool: s.Pool, MilliCPU: -1, Memory: 1024})
+	c.Assert(err, check.Equals, quota.ErrLimitLowerThanAllocated)
+	err = SetTeamResourceQuota(context.TODO(), s.team.Name, quota.ResourceQuota{Pool: s.Pool, MilliCPU: -1, Memory: 2048})
+	c.Assert(err, check.IsNil)
+	c.Assert(set, check.DeepEquals, []quota.ResourceQuota{{Pool: s.Pool, MilliCPU: -1, Memory: 2048}})
+	team := authTypes.Team{ResourceQuotas: set}
+	usage, err := TeamResourceQuotaUsage(context.TODO(), &team)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, []quota.ResourceQuotaUsage{{
+		ResourceQuota: set[0],
+		Allocated:     quota.Resources{Memory: 2048},
+	}})
+}
+
+func (s *S) TestUnitResourcesWithSidecars(c *check.C) {
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version, err := servicemanager.AppVersion.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: &a})
+	c.Assert(err, check.IsNil)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		CustomData: map[string]interface{}{
+			"kubernetes": provTypes.TsuruYamlKubernetesConfig{
+				Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+					"pod": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+						"web": {
+							Sidecars: []provTypes.TsuruYamlKubernetesContainer{
+								{Name: "proxy", Image: "proxy:v1", Resources: &provTypes.TsuruYamlKubernetesProcessResources{Memory: "512"}},
+								{Name: "shipper", Image: "shipper:v1", Resources: &provTypes.TsuruYamlKubernetesProcessResources{Memory: "1Gi"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = version.CommitSuccessful()
+	c.Assert(err, check.IsNil)
+	calc, err := newUnitResourcesCalculator(&a, nil)
+	c.Assert(err, check.IsNil)
+	r, err := calc.unit("web")
+	c.Assert(err, check.IsNil)
+	// the proxy is raised to the pool minimum and both sidecars are bounded
+	// by the process plan
+	c.Assert(r, check.DeepEquals, quota.Resources{MilliCPU: 100, Memory: a.GetProcessMemory("web") * 3})
+	r, err = calc.unit("worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.DeepEquals, quota.Resources{Memory: a.GetProcessMemory("worker")})
+}
+
+func (s *S) TestUnitResourcesWithProcessResources(c *check.C) {
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version, err := servicemanager.AppVersion.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: &a})
+	c.Assert(err, check.IsNil)
+	err = version.AddData(appTypes.AddVersionDataArgs{
+		CustomData: map[string]interface{}{
+			"kubernetes": provTypes.TsuruYamlKubernetesConfig{
+				Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+					"pod": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+						"worker": {Resources: &provTypes.TsuruYamlKubernetesProcessResources{Memory: "512"}},
+						"web":    {Resources: &provTypes.TsuruYamlKubernetesProcessResources{Memory: "1Gi"}},
+					},
+				},
+			},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = version.CommitSuccessful()
+	c.Assert(err, check.IsNil)
+	calc, err := newUnitResourcesCalculator(&a, nil)
+	c.Assert(err, check.IsNil)
+	r, err := calc.unit("worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.DeepEquals, quota.Resources{Memory: 512})
+	// tsuru.yaml can't raise a process beyond the app plan
+	r, err = calc.unit("web")
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.DeepEquals, quota.Resources{Memory: a.GetProcessMemory("web")})
+}
+
+func (s *S) TestStartTeamResourceQuotaExceeded(c *check.C) {
+	s.mockService.Team.OnFindByName = func(name string) (*authTypes.Team, error) {
+		return &authTypes.Team{
+			Name:           s.team.Name,
+			ResourceQuotas: []quota.ResourceQuota{{Pool: s.Pool, MilliCPU: -1, Memory: 4096}},
+		}, nil
+	}
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	err = a.AddUnits(3, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	err = a.Stop(context.TODO(), nil, "", "")
+	c.Assert(err, check.IsNil)
+	other := App{Name: "blackout", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err = CreateApp(context.TODO(), &other, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &other)
+	err = other.AddUnits(2, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	err = a.Start(context.TODO(), nil, "", "")
+	c.Assert(err, check.DeepEquals, &quota.ResourceQuotaExceededError{
+		Pool:      s.Pool,
+		Resource:  "memory",
+		Requested: 3072,
+		Available: 2048,
+	})
+}
+
+func (s *S) TestUpdatePlanOverrideTeamResourceQuotaExceeded(c *check.C) {
+	s.mockService.Team.OnFindByName = func(name string) (*authTypes.Team, error) {
+		return &authTypes.Team{
+			Name:           s.team.Name,
+			ResourceQuotas: []quota.ResourceQuota{{Pool: s.Pool, MilliCPU: -1, Memory: 4096}},
+		}, nil
+	}
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulAppVersion(c, &a)
+	err = version.AddData(appTypes.AddVersionDataArgs{Processes: map[string][]string{"web": {"python app.py"}}})
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	memory := int64(4096)
+	updateData := App{Plan: appTypes.Plan{ProcessOverride: map[string]appTypes.PlanOverride{
+		"web": {Memory: &memory},
+	}}}
+	err = a.Update(UpdateAppArgs{UpdateData: updateData})
+	c.Assert(err, check.DeepEquals, &quota.ResourceQuotaExceededError{
+		Pool:      s.Pool,
+		Resource:  "memory",
+		Requested: 6144,
+		Available: 2048,
+	})
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan.ProcessOverride, check.IsNil)
+}
+
+func (s *S) TestUpdatePoolOtherProvisionerTeamResourceQuotaExceeded(c *check.C) {
+	provision.Register("otherProv", func() (provision.Provisioner, error) {
+		return provisiontest.NewFakeProvisioner(), nil
+	})
+	defer provision.Unregister("otherProv")
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{Name: "other-pool", Provisioner: "otherProv"})
+	c.Assert(err, check.IsNil)
+	err = pool.AddTeamsToPool("other-pool", []string{s.team.Name})
+	c.Assert(err, check.IsNil)
+	s.mockService.Team.OnFindByName = func(name string) (*authTypes.Team, error) {
+		return &authTypes.Team{
+			Name:           s.team.Name,
+			ResourceQuotas: []quota.ResourceQuota{{Pool: "other-pool", MilliCPU: -1, Memory: 1024}},
+		}, nil
+	}
+	a := App{Name: "warpaint", Platform: "python", Quota: quota.UnlimitedQuota, TeamOwner: s.team.Name}
+	err = CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	newSuccessfulAppVersion(c, &a)
+	err = a.AddUnits(2, "web", "", nil)
+	c.Assert(err, check.IsNil)
+	err = a.Update(UpdateAppArgs{UpdateData: App{Pool: "other-pool"}, Writer: new(bytes.Buffer)})
+	c.Assert(err, check.DeepEquals, &quota.ResourceQuotaExceededError{
+		Pool:      "other-pool",
+		Resource:  "memory",
+		Requested: 2048,
+		Available: 1024,
+	})
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Pool, check.Equals, s.Pool)
+}
@@ -174,6 +174,8 @@ func (s *S) SetUpTest(c *check.C) {
 	c.Assert(err, check.IsNil)
 	servicemanager.Volume, err = volume.VolumeService()
 	c.Assert(err, check.IsNil)
+	servicemanager.Pipeline, err = PipelineService()
+	c.Assert(err, check.IsNil)
 }
 
 func (s *S) TearDownTest(c *check.C) {
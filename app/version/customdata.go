@@ -34,8 +34,18 @@ type tsuruYamlKubernetesGroup struct {
 }
 
 type tsuruYamlKubernetesProcess struct {
-	Name  string
-	Ports []tsuruYamlKubernetesProcessPortConfig
+	Name             string
+	Ports            []tsuruYamlKubernetesProcessPortConfig
+	Resources        *provTypes.TsuruYamlKubernetesProcessResources `json:",omitempty" bson:",omitempty"`
+	Sidecars         []provTypes.TsuruYamlKubernetesContainer       `json:",omitempty" bson:",omitempty"`
+	InitContainers   []provTypes.TsuruYamlKubernetesContainer       `json:"init_containers,omitempty" bson:"init_containers,omitempty"`
+	VolumeMounts     []provTypes.TsuruYamlKubernetesVolumeMount     `json:"volume_mounts,omitempty" bson:"volume_mounts,omitempty"`
+	Rollout          *provTypes.TsuruYamlKubernetesRollout          `json:",omitempty" bson:",omitempty"`
+	Liveness         *provTypes.TsuruYamlKubernetesProbe            `json:",omitempty" bson:",omitempty"`
+	Readiness        *provTypes.TsuruYamlKubernetesProbe            `json:",omitempty" bson:",omitempty"`
+	Startup          *provTypes.TsuruYamlKubernetesProbe            `json:",omitempty" bson:",omitempty"`
+	Spread           *provTypes.TsuruYamlKubernetesSpread           `json:",omitempty" bson:",omitempty"`
+	DisruptionBudget *provTypes.TsuruYamlKubernetesDisruptionBudget `json:"disruption_budget,omitempty" bson:"disruption_budget,omitempty"`
 }
 
 type tsuruYamlKubernetesProcessPortConfig struct {
@@ -72,7 +82,17 @@ func unmarshalYamlData(data map[string]interface{}) (provTypes.TsuruYamlData, er
 		group := provTypes.TsuruYamlKubernetesGroup{}
 		for _, proc := range g.Processes {
 			group[proc.Name] = provTypes.TsuruYamlKubernetesProcessConfig{
-				Ports: make([]provTypes.TsuruYamlKubernetesProcessPortConfig, len(proc.Ports)),
+				Ports:            make([]provTypes.TsuruYamlKubernetesProcessPortConfig, len(proc.Ports)),
+				Resources:        proc.Resources,
+				Sidecars:         proc.Sidecars,
+				InitContainers:   proc.InitContainers,
+				VolumeMounts:     proc.VolumeMounts,
+				Rollout:          proc.Rollout,
+				Liveness:         proc.Liveness,
+				Readiness:        proc.Readiness,
+				Startup:          proc.Startup,
+				Spread:           proc.Spread,
+				DisruptionBudget: proc.DisruptionBudget,
 			}
 			for i, port := range proc.Ports {
 				group[proc.Name].Ports[i] = provTypes.TsuruYamlKubernetesProcessPortConfig(port)
@@ -119,7 +139,19 @@ func marshalCustomData(data map[string]interface{}) (map[string]interface{}, err
 	for groupName, groupData := range yamlData.Kubernetes.Groups {
 		group := tsuruYamlKubernetesGroup{Name: groupName}
 		for procName, procData := range groupData {
-			proc := tsuruYamlKubernetesProcess{Name: procName}
+			proc := tsuruYamlKubernetesProcess{
+				Name:             procName,
+				Resources:        procData.Resources,
+				Sidecars:         procData.Sidecars,
+				InitContainers:   procData.InitContainers,
+				VolumeMounts:     procData.VolumeMounts,
+				Rollout:          procData.Rollout,
+				Liveness:         procData.Liveness,
+				Readiness:        procData.Readiness,
+				Startup:          procData.Startup,
+				Spread:           procData.Spread,
+				DisruptionBudget: procData.DisruptionBudget,
+			}
 			for _, port := range procData.Ports {
 				proc.Ports = append(proc.Ports, tsuruYamlKubernetesProcessPortConfig(port))
 			}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/tsuru/tsuru/storage"
 	appTypes "github.com/tsuru/tsuru/types/app"
+	"github.com/tsuru/tsuru/validation"
 )
 
 type appVersionService struct {
@@ -82,6 +83,11 @@ func (s *appVersionService) VersionByImageOrVersion(ctx context.Context, app app
 	if err != nil {
 		return nil, err
 	}
+	if channelVersion, ok := versions.Channels[imageOrVersion]; ok {
+		if v, ok := versions.Versions[channelVersion]; ok {
+			return newAppVersionImpl(ctx, s.storage, app, &v)
+		}
+	}
 	for _, v := range versions.Versions {
 		if v.DeploySuccessful &&
 			v.DeployImage == imageOrVersion ||
@@ -120,3 +126,36 @@ func (s *appVersionService) MarkVersionsToRemoval(ctx context.Context, appName s
 func (s *appVersionService) AppVersionFromInfo(ctx context.Context, app appTypes.App, info appTypes.AppVersionInfo) (appTypes.AppVersion, error) {
 	return newAppVersionImpl(ctx, s.storage, app, &info)
 }
+
+func (s *appVersionService) SetVersionChannel(ctx context.Context, app appTypes.App, channel string, version int) error {
+	if !validation.ValidateName(channel) {
+		return appTypes.ErrInvalidVersionChannel
+	}
+	versions, err := s.storage.AppVersions(ctx, app)
+	if err != nil {
+		return err
+	}
+	vi, ok := versions.Versions[version]
+	if !ok {
+		return appTypes.ErrInvalidVersion{Version: strconv.Itoa(version)}
+	}
+	if vi.MarkedToRemoval {
+		return appTypes.ErrVersionMarkedToRemoval
+	}
+	return s.storage.SetVersionChannel(ctx, app.GetName(), channel, version, &appTypes.AppVersionWriteOptions{
+		PreviousUpdatedHash: versions.UpdatedHash,
+	})
+}
+
+func (s *appVersionService) UnsetVersionChannel(ctx context.Context, app appTypes.App, channel string) error {
+	versions, err := s.storage.AppVersions(ctx, app)
+	if err != nil {
+		return err
+	}
+	if _, ok := versions.Channels[channel]; !ok {
+		return appTypes.ErrVersionChannelNotFound
+	}
+	return s.storage.UnsetVersionChannel(ctx, app.GetName(), channel, &appTypes.AppVersionWriteOptions{
+		PreviousUpdatedHash: versions.UpdatedHash,
+	})
+}
@@ -264,3 +264,77 @@ func (s *S) TestAppVersionService_VersionByImageOrVersion(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(version.Version(), check.Equals, 1)
 }
+
+func (s *S) TestAppVersionService_VersionByImageOrVersionWithChannel(c *check.C) {
+	app := &appTypes.MockApp{Name: "myapp"}
+	svc, err := AppVersionService()
+	c.Assert(err, check.IsNil)
+
+	v1, err := svc.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	err = v1.CommitBaseImage()
+	c.Assert(err, check.IsNil)
+	err = v1.CommitSuccessful()
+	c.Assert(err, check.IsNil)
+	v2, err := svc.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	err = v2.CommitBaseImage()
+	c.Assert(err, check.IsNil)
+	err = v2.CommitSuccessful()
+	c.Assert(err, check.IsNil)
+
+	err = svc.SetVersionChannel(context.TODO(), app, "stable", 1)
+	c.Assert(err, check.IsNil)
+	version, err := svc.VersionByImageOrVersion(context.TODO(), app, "stable")
+	c.Assert(err, check.IsNil)
+	c.Assert(version.Version(), check.Equals, 1)
+
+	err = svc.SetVersionChannel(context.TODO(), app, "stable", 2)
+	c.Assert(err, check.IsNil)
+	version, err = svc.VersionByImageOrVersion(context.TODO(), app, "stable")
+	c.Assert(err, check.IsNil)
+	c.Assert(version.Version(), check.Equals, 2)
+
+	err = svc.UnsetVersionChannel(context.TODO(), app, "stable")
+	c.Assert(err, check.IsNil)
+	_, err = svc.VersionByImageOrVersion(context.TODO(), app, "stable")
+	c.Assert(err, check.Equals, appTypes.ErrInvalidVersion{
+		Version: "stable",
+	})
+}
+
+func (s *S) TestAppVersionService_SetVersionChannel(c *check.C) {
+	app := &appTypes.MockApp{Name: "myapp"}
+	svc, err := AppVersionService()
+	c.Assert(err, check.IsNil)
+
+	_, err = svc.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+
+	err = svc.SetVersionChannel(context.TODO(), app, "Not Valid", 1)
+	c.Assert(err, check.Equals, appTypes.ErrInvalidVersionChannel)
+	err = svc.SetVersionChannel(context.TODO(), app, "stable", 9)
+	c.Assert(err, check.Equals, appTypes.ErrInvalidVersion{Version: "9"})
+
+	err = svc.SetVersionChannel(context.TODO(), app, "approved-by-qa", 1)
+	c.Assert(err, check.IsNil)
+	versions, err := svc.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Channels, check.DeepEquals, map[string]int{"approved-by-qa": 1})
+
+	err = svc.MarkVersionsToRemoval(context.TODO(), app.Name, []int{1})
+	c.Assert(err, check.IsNil)
+	err = svc.SetVersionChannel(context.TODO(), app, "stable", 1)
+	c.Assert(err, check.Equals, appTypes.ErrVersionMarkedToRemoval)
+}
+
+func (s *S) TestAppVersionService_UnsetVersionChannelNotFound(c *check.C) {
+	app := &appTypes.MockApp{Name: "myapp"}
+	svc, err := AppVersionService()
+	c.Assert(err, check.IsNil)
+
+	_, err = svc.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	err = svc.UnsetVersionChannel(context.TODO(), app, "stable")
+	c.Assert(err, check.Equals, appTypes.ErrVersionChannelNotFound)
+}
@@ -7,6 +7,7 @@ package version
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/app/image"
@@ -114,6 +115,7 @@ func (v *appVersionImpl) CommitSuccessful() error {
 		return err
 	}
 	v.versionInfo.DeploySuccessful = true
+	v.versionInfo.DeployedAt = time.Now().UTC()
 	return v.storage.UpdateVersionSuccess(v.ctx, v.app.GetName(), v.versionInfo)
 }
 
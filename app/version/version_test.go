@@ -238,6 +238,114 @@ func (s *S) TestAppVersionImpl_AddData(c *check.C) {
 				},
 			},
 		},
+		{
+			name: "parse and recover kubernetes process resources",
+			addData: appTypes.AddVersionDataArgs{
+				CustomData: map[string]interface{}{
+					"kubernetes": map[string]interface{}{
+						"groups": map[string]interface{}{
+							"pod1": map[string]interface{}{
+								"worker": map[string]interface{}{
+									"resources": map[string]interface{}{
+										"memory": "256Mi",
+										"cpu":    "100m",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedProcesses: map[string][]string{},
+			expectedPorts:     []string{},
+			expectedYamlData: provTypes.TsuruYamlData{
+				Kubernetes: &provTypes.TsuruYamlKubernetesConfig{
+					Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+						"pod1": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+							"worker": {
+								Ports: []provTypes.TsuruYamlKubernetesProcessPortConfig{},
+								Resources: &provTypes.TsuruYamlKubernetesProcessResources{
+									Memory: "256Mi",
+									CPU:    "100m",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "parse and recover kubernetes sidecars and init containers",
+			addData: appTypes.AddVersionDataArgs{
+				CustomData: map[string]interface{}{
+					"kubernetes": map[string]interface{}{
+						"groups": map[string]interface{}{
+							"pod1": map[string]interface{}{
+								"web": map[string]interface{}{
+									"volume_mounts": []interface{}{
+										map[string]interface{}{"name": "cache", "mount_path": "/cache"},
+									},
+									"sidecars": []interface{}{
+										map[string]interface{}{
+											"name":    "proxy",
+											"image":   "gcr.io/cloudsql-docker/gce-proxy:1.28",
+											"command": []interface{}{"/cloud_sql_proxy"},
+											"env": []interface{}{
+												map[string]interface{}{"name": "PORT", "value": "5432"},
+											},
+											"ports": []interface{}{
+												map[string]interface{}{"port": 5432},
+											},
+										},
+									},
+									"init_containers": []interface{}{
+										map[string]interface{}{
+											"name":  "warmer",
+											"image": "warmer:v1",
+											"volume_mounts": []interface{}{
+												map[string]interface{}{"name": "cache", "mount_path": "/data", "read_only": false},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedProcesses: map[string][]string{},
+			expectedPorts:     []string{},
+			expectedYamlData: provTypes.TsuruYamlData{
+				Kubernetes: &provTypes.TsuruYamlKubernetesConfig{
+					Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+						"pod1": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+							"web": {
+								Ports: []provTypes.TsuruYamlKubernetesProcessPortConfig{},
+								VolumeMounts: []provTypes.TsuruYamlKubernetesVolumeMount{
+									{Name: "cache", MountPath: "/cache"},
+								},
+								Sidecars: []provTypes.TsuruYamlKubernetesContainer{
+									{
+										Name:    "proxy",
+										Image:   "gcr.io/cloudsql-docker/gce-proxy:1.28",
+										Command: []string{"/cloud_sql_proxy"},
+										Env:     []provTypes.TsuruYamlKubernetesEnvVar{{Name: "PORT", Value: "5432"}},
+										Ports:   []provTypes.TsuruYamlKubernetesContainerPort{{Port: 5432}},
+									},
+								},
+								InitContainers: []provTypes.TsuruYamlKubernetesContainer{
+									{
+										Name:         "warmer",
+										Image:        "warmer:v1",
+										VolumeMounts: []provTypes.TsuruYamlKubernetesVolumeMount{{Name: "cache", MountPath: "/data"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 	svc, err := AppVersionService()
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,248 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// AnnotationApplyVPA enables applying the vertical autoscaling
+	// recommendations as process plan overrides. Its value must be either
+	// "deploy", applying them on the next deploy, or "schedule", applying
+	// them periodically and restarting the changed processes.
+	AnnotationApplyVPA = "app.tsuru.io/apply-vpa"
+
+	// AnnotationApplyVPAProcesses restricts the processes receiving the
+	// recommendations, its value is a comma separated list of processes.
+	// All processes are considered when it's not set.
+	AnnotationApplyVPAProcesses = "app.tsuru.io/apply-vpa-processes"
+
+	VPAApplyOnDeploy = "deploy"
+	VPAApplySchedule = "schedule"
+
+	vpaRecommendationType = "target"
+	vpaEventKind          = "vpa-apply"
+)
+
+// VerticalAutoScaleChange describes the resources of a process before and
+// after applying its vertical autoscaling recommendation.
+type VerticalAutoScaleChange struct {
+	Process        string `json:"process"`
+	MemoryBefore   int64  `json:"memoryBefore"`
+	MemoryAfter    int64  `json:"memoryAfter"`
+	CPUMilliBefore int    `json:"cpuMilliBefore"`
+	CPUMilliAfter  int    `json:"cpuMilliAfter"`
+}
+
+// VerticalAutoScaleMode returns when the vertical autoscaling
+// recommendations are applied to the app, or an empty string if they are not
+// applied.
+func (app *App) VerticalAutoScaleMode() string {
+	mode, _ := app.Metadata.Annotation(AnnotationApplyVPA)
+	switch mode {
+	case VPAApplyOnDeploy, VPAApplySchedule:
+		return mode
+	}
+	return ""
+}
+
+func (app *App) verticalAutoScaleProcesses() map[string]struct{} {
+	raw, ok := app.Metadata.Annotation(AnnotationApplyVPAProcesses)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	processes := map[string]struct{}{}
+	for _, p := range strings.Split(raw, ",") {
+		processes[strings.TrimSpace(p)] = struct{}{}
+	}
+	return processes
+}
+
+func (app *App) verticalAutoScaleChanges() ([]VerticalAutoScaleChange, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	autoscaleProv, ok := prov.(provision.AutoScaleProvisioner)
+	if !ok {
+		return nil, nil
+	}
+	recommendations, err := autoscaleProv.GetVerticalAutoScaleRecommendations(app.ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	appPool, err := pool.GetPoolByName(app.ctx, app.Pool)
+	if err != nil {
+		return nil, err
+	}
+	bounds, err := appPool.GetVPABounds()
+	if err != nil {
+		return nil, err
+	}
+	factors := provision.OvercommitFactors{Memory: 1, CPU: 1}
+	if overcommitProv, ok := prov.(provision.OvercommitProvisioner); ok {
+		factors, err = overcommitProv.OvercommitFactors(app.ctx, app)
+		if err != nil {
+			return nil, err
+		}
+	}
+	processes := app.verticalAutoScaleProcesses()
+	var changes []VerticalAutoScaleChange
+	for _, rec := range recommendations {
+		if processes != nil {
+			if _, ok := processes[rec.Process]; !ok {
+				continue
+			}
+		}
+		for _, r := range rec.Recommendations {
+			if r.Type != vpaRecommendationType {
+				continue
+			}
+			memory, err := resource.ParseQuantity(r.Memory)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid memory recommendation for process %q", rec.Process)
+			}
+			cpu, err := resource.ParseQuantity(r.CPU)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid cpu recommendation for process %q", rec.Process)
+			}
+			change := VerticalAutoScaleChange{
+				Process:        rec.Process,
+				MemoryBefore:   app.GetProcessMemory(rec.Process),
+				CPUMilliBefore: app.GetProcessMilliCPU(rec.Process),
+			}
+			change.MemoryAfter, change.CPUMilliAfter = bounds.Clamp(
+				int64(float64(memory.Value())*factors.Memory),
+				int(float64(cpu.MilliValue())*factors.CPU),
+			)
+			if change.MemoryAfter == change.MemoryBefore && change.CPUMilliAfter == change.CPUMilliBefore {
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Process < changes[j].Process
+	})
+	return changes, nil
+}
+
+// ApplyVerticalAutoScaleRecommendations stores the vertical autoscaling
+// recommendations of the app processes as process plan overrides, within the
+// bounds defined by the app pool. An event is recorded with the values before
+// and after the change. The new values take effect on the next deploy or
+// restart of each process.
+//
+// The recommended target is a resource request while the plan is the limit of
+// the units, so the target is multiplied by the overcommit factors of the
+// pool before being bounded and stored.
+func (app *App) ApplyVerticalAutoScaleRecommendations(w io.Writer) (changes []VerticalAutoScaleChange, err error) {
+	changes, err = app.verticalAutoScaleChanges()
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+	updated := *app
+	for _, change := range changes {
+		memory, cpuMilli := change.MemoryAfter, change.CPUMilliAfter
+		updated.Plan.MergeProcessOverride(change.Process, appTypes.PlanOverride{Memory: &memory, CPUMilli: &cpuMilli})
+	}
+	err = checkTeamResourceQuotaChange(app.ctx, app, &updated, appResourcesOpts{})
+	if err != nil {
+		return nil, err
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: app.Name},
+		InternalKind: vpaEventKind,
+		CustomData:   changes,
+		DisableLock:  true,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permTypes.CtxTeam, app.Teams),
+			permission.Context(permTypes.CtxApp, app.Name),
+			permission.Context(permTypes.CtxPool, app.Pool),
+		)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { evt.Done(err) }()
+	app.Plan = updated.Plan
+	for _, change := range changes {
+		fmt.Fprintf(evt, "process %q: memory %d -> %d, cpu %dm -> %dm\n", change.Process,
+			change.MemoryBefore, change.MemoryAfter, change.CPUMilliBefore, change.CPUMilliAfter)
+	}
+	if w != nil {
+		fmt.Fprintf(w, "---- Applied vertical autoscaling recommendations to %d process(es) ----\n", len(changes))
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Only the fields of the changed processes are written, so overrides
+	// updated concurrently through the API aren't lost.
+	set, unset := bson.M{}, bson.M{}
+	for _, change := range changes {
+		override := app.Plan.ProcessOverride[change.Process]
+		prefix := "plan.processoverride." + change.Process
+		if override.Memory != nil {
+			set[prefix+".memory"] = *override.Memory
+		} else {
+			unset[prefix+".memory"] = ""
+		}
+		if override.CPUMilli != nil {
+			set[prefix+".cpumilli"] = *override.CPUMilli
+		} else {
+			unset[prefix+".cpumilli"] = ""
+		}
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// ListByVerticalAutoScaleMode returns the apps applying the vertical
+// autoscaling recommendations in the given mode.
+func ListByVerticalAutoScaleMode(ctx context.Context, mode string) ([]App, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{
+		"metadata.annotations": bson.M{"$elemMatch": bson.M{"name": AnnotationApplyVPA, "value": mode}},
+	}).All(&apps)
+	if err != nil {
+		return nil, err
+	}
+	for i := range apps {
+		apps[i].ctx = ctx
+	}
+	return apps, nil
+}
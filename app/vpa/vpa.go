@@ -0,0 +1,145 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vpa periodically applies the vertical autoscaling recommendations
+// to apps opting in the scheduled mode.
+package vpa
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+)
+
+const (
+	defaultRunInterval = time.Hour
+	applyEventKind     = "vpa-apply-schedule"
+)
+
+var applyTarget = event.Target{Type: event.TargetTypeGlobal, Value: applyEventKind}
+
+func runInterval() time.Duration {
+	if seconds, err := config.GetInt("vpa:apply-interval"); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultRunInterval
+}
+
+func Initialize() error {
+	// Every API replica runs the applier, the throttling and the event lock
+	// ensure a single run per interval across all of them.
+	event.SetThrottling(event.ThrottlingSpec{
+		TargetType: event.TargetTypeGlobal,
+		KindName:   applyEventKind,
+		Time:       runInterval(),
+		Max:        1,
+		AllTargets: true,
+		WaitFinish: true,
+	})
+	a := &applier{once: &sync.Once{}}
+	a.start()
+	shutdown.Register(a)
+	return nil
+}
+
+type applier struct {
+	once   *sync.Once
+	stopCh chan struct{}
+}
+
+func (a *applier) start() {
+	a.once.Do(func() {
+		a.stopCh = make(chan struct{})
+		go a.spin()
+	})
+}
+
+func (a *applier) Shutdown(ctx context.Context) error {
+	if a.stopCh == nil {
+		return nil
+	}
+	a.stopCh <- struct{}{}
+	a.stopCh = nil
+	a.once = &sync.Once{}
+	return nil
+}
+
+func (a *applier) spin() {
+	interval := runInterval()
+	for {
+		runPeriodicApply()
+
+		select {
+		case <-a.stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func runPeriodicApply() (err error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       applyTarget,
+		InternalKind: applyEventKind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permTypes.CtxGlobal, "")),
+	})
+	defer func() {
+		if err != nil {
+			log.Errorf("[vpa apply] %v", err)
+		}
+		if evt != nil {
+			// the finished event is kept so the throttling holds other
+			// replicas until the next interval
+			evt.Done(err)
+		}
+	}()
+	if err != nil {
+		_, isThrottled := err.(event.ErrThrottled)
+		_, isLocked := err.(event.ErrEventLocked)
+		if isThrottled || isLocked {
+			err = nil
+			return
+		}
+		err = errors.Wrap(err, "could not create event")
+		return
+	}
+	err = RunOnce(context.Background(), io.Discard)
+	return
+}
+
+// RunOnce applies the vertical autoscaling recommendations to every app in
+// the scheduled mode, restarting the processes whose resources changed.
+func RunOnce(ctx context.Context, w io.Writer) error {
+	apps, err := app.ListByVerticalAutoScaleMode(ctx, app.VPAApplySchedule)
+	if err != nil {
+		return err
+	}
+	multi := tsuruErrors.NewMultiError()
+	for i := range apps {
+		a := &apps[i]
+		changes, err := a.ApplyVerticalAutoScaleRecommendations(w)
+		if err != nil {
+			multi.Add(errors.Wrapf(err, "unable to apply recommendations to app %q", a.Name))
+			continue
+		}
+		for _, change := range changes {
+			err = a.Restart(ctx, change.Process, "", w)
+			if err != nil {
+				multi.Add(errors.Wrapf(err, "unable to restart process %q of app %q", change.Process, a.Name))
+			}
+		}
+	}
+	return multi.ToError()
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) registerVPAProvisioner(c *check.C, overcommit *provision.OvercommitFactors) func() {
+	oldProvisioner := provision.DefaultProvisioner
+	provision.DefaultProvisioner = "vpaProv"
+	provision.Register("vpaProv", func() (provision.Provisioner, error) {
+		return &provisiontest.AutoScaleProvisioner{
+			FakeProvisioner: provisiontest.ProvisionerInstance,
+			Overcommit:      overcommit,
+			Recommendations: []provision.RecommendedResources{
+				{Process: "web", Recommendations: []provision.RecommendedProcessResources{
+					{Type: "lowerBound", CPU: "10m", Memory: "64Mi"},
+					{Type: "target", CPU: "50m", Memory: "1Gi"},
+				}},
+				{Process: "worker", Recommendations: []provision.RecommendedProcessResources{
+					{Type: "target", CPU: "200m", Memory: "256Mi"},
+				}},
+			},
+		}, nil
+	})
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{
+		Name:        "vpa-pool",
+		Provisioner: "vpaProv",
+		Labels:      map[string]string{"vpa-max-memory": "512Mi", "vpa-min-cpu": "100m"},
+	})
+	c.Assert(err, check.IsNil)
+	return func() {
+		provision.DefaultProvisioner = oldProvisioner
+		provision.Unregister("vpaProv")
+	}
+}
+
+func (s *S) TestApplyVerticalAutoScaleRecommendations(c *check.C) {
+	defer s.registerVPAProvisioner(c, nil)()
+	a := App{
+		Name:      "myapp",
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+		Pool:      "vpa-pool",
+		Metadata: appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationApplyVPA, Value: VPAApplyOnDeploy},
+			{Name: AnnotationApplyVPAProcesses, Value: "web"},
+		}},
+	}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.VerticalAutoScaleMode(), check.Equals, VPAApplyOnDeploy)
+	changes, err := a.ApplyVerticalAutoScaleRecommendations(nil)
+	c.Assert(err, check.IsNil)
+	expected := []VerticalAutoScaleChange{
+		{
+			Process:        "web",
+			MemoryBefore:   a.Plan.Memory,
+			MemoryAfter:    512 * 1024 * 1024,
+			CPUMilliBefore: a.Plan.CPUMilli,
+			CPUMilliAfter:  100,
+		},
+	}
+	c.Assert(changes, check.DeepEquals, expected)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GetProcessMemory("web"), check.Equals, int64(512*1024*1024))
+	c.Assert(dbApp.GetProcessMilliCPU("web"), check.Equals, 100)
+	c.Assert(dbApp.GetProcessMemory("worker"), check.Equals, a.Plan.Memory)
+	c.Assert(eventtest.EventDesc{
+		Target:          event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:            "vpa-apply",
+		StartCustomData: []map[string]interface{}{{"process": "web", "memoryafter": int64(512 * 1024 * 1024), "cpumilliafter": 100}},
+	}, eventtest.HasEvent)
+	changes, err = dbApp.ApplyVerticalAutoScaleRecommendations(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 0)
+}
+
+func (s *S) TestApplyVerticalAutoScaleRecommendationsOvercommit(c *check.C) {
+	defer s.registerVPAProvisioner(c, &provision.OvercommitFactors{Memory: 1.5, CPU: 4})()
+	a := App{
+		Name:      "myapp",
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+		Pool:      "vpa-pool",
+		Metadata: appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationApplyVPA, Value: VPAApplySchedule},
+			{Name: AnnotationApplyVPAProcesses, Value: "worker"},
+		}},
+	}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	changes, err := a.ApplyVerticalAutoScaleRecommendations(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []VerticalAutoScaleChange{
+		{
+			Process:        "worker",
+			MemoryBefore:   a.Plan.Memory,
+			MemoryAfter:    384 * 1024 * 1024,
+			CPUMilliBefore: a.Plan.CPUMilli,
+			CPUMilliAfter:  800,
+		},
+	})
+}
+
+func (s *S) TestApplyVerticalAutoScaleRecommendationsKeepsConcurrentOverrides(c *check.C) {
+	defer s.registerVPAProvisioner(c, nil)()
+	a := App{
+		Name:      "myapp",
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+		Pool:      "vpa-pool",
+		Metadata: appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationApplyVPA, Value: VPAApplySchedule},
+			{Name: AnnotationApplyVPAProcesses, Value: "worker"},
+		}},
+	}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{
+		"$set": bson.M{"plan.processoverride.web.memory": int64(128 * 1024 * 1024)},
+	})
+	c.Assert(err, check.IsNil)
+	changes, err := a.ApplyVerticalAutoScaleRecommendations(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 1)
+	dbApp, err := GetByName(context.TODO(), a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.GetProcessMemory("web"), check.Equals, int64(128*1024*1024))
+	c.Assert(dbApp.GetProcessMemory("worker"), check.Equals, int64(256*1024*1024))
+	c.Assert(dbApp.GetProcessMilliCPU("worker"), check.Equals, 200)
+}
+
+func (s *S) TestListByVerticalAutoScaleMode(c *check.C) {
+	a := App{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Metadata:  appTypes.Metadata{Annotations: []appTypes.MetadataItem{{Name: AnnotationApplyVPA, Value: VPAApplySchedule}}},
+	}
+	err := CreateApp(context.TODO(), &a, s.user)
+	c.Assert(err, check.IsNil)
+	other := App{Name: "other", TeamOwner: s.team.Name}
+	err = CreateApp(context.TODO(), &other, s.user)
+	c.Assert(err, check.IsNil)
+	apps, err := ListByVerticalAutoScaleMode(context.TODO(), VPAApplySchedule)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, "myapp")
+}
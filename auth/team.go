@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/storage"
 	authTypes "github.com/tsuru/tsuru/types/auth"
@@ -77,6 +78,35 @@ func (t *teamService) Update(ctx context.Context, name string, tags []string) er
 	return t.storage.Update(ctx, *team)
 }
 
+// SetResourceQuota sets the resource quota of the team in a pool, replacing
+// the previous one. Setting an unlimited quota removes it.
+func (t *teamService) SetResourceQuota(ctx context.Context, name string, q quota.ResourceQuota) error {
+	if q.Pool == "" {
+		return &tsuruErrors.ValidationError{Message: "pool is required"}
+	}
+	if q.MilliCPU < 0 {
+		q.MilliCPU = -1
+	}
+	if q.Memory < 0 {
+		q.Memory = -1
+	}
+	team, err := t.storage.FindByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	quotas := make([]quota.ResourceQuota, 0, len(team.ResourceQuotas)+1)
+	for _, existing := range team.ResourceQuotas {
+		if existing.Pool != q.Pool {
+			quotas = append(quotas, existing)
+		}
+	}
+	if !q.IsUnlimited() {
+		quotas = append(quotas, q)
+	}
+	team.ResourceQuotas = quotas
+	return t.storage.Update(ctx, *team)
+}
+
 func (t *teamService) List(ctx context.Context) ([]authTypes.Team, error) {
 	return t.storage.FindAll(ctx)
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/globalsign/mgo/bson"
 	authTypes "github.com/tsuru/tsuru/types/auth"
+	"github.com/tsuru/tsuru/types/quota"
 	check "gopkg.in/check.v1"
 )
 
@@ -52,6 +53,37 @@ func (s *S) TestTeamServiceUpdate(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestTeamServiceSetResourceQuota(c *check.C) {
+	var updated *authTypes.Team
+	ts := &teamService{
+		storage: &authTypes.MockTeamStorage{
+			OnFindByName: func(name string) (*authTypes.Team, error) {
+				return &authTypes.Team{Name: name, ResourceQuotas: []quota.ResourceQuota{
+					{Pool: "pool1", MilliCPU: 1000, Memory: -1},
+					{Pool: "pool2", MilliCPU: 2000, Memory: 1024},
+				}}, nil
+			},
+			OnUpdate: func(t authTypes.Team) error {
+				updated = &t
+				return nil
+			},
+		},
+	}
+	err := ts.SetResourceQuota(context.TODO(), "pos", quota.ResourceQuota{Pool: "pool1", MilliCPU: 500, Memory: -10})
+	c.Assert(err, check.IsNil)
+	c.Assert(updated.ResourceQuotas, check.DeepEquals, []quota.ResourceQuota{
+		{Pool: "pool2", MilliCPU: 2000, Memory: 1024},
+		{Pool: "pool1", MilliCPU: 500, Memory: -1},
+	})
+	err = ts.SetResourceQuota(context.TODO(), "pos", quota.ResourceQuota{Pool: "pool2", MilliCPU: -1, Memory: -1})
+	c.Assert(err, check.IsNil)
+	c.Assert(updated.ResourceQuotas, check.DeepEquals, []quota.ResourceQuota{
+		{Pool: "pool1", MilliCPU: 1000, Memory: -1},
+	})
+	err = ts.SetResourceQuota(context.TODO(), "pos", quota.ResourceQuota{MilliCPU: 10})
+	c.Assert(err, check.ErrorMatches, "pool is required")
+}
+
 func (s *S) TestTeamServiceCreateDuplicate(c *check.C) {
 	teamName := "pos"
 	u := authTypes.User{Email: "king@pos.com"}
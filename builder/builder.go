@@ -31,6 +31,7 @@ type BuildOpts struct {
 	ImageID             string
 	Tag                 string
 	Message             string
+	Provenance          *appTypes.AppVersionProvenance
 }
 
 // Builder is the basic interface of this package.
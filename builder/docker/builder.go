@@ -157,7 +157,7 @@ func imageBuild(ctx context.Context, client provision.BuilderDockerClient, app p
 	if err != nil {
 		return nil, err
 	}
-	newVersion, err := pushImageToRegistry(ctx, client, app, imageID, evt, opts.Message)
+	newVersion, err := pushImageToRegistry(ctx, client, app, imageID, evt, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -179,11 +179,12 @@ func imageBuild(ctx context.Context, client provision.BuilderDockerClient, app p
 	return newVersion, nil
 }
 
-func pushImageToRegistry(ctx context.Context, client provision.BuilderDockerClient, app provision.App, imageID string, evt *event.Event, message string) (appTypes.AppVersion, error) {
+func pushImageToRegistry(ctx context.Context, client provision.BuilderDockerClient, app provision.App, imageID string, evt *event.Event, opts *builder.BuildOpts) (appTypes.AppVersion, error) {
 	newVersion, err := servicemanager.AppVersion.NewAppVersion(ctx, appTypes.NewVersionArgs{
 		App:         app,
 		EventID:     evt.UniqueID.Hex(),
-		Description: message,
+		Description: opts.Message,
+		Provenance:  opts.Provenance,
 	})
 	if err != nil {
 		return nil, err
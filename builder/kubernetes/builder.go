@@ -84,6 +84,7 @@ func imageBuild(ctx context.Context, client provision.BuilderKubeClient, a provi
 		App:         a,
 		EventID:     evt.UniqueID.Hex(),
 		Description: opts.Message,
+		Provenance:  opts.Provenance,
 	})
 	if err != nil {
 		return nil, err
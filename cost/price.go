@@ -0,0 +1,55 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cost computes how much the apps, volumes and service instances of
+// teams cost, based on the prices configured by admins.
+package cost
+
+import (
+	"context"
+
+	"github.com/tsuru/tsuru/storage"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+)
+
+type priceService struct {
+	storage costTypes.PriceStorage
+}
+
+var _ costTypes.PriceService = &priceService{}
+
+func PriceStorage() (costTypes.PriceStorage, error) {
+	dbDriver, err := storage.GetCurrentDbDriver()
+	if err != nil {
+		dbDriver, err = storage.GetDefaultDbDriver()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dbDriver.CostPriceStorage, nil
+}
+
+func PriceService() (costTypes.PriceService, error) {
+	storage, err := PriceStorage()
+	if err != nil {
+		return nil, err
+	}
+	return &priceService{storage: storage}, nil
+}
+
+func (s *priceService) Set(ctx context.Context, p costTypes.Price) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+	return s.storage.Upsert(ctx, p)
+}
+
+func (s *priceService) Remove(ctx context.Context, p costTypes.Price) error {
+	return s.storage.Delete(ctx, p)
+}
+
+func (s *priceService) List(ctx context.Context) (costTypes.Prices, error) {
+	return s.storage.FindAll(ctx)
+}
@@ -0,0 +1,665 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cost
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	volumeTypes "github.com/tsuru/tsuru/types/volume"
+)
+
+const (
+	monthFormat = "2006-01"
+
+	// unitEventsLimit bounds the unit events of an app read for a report.
+	unitEventsLimit = 100000
+)
+
+var (
+	ErrInvalidMonth = errors.New("invalid month, must be in the YYYY-MM format")
+
+	now = time.Now
+
+	unitEventKinds = []string{
+		provTypes.UnitEventReady,
+		provTypes.UnitEventNotReady,
+		provTypes.UnitEventEvicted,
+		provTypes.UnitEventDeleted,
+	}
+
+	csvHeader = []string{"kind", "name", "team", "process", "pool", "service", "plan", "units", "hours", "hourly_price", "cost", "forecast"}
+)
+
+// ParseMonth parses a month in the YYYY-MM format, the current month is
+// returned for an empty string.
+func ParseMonth(month string) (time.Time, error) {
+	if month == "" {
+		current := now().UTC()
+		return time.Date(current.Year(), current.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	t, err := time.Parse(monthFormat, month)
+	if err != nil {
+		return time.Time{}, ErrInvalidMonth
+	}
+	return t, nil
+}
+
+// MonthUnavailableError is returned for reports of months starting before
+// the oldest unit event kept, as the unit-hours of the month can't be
+// computed anymore.
+type MonthUnavailableError struct {
+	Month  time.Time
+	Oldest time.Time
+}
+
+func (e *MonthUnavailableError) Error() string {
+	return fmt.Sprintf("no report for %s, unit events are only kept for reports from %s on",
+		e.Month.Format(monthFormat), e.Oldest.Format(monthFormat))
+}
+
+// oldestMonth returns the first month starting after the oldest unit event
+// kept with the retention.
+func oldestMonth(current time.Time, retention time.Duration) time.Time {
+	oldest := current.Add(-retention)
+	month := time.Date(oldest.Year(), oldest.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month.Before(oldest) {
+		month = month.AddDate(0, 1, 0)
+	}
+	return month
+}
+
+// period is the month of a report. Costs are computed from start to until,
+// the current time for the current month, and forecast from until to end.
+type period struct {
+	start time.Time
+	end   time.Time
+	until time.Time
+	now   time.Time
+}
+
+func newPeriod(month time.Time) period {
+	p := period{start: month, end: month.AddDate(0, 1, 0), now: now().UTC()}
+	p.until = p.now
+	if p.until.Before(p.start) {
+		p.until = p.start
+	}
+	if p.until.After(p.end) {
+		p.until = p.end
+	}
+	return p
+}
+
+// reportPeriod returns the period of the month, as long as the unit events
+// of the whole month are still kept.
+func reportPeriod(ctx context.Context, month time.Time) (period, error) {
+	p := newPeriod(month)
+	retention, err := servicemanager.UnitEvent.Retention(ctx)
+	if err != nil {
+		return p, err
+	}
+	if oldest := oldestMonth(p.now, retention); p.start.Before(oldest) {
+		return p, &MonthUnavailableError{Month: p.start, Oldest: oldest}
+	}
+	return p, nil
+}
+
+// hoursBetween returns the hours from from until to, zero for open ends,
+// within the costs of the period.
+func (p period) hoursBetween(from, to time.Time) float64 {
+	if from.Before(p.start) {
+		from = p.start
+	}
+	if to.IsZero() || to.After(p.until) {
+		to = p.until
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return to.Sub(from).Hours()
+}
+
+func (p period) remainingHours() float64 {
+	return p.end.Sub(p.until).Hours()
+}
+
+// TeamReport returns the cost, in the month, of the apps, volumes and service
+// instances owned by the team. Resources removed or moved to other teams
+// since the start of the month are found from the snapshots kept in their
+// events, they're charged for the time the team owned them.
+func TeamReport(ctx context.Context, team string, month time.Time) (*costTypes.Report, error) {
+	prices, err := servicemanager.CostPrice.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := reportPeriod(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+	report := newReport(p)
+	report.Team = team
+	apps, err := app.List(ctx, &app.Filter{TeamOwner: team})
+	if err != nil {
+		return nil, err
+	}
+	currentApps := map[string]*app.App{}
+	for i := range apps {
+		currentApps[apps[i].Name] = &apps[i]
+	}
+	pastApps, err := teamTargets(event.TargetTypeApp, appHistoryKinds, team, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pastApps {
+		if _, ok := currentApps[name]; ok {
+			continue
+		}
+		a, err := app.GetByName(ctx, name)
+		if err != nil && err != appTypes.ErrAppNotFound {
+			return nil, err
+		}
+		currentApps[name] = a
+	}
+	for name, a := range currentApps {
+		items, err := appItems(ctx, name, a, team, prices, p)
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, items...)
+	}
+	volumes, err := servicemanager.Volume.ListByFilter(ctx, &volumeTypes.Filter{Teams: []string{team}})
+	if err != nil {
+		return nil, err
+	}
+	currentVolumes := map[string]*Snapshot{}
+	for _, v := range volumes {
+		if v.TeamOwner != team {
+			continue
+		}
+		snapshot := VolumeSnapshot(&v)
+		currentVolumes[v.Name] = &snapshot
+	}
+	pastVolumes, err := teamTargets(event.TargetTypeVolume, volumeHistoryKinds, team, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pastVolumes {
+		if _, ok := currentVolumes[name]; ok {
+			continue
+		}
+		v, err := servicemanager.Volume.Get(ctx, name)
+		if err != nil && err != volumeTypes.ErrVolumeNotFound {
+			return nil, err
+		}
+		currentVolumes[name] = nil
+		if v != nil {
+			snapshot := VolumeSnapshot(v)
+			currentVolumes[name] = &snapshot
+		}
+	}
+	for name, current := range currentVolumes {
+		items, err := fixedItems(costTypes.KindVolume, event.Target{Type: event.TargetTypeVolume, Value: name}, permission.PermVolumeCreate, volumeHistoryKinds, current, team, prices, p)
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, items...)
+	}
+	instances, err := service.GetServicesInstancesByTeamsAndNames([]string{team}, []string{}, "", "")
+	if err != nil {
+		return nil, err
+	}
+	currentInstances := map[string]*Snapshot{}
+	for i := range instances {
+		if instances[i].TeamOwner != team {
+			continue
+		}
+		snapshot := ServiceInstanceSnapshot(&instances[i])
+		currentInstances[instances[i].ServiceName+"/"+instances[i].Name] = &snapshot
+	}
+	pastInstances, err := teamTargets(event.TargetTypeServiceInstance, serviceInstanceHistoryKinds, team, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pastInstances {
+		if _, ok := currentInstances[name]; ok {
+			continue
+		}
+		currentInstances[name] = nil
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		si, err := service.GetServiceInstance(ctx, parts[0], parts[1])
+		if err != nil && err != service.ErrServiceInstanceNotFound {
+			return nil, err
+		}
+		if si != nil {
+			snapshot := ServiceInstanceSnapshot(si)
+			currentInstances[name] = &snapshot
+		}
+	}
+	for name, current := range currentInstances {
+		items, err := fixedItems(costTypes.KindServiceInstance, event.Target{Type: event.TargetTypeServiceInstance, Value: name}, permission.PermServiceInstanceCreate, serviceInstanceHistoryKinds, current, team, prices, p)
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, items...)
+	}
+	summarize(report)
+	return report, nil
+}
+
+// AppReport returns the cost of the units of the app in the month. Volumes
+// and service instances are charged to the teams owning them, they're only
+// present in team reports.
+func AppReport(ctx context.Context, a *app.App, month time.Time) (*costTypes.Report, error) {
+	prices, err := servicemanager.CostPrice.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := reportPeriod(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+	report := newReport(p)
+	report.Team = a.TeamOwner
+	report.App = a.Name
+	items, err := appItems(ctx, a.Name, a, "", prices, p)
+	if err != nil {
+		return nil, err
+	}
+	report.Items = append(report.Items, items...)
+	summarize(report)
+	return report, nil
+}
+
+// WriteCSV writes the items of the report as CSV, one per line, followed by
+// the totals.
+func WriteCSV(w io.Writer, report *costTypes.Report) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		err = writer.Write([]string{
+			item.Kind,
+			item.Name,
+			item.Team,
+			item.Process,
+			item.Pool,
+			item.Service,
+			item.Plan,
+			strconv.Itoa(item.Units),
+			formatFloat(item.Hours),
+			formatFloat(item.HourlyPrice),
+			formatFloat(item.Cost),
+			formatFloat(item.Forecast),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = writer.Write([]string{"total", report.App, report.Team, "", "", "", "", "", "", "", formatFloat(report.Cost), formatFloat(report.Forecast)})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+func newReport(p period) *costTypes.Report {
+	currency, _ := config.GetString("cost:currency")
+	return &costTypes.Report{
+		Start:       p.start,
+		End:         p.end,
+		GeneratedAt: p.now,
+		Currency:    currency,
+		Items:       []costTypes.Item{},
+	}
+}
+
+func summarize(report *costTypes.Report) {
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if a.Kind != b.Kind {
+			return a.Kind > b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Process < b.Process
+	})
+	for _, item := range report.Items {
+		report.Cost += item.Cost
+		report.Forecast += item.Forecast
+	}
+}
+
+// itemKey groups the cost of the segments of a resource with the same
+// state in a single item.
+type itemKey struct {
+	process string
+	team    string
+	pool    string
+	service string
+	plan    string
+	hourly  float64
+}
+
+// items accumulates the items of a resource, in the order they're added.
+type items struct {
+	keys  []itemKey
+	items map[itemKey]*costTypes.Item
+}
+
+func (is *items) get(key itemKey, template costTypes.Item) *costTypes.Item {
+	if is.items == nil {
+		is.items = map[itemKey]*costTypes.Item{}
+	}
+	item, ok := is.items[key]
+	if !ok {
+		item = &template
+		item.HourlyPrice = key.hourly
+		is.items[key] = item
+		is.keys = append(is.keys, key)
+	}
+	return item
+}
+
+func (is *items) list() []costTypes.Item {
+	result := make([]costTypes.Item, 0, len(is.keys))
+	for _, key := range is.keys {
+		item := is.items[key]
+		item.Cost = item.Hours * item.HourlyPrice
+		item.Forecast += item.Cost
+		result = append(result, *item)
+	}
+	return result
+}
+
+// fixedItems returns the cost of a volume or service instance, charged by
+// the hour from its creation until its removal, with the plan of each of its
+// states. current is the state of a resource still existing.
+func fixedItems(kind string, target event.Target, createKind *permission.PermissionScheme, kinds []string, current *Snapshot, team string, prices costTypes.Prices, p period) ([]costTypes.Item, error) {
+	since, err := createdSince(target, createKind, p)
+	if err != nil {
+		return nil, err
+	}
+	if !since.Before(p.end) {
+		return nil, nil
+	}
+	h, err := resourceHistory(target, kinds, current, p)
+	if err != nil {
+		return nil, err
+	}
+	name := target.Value
+	if kind == costTypes.KindServiceInstance {
+		if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+			name = parts[1]
+		}
+	}
+	var result items
+	for _, seg := range h.segments(team) {
+		if !seg.to.IsZero() && !seg.to.After(since) {
+			continue
+		}
+		scope := seg.Pool
+		if kind == costTypes.KindServiceInstance {
+			scope = seg.Service
+		}
+		price, _ := prices.Find(kind, scope, seg.Plan)
+		key := itemKey{team: seg.TeamOwner, pool: seg.Pool, service: seg.Service, plan: seg.Plan, hourly: price.Hourly}
+		item := result.get(key, costTypes.Item{
+			Kind:    kind,
+			Name:    name,
+			Team:    seg.TeamOwner,
+			Pool:    seg.Pool,
+			Service: seg.Service,
+			Plan:    seg.Plan,
+		})
+		item.Hours += p.hoursBetween(latest(seg.from, since), seg.to)
+		if seg.to.IsZero() {
+			item.Forecast += price.Hourly * p.remainingHours()
+		}
+	}
+	return result.list(), nil
+}
+
+// appItems returns the cost of the units of an app, by process, priced with
+// the plan and pool of each state of the app. current is nil for removed
+// apps. Only the states owned by team are charged, when it's not empty.
+func appItems(ctx context.Context, name string, current *app.App, team string, prices costTypes.Prices, p period) ([]costTypes.Item, error) {
+	target := event.Target{Type: event.TargetTypeApp, Value: name}
+	since, err := createdSince(target, permission.PermAppCreate, p)
+	if err != nil {
+		return nil, err
+	}
+	if !since.Before(p.end) {
+		return nil, nil
+	}
+	var currentState *Snapshot
+	var units []provision.Unit
+	if current != nil {
+		snapshot := AppSnapshot(current)
+		currentState = &snapshot
+		units, err = current.Units()
+		if err != nil {
+			return nil, err
+		}
+	}
+	h, err := resourceHistory(target, appHistoryKinds, currentState, p)
+	if err != nil {
+		return nil, err
+	}
+	segments := h.segments(team)
+	if len(segments) == 0 {
+		return nil, nil
+	}
+	events, err := servicemanager.UnitEvent.List(ctx, provTypes.UnitEventFilter{
+		App:   name,
+		Kinds: unitEventKinds,
+		Since: since,
+		Limit: unitEventsLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	intervals, running := unitIntervals(events, units, since, p.now, h.removed)
+	var result items
+	for _, seg := range segments {
+		if !seg.to.IsZero() && !seg.to.After(since) {
+			continue
+		}
+		plan := appTypes.Plan{Name: seg.Plan}
+		if seg.AppPlan != nil {
+			plan = *seg.AppPlan
+		}
+		segApp := &app.App{Name: name, TeamOwner: seg.TeamOwner, Pool: seg.Pool, Plan: plan}
+		segApp.ReplaceContext(ctx)
+		price, _ := prices.Find(costTypes.KindUnit, seg.Pool, seg.Plan)
+		segItem := func(process string) (*costTypes.Item, error) {
+			resources, err := app.UnitResources(segApp, process)
+			if err != nil {
+				return nil, err
+			}
+			hourly := price.UnitHourly(resources.MilliCPU, resources.Memory)
+			key := itemKey{process: process, team: seg.TeamOwner, pool: seg.Pool, plan: seg.Plan, hourly: hourly}
+			return result.get(key, costTypes.Item{
+				Kind:    costTypes.KindUnit,
+				Name:    name,
+				Team:    seg.TeamOwner,
+				Process: process,
+				Pool:    seg.Pool,
+				Plan:    seg.Plan,
+			}), nil
+		}
+		from := latest(seg.from, since)
+		hours := map[string]float64{}
+		for _, in := range intervals {
+			if in.from.Before(from) {
+				in.from = from
+			}
+			if !seg.to.IsZero() && in.to.After(seg.to) {
+				in.to = seg.to
+			}
+			hours[in.process] += p.hoursBetween(in.from, in.to)
+		}
+		for process, h := range hours {
+			if h == 0 {
+				continue
+			}
+			item, err := segItem(process)
+			if err != nil {
+				return nil, err
+			}
+			item.Hours += h
+		}
+		if !seg.to.IsZero() {
+			continue
+		}
+		for process, n := range running {
+			item, err := segItem(process)
+			if err != nil {
+				return nil, err
+			}
+			item.Units = n
+			item.Forecast += item.HourlyPrice * float64(n) * p.remainingHours()
+		}
+	}
+	return result.list(), nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// createdSince returns the time the target was created in the period, from
+// its creation event, or the start of the period if it was created before.
+func createdSince(target event.Target, kind *permission.PermissionScheme, p period) (time.Time, error) {
+	evts, err := event.List(&event.Filter{
+		Target:    target,
+		KindNames: []string{kind.FullName()},
+		Since:     p.start,
+		Limit:     1,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, evt := range evts {
+		if evt.Error == "" && evt.StartTime.After(p.start) {
+			return evt.StartTime.UTC(), nil
+		}
+	}
+	return p.start, nil
+}
+
+type unitState struct {
+	process      string
+	running      bool
+	runningSince time.Time
+}
+
+// unitInterval is a time a unit of the process was running.
+type unitInterval struct {
+	process string
+	from    time.Time
+	to      time.Time
+}
+
+// unitIntervals returns the intervals the units of an app ran from since on,
+// and how many units each process has now. Units run from their ready events
+// to their not-ready, evicted or deleted events, units with no events since
+// were already running then. Units still running at their last event but
+// missing from, or stopped in, units went away without a recorded event,
+// they stop at gone, when the app was removed, or at the last event of the
+// app.
+func unitIntervals(events []provTypes.UnitEvent, units []provision.Unit, since, current, gone time.Time) ([]unitInterval, map[string]int) {
+	events = append([]provTypes.UnitEvent(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	var intervals []unitInterval
+	add := func(process string, from, to time.Time) {
+		if from.Before(since) {
+			from = since
+		}
+		if to.After(from) {
+			intervals = append(intervals, unitInterval{process: process, from: from, to: to})
+		}
+	}
+	states := map[string]*unitState{}
+	var unitOrder []string
+	for _, evt := range events {
+		st, seen := states[evt.Unit]
+		if !seen {
+			st = &unitState{process: evt.Process}
+			states[evt.Unit] = st
+			unitOrder = append(unitOrder, evt.Unit)
+		}
+		switch evt.Kind {
+		case provTypes.UnitEventReady:
+			if !st.running {
+				st.running = true
+				st.runningSince = evt.Time
+			}
+		case provTypes.UnitEventNotReady, provTypes.UnitEventEvicted, provTypes.UnitEventDeleted:
+			if st.running {
+				add(st.process, st.runningSince, evt.Time)
+			} else if !seen {
+				add(st.process, since, evt.Time)
+			}
+			st.running = false
+		}
+	}
+	running := map[string]int{}
+	for _, u := range units {
+		if u.Status == provision.StatusStopped || u.Status == provision.StatusAsleep {
+			continue
+		}
+		running[u.ProcessName]++
+		st, seen := states[u.Name]
+		if !seen {
+			add(u.ProcessName, since, current)
+		} else if st.running {
+			add(st.process, st.runningSince, current)
+			st.running = false
+		}
+	}
+	end := gone
+	if end.IsZero() && len(events) > 0 {
+		end = events[len(events)-1].Time
+	}
+	for _, unit := range unitOrder {
+		if st := states[unit]; st.running {
+			add(st.process, st.runningSince, end)
+		}
+	}
+	return intervals, running
+}
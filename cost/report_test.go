@@ -0,0 +1,201 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cost
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestParseMonth(c *check.C) {
+	month, err := ParseMonth("2022-03")
+	c.Assert(err, check.IsNil)
+	c.Assert(month, check.DeepEquals, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC))
+	month, err = ParseMonth("")
+	c.Assert(err, check.IsNil)
+	c.Assert(month, check.DeepEquals, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+	_, err = ParseMonth("03/2022")
+	c.Assert(err, check.Equals, ErrInvalidMonth)
+}
+
+func (s *S) TestPeriod(c *check.C) {
+	p := newPeriod(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(p.hoursBetween(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), time.Time{}), check.Equals, float64(10*24+12))
+	c.Assert(p.hoursBetween(time.Date(2022, 5, 11, 0, 0, 0, 0, time.UTC), time.Time{}), check.Equals, float64(12))
+	c.Assert(p.hoursBetween(time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC), time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC)), check.Equals, float64(24))
+	c.Assert(p.hoursBetween(time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC), time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC)), check.Equals, float64(0))
+	c.Assert(p.remainingHours(), check.Equals, float64(20*24+12))
+	p = newPeriod(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(p.hoursBetween(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), time.Time{}), check.Equals, float64(30*24))
+	c.Assert(p.hoursBetween(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC)), check.Equals, float64(30*24))
+	c.Assert(p.remainingHours(), check.Equals, float64(0))
+	p = newPeriod(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(p.hoursBetween(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), time.Time{}), check.Equals, float64(0))
+	c.Assert(p.remainingHours(), check.Equals, float64(30*24))
+}
+
+func (s *S) TestPricesFind(c *check.C) {
+	prices := costTypes.Prices{
+		{Kind: costTypes.KindUnit, Hourly: 1},
+		{Kind: costTypes.KindUnit, Pool: "prod", Hourly: 2},
+		{Kind: costTypes.KindUnit, Plan: "large", Hourly: 3},
+		{Kind: costTypes.KindUnit, Pool: "prod", Plan: "large", Hourly: 4},
+		{Kind: costTypes.KindServiceInstance, Service: "mysql", Hourly: 5},
+	}
+	tests := []struct {
+		kind, scope, plan string
+		hourly            float64
+		found             bool
+	}{
+		{costTypes.KindUnit, "prod", "large", 4, true},
+		{costTypes.KindUnit, "dev", "large", 3, true},
+		{costTypes.KindUnit, "prod", "small", 2, true},
+		{costTypes.KindUnit, "dev", "small", 1, true},
+		{costTypes.KindServiceInstance, "mysql", "small", 5, true},
+		{costTypes.KindServiceInstance, "redis", "small", 0, false},
+		{costTypes.KindVolume, "prod", "ebs", 0, false},
+	}
+	for _, tt := range tests {
+		price, found := prices.Find(tt.kind, tt.scope, tt.plan)
+		c.Check(found, check.Equals, tt.found, check.Commentf("%+v", tt))
+		c.Check(price.Hourly, check.Equals, tt.hourly, check.Commentf("%+v", tt))
+	}
+}
+
+func (s *S) TestPriceValidate(c *check.C) {
+	c.Assert(costTypes.Price{Kind: costTypes.KindUnit, CPUHourly: 0.1, MemoryHourly: 0.2}.Validate(), check.IsNil)
+	c.Assert(costTypes.Price{Kind: "node"}.Validate(), check.Equals, costTypes.ErrInvalidPriceKind)
+	c.Assert(costTypes.Price{Kind: costTypes.KindVolume, Hourly: -1}.Validate(), check.Equals, costTypes.ErrNegativePrice)
+	c.Assert(costTypes.Price{Kind: costTypes.KindVolume, CPUHourly: 1}.Validate(), check.Equals, costTypes.ErrInvalidPrice)
+	c.Assert(costTypes.Price{Kind: costTypes.KindServiceInstance, Pool: "prod"}.Validate(), check.Equals, costTypes.ErrInvalidPricePool)
+	price := costTypes.Price{Kind: costTypes.KindUnit, Hourly: 0.01, CPUHourly: 0.04, MemoryHourly: 0.02}
+	c.Assert(price.UnitHourly(500, 2*1024*1024*1024), check.Equals, 0.01+0.02+0.04)
+}
+
+func intervalHours(intervals []unitInterval, since, until time.Time) map[string]float64 {
+	hours := map[string]float64{}
+	for _, in := range intervals {
+		from, to := in.from, in.to
+		if from.Before(since) {
+			from = since
+		}
+		if to.After(until) {
+			to = until
+		}
+		if to.After(from) {
+			hours[in.process] += to.Sub(from).Hours()
+		}
+	}
+	return hours
+}
+
+func (s *S) TestUnitIntervals(c *check.C) {
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	events := []provTypes.UnitEvent{
+		// ready before the period, not ready 10 hours into it
+		{Unit: "web-1", Process: "web", Kind: provTypes.UnitEventNotReady, Time: at(10)},
+		// two intervals, 5 and 3 hours
+		{Unit: "web-2", Process: "web", Kind: provTypes.UnitEventReady, Time: at(2)},
+		{Unit: "web-2", Process: "web", Kind: provTypes.UnitEventNotReady, Time: at(7)},
+		{Unit: "web-2", Process: "web", Kind: provTypes.UnitEventReady, Time: at(8)},
+		{Unit: "web-2", Process: "web", Kind: provTypes.UnitEventEvicted, Time: at(11)},
+		// still running, from hour 20
+		{Unit: "worker-1", Process: "worker", Kind: provTypes.UnitEventReady, Time: at(20)},
+		// ready after until
+		{Unit: "web-4", Process: "web", Kind: provTypes.UnitEventReady, Time: at(50)},
+		// deleted while ready, 4 hours
+		{Unit: "web-6", Process: "web", Kind: provTypes.UnitEventReady, Time: at(5)},
+		{Unit: "web-6", Process: "web", Kind: provTypes.UnitEventDeleted, Time: at(9)},
+	}
+	units := []provision.Unit{
+		{Name: "worker-1", ProcessName: "worker", Status: provision.StatusStarted},
+		{Name: "web-3", ProcessName: "web", Status: provision.StatusStarted},
+		{Name: "web-4", ProcessName: "web", Status: provision.StatusStarted},
+		{Name: "web-5", ProcessName: "web", Status: provision.StatusStopped},
+	}
+	intervals, running := unitIntervals(events, units, start, at(60), time.Time{})
+	// web-1: 10, web-2: 5+3, web-3: 30 (running with no events), web-6: 4
+	c.Assert(intervalHours(intervals, start, at(30)), check.DeepEquals, map[string]float64{"web": 52, "worker": 10})
+	c.Assert(running, check.DeepEquals, map[string]int{"web": 2, "worker": 1})
+}
+
+func (s *S) TestUnitIntervalsUnitGoneWithoutEvent(c *check.C) {
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	events := []provTypes.UnitEvent{
+		// removed with no deletion recorded, replaced by web-2 at hour 12
+		{Unit: "web-1", Process: "web", Kind: provTypes.UnitEventReady, Time: at(2)},
+		{Unit: "web-2", Process: "web", Kind: provTypes.UnitEventReady, Time: at(12)},
+	}
+	units := []provision.Unit{
+		{Name: "web-2", ProcessName: "web", Status: provision.StatusStarted},
+	}
+	intervals, running := unitIntervals(events, units, start, at(20), time.Time{})
+	// web-1 stops at the last event of the app: 10, web-2: 8
+	c.Assert(intervalHours(intervals, start, at(20)), check.DeepEquals, map[string]float64{"web": 18})
+	c.Assert(running, check.DeepEquals, map[string]int{"web": 1})
+	// units of a removed app stop when it was removed
+	intervals, running = unitIntervals(events, nil, start, at(20), at(15))
+	c.Assert(intervalHours(intervals, start, at(20)), check.DeepEquals, map[string]float64{"web": 13 + 3})
+	c.Assert(running, check.DeepEquals, map[string]int{})
+}
+
+func (s *S) TestHistorySegments(c *check.C) {
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	h := history{states: []state{
+		{Snapshot: Snapshot{TeamOwner: "myteam", Pool: "dev", Plan: "small"}, until: at(10)},
+		{Snapshot: Snapshot{TeamOwner: "myteam", Pool: "prod", Plan: "small"}, until: at(20)},
+		{Snapshot: Snapshot{TeamOwner: "other", Pool: "prod", Plan: "large"}},
+	}}
+	c.Assert(h.segments("myteam"), check.DeepEquals, []segment{
+		{Snapshot: Snapshot{TeamOwner: "myteam", Pool: "dev", Plan: "small"}, to: at(10)},
+		{Snapshot: Snapshot{TeamOwner: "myteam", Pool: "prod", Plan: "small"}, from: at(10), to: at(20)},
+	})
+	c.Assert(h.segments(""), check.HasLen, 3)
+	c.Assert(h.segments("other"), check.DeepEquals, []segment{
+		{Snapshot: Snapshot{TeamOwner: "other", Pool: "prod", Plan: "large"}, from: at(20)},
+	})
+}
+
+func (s *S) TestWriteCSV(c *check.C) {
+	report := &costTypes.Report{
+		Team:  "myteam",
+		Start: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+		Items: []costTypes.Item{
+			{Kind: costTypes.KindUnit, Name: "myapp", Team: "myteam", Process: "web", Pool: "prod", Plan: "small", Units: 2, Hours: 10, HourlyPrice: 0.5, Cost: 5, Forecast: 12.25},
+			{Kind: costTypes.KindServiceInstance, Name: "mydb", Team: "myteam", Service: "mysql", Plan: "small", Hours: 5, HourlyPrice: 1, Cost: 5, Forecast: 8},
+		},
+		Cost:     10,
+		Forecast: 20.25,
+	}
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, report)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, `kind,name,team,process,pool,service,plan,units,hours,hourly_price,cost,forecast
+unit,myapp,myteam,web,prod,,small,2,10.0000,0.5000,5.0000,12.2500
+service-instance,mydb,myteam,,,mysql,small,0,5.0000,1.0000,5.0000,8.0000
+total,,myteam,,,,,,,,10.0000,20.2500
+`)
+}
+
+func (s *S) TestOldestMonth(c *check.C) {
+	current := time.Date(2022, 5, 11, 12, 0, 0, 0, time.UTC)
+	c.Assert(oldestMonth(current, 62*24*time.Hour), check.DeepEquals, time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(oldestMonth(current, 7*24*time.Hour), check.DeepEquals, time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(oldestMonth(current, 10*24*time.Hour+12*time.Hour), check.DeepEquals, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+}
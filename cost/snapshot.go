@@ -0,0 +1,161 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cost
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/service"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	volumeTypes "github.com/tsuru/tsuru/types/volume"
+)
+
+// historyEventsLimit bounds the events read for the history of the resources
+// of a report.
+const historyEventsLimit = 10000
+
+var (
+	appHistoryKinds             = []string{permission.PermAppUpdate.FullName(), permission.PermAppDelete.FullName()}
+	volumeHistoryKinds          = []string{permission.PermVolumeDelete.FullName()}
+	serviceInstanceHistoryKinds = []string{permission.PermServiceInstanceDelete.FullName()}
+)
+
+// Snapshot is the state of an app, volume or service instance charged in cost
+// reports. It's kept in the events updating or removing them, as the state
+// they had until the event, so reports of past months charge resources
+// removed since with the team, pool and plan they had then.
+type Snapshot struct {
+	TeamOwner string
+	Pool      string
+	Service   string
+	Plan      string
+	// AppPlan is the plan of an app, with its overrides.
+	AppPlan *appTypes.Plan `bson:",omitempty"`
+}
+
+func AppSnapshot(a *app.App) Snapshot {
+	plan := a.Plan
+	return Snapshot{TeamOwner: a.TeamOwner, Pool: a.Pool, Plan: plan.Name, AppPlan: &plan}
+}
+
+func VolumeSnapshot(v *volumeTypes.Volume) Snapshot {
+	return Snapshot{TeamOwner: v.TeamOwner, Pool: v.Pool, Plan: v.Plan.Name}
+}
+
+func ServiceInstanceSnapshot(si *service.ServiceInstance) Snapshot {
+	return Snapshot{TeamOwner: si.TeamOwner, Pool: si.Pool, Service: si.ServiceName, Plan: si.PlanName}
+}
+
+// state is a snapshot of a resource until a time, the current state of a
+// resource has a zero until.
+type state struct {
+	Snapshot
+	until time.Time
+}
+
+// history is the states of a resource from the start of a period on, and
+// when it was removed, zero for resources still existing.
+type history struct {
+	states  []state
+	removed time.Time
+}
+
+// segment is the interval in which a resource had a state, a zero to is an
+// interval still open.
+type segment struct {
+	Snapshot
+	from time.Time
+	to   time.Time
+}
+
+// resourceHistory returns the history of the target from the snapshots of its
+// successful events of the kinds since the start of the period. current is
+// the state of a resource still existing, nil for removed ones. Events
+// recorded before snapshots were kept are ignored.
+func resourceHistory(target event.Target, kinds []string, current *Snapshot, p period) (history, error) {
+	var h history
+	running := false
+	evts, err := event.List(&event.Filter{
+		Target:    target,
+		KindNames: kinds,
+		Since:     p.start,
+		Running:   &running,
+		Raw:       bson.M{"error": ""},
+		Sort:      "starttime",
+		Limit:     historyEventsLimit,
+	})
+	if err != nil {
+		return h, err
+	}
+	for _, evt := range evts {
+		var snapshot Snapshot
+		if err := evt.OtherData(&snapshot); err != nil || snapshot.TeamOwner == "" {
+			continue
+		}
+		h.states = append(h.states, state{Snapshot: snapshot, until: evt.StartTime.UTC()})
+		if current == nil && isRemoval(evt.Kind.Name) {
+			h.removed = evt.StartTime.UTC()
+			return h, nil
+		}
+	}
+	if current != nil {
+		h.states = append(h.states, state{Snapshot: *current})
+	}
+	return h, nil
+}
+
+func isRemoval(kind string) bool {
+	switch kind {
+	case permission.PermAppDelete.FullName(), permission.PermVolumeDelete.FullName(), permission.PermServiceInstanceDelete.FullName():
+		return true
+	}
+	return false
+}
+
+// segments returns the interval of each state of the history, only the ones
+// owned by team when it's not empty.
+func (h history) segments(team string) []segment {
+	var segments []segment
+	var from time.Time
+	for _, st := range h.states {
+		if team == "" || st.TeamOwner == team {
+			segments = append(segments, segment{Snapshot: st.Snapshot, from: from, to: st.until})
+		}
+		from = st.until
+	}
+	return segments
+}
+
+// teamTargets returns the names of the targets of the type with events of
+// the kinds, since the start of the period, keeping snapshots owned by the
+// team. These are resources removed or moved to other teams since.
+func teamTargets(targetType event.TargetType, kinds []string, team string, p period) ([]string, error) {
+	running := false
+	evts, err := event.List(&event.Filter{
+		Target:    event.Target{Type: targetType},
+		KindNames: kinds,
+		Since:     p.start,
+		Running:   &running,
+		Raw:       bson.M{"error": "", "othercustomdata.teamowner": team},
+		Limit:     historyEventsLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	var names []string
+	for _, evt := range evts {
+		if _, ok := seen[evt.Target.Value]; ok {
+			continue
+		}
+		seen[evt.Target.Value] = struct{}{}
+		names = append(names, evt.Target.Value)
+	}
+	return names, nil
+}
@@ -114,6 +114,7 @@ var (
 	TargetTypeWebhook         = TargetType("webhook")
 	TargetTypeGC              = TargetType("gc")
 	TargetTypeRouter          = TargetType("router")
+	TargetTypePipeline        = TargetType("pipeline")
 )
 
 const (
@@ -283,6 +284,8 @@ func GetTargetType(t string) (TargetType, error) {
 		return TargetTypeWebhook, nil
 	case "router":
 		return TargetTypeRouter, nil
+	case "pipeline":
+		return TargetTypePipeline, nil
 	}
 	return TargetType(""), ErrInvalidTargetType
 }
@@ -383,6 +386,8 @@ type Event struct {
 	eventData
 	logMu     sync.Mutex
 	logWriter io.Writer
+	phaseMu   sync.Mutex
+	phases    []Phase
 }
 
 type ExtraTarget struct {
@@ -0,0 +1,90 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+)
+
+// Phase is a step of a long running event, like the build or the rollout of
+// a process during a deploy.
+type Phase struct {
+	Name      string    `json:"name"`
+	Process   string    `json:"process,omitempty" bson:",omitempty"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime" bson:",omitempty"`
+	Error     string    `json:"error,omitempty" bson:",omitempty"`
+}
+
+// Duration returns how long the phase took, or zero if it's still running.
+func (p Phase) Duration() time.Duration {
+	if p.EndTime.IsZero() {
+		return 0
+	}
+	return p.EndTime.Sub(p.StartTime)
+}
+
+// StartPhase records the beginning of a phase in the event custom data. The
+// returned function must be called with the phase outcome once it ends.
+func (e *Event) StartPhase(name string) func(error) {
+	return e.startPhase(Phase{Name: name})
+}
+
+// StartProcessPhase is like StartPhase for phases bound to a single process
+// of an app, like its rollout.
+func (e *Event) StartProcessPhase(name, process string) func(error) {
+	return e.startPhase(Phase{Name: name, Process: process})
+}
+
+// Phases returns a copy of the phases recorded so far.
+func (e *Event) Phases() []Phase {
+	e.phaseMu.Lock()
+	defer e.phaseMu.Unlock()
+	return append([]Phase(nil), e.phases...)
+}
+
+func (e *Event) startPhase(phase Phase) func(error) {
+	e.phaseMu.Lock()
+	phase.StartTime = time.Now().UTC()
+	idx := len(e.phases)
+	e.phases = append(e.phases, phase)
+	e.savePhases()
+	e.phaseMu.Unlock()
+	var done bool
+	return func(err error) {
+		e.phaseMu.Lock()
+		defer e.phaseMu.Unlock()
+		if done {
+			return
+		}
+		done = true
+		e.phases[idx].EndTime = time.Now().UTC()
+		if err != nil {
+			e.phases[idx].Error = err.Error()
+		}
+		e.savePhases()
+	}
+}
+
+// savePhases must be called with phaseMu held. Failing to store the phases
+// must never interrupt the event, so errors are only logged.
+func (e *Event) savePhases() {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[events] unable to store phases for event %s: %v", e.UniqueID.Hex(), err)
+		return
+	}
+	defer conn.Close()
+	err = conn.Events().UpdateId(e.ID, bson.M{
+		"$set": bson.M{"othercustomdata.phases": e.phases},
+	})
+	if err != nil {
+		log.Errorf("[events] unable to store phases for event %s: %v", e.UniqueID.Hex(), err)
+	}
+}
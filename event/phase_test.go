@@ -0,0 +1,49 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+
+	"github.com/tsuru/tsuru/permission"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestEventPhases(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	endBuild := evt.StartPhase("build")
+	endBuild(nil)
+	endBuild(errors.New("ignored"))
+	endRollout := evt.StartProcessPhase("rollout", "web")
+	endRollout(errors.New("rollout failed"))
+	phases := evt.Phases()
+	c.Assert(phases, check.HasLen, 2)
+	c.Assert(phases[0].Name, check.Equals, "build")
+	c.Assert(phases[0].Error, check.Equals, "")
+	c.Assert(phases[0].EndTime.IsZero(), check.Equals, false)
+	c.Assert(phases[1].Name, check.Equals, "rollout")
+	c.Assert(phases[1].Process, check.Equals, "web")
+	c.Assert(phases[1].Error, check.Equals, "rollout failed")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err := All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	var data struct {
+		Phases []Phase
+	}
+	err = evts[0].OtherData(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.Phases, check.HasLen, 2)
+	c.Assert(data.Phases[0].Name, check.Equals, "build")
+	c.Assert(data.Phases[1].Process, check.Equals, "web")
+	c.Assert(data.Phases[1].Error, check.Equals, "rollout failed")
+}
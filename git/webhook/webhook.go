@@ -0,0 +1,227 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook parses and verifies push webhooks sent by git hosting
+// services, currently GitHub, GitLab and Gitea.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Provider string
+
+const (
+	ProviderGitHub Provider = "github"
+	ProviderGitLab Provider = "gitlab"
+	ProviderGitea  Provider = "gitea"
+
+	branchRefPrefix = "refs/heads/"
+	nullCommit      = "0000000000000000000000000000000000000000"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unable to detect webhook provider from request headers")
+	ErrNotPushEvent     = errors.New("webhook event is not a push")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Push is the provider independent representation of a push to a branch.
+type Push struct {
+	Provider    Provider
+	Repository  string
+	Branch      string
+	Commit      string
+	Message     string
+	Author      string
+	AuthorEmail string
+	ArchiveURL  string
+}
+
+// IsDeletion returns whether the push removed the branch, in which case
+// there's nothing to deploy.
+func (p *Push) IsDeletion() bool {
+	return p.Commit == "" || p.Commit == nullCommit
+}
+
+// DetectProvider returns the provider responsible for the webhook based on
+// its headers. Gitea also sends GitHub compatible headers, so it must be
+// checked first.
+func DetectProvider(h http.Header) (Provider, error) {
+	switch {
+	case h.Get("X-Gitea-Event") != "":
+		return ProviderGitea, nil
+	case h.Get("X-GitHub-Event") != "":
+		return ProviderGitHub, nil
+	case h.Get("X-Gitlab-Event") != "":
+		return ProviderGitLab, nil
+	}
+	return "", ErrUnknownProvider
+}
+
+// Parse parses the push sent in body, returning ErrNotPushEvent for any other
+// kind of event, like GitHub pings.
+func Parse(h http.Header, body []byte) (*Push, error) {
+	provider, err := DetectProvider(h)
+	if err != nil {
+		return nil, err
+	}
+	var push *Push
+	switch provider {
+	case ProviderGitHub:
+		if h.Get("X-GitHub-Event") != "push" {
+			return nil, ErrNotPushEvent
+		}
+		push, err = parseGitHubLike(body)
+	case ProviderGitea:
+		if h.Get("X-Gitea-Event") != "push" {
+			return nil, ErrNotPushEvent
+		}
+		push, err = parseGitHubLike(body)
+	case ProviderGitLab:
+		if h.Get("X-Gitlab-Event") != "Push Hook" {
+			return nil, ErrNotPushEvent
+		}
+		push, err = parseGitLab(body)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s push", provider)
+	}
+	push.Provider = provider
+	return push, nil
+}
+
+// Verify checks that the webhook was signed with the given secret. GitHub and
+// Gitea send an HMAC-SHA256 signature of the body while GitLab sends the
+// secret itself.
+func Verify(provider Provider, h http.Header, body []byte, secret string) error {
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+	var received string
+	switch provider {
+	case ProviderGitHub:
+		received = strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+	case ProviderGitea:
+		received = h.Get("X-Gitea-Signature")
+	case ProviderGitLab:
+		if subtle.ConstantTimeCompare([]byte(h.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return ErrUnknownProvider
+	}
+	receivedMAC, err := hex.DecodeString(received)
+	if err != nil || len(receivedMAC) == 0 {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(receivedMAC, Sign(body, secret)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Sign returns the HMAC-SHA256 of body using secret as key.
+func Sign(body []byte, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+type gitCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Author  struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+}
+
+type gitHubPush struct {
+	Ref        string     `json:"ref"`
+	After      string     `json:"after"`
+	HeadCommit *gitCommit `json:"head_commit"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+func parseGitHubLike(body []byte) (*Push, error) {
+	var payload gitHubPush
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+	push := &Push{
+		Repository: payload.Repository.FullName,
+		Branch:     strings.TrimPrefix(payload.Ref, branchRefPrefix),
+		Commit:     payload.After,
+	}
+	if !strings.HasPrefix(payload.Ref, branchRefPrefix) {
+		return nil, errors.Errorf("ref %q is not a branch", payload.Ref)
+	}
+	if payload.HeadCommit != nil {
+		push.Commit = payload.HeadCommit.ID
+		push.Message = payload.HeadCommit.Message
+		push.Author = payload.HeadCommit.Author.Name
+		push.AuthorEmail = payload.HeadCommit.Author.Email
+	}
+	if payload.Repository.HTMLURL != "" && !push.IsDeletion() {
+		push.ArchiveURL = fmt.Sprintf("%s/archive/%s.tar.gz", strings.TrimSuffix(payload.Repository.HTMLURL, "/"), push.Commit)
+	}
+	return push, nil
+}
+
+type gitLabPush struct {
+	Ref         string      `json:"ref"`
+	CheckoutSHA string      `json:"checkout_sha"`
+	UserName    string      `json:"user_name"`
+	UserEmail   string      `json:"user_email"`
+	Commits     []gitCommit `json:"commits"`
+	Project     struct {
+		Name              string `json:"name"`
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+}
+
+func parseGitLab(body []byte) (*Push, error) {
+	var payload gitLabPush
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(payload.Ref, branchRefPrefix) {
+		return nil, errors.Errorf("ref %q is not a branch", payload.Ref)
+	}
+	push := &Push{
+		Repository:  payload.Project.PathWithNamespace,
+		Branch:      strings.TrimPrefix(payload.Ref, branchRefPrefix),
+		Commit:      payload.CheckoutSHA,
+		Author:      payload.UserName,
+		AuthorEmail: payload.UserEmail,
+	}
+	for _, commit := range payload.Commits {
+		if commit.ID == push.Commit {
+			push.Message = commit.Message
+			push.Author = commit.Author.Name
+			push.AuthorEmail = commit.Author.Email
+		}
+	}
+	if payload.Project.WebURL != "" && !push.IsDeletion() {
+		push.ArchiveURL = fmt.Sprintf("%s/-/archive/%s/%s-%s.tar.gz", strings.TrimSuffix(payload.Project.WebURL, "/"), push.Commit, payload.Project.Name, push.Commit)
+	}
+	return push, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	check "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+const gitHubPushBody = `{
+	"ref": "refs/heads/main",
+	"after": "9f2c1e4b5a",
+	"repository": {"full_name": "tsuru/myapp", "html_url": "https://github.com/tsuru/myapp"},
+	"head_commit": {"id": "9f2c1e4b5a", "message": "fix everything", "author": {"name": "Jane Doe", "email": "jane@example.com"}}
+}`
+
+const gitLabPushBody = `{
+	"ref": "refs/heads/production",
+	"checkout_sha": "abc123",
+	"user_name": "Pusher",
+	"user_email": "pusher@example.com",
+	"project": {"name": "myapp", "path_with_namespace": "group/myapp", "web_url": "https://gitlab.example.com/group/myapp"},
+	"commits": [
+		{"id": "000111", "message": "older", "author": {"name": "Someone", "email": "someone@example.com"}},
+		{"id": "abc123", "message": "add feature", "author": {"name": "John Doe", "email": "john@example.com"}}
+	]
+}`
+
+func (s *S) TestDetectProvider(c *check.C) {
+	tests := []struct {
+		header   http.Header
+		expected Provider
+	}{
+		{header: http.Header{"X-Github-Event": {"push"}}, expected: ProviderGitHub},
+		{header: http.Header{"X-Gitlab-Event": {"Push Hook"}}, expected: ProviderGitLab},
+		{header: http.Header{"X-Gitea-Event": {"push"}, "X-Github-Event": {"push"}}, expected: ProviderGitea},
+	}
+	for _, tt := range tests {
+		provider, err := DetectProvider(tt.header)
+		c.Check(err, check.IsNil)
+		c.Check(provider, check.Equals, tt.expected)
+	}
+	_, err := DetectProvider(http.Header{})
+	c.Assert(err, check.Equals, ErrUnknownProvider)
+}
+
+func (s *S) TestParseGitHub(c *check.C) {
+	push, err := Parse(http.Header{"X-Github-Event": {"push"}}, []byte(gitHubPushBody))
+	c.Assert(err, check.IsNil)
+	c.Assert(push, check.DeepEquals, &Push{
+		Provider:    ProviderGitHub,
+		Repository:  "tsuru/myapp",
+		Branch:      "main",
+		Commit:      "9f2c1e4b5a",
+		Message:     "fix everything",
+		Author:      "Jane Doe",
+		AuthorEmail: "jane@example.com",
+		ArchiveURL:  "https://github.com/tsuru/myapp/archive/9f2c1e4b5a.tar.gz",
+	})
+}
+
+func (s *S) TestParseGitea(c *check.C) {
+	header := http.Header{"X-Gitea-Event": {"push"}, "X-Github-Event": {"push"}}
+	push, err := Parse(header, []byte(gitHubPushBody))
+	c.Assert(err, check.IsNil)
+	c.Assert(push.Provider, check.Equals, ProviderGitea)
+	c.Assert(push.Repository, check.Equals, "tsuru/myapp")
+	c.Assert(push.Branch, check.Equals, "main")
+}
+
+func (s *S) TestParseGitLab(c *check.C) {
+	push, err := Parse(http.Header{"X-Gitlab-Event": {"Push Hook"}}, []byte(gitLabPushBody))
+	c.Assert(err, check.IsNil)
+	c.Assert(push, check.DeepEquals, &Push{
+		Provider:    ProviderGitLab,
+		Repository:  "group/myapp",
+		Branch:      "production",
+		Commit:      "abc123",
+		Message:     "add feature",
+		Author:      "John Doe",
+		AuthorEmail: "john@example.com",
+		ArchiveURL:  "https://gitlab.example.com/group/myapp/-/archive/abc123/myapp-abc123.tar.gz",
+	})
+}
+
+func (s *S) TestParseNotPush(c *check.C) {
+	_, err := Parse(http.Header{"X-Github-Event": {"ping"}}, []byte(`{}`))
+	c.Assert(err, check.Equals, ErrNotPushEvent)
+	_, err = Parse(http.Header{"X-Gitlab-Event": {"Tag Push Hook"}}, []byte(`{}`))
+	c.Assert(err, check.Equals, ErrNotPushEvent)
+}
+
+func (s *S) TestParseTag(c *check.C) {
+	_, err := Parse(http.Header{"X-Github-Event": {"push"}}, []byte(`{"ref": "refs/tags/v1"}`))
+	c.Assert(err, check.ErrorMatches, `unable to parse github push: ref "refs/tags/v1" is not a branch`)
+}
+
+func (s *S) TestPushIsDeletion(c *check.C) {
+	push, err := Parse(http.Header{"X-Github-Event": {"push"}}, []byte(`{"ref": "refs/heads/main", "after": "0000000000000000000000000000000000000000"}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(push.IsDeletion(), check.Equals, true)
+	c.Assert(push.ArchiveURL, check.Equals, "")
+}
+
+func (s *S) TestVerify(c *check.C) {
+	body := []byte(gitHubPushBody)
+	signature := hex.EncodeToString(Sign(body, "my-secret"))
+	err := Verify(ProviderGitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + signature}}, body, "my-secret")
+	c.Assert(err, check.IsNil)
+	err = Verify(ProviderGitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + signature}}, body, "other-secret")
+	c.Assert(err, check.Equals, ErrInvalidSignature)
+	err = Verify(ProviderGitHub, http.Header{}, body, "my-secret")
+	c.Assert(err, check.Equals, ErrInvalidSignature)
+	err = Verify(ProviderGitea, http.Header{"X-Gitea-Signature": {signature}}, body, "my-secret")
+	c.Assert(err, check.IsNil)
+	err = Verify(ProviderGitLab, http.Header{"X-Gitlab-Token": {"my-secret"}}, body, "my-secret")
+	c.Assert(err, check.IsNil)
+	err = Verify(ProviderGitLab, http.Header{"X-Gitlab-Token": {"my-secret"}}, body, "other-secret")
+	c.Assert(err, check.Equals, ErrInvalidSignature)
+	err = Verify(ProviderGitLab, http.Header{"X-Gitlab-Token": {""}}, body, "")
+	c.Assert(err, check.Equals, ErrInvalidSignature)
+}
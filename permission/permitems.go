@@ -21,10 +21,12 @@ var (
 	PermAppDeployBuild                   = PermissionRegistry.get("app.deploy.build")                    // [global app team pool]
 	PermAppDeployGit                     = PermissionRegistry.get("app.deploy.git")                      // [global app team pool]
 	PermAppDeployImage                   = PermissionRegistry.get("app.deploy.image")                    // [global app team pool]
+	PermAppDeployPromote                 = PermissionRegistry.get("app.deploy.promote")                  // [global app team pool]
 	PermAppDeployRollback                = PermissionRegistry.get("app.deploy.rollback")                 // [global app team pool]
 	PermAppDeployUpload                  = PermissionRegistry.get("app.deploy.upload")                   // [global app team pool]
 	PermAppRead                          = PermissionRegistry.get("app.read")                            // [global app team pool]
 	PermAppReadCertificate               = PermissionRegistry.get("app.read.certificate")                // [global app team pool]
+	PermAppReadCosts                     = PermissionRegistry.get("app.read.costs")                      // [global app team pool]
 	PermAppReadDeploy                    = PermissionRegistry.get("app.read.deploy")                     // [global app team pool]
 	PermAppReadEnv                       = PermissionRegistry.get("app.read.env")                        // [global app team pool]
 	PermAppReadEvents                    = PermissionRegistry.get("app.read.events")                     // [global app team pool]
@@ -33,6 +35,9 @@ var (
 	PermAppReadMetric                    = PermissionRegistry.get("app.read.metric")                     // [global app team pool]
 	PermAppReadRouter                    = PermissionRegistry.get("app.read.router")                     // [global app team pool]
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
+	PermAppRunDebug                      = PermissionRegistry.get("app.run.debug")                       // [global app team pool]
+	PermAppRunFileDownload               = PermissionRegistry.get("app.run.file-download")               // [global app team pool]
+	PermAppRunFileUpload                 = PermissionRegistry.get("app.run.file-upload")                 // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")                     // [global app team pool]
@@ -40,6 +45,7 @@ var (
 	PermAppUpdateCertificate             = PermissionRegistry.get("app.update.certificate")              // [global app team pool]
 	PermAppUpdateCertificateSet          = PermissionRegistry.get("app.update.certificate.set")          // [global app team pool]
 	PermAppUpdateCertificateUnset        = PermissionRegistry.get("app.update.certificate.unset")        // [global app team pool]
+	PermAppUpdateCluster                 = PermissionRegistry.get("app.update.cluster")                  // [global app team pool]
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")                    // [global app team pool]
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
@@ -50,6 +56,9 @@ var (
 	PermAppUpdateEnvSet                  = PermissionRegistry.get("app.update.env.set")                  // [global app team pool]
 	PermAppUpdateEnvUnset                = PermissionRegistry.get("app.update.env.unset")                // [global app team pool]
 	PermAppUpdateEvents                  = PermissionRegistry.get("app.update.events")                   // [global app team pool]
+	PermAppUpdateGitDeploy               = PermissionRegistry.get("app.update.git-deploy")               // [global app team pool]
+	PermAppUpdateGitDeploySet            = PermissionRegistry.get("app.update.git-deploy.set")           // [global app team pool]
+	PermAppUpdateGitDeployUnset          = PermissionRegistry.get("app.update.git-deploy.unset")         // [global app team pool]
 	PermAppUpdateGrant                   = PermissionRegistry.get("app.update.grant")                    // [global app team pool]
 	PermAppUpdateImageReset              = PermissionRegistry.get("app.update.image-reset")              // [global app team pool]
 	PermAppUpdateLog                     = PermissionRegistry.get("app.update.log")                      // [global app team pool]
@@ -78,10 +87,13 @@ var (
 	PermAppUpdateUnitAutoscale           = PermissionRegistry.get("app.update.unit.autoscale")           // [global app team pool]
 	PermAppUpdateUnitAutoscaleAdd        = PermissionRegistry.get("app.update.unit.autoscale.add")       // [global app team pool]
 	PermAppUpdateUnitAutoscaleRemove     = PermissionRegistry.get("app.update.unit.autoscale.remove")    // [global app team pool]
+	PermAppUpdateUnitKill                = PermissionRegistry.get("app.update.unit.kill")                // [global app team pool]
 	PermAppUpdateUnitRegister            = PermissionRegistry.get("app.update.unit.register")            // [global app team pool]
 	PermAppUpdateUnitRemove              = PermissionRegistry.get("app.update.unit.remove")              // [global app team pool]
-	PermAppUpdateUnitKill                = PermissionRegistry.get("app.update.unit.kill")                // [global app team pool]
 	PermAppUpdateUnitStatus              = PermissionRegistry.get("app.update.unit.status")              // [global app team pool]
+	PermAppUpdateVersionChannel          = PermissionRegistry.get("app.update.version-channel")          // [global app team pool]
+	PermAppUpdateVersionChannelSet       = PermissionRegistry.get("app.update.version-channel.set")      // [global app team pool]
+	PermAppUpdateVersionChannelUnset     = PermissionRegistry.get("app.update.version-channel.unset")    // [global app team pool]
 	PermCluster                          = PermissionRegistry.get("cluster")                             // [global]
 	PermClusterAdmin                     = PermissionRegistry.get("cluster.admin")                       // [global]
 	PermClusterCreate                    = PermissionRegistry.get("cluster.create")                      // [global]
@@ -89,6 +101,9 @@ var (
 	PermClusterRead                      = PermissionRegistry.get("cluster.read")                        // [global]
 	PermClusterReadEvents                = PermissionRegistry.get("cluster.read.events")                 // [global]
 	PermClusterUpdate                    = PermissionRegistry.get("cluster.update")                      // [global]
+	PermCostPrice                        = PermissionRegistry.get("cost-price")                          // [global]
+	PermCostPriceRead                    = PermissionRegistry.get("cost-price.read")                     // [global]
+	PermCostPriceUpdate                  = PermissionRegistry.get("cost-price.update")                   // [global]
 	PermDebug                            = PermissionRegistry.get("debug")                               // [global]
 	PermEventBlock                       = PermissionRegistry.get("event-block")                         // [global]
 	PermEventBlockAdd                    = PermissionRegistry.get("event-block.add")                     // [global]
@@ -130,6 +145,14 @@ var (
 	PermNodecontainerRead                = PermissionRegistry.get("nodecontainer.read")                  // [global pool]
 	PermNodecontainerUpdate              = PermissionRegistry.get("nodecontainer.update")                // [global pool]
 	PermNodecontainerUpdateUpgrade       = PermissionRegistry.get("nodecontainer.update.upgrade")        // [global pool]
+	PermPipeline                         = PermissionRegistry.get("pipeline")                            // [global team]
+	PermPipelineApprove                  = PermissionRegistry.get("pipeline.approve")                    // [global team]
+	PermPipelineCreate                   = PermissionRegistry.get("pipeline.create")                     // [global team]
+	PermPipelineDelete                   = PermissionRegistry.get("pipeline.delete")                     // [global team]
+	PermPipelinePromote                  = PermissionRegistry.get("pipeline.promote")                    // [global team]
+	PermPipelineRead                     = PermissionRegistry.get("pipeline.read")                       // [global team]
+	PermPipelineReadEvents               = PermissionRegistry.get("pipeline.read.events")                // [global team]
+	PermPipelineUpdate                   = PermissionRegistry.get("pipeline.update")                     // [global team]
 	PermPlan                             = PermissionRegistry.get("plan")                                // [global]
 	PermPlanCreate                       = PermissionRegistry.get("plan.create")                         // [global]
 	PermPlanDelete                       = PermissionRegistry.get("plan.delete")                         // [global]
@@ -218,6 +241,7 @@ var (
 	PermTeamCreate                       = PermissionRegistry.get("team.create")                         // [global]
 	PermTeamDelete                       = PermissionRegistry.get("team.delete")                         // [global team]
 	PermTeamRead                         = PermissionRegistry.get("team.read")                           // [global team]
+	PermTeamReadCosts                    = PermissionRegistry.get("team.read.costs")                     // [global team]
 	PermTeamReadEvents                   = PermissionRegistry.get("team.read.events")                    // [global team]
 	PermTeamReadQuota                    = PermissionRegistry.get("team.read.quota")                     // [global team]
 	PermTeamToken                        = PermissionRegistry.get("team.token")                          // [global team]
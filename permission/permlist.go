@@ -19,6 +19,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.tags",
 	"app.update.log",
 	"app.update.pool",
+	"app.update.cluster",
 	"app.update.unit.add",
 	"app.update.unit.remove",
 	"app.update.unit.kill",
@@ -55,6 +56,10 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.router.remove",
 	"app.update.routable",
 	"app.update.metadata",
+	"app.update.version-channel.set",
+	"app.update.version-channel.unset",
+	"app.update.git-deploy.set",
+	"app.update.git-deploy.unset",
 	"app.deploy",
 	"app.deploy.archive-url",
 	"app.deploy.build",
@@ -62,6 +67,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.deploy.image",
 	"app.deploy.rollback",
 	"app.deploy.upload",
+	"app.deploy.promote",
 	"app.read",
 	"app.read.deploy",
 	"app.read.router",
@@ -71,9 +77,13 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.read.log",
 	"app.read.certificate",
 	"app.read.info",
+	"app.read.costs",
 	"app.delete",
 	"app.run",
 	"app.run.shell",
+	"app.run.file-upload",
+	"app.run.file-download",
+	"app.run.debug",
 	"app.admin.routes",
 	"app.admin.quota",
 	"app.build",
@@ -117,6 +127,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.token.update",
 	"team.read.quota",
 	"team.update.quota",
+	"team.read.costs",
 ).addWithCtx(
 	"user", []permTypes.ContextType{permTypes.CtxUser},
 ).addWithCtx(
@@ -230,6 +241,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"cluster.create",
 	"cluster.update",
 	"cluster.delete",
+).add(
+	"cost-price.read",
+	"cost-price.update",
 ).addWithCtx(
 	"volume", []permTypes.ContextType{permTypes.CtxVolume, permTypes.CtxTeam, permTypes.CtxPool},
 ).addWithCtx(
@@ -247,6 +261,16 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"webhook.create",
 	"webhook.update",
 	"webhook.delete",
+).addWithCtx(
+	"pipeline", []permTypes.ContextType{permTypes.CtxTeam},
+).add(
+	"pipeline.create",
+	"pipeline.read",
+	"pipeline.read.events",
+	"pipeline.update",
+	"pipeline.delete",
+	"pipeline.promote",
+	"pipeline.approve",
 ).addWithCtx(
 	"router", []permTypes.ContextType{permTypes.CtxRouter},
 ).addWithCtx(
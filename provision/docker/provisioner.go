@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
@@ -92,6 +94,7 @@ var (
 	_ provision.AppFilterProvisioner      = &dockerProvisioner{}
 	_ provision.BuilderDeploy             = &dockerProvisioner{}
 	_ provision.BuilderDeployDockerClient = &dockerProvisioner{}
+	_ provision.UnitFileCopyProvisioner   = &dockerProvisioner{}
 )
 
 type hookHealer struct {
@@ -690,6 +693,75 @@ func (p *dockerProvisioner) ExecuteCommand(ctx context.Context, opts provision.E
 	return nil
 }
 
+func (p *dockerProvisioner) UploadToUnit(ctx context.Context, a provision.App, opts provision.UnitFileCopyOptions, tarStream io.Reader) error {
+	cont, err := p.containerForFileCopy(a, opts)
+	if err != nil {
+		return err
+	}
+	// The stream is extracted to a staging directory and only moved into
+	// Path once it's fully read, an upload interrupted or over the size
+	// limit leaves nothing behind.
+	staging := provision.FileUploadStagingPath(opts.Path)
+	err = p.execFileCopy(cont, "mkdir", "--", staging)
+	if err != nil {
+		return err
+	}
+	reader := &provision.FileUploadReader{Reader: tarStream}
+	err = p.ClusterClient().UploadToContainer(cont.ID, docker.UploadToContainerOptions{
+		Context:     ctx,
+		InputStream: reader,
+		Path:        staging,
+	})
+	if readErr := reader.Err(); readErr != nil {
+		err = readErr
+	}
+	if err != nil {
+		if cleanupErr := p.execFileCopy(cont, provision.FileUploadCleanupCmds(staging)...); cleanupErr != nil {
+			log.Errorf("unable to remove upload staging directory %q in container %q: %v", staging, cont.ID, cleanupErr)
+		}
+		return err
+	}
+	return p.execFileCopy(cont, provision.FileUploadCommitCmds(staging, opts.Path)...)
+}
+
+func (p *dockerProvisioner) execFileCopy(cont *container.Container, cmds ...string) error {
+	var stderr bytes.Buffer
+	err := cont.Exec(p.ClusterClient(), nil, ioutil.Discard, &stderr, container.Pty{}, cmds...)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.Wrapf(err, "unable to copy files of unit %q: %s", cont.ID, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *dockerProvisioner) DownloadFromUnit(ctx context.Context, a provision.App, opts provision.UnitFileCopyOptions, tarStream io.Writer) error {
+	cont, err := p.containerForFileCopy(a, opts)
+	if err != nil {
+		return err
+	}
+	return p.ClusterClient().DownloadFromContainer(cont.ID, docker.DownloadFromContainerOptions{
+		Context:      ctx,
+		OutputStream: tarStream,
+		Path:         opts.Path,
+	})
+}
+
+func (p *dockerProvisioner) containerForFileCopy(a provision.App, opts provision.UnitFileCopyOptions) (*container.Container, error) {
+	if opts.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	cont, err := p.GetContainer(opts.Unit)
+	if err != nil {
+		return nil, err
+	}
+	if cont.AppName != a.GetName() {
+		return nil, errors.Errorf("container %q does not belong to app %q", cont.ID, a.GetName())
+	}
+	return cont, nil
+}
+
 func (p *dockerProvisioner) Collection() *storage.Collection {
 	conn, err := db.Conn()
 	if err != nil {
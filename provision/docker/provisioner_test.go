@@ -24,6 +24,7 @@ import (
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/fsouza/go-dockerclient/testing"
 	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
 	"github.com/tsuru/tsuru/app"
@@ -2050,6 +2051,140 @@ func (s *S) TestExecuteCommandStdin(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+type fileCopyRecorder struct {
+	sync.Mutex
+	cmds        [][]string
+	archivePath string
+	archive     string
+}
+
+func (s *S) recordFileCopy(c *check.C) *fileCopyRecorder {
+	rec := &fileCopyRecorder{}
+	s.server.CustomHandler("/containers/[^/]+/exec$", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		var opts docker.CreateExecOptions
+		err := json.Unmarshal(data, &opts)
+		c.Assert(err, check.IsNil)
+		rec.Lock()
+		rec.cmds = append(rec.cmds, opts.Cmd)
+		rec.Unlock()
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	s.server.CustomHandler("/containers/[^/]+/archive$", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.Lock()
+		defer rec.Unlock()
+		rec.archivePath = r.URL.Query().Get("path")
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/x-tar")
+			fmt.Fprint(w, "tar data")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rec.archive = string(data)
+	}))
+	return rec
+}
+
+func (s *S) TestUploadToUnit(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.GetName()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	rec := s.recordFileCopy(c)
+	err = s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: cont.ID,
+		Path: "/home/application/current",
+	}, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	rec.Lock()
+	defer rec.Unlock()
+	c.Assert(rec.cmds, check.HasLen, 2)
+	c.Assert(rec.cmds[0], check.HasLen, 3)
+	c.Assert(rec.cmds[0][:2], check.DeepEquals, []string{"mkdir", "--"})
+	staging := rec.cmds[0][2]
+	c.Assert(staging, check.Matches, `/home/application/current/\.tsuru-upload-[0-9a-f]{16}`)
+	c.Assert(rec.archivePath, check.Equals, staging)
+	c.Assert(rec.archive, check.Equals, "tar data")
+	c.Assert(rec.cmds[1], check.DeepEquals, provision.FileUploadCommitCmds(staging, "/home/application/current"))
+}
+
+type failingFileCopyReader struct {
+	data *strings.Reader
+	err  error
+}
+
+func (r *failingFileCopyReader) Read(p []byte) (int, error) {
+	n, _ := r.data.Read(p)
+	if r.data.Len() == 0 {
+		return n, r.err
+	}
+	return n, nil
+}
+
+func (s *S) TestUploadToUnitReadErrorRemovesStaging(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.GetName()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	rec := s.recordFileCopy(c)
+	tooLarge := errors.New("too large")
+	err = s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: cont.ID,
+		Path: "/home/application/current",
+	}, &failingFileCopyReader{data: strings.NewReader("tar data"), err: tooLarge})
+	c.Assert(err, check.Equals, tooLarge)
+	rec.Lock()
+	defer rec.Unlock()
+	c.Assert(rec.cmds, check.HasLen, 2)
+	staging := rec.cmds[0][2]
+	c.Assert(rec.cmds[1], check.DeepEquals, []string{"rm", "-rf", "--", staging})
+}
+
+func (s *S) TestUploadToUnitOtherApp(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: "otherapp"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: cont.ID,
+		Path: "/home/application/current",
+	}, strings.NewReader("tar data"))
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf(`container %q does not belong to app "almah"`, cont.ID))
+}
+
+func (s *S) TestDownloadFromUnit(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.GetName()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	rec := s.recordFileCopy(c)
+	buf := safe.NewBuffer(nil)
+	err = s.p.DownloadFromUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: cont.ID,
+		Path: "/home/application/data",
+	}, buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "tar data")
+	rec.Lock()
+	defer rec.Unlock()
+	c.Assert(rec.archivePath, check.Equals, "/home/application/data")
+	c.Assert(rec.cmds, check.HasLen, 0)
+}
+
+func (s *S) TestDownloadFromUnitRequiresPath(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.GetName()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.DownloadFromUnit(context.TODO(), a, provision.UnitFileCopyOptions{Unit: cont.ID}, safe.NewBuffer(nil))
+	c.Assert(err, check.ErrorMatches, "path is required")
+}
+
 func (s *S) TestDryMode(c *check.C) {
 	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
 	s.p.Provision(context.TODO(), appInstance)
@@ -0,0 +1,63 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"path"
+	"sync"
+)
+
+// FileUploadStagingPath returns the directory, inside dst, an upload is
+// extracted to before being moved into dst. A failed upload is then removed
+// instead of leaving a partial extraction in dst.
+func FileUploadStagingPath(dst string) string {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return path.Join(path.Clean(dst), ".tsuru-upload-"+hex.EncodeToString(suffix))
+}
+
+// FileUploadCommitCmds returns the command moving the files extracted in
+// staging into dst and removing staging. Files are copied over dst so
+// existing directories are merged, as a direct extraction would do.
+func FileUploadCommitCmds(staging, dst string) []string {
+	return []string{"sh", "-c", `cp -a "$1/." "$2/"; status=$?; rm -rf "$1"; exit $status`, "sh", staging, dst}
+}
+
+// FileUploadCleanupCmds returns the command removing the staging directory
+// of a failed upload.
+func FileUploadCleanupCmds(staging string) []string {
+	return []string{"rm", "-rf", "--", staging}
+}
+
+// FileUploadReader keeps the first error returned by the tar stream of an
+// upload. The input of a remote command is closed when reading it fails, so
+// the command may succeed extracting a truncated stream.
+type FileUploadReader struct {
+	io.Reader
+	mu  sync.Mutex
+	err error
+}
+
+func (r *FileUploadReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.mu.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// Err returns the first error, other than io.EOF, returned by the stream.
+func (r *FileUploadReader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	check "gopkg.in/check.v1"
+)
+
+type errorAfterReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errorAfterReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func (s *S) TestFileUploadReader(c *check.C) {
+	r := &FileUploadReader{Reader: strings.NewReader("tar data")}
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "tar data")
+	c.Assert(r.Err(), check.IsNil)
+	tooLarge := errors.New("too large")
+	r = &FileUploadReader{Reader: &errorAfterReader{Reader: strings.NewReader("tar data"), err: tooLarge}}
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, check.Equals, tooLarge)
+	c.Assert(r.Err(), check.Equals, tooLarge)
+}
+
+func (s *S) TestFileUploadStagingPath(c *check.C) {
+	staging := FileUploadStagingPath("/home/application/current/")
+	c.Assert(staging, check.Matches, `/home/application/current/\.tsuru-upload-[0-9a-f]{16}`)
+	c.Assert(FileUploadStagingPath("/home/application/current"), check.Not(check.Equals), staging)
+}
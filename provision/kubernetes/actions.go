@@ -16,11 +16,13 @@ import (
 )
 
 type updatePipelineParams struct {
-	p        *kubernetesProvisioner
-	new      provision.App
-	old      provision.App
-	versions []appTypes.AppVersion
-	w        io.Writer
+	p            *kubernetesProvisioner
+	new          provision.App
+	old          provision.App
+	oldNamespace string
+	newNamespace string
+	versions     []appTypes.AppVersion
+	w            io.Writer
 }
 
 var provisionNewApp = action.Action{
@@ -95,11 +97,11 @@ var updateAppCR = action.Action{
 	Name: "update-app-custom-resource",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
 		params := ctx.Params[0].(updatePipelineParams)
-		client, err := clusterForPool(ctx.Context, params.old.GetPool())
+		client, err := clusterForApp(ctx.Context, params.old)
 		if err != nil {
 			return nil, err
 		}
-		return nil, updateAppNamespace(ctx.Context, client, params.old.GetName(), client.PoolNamespace(params.new.GetPool()))
+		return nil, updateAppNamespace(ctx.Context, client, params.old.GetName(), params.newNamespace)
 	},
 	Backward: func(ctx action.BWContext) {
 		params := ctx.Params[0].(updatePipelineParams)
@@ -110,18 +112,18 @@ var updateAppCR = action.Action{
 }
 
 func backwardCR(ctx context.Context, params updatePipelineParams) error {
-	client, err := clusterForPool(ctx, params.old.GetPool())
+	client, err := clusterForApp(ctx, params.old)
 	if err != nil {
 		return err
 	}
-	return updateAppNamespace(ctx, client, params.old.GetName(), client.PoolNamespace(params.old.GetPool()))
+	return updateAppNamespace(ctx, client, params.old.GetName(), params.oldNamespace)
 }
 
 var removeOldAppResources = action.Action{
 	Name: "remove-old-app-resources",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
 		params := ctx.Params[0].(updatePipelineParams)
-		client, err := clusterForPool(ctx.Context, params.old.GetPool())
+		client, err := clusterForApp(ctx.Context, params.old)
 		if err != nil {
 			log.Errorf("failed to remove old resources: %v", err)
 			return nil, nil
@@ -131,7 +133,7 @@ var removeOldAppResources = action.Action{
 			log.Errorf("failed to remove old resources: %v", err)
 			return nil, nil
 		}
-		oldAppCR.Spec.NamespaceName = client.PoolNamespace(params.old.GetPool())
+		oldAppCR.Spec.NamespaceName = params.oldNamespace
 		err = params.p.removeResources(ctx.Context, client, oldAppCR, params.old)
 		if err != nil {
 			log.Errorf("failed to remove old resources: %v", err)
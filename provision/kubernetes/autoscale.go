@@ -16,6 +16,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	autoscalingv2 "k8s.io/api/autoscaling/v2beta2"
+	apiv1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,7 +32,7 @@ const (
 var errNoDeploy = errors.New("no routable version found for app, at least one deploy is required before configuring autoscale")
 
 func (p *kubernetesProvisioner) GetVerticalAutoScaleRecommendations(ctx context.Context, a provision.App) ([]provision.RecommendedResources, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +80,21 @@ func (p *kubernetesProvisioner) GetVerticalAutoScaleRecommendations(ctx context.
 	return specs, nil
 }
 
+func (p *kubernetesProvisioner) OvercommitFactors(ctx context.Context, a provision.App) (provision.OvercommitFactors, error) {
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return provision.OvercommitFactors{}, err
+	}
+	factors, err := requirementsFactorsForPool(client, a.GetPool())
+	if err != nil {
+		return provision.OvercommitFactors{}, err
+	}
+	return provision.OvercommitFactors{
+		Memory: factors.memoryOvercommitFactor(),
+		CPU:    factors.cpuOvercommitFactor(),
+	}, nil
+}
+
 func vpaToRecommended(vpa vpav1.VerticalPodAutoscaler) provision.RecommendedResources {
 	ls := labelSetFromMeta(&vpa.ObjectMeta)
 	rec := provision.RecommendedResources{
@@ -116,7 +132,7 @@ func vpaToRecommended(vpa vpav1.VerticalPodAutoscaler) provision.RecommendedReso
 }
 
 func (p *kubernetesProvisioner) GetAutoScale(ctx context.Context, a provision.App) ([]provision.AutoScaleSpec, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
@@ -167,21 +183,131 @@ func hpaToSpec(hpa autoscalingv2.HorizontalPodAutoscaler) provision.AutoScaleSpe
 		spec.MinUnits = uint(*hpa.Spec.MinReplicas)
 	}
 
-	cpuValue := int64(0)
-	if len(hpa.Spec.Metrics) > 0 && hpa.Spec.Metrics[0].Resource != nil {
-		if hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != nil {
-			cpuValue = int64(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
-			cpuValue = cpuValue * 10
-		} else if hpa.Spec.Metrics[0].Resource.Target.AverageValue != nil {
-			cpuValue = hpa.Spec.Metrics[0].Resource.Target.AverageValue.MilliValue()
+	for _, metric := range hpa.Spec.Metrics {
+		if metric.Resource != nil && metric.Resource.Name == apiv1.ResourceCPU {
+			cpuValue := int64(0)
+			if metric.Resource.Target.AverageUtilization != nil {
+				cpuValue = int64(*metric.Resource.Target.AverageUtilization)
+				cpuValue = cpuValue * 10
+			} else if metric.Resource.Target.AverageValue != nil {
+				cpuValue = metric.Resource.Target.AverageValue.MilliValue()
+			}
+			if cpuValue > 0 {
+				spec.AverageCPU = fmt.Sprintf("%dm", cpuValue)
+			}
+			continue
+		}
+		if m, ok := metricSpecToAutoScale(metric); ok {
+			spec.Metrics = append(spec.Metrics, m)
 		}
 	}
 
-	if cpuValue > 0 {
-		spec.AverageCPU = fmt.Sprintf("%dm", cpuValue)
+	return spec
+}
+
+func metricSpecToAutoScale(metric autoscalingv2.MetricSpec) (provision.AutoScaleMetric, bool) {
+	var m provision.AutoScaleMetric
+	var target autoscalingv2.MetricTarget
+	switch {
+	case metric.Resource != nil && metric.Resource.Name == apiv1.ResourceMemory:
+		m.Type = provision.AutoScaleMetricMemory
+		target = metric.Resource.Target
+		if target.AverageUtilization != nil {
+			m.Target = fmt.Sprintf("%d%%", *target.AverageUtilization)
+			return m, true
+		}
+	case metric.Pods != nil:
+		m.Type = provision.AutoScaleMetricPods
+		m.Name, m.Selector = metricIdentifierToAutoScale(metric.Pods.Metric)
+		target = metric.Pods.Target
+	case metric.External != nil:
+		m.Type = provision.AutoScaleMetricExternal
+		m.Name, m.Selector = metricIdentifierToAutoScale(metric.External.Metric)
+		target = metric.External.Target
+		m.Average = target.Type == autoscalingv2.AverageValueMetricType
+	default:
+		return m, false
+	}
+	if target.AverageValue != nil {
+		m.Target = target.AverageValue.String()
+	} else if target.Value != nil {
+		m.Target = target.Value.String()
+	}
+	return m, true
+}
+
+func metricIdentifierToAutoScale(id autoscalingv2.MetricIdentifier) (string, map[string]string) {
+	if id.Selector == nil || len(id.Selector.MatchLabels) == 0 {
+		return id.Name, nil
 	}
+	return id.Name, id.Selector.MatchLabels
+}
 
-	return spec
+func autoScaleToMetricSpec(a provision.App, process string, m provision.AutoScaleMetric) (autoscalingv2.MetricSpec, error) {
+	err := m.Validate(a, process)
+	if err != nil {
+		return autoscalingv2.MetricSpec{}, err
+	}
+	if m.Type == provision.AutoScaleMetricMemory {
+		if utilization, ok, _ := m.MemoryUtilization(); ok {
+			val := int32(utilization)
+			return autoscalingv2.MetricSpec{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name: apiv1.ResourceMemory,
+					Target: autoscalingv2.MetricTarget{
+						Type:               autoscalingv2.UtilizationMetricType,
+						AverageUtilization: &val,
+					},
+				},
+			}, nil
+		}
+	}
+	quantity, err := m.TargetQuantity()
+	if err != nil {
+		return autoscalingv2.MetricSpec{}, err
+	}
+	// Fill string value for easier tests
+	_ = quantity.String()
+	target := autoscalingv2.MetricTarget{
+		Type:         autoscalingv2.AverageValueMetricType,
+		AverageValue: &quantity,
+	}
+	id := autoscalingv2.MetricIdentifier{Name: m.Name}
+	if len(m.Selector) > 0 {
+		id.Selector = &metav1.LabelSelector{MatchLabels: m.Selector}
+	}
+	switch m.Type {
+	case provision.AutoScaleMetricMemory:
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name:   apiv1.ResourceMemory,
+				Target: target,
+			},
+		}, nil
+	case provision.AutoScaleMetricPods:
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: id,
+				Target: target,
+			},
+		}, nil
+	}
+	if !m.Average {
+		target = autoscalingv2.MetricTarget{
+			Type:  autoscalingv2.ValueMetricType,
+			Value: &quantity,
+		}
+	}
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: &autoscalingv2.ExternalMetricSource{
+			Metric: id,
+			Target: target,
+		},
+	}, nil
 }
 
 func (p *kubernetesProvisioner) deleteAllAutoScale(ctx context.Context, a provision.App) error {
@@ -215,7 +341,7 @@ func (p *kubernetesProvisioner) deleteHPAByVersionAndProcess(ctx context.Context
 }
 
 func (p *kubernetesProvisioner) RemoveAutoScale(ctx context.Context, a provision.App, process string) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -236,7 +362,7 @@ func (p *kubernetesProvisioner) RemoveAutoScale(ctx context.Context, a provision
 }
 
 func (p *kubernetesProvisioner) SetAutoScale(ctx context.Context, a provision.App, spec provision.AutoScaleSpec) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -248,6 +374,7 @@ func setAutoScale(ctx context.Context, client *ClusterClient, a provision.App, s
 	if err != nil {
 		return err
 	}
+	spec.Process = depInfo.process
 
 	labels, err := provision.ServiceLabels(ctx, provision.ServiceLabelsOpts{
 		App:     a,
@@ -266,21 +393,38 @@ func setAutoScale(ctx context.Context, client *ClusterClient, a provision.App, s
 
 	hpaName := hpaNameForApp(a, depInfo.process)
 
-	cpuValue, err := spec.ToCPUValue(a)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	var metrics []autoscalingv2.MetricSpec
+	if spec.AverageCPU != "" || len(spec.Metrics) == 0 {
+		cpuValue, err := spec.ToCPUValue(a)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	target := autoscalingv2.MetricTarget{}
-	if a.GetMilliCPU() > 0 {
-		target.Type = autoscalingv2.UtilizationMetricType
-		val := int32(cpuValue)
-		target.AverageUtilization = &val
-	} else {
-		target.Type = autoscalingv2.AverageValueMetricType
-		target.AverageValue = resource.NewMilliQuantity(int64(cpuValue), resource.DecimalSI)
-		// Fill string value for easier tests
-		_ = target.AverageValue.String()
+		target := autoscalingv2.MetricTarget{}
+		if a.GetProcessMilliCPU(depInfo.process) > 0 {
+			target.Type = autoscalingv2.UtilizationMetricType
+			val := int32(cpuValue)
+			target.AverageUtilization = &val
+		} else {
+			target.Type = autoscalingv2.AverageValueMetricType
+			target.AverageValue = resource.NewMilliQuantity(int64(cpuValue), resource.DecimalSI)
+			// Fill string value for easier tests
+			_ = target.AverageValue.String()
+		}
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name:   "cpu",
+				Target: target,
+			},
+		})
+	}
+	for _, m := range spec.Metrics {
+		metric, err := autoScaleToMetricSpec(a, depInfo.process, m)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		metrics = append(metrics, metric)
 	}
 
 	policyMin := autoscalingv2.MinPolicySelect
@@ -318,15 +462,7 @@ func setAutoScale(ctx context.Context, client *ClusterClient, a provision.App, s
 					},
 				},
 			},
-			Metrics: []autoscalingv2.MetricSpec{
-				{
-					Type: autoscalingv2.ResourceMetricSourceType,
-					Resource: &autoscalingv2.ResourceMetricSource{
-						Name:   "cpu",
-						Target: target,
-					},
-				},
-			},
+			Metrics: metrics,
 		},
 	}
 
@@ -465,6 +465,81 @@ func (s *S) TestProvisionerGetAutoScale(c *check.C) {
 	})
 }
 
+func (s *S) TestProvisionerSetAutoScaleCustomMetrics(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	a.Memory = 1024 * 1024 * 1024
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	err := s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+
+	spec := provision.AutoScaleSpec{
+		MinUnits: 1,
+		MaxUnits: 2,
+		Metrics: []provision.AutoScaleMetric{
+			{Type: provision.AutoScaleMetricMemory, Target: "80%"},
+			{Type: provision.AutoScaleMetricPods, Name: "http_requests_per_second", Target: "100"},
+			{Type: provision.AutoScaleMetricExternal, Name: "queue_messages_ready", Selector: map[string]string{"queue": "jobs"}, Target: "30", Average: true},
+		},
+	}
+	err = s.p.SetAutoScale(context.TODO(), a, spec)
+	c.Assert(err, check.IsNil)
+
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	hpa, err := s.client.AutoscalingV2beta2().HorizontalPodAutoscalers(ns).Get(context.TODO(), "myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	rps := resource.MustParse("100")
+	queue := resource.MustParse("30")
+	_, _ = rps.String(), queue.String()
+	c.Assert(hpa.Spec.Metrics, check.DeepEquals, []autoscalingv2.MetricSpec{
+		{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: "memory",
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: toInt32Ptr(80),
+				},
+			},
+		},
+		{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: "http_requests_per_second"},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: &rps,
+				},
+			},
+		},
+		{
+			Type: autoscalingv2.ExternalMetricSourceType,
+			External: &autoscalingv2.ExternalMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{
+					Name:     "queue_messages_ready",
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "jobs"}},
+				},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: &queue,
+				},
+			},
+		},
+	})
+
+	scales, err := getAutoScale(context.TODO(), s.clusterClient, a, "web")
+	c.Assert(err, check.IsNil)
+	spec.Process = "web"
+	spec.Version = 1
+	c.Assert(scales, check.DeepEquals, []provision.AutoScaleSpec{spec})
+}
+
 func (s *S) TestEnsureVPAIfEnabled(c *check.C) {
 	a, wait, rollback := s.mock.DefaultReactions(c)
 	defer rollback()
@@ -38,7 +38,7 @@ func (c *KubeClient) BuildPod(ctx context.Context, a provision.App, evt *event.E
 		return errors.WithStack(err)
 	}
 	buildPodName := buildPodNameForApp(a, version)
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -71,12 +71,19 @@ func (c *KubeClient) BuildPod(ctx context.Context, a provision.App, evt *event.E
 		inputFile:         inputFile,
 		quota:             quota,
 		cmds:              dockercommon.ArchiveBuildCmds(a, "file://"+inputFile),
+		evt:               evt,
+		phases: podPhases{
+			scheduling: provision.DeployPhaseBuildPodScheduling,
+			input:      provision.DeployPhaseArchiveUpload,
+			run:        provision.DeployPhaseBuild,
+			push:       provision.DeployPhaseImagePush,
+		},
 	}
 	return createPod(ctx, params)
 }
 
 func (c *KubeClient) ImageTagPushAndInspect(ctx context.Context, a provision.App, evt *event.Event, oldImage string, version appTypes.AppVersion) (provision.InspectData, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return provision.InspectData{}, err
 	}
@@ -103,6 +110,7 @@ func (c *KubeClient) ImageTagPushAndInspect(ctx context.Context, a provision.App
 	if tag != "latest" {
 		destImages = append(destImages, fmt.Sprintf("%s:latest", repository))
 	}
+	endInspect := evt.StartPhase(provision.DeployPhaseInspect)
 	err = runInspectSidecar(ctx, inspectParams{
 		client:            client,
 		stdout:            stdout,
@@ -114,6 +122,7 @@ func (c *KubeClient) ImageTagPushAndInspect(ctx context.Context, a provision.App
 		podName:           deployPodName,
 		labels:            labels,
 	})
+	endInspect(err)
 	if err != nil {
 		stdoutData := stdout.String()
 		stderrData := stderr.String()
@@ -136,7 +145,7 @@ func (c *KubeClient) ImageTagPushAndInspect(ctx context.Context, a provision.App
 }
 
 func (c *KubeClient) DownloadFromContainer(ctx context.Context, app provision.App, evt *event.Event, imageName string) (io.ReadCloser, error) {
-	client, err := clusterForPool(ctx, app.GetPool())
+	client, err := clusterForApp(ctx, app)
 	if err != nil {
 		return nil, err
 	}
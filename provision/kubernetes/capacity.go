@@ -0,0 +1,214 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/log"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const capacityTopApps = 5
+
+func (p *kubernetesProvisioner) ClusterCapacity(ctx context.Context, cluster *provTypes.Cluster) (*provTypes.ClusterCapacity, error) {
+	client, err := NewClusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nodeUsage, podUsage, err := clusterUsage(ctx, client)
+	if err != nil {
+		// Metrics are optional, the report is still useful without them.
+		log.Errorf("[capacity] unable to get resource usage of cluster %q: %v", cluster.Name, err)
+	}
+
+	pools := map[string]*provTypes.PoolCapacity{}
+	nodeIndex := map[string]*provTypes.NodeCapacity{}
+	nodePool := map[string]string{}
+	for _, node := range nodes.Items {
+		poolName := labelSetFromMeta(&node.ObjectMeta).NodePool()
+		pool, ok := pools[poolName]
+		if !ok {
+			pool = &provTypes.PoolCapacity{Pool: poolName}
+			pools[poolName] = pool
+		}
+		nodeCapacity := provTypes.NodeCapacity{
+			Name:        node.Name,
+			Allocatable: capacityResources(node.Status.Allocatable),
+			Pods:        provTypes.PodsCapacity{Limit: node.Status.Allocatable.Pods().Value()},
+		}
+		if used, ok := nodeUsage[node.Name]; ok {
+			nodeCapacity.Used = &used
+		}
+		pool.Nodes = append(pool.Nodes, nodeCapacity)
+		nodePool[node.Name] = poolName
+	}
+	for _, pool := range pools {
+		for i := range pool.Nodes {
+			nodeIndex[pool.Nodes[i].Name] = &pool.Nodes[i]
+		}
+	}
+
+	apps := map[string]map[string]*provTypes.AppCapacity{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+		node, ok := nodeIndex[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		requests, limits := podResources(&pod)
+		node.Requested = node.Requested.Add(requests)
+		node.Limits = node.Limits.Add(limits)
+		node.Pods.Count++
+		appName := labelSetFromMeta(&pod.ObjectMeta).AppName()
+		if appName == "" {
+			continue
+		}
+		poolName := nodePool[pod.Spec.NodeName]
+		if apps[poolName] == nil {
+			apps[poolName] = map[string]*provTypes.AppCapacity{}
+		}
+		appCapacity, ok := apps[poolName][appName]
+		if !ok {
+			appCapacity = &provTypes.AppCapacity{App: appName}
+			apps[poolName][appName] = appCapacity
+		}
+		appCapacity.Units++
+		appCapacity.Requested = appCapacity.Requested.Add(requests)
+		if used, ok := podUsage[pod.Namespace+"/"+pod.Name]; ok {
+			if appCapacity.Used == nil {
+				appCapacity.Used = &provTypes.CapacityResources{}
+			}
+			*appCapacity.Used = appCapacity.Used.Add(used)
+		}
+	}
+
+	result := &provTypes.ClusterCapacity{Cluster: cluster.Name, Pools: []provTypes.PoolCapacity{}}
+	for poolName, pool := range pools {
+		err = summarizePoolCapacity(client, pool, apps[poolName])
+		if err != nil {
+			return nil, err
+		}
+		result.Pools = append(result.Pools, *pool)
+	}
+	sort.Slice(result.Pools, func(i, j int) bool {
+		return result.Pools[i].Pool < result.Pools[j].Pool
+	})
+	return result, nil
+}
+
+func summarizePoolCapacity(client *ClusterClient, pool *provTypes.PoolCapacity, apps map[string]*provTypes.AppCapacity) error {
+	factors, err := requirementsFactorsForPool(client, pool.Pool)
+	if err != nil {
+		return err
+	}
+	pool.Factors = provTypes.CapacityFactors{
+		CPUOvercommit:    factors.cpuOvercommitFactor(),
+		MemoryOvercommit: factors.memoryOvercommitFactor(),
+		CPUBurst:         factors.cpuBurstFactor(),
+	}
+	sort.Slice(pool.Nodes, func(i, j int) bool {
+		return pool.Nodes[i].Name < pool.Nodes[j].Name
+	})
+	for _, node := range pool.Nodes {
+		pool.Allocatable = pool.Allocatable.Add(node.Allocatable)
+		pool.Requested = pool.Requested.Add(node.Requested)
+		pool.Limits = pool.Limits.Add(node.Limits)
+		pool.Pods.Count += node.Pods.Count
+		pool.Pods.Limit += node.Pods.Limit
+		if node.Used != nil {
+			if pool.Used == nil {
+				pool.Used = &provTypes.CapacityResources{}
+			}
+			*pool.Used = pool.Used.Add(*node.Used)
+		}
+	}
+	// Units request their plan divided by the overcommit factor, so the
+	// nodes fit plans that much larger than their allocatable resources.
+	pool.PlanCapacity = provTypes.CapacityResources{
+		MilliCPU:         int64(float64(pool.Allocatable.MilliCPU) * pool.Factors.CPUOvercommit),
+		Memory:           int64(float64(pool.Allocatable.Memory) * pool.Factors.MemoryOvercommit),
+		EphemeralStorage: pool.Allocatable.EphemeralStorage,
+	}
+	pool.TopApps = []provTypes.AppCapacity{}
+	for _, app := range apps {
+		pool.TopApps = append(pool.TopApps, *app)
+	}
+	sort.Slice(pool.TopApps, func(i, j int) bool {
+		a, b := pool.TopApps[i], pool.TopApps[j]
+		if a.Requested.Memory != b.Requested.Memory {
+			return a.Requested.Memory > b.Requested.Memory
+		}
+		if a.Requested.MilliCPU != b.Requested.MilliCPU {
+			return a.Requested.MilliCPU > b.Requested.MilliCPU
+		}
+		return a.App < b.App
+	})
+	if len(pool.TopApps) > capacityTopApps {
+		pool.TopApps = pool.TopApps[:capacityTopApps]
+	}
+	return nil
+}
+
+func capacityResources(list apiv1.ResourceList) provTypes.CapacityResources {
+	return provTypes.CapacityResources{
+		MilliCPU:         list.Cpu().MilliValue(),
+		Memory:           list.Memory().Value(),
+		EphemeralStorage: list.StorageEphemeral().Value(),
+	}
+}
+
+func podResources(pod *apiv1.Pod) (provTypes.CapacityResources, provTypes.CapacityResources) {
+	var requests, limits provTypes.CapacityResources
+	for _, container := range pod.Spec.Containers {
+		requests = requests.Add(capacityResources(container.Resources.Requests))
+		limits = limits.Add(capacityResources(container.Resources.Limits))
+	}
+	return requests, limits
+}
+
+// clusterUsage returns the resources used by each node and pod, as reported
+// by metrics-server.
+func clusterUsage(ctx context.Context, client *ClusterClient) (map[string]provTypes.CapacityResources, map[string]provTypes.CapacityResources, error) {
+	metricsClient, err := MetricsClientForConfig(client.restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeMetrics, err := metricsClient.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	podMetrics, err := metricsClient.MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	nodeUsage := map[string]provTypes.CapacityResources{}
+	for _, metric := range nodeMetrics.Items {
+		nodeUsage[metric.Name] = capacityResources(metric.Usage)
+	}
+	podUsage := map[string]provTypes.CapacityResources{}
+	for _, metric := range podMetrics.Items {
+		var used provTypes.CapacityResources
+		for _, container := range metric.Containers {
+			used = used.Add(capacityResources(container.Usage))
+		}
+		podUsage[metric.Namespace+"/"+metric.Name] = used
+	}
+	return nodeUsage, podUsage, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func (s *S) TestClusterCapacity(c *check.C) {
+	s.clusterClient.CustomData["capool:"+overcommitClusterKey] = "2"
+	s.clusterClient.CustomData["capool:"+cpuBurstKey] = "1.5"
+	defer func() {
+		delete(s.clusterClient.CustomData, "capool:"+overcommitClusterKey)
+		delete(s.clusterClient.CustomData, "capool:"+cpuBurstKey)
+	}()
+	for _, name := range []string{"n1", "n2"} {
+		_, err := s.client.CoreV1().Nodes().Create(context.TODO(), &apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"tsuru.io/pool": "capool"},
+			},
+			Status: apiv1.NodeStatus{
+				Allocatable: apiv1.ResourceList{
+					apiv1.ResourceCPU:              resource.MustParse("2"),
+					apiv1.ResourceMemory:           resource.MustParse("4Gi"),
+					apiv1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+					apiv1.ResourcePods:             resource.MustParse("10"),
+				},
+			},
+		}, metav1.CreateOptions{})
+		c.Assert(err, check.IsNil)
+	}
+	newPod := func(name, app, node string, cpu, memory string) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: node,
+				Containers: []apiv1.Container{{
+					Name: "c",
+					Resources: apiv1.ResourceRequirements{
+						Requests: apiv1.ResourceList{
+							apiv1.ResourceCPU:    resource.MustParse(cpu),
+							apiv1.ResourceMemory: resource.MustParse(memory),
+						},
+					},
+				}},
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+		}
+		if app != "" {
+			pod.Labels = map[string]string{"tsuru.io/app-name": app}
+		}
+		return pod
+	}
+	for _, pod := range []*apiv1.Pod{
+		newPod("app1-1", "app1", "n1", "500m", "1Gi"),
+		newPod("app1-2", "app1", "n2", "500m", "1Gi"),
+		newPod("app2-1", "app2", "n1", "250m", "2Gi"),
+		newPod("daemon", "", "n2", "100m", "128Mi"),
+		newPod("pending", "app3", "", "100m", "128Mi"),
+	} {
+		_, err := s.client.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		c.Assert(err, check.IsNil)
+	}
+	s.client.MetricsClientset.PrependReactor("list", "nodes", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Usage: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("1"),
+				apiv1.ResourceMemory: resource.MustParse("2Gi"),
+			}},
+		}}, nil
+	})
+	s.client.MetricsClientset.PrependReactor("list", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "app2-1", Namespace: "default"}, Containers: []metricsv1beta1.ContainerMetrics{
+				{Name: "c", Usage: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse("200m"),
+					apiv1.ResourceMemory: resource.MustParse("1Gi"),
+				}},
+			}},
+		}}, nil
+	})
+
+	capacity, err := s.p.ClusterCapacity(context.TODO(), s.clusterClient.Cluster)
+	c.Assert(err, check.IsNil)
+	c.Assert(capacity.Cluster, check.Equals, s.clusterClient.Name)
+	var pool *provTypes.PoolCapacity
+	for i := range capacity.Pools {
+		if capacity.Pools[i].Pool == "capool" {
+			pool = &capacity.Pools[i]
+		}
+	}
+	c.Assert(pool, check.NotNil)
+	const gi = 1024 * 1024 * 1024
+	c.Assert(pool.Factors, check.DeepEquals, provTypes.CapacityFactors{CPUOvercommit: 2, MemoryOvercommit: 2, CPUBurst: 1.5})
+	c.Assert(pool.Allocatable, check.DeepEquals, provTypes.CapacityResources{MilliCPU: 4000, Memory: 8 * gi, EphemeralStorage: 20 * gi})
+	c.Assert(pool.PlanCapacity, check.DeepEquals, provTypes.CapacityResources{MilliCPU: 8000, Memory: 16 * gi, EphemeralStorage: 20 * gi})
+	c.Assert(pool.Requested, check.DeepEquals, provTypes.CapacityResources{MilliCPU: 1350, Memory: 4*gi + 128*1024*1024})
+	c.Assert(pool.Used, check.DeepEquals, &provTypes.CapacityResources{MilliCPU: 1000, Memory: 2 * gi})
+	c.Assert(pool.Pods, check.DeepEquals, provTypes.PodsCapacity{Count: 4, Limit: 20})
+	c.Assert(pool.Nodes, check.HasLen, 2)
+	c.Assert(pool.Nodes[0].Name, check.Equals, "n1")
+	c.Assert(pool.Nodes[0].Pods, check.DeepEquals, provTypes.PodsCapacity{Count: 2, Limit: 10})
+	c.Assert(pool.Nodes[1].Used, check.IsNil)
+	c.Assert(pool.TopApps, check.DeepEquals, []provTypes.AppCapacity{
+		{App: "app1", Units: 2, Requested: provTypes.CapacityResources{MilliCPU: 1000, Memory: 2 * gi}},
+		{App: "app2", Units: 1, Requested: provTypes.CapacityResources{MilliCPU: 250, Memory: 2 * gi}, Used: &provTypes.CapacityResources{MilliCPU: 200, Memory: gi}},
+	})
+}
@@ -57,6 +57,10 @@ const (
 	disableHeadlessKey            = "disable-headless"
 	maxSurgeKey                   = "max-surge"
 	maxUnavailableKey             = "max-unavailable"
+	maxSurgeLimitKey              = "max-surge-limit"
+	maxUnavailableLimitKey        = "max-unavailable-limit"
+	gracePeriodLimitKey           = "termination-grace-period-limit"
+	preStopSleepLimitKey          = "pre-stop-sleep-limit"
 	singlePoolKey                 = "single-pool"
 	ephemeralStorageKey           = "ephemeral-storage"
 	preStopSleepKey               = "pre-stop-sleep"
@@ -77,6 +81,11 @@ const (
 	versionedServices             = "enable-versioned-services"
 	dockerConfigJSONKey           = "docker-config-json"
 	dnsConfigNdotsKey             = "dns-config-ndots"
+	networkPolicyNamespacesKey    = "network-policy-allowed-namespaces"
+	teamNamespacesKey             = "team-namespaces"
+	teamNamespaceQuotaKey         = "team-namespace-quota"
+	teamNamespaceRoleKey          = "team-namespace-role"
+	teamResourceQuotasKey         = "team-resource-quotas"
 
 	dialTimeout  = 30 * time.Second
 	tcpKeepAlive = 30 * time.Second
@@ -97,6 +106,10 @@ var (
 		disableHeadlessKey:            "Disable headless service creation for every app-process. This config may be prefixed with `<pool-name>:`.",
 		maxSurgeKey:                   "Max surge for deployments rollout. This config may be prefixed with `<pool-name>:`. Defaults to 100%.",
 		maxUnavailableKey:             "Max unavailable for deployments rollout. This config may be prefixed with `<pool-name>:`. Defaults to 0.",
+		maxSurgeLimitKey:              "Upper bound for the max surge set by apps for their processes. This config may be prefixed with `<pool-name>:`.",
+		maxUnavailableLimitKey:        "Upper bound for the max unavailable set by apps for their processes. This config may be prefixed with `<pool-name>:`.",
+		gracePeriodLimitKey:           "Upper bound in seconds for the termination grace period set by apps for their processes. This config may be prefixed with `<pool-name>:`.",
+		preStopSleepLimitKey:          "Upper bound in seconds for the preStop sleep set by apps for their processes. This config may be prefixed with `<pool-name>:`.",
 		singlePoolKey:                 "Set to use entire cluster to a pool instead only designated nodes. Defaults do false.",
 		ephemeralStorageKey:           fmt.Sprintf("Sets limit for ephemeral storage for created pods. This config may be prefixed with `<pool-name>:`. Defaults to %s.", defaultEphemeralStorageLimit.String()),
 		preStopSleepKey:               fmt.Sprintf("Number of seconds to sleep in the preStop lifecycle hook. This config may be prefixed with `<pool-name>:`. Defaults to %d.", defaultPreStopSleepSeconds),
@@ -112,6 +125,11 @@ var (
 		dockerConfigJSONKey:           "Custom Docker config (~/.docker/config.json) to be mounted on deploy-agent container",
 		disablePDBKey:                 "Disable PodDisruptionBudget for entire pool.",
 		dnsConfigNdotsKey:             "Number of dots in the domain name to be used in the search list for DNS lookups. Default to uses kubernetes default value (5).",
+		networkPolicyNamespacesKey:    "Comma separated list of namespaces always allowed to reach apps with restricted ingress traffic, like the ones running routers. This config may be prefixed with `<pool-name>:`.",
+		teamNamespacesKey:             "Place apps in a namespace per owning team, instead of per pool, moving existing apps when enabled. Defaults to false.",
+		teamNamespaceQuotaKey:         "Resource quota of team namespaces in the format <resource1>=<quantity1>,<resource2>=<quantity2>... This config may be prefixed with `<team-name>:`.",
+		teamNamespaceRoleKey:          "Name of the ClusterRole bound, in each team namespace, to the group named after the team. This config may be prefixed with `<team-name>:`.",
+		teamResourceQuotasKey:         "Enforce the CPU and memory quotas of teams as limits in the resource quota of team namespaces. Requires team-namespaces. Defaults to false.",
 	}
 )
 
@@ -341,6 +359,41 @@ func (c *ClusterClient) PoolNamespace(pool string) string {
 	return prefix
 }
 
+// TeamNamespace returns the namespace of the apps owned by the team, used
+// when the cluster places apps in namespaces per team.
+func (c *ClusterClient) TeamNamespace(team string) string {
+	prefix := "tsuru"
+	if c.CustomData != nil && c.CustomData[namespaceClusterKey] != "" {
+		prefix = c.CustomData[namespaceClusterKey]
+	}
+	return fmt.Sprintf("%s-team-%s", prefix, provision.ValidKubeName(team))
+}
+
+// namespaceForApp returns the namespace where the app should run, per team
+// or per pool depending on the cluster configuration.
+func (c *ClusterClient) namespaceForApp(a appTypes.App) string {
+	if c.teamNamespacesEnabled() {
+		return c.TeamNamespace(a.GetTeamOwner())
+	}
+	return c.PoolNamespace(a.GetPool())
+}
+
+func (c *ClusterClient) teamNamespacesEnabled() bool {
+	if c.CustomData == nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(c.CustomData[teamNamespacesKey])
+	return enabled
+}
+
+func (c *ClusterClient) teamResourceQuotasEnabled() bool {
+	if c.CustomData == nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(c.CustomData[teamResourceQuotasKey])
+	return enabled
+}
+
 // Namespace returns the namespace to be used by Custom Resources
 func (c *ClusterClient) Namespace() string {
 	if c.CustomData != nil && c.CustomData[namespaceClusterKey] != "" {
@@ -550,6 +603,18 @@ func (c *ClusterClient) maxUnavailable(pool string) intstr.IntOrString {
 	return intstr.Parse(maxUnavailable)
 }
 
+func (c *ClusterClient) rolloutLimit(pool, key string) *intstr.IntOrString {
+	if c.CustomData == nil {
+		return nil
+	}
+	limit := c.configForContext(pool, key)
+	if limit == "" {
+		return nil
+	}
+	value := intstr.Parse(limit)
+	return &value
+}
+
 func (c *ClusterClient) dnsConfigNdots(pool string) intstr.IntOrString {
 	DNSConfigNdots := c.configForContext(pool, dnsConfigNdotsKey)
 	if DNSConfigNdots == "" {
@@ -646,6 +711,16 @@ func (c *ClusterClient) GetCluster() *provTypes.Cluster {
 	return c.Cluster
 }
 
+func (c *ClusterClient) networkPolicyAllowedNamespaces(pool string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(c.configForContext(pool, networkPolicyNamespacesKey), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
 func (c *ClusterClient) disablePDB(pool string) bool {
 	if disable := c.configForContext(pool, disablePDBKey); disable != "" {
 		d, _ := strconv.ParseBool(disable)
@@ -672,15 +747,29 @@ func clustersForApps(ctx context.Context, apps []provision.App) ([]clusterApp, e
 	clusterClientMap := map[string]clusterApp{}
 	var poolNames []string
 	for _, a := range apps {
-		poolNames = append(poolNames, a.GetPool())
+		if a.GetCluster() == "" {
+			poolNames = append(poolNames, a.GetPool())
+		}
 	}
 	clusterPoolMap, err := servicemanager.Cluster.FindByPools(ctx, provisionerName, poolNames)
 	if err != nil {
 		return nil, err
 	}
+	pinnedClusters := map[string]provTypes.Cluster{}
 	for _, a := range apps {
-		poolName := a.GetPool()
-		cluster := clusterPoolMap[poolName]
+		cluster := clusterPoolMap[a.GetPool()]
+		if name := a.GetCluster(); name != "" {
+			pinned, ok := pinnedClusters[name]
+			if !ok {
+				found, err := servicemanager.Cluster.FindByName(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				pinned = *found
+				pinnedClusters[name] = pinned
+			}
+			cluster = pinned
+		}
 		mapItem, inMap := clusterClientMap[cluster.Name]
 		if !inMap {
 			cli, err := NewClusterClient(&cluster)
@@ -709,6 +798,51 @@ func clusterForPool(ctx context.Context, pool string) (*ClusterClient, error) {
 	return NewClusterClient(clust)
 }
 
+// clusterForApp returns the client for the cluster the app runs in, the
+// cluster it's pinned to or the one serving its pool.
+func clusterForApp(ctx context.Context, a appTypes.App) (*ClusterClient, error) {
+	if a.GetCluster() == "" {
+		return clusterForPool(ctx, a.GetPool())
+	}
+	clust, err := servicemanager.Cluster.FindByName(ctx, a.GetCluster())
+	if err != nil {
+		return nil, err
+	}
+	return NewClusterClient(clust)
+}
+
+// clusterApps returns the apps running in the cluster, the ones pinned to it
+// and the ones in pools it serves.
+func clusterApps(ctx context.Context, clusterName string) ([]provision.App, error) {
+	apps, err := servicemanager.App.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	poolClusters := map[string]string{}
+	var result []provision.App
+	for _, a := range apps {
+		provApp, ok := a.(provision.App)
+		if !ok {
+			continue
+		}
+		name := a.GetCluster()
+		if name == "" {
+			name, ok = poolClusters[a.GetPool()]
+			if !ok {
+				client, err := clusterForPool(ctx, a.GetPool())
+				if err == nil {
+					name = client.Name
+				}
+				poolClusters[a.GetPool()] = name
+			}
+		}
+		if name == clusterName {
+			result = append(result, provApp)
+		}
+	}
+	return result, nil
+}
+
 func allClusters(ctx context.Context) ([]*ClusterClient, error) {
 	clusters, err := servicemanager.Cluster.FindByProvisioner(ctx, provisionerName)
 	if err != nil {
@@ -15,6 +15,7 @@ import (
 
 	"github.com/elazarl/goproxy"
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	provTypes "github.com/tsuru/tsuru/types/provision"
@@ -619,6 +620,121 @@ func (s *S) TestClustersForApps(c *check.C) {
 	c.Assert(cApps[1].apps, check.DeepEquals, []provision.App{a2, a3})
 }
 
+func (s *S) TestClustersForAppsPinnedCluster(c *check.C) {
+	c1 := provTypes.Cluster{
+		Name:        "c1",
+		Addresses:   []string{"addr1"},
+		Pools:       []string{"p1"},
+		Provisioner: provisionerName,
+	}
+	c2 := provTypes.Cluster{
+		Name:        "c2",
+		Addresses:   []string{"addr2"},
+		Provisioner: provisionerName,
+	}
+	s.mockService.Cluster.OnFindByPools = func(prov string, pools []string) (map[string]provTypes.Cluster, error) {
+		c.Assert(pools, check.DeepEquals, []string{"p1"})
+		return map[string]provTypes.Cluster{"p1": c1}, nil
+	}
+	var found []string
+	s.mockService.Cluster.OnFindByName = func(name string) (*provTypes.Cluster, error) {
+		found = append(found, name)
+		if name == c2.Name {
+			return &c2, nil
+		}
+		return nil, provTypes.ErrClusterNotFound
+	}
+	a1 := provisiontest.NewFakeApp("myapp1", "python", 0)
+	a1.Pool = "p1"
+	a2 := provisiontest.NewFakeApp("myapp2", "python", 0)
+	a2.Pool = "p1"
+	a2.Cluster = "c2"
+	a3 := provisiontest.NewFakeApp("myapp3", "python", 0)
+	a3.Pool = "p1"
+	a3.Cluster = "c2"
+	cApps, err := clustersForApps(context.TODO(), []provision.App{a1, a2, a3})
+	c.Assert(err, check.IsNil)
+	c.Assert(cApps, check.HasLen, 2)
+	sort.Slice(cApps, func(i, j int) bool {
+		return cApps[i].client.Name < cApps[j].client.Name
+	})
+	c.Assert(cApps[0].client.Name, check.Equals, "c1")
+	c.Assert(cApps[0].apps, check.DeepEquals, []provision.App{a1})
+	c.Assert(cApps[1].client.Name, check.Equals, "c2")
+	c.Assert(cApps[1].apps, check.DeepEquals, []provision.App{a2, a3})
+	// the pinned cluster is looked up once
+	c.Assert(found, check.DeepEquals, []string{"c2"})
+	a3.Cluster = "unknown"
+	_, err = clustersForApps(context.TODO(), []provision.App{a1, a3})
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+}
+
+func (s *S) TestClusterForApp(c *check.C) {
+	pinned := provTypes.Cluster{
+		Name:        "pinned",
+		Addresses:   []string{"addr2"},
+		Provisioner: provisionerName,
+	}
+	s.mockService.Cluster.OnFindByName = func(name string) (*provTypes.Cluster, error) {
+		if name == pinned.Name {
+			return &pinned, nil
+		}
+		return nil, provTypes.ErrClusterNotFound
+	}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	client, err := clusterForApp(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	c.Assert(client.Name, check.Equals, s.clusterClient.Name)
+	a.Cluster = "pinned"
+	client, err = clusterForApp(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	c.Assert(client.Name, check.Equals, "pinned")
+	a.Cluster = "unknown"
+	_, err = clusterForApp(context.TODO(), a)
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+}
+
+func (s *S) TestProvisionerUsesPinnedCluster(c *check.C) {
+	s.mockService.Cluster.OnFindByName = func(name string) (*provTypes.Cluster, error) {
+		return nil, provTypes.ErrClusterNotFound
+	}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Cluster = "unknown"
+	_, err := s.p.Units(context.TODO(), a)
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+	err = s.p.Provision(context.TODO(), a)
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+	err = s.p.Stop(context.TODO(), a, "", nil, nil)
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+	err = s.p.Destroy(context.TODO(), a)
+	c.Assert(err, check.Equals, provTypes.ErrClusterNotFound)
+}
+
+func (s *S) TestClusterApps(c *check.C) {
+	pinned := provTypes.Cluster{
+		Name:        "pinned",
+		Addresses:   []string{"addr2"},
+		Provisioner: provisionerName,
+	}
+	s.mockService.Cluster.OnFindByName = func(name string) (*provTypes.Cluster, error) {
+		return &pinned, nil
+	}
+	a1 := &app.App{Name: "myapp1", Pool: "test-default", TeamOwner: s.team.Name}
+	a2 := &app.App{Name: "myapp2", Pool: "test-default", TeamOwner: s.team.Name, Cluster: "pinned"}
+	for _, a := range []*app.App{a1, a2} {
+		err := s.conn.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	apps, err := clusterApps(context.TODO(), s.clusterClient.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].GetName(), check.Equals, "myapp1")
+	apps, err = clusterApps(context.TODO(), "pinned")
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].GetName(), check.Equals, "myapp2")
+}
+
 func (s *S) TestClusterDisablePDB(c *check.C) {
 	c1, err := NewClusterClient(&provTypes.Cluster{Addresses: []string{"addr1"}})
 	c.Assert(err, check.IsNil)
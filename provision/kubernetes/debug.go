@@ -0,0 +1,129 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const debugContainerPrefix = "debugger-"
+
+// Debug adds an ephemeral container running the debug image to the unit pod,
+// targeting the app container so its processes are visible, and attaches to
+// it. Ephemeral containers can't be removed, the container finishes once the
+// attach is closed and it's gone when the pod is replaced.
+func (p *kubernetesProvisioner) Debug(ctx context.Context, a provision.App, opts provision.DebugOptions) error {
+	if opts.Image == "" {
+		return errors.New("image is required")
+	}
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return err
+	}
+	ns, err := client.AppNamespace(ctx, a)
+	if err != nil {
+		return err
+	}
+	pod, err := client.CoreV1().Pods(ns).Get(ctx, opts.Unit, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return &provision.UnitNotFoundError{ID: opts.Unit}
+		}
+		return errors.WithStack(err)
+	}
+	l := labelSetFromMeta(&pod.ObjectMeta)
+	if l.AppName() != a.GetName() {
+		return errors.Errorf("pod %q do not belong to app %q", pod.Name, a.GetName())
+	}
+	if pod.Status.Phase != apiv1.PodRunning {
+		return errors.Errorf("unit %q is not running", pod.Name)
+	}
+	ephemeral, err := client.CoreV1().Pods(ns).GetEphemeralContainers(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return errors.New("ephemeral containers are not enabled in the cluster")
+		}
+		return errors.WithStack(err)
+	}
+	container := debugContainer(pod, opts)
+	ephemeral.EphemeralContainers = append(ephemeral.EphemeralContainers, container)
+	_, err = client.CoreV1().Pods(ns).UpdateEphemeralContainers(ctx, pod.Name, ephemeral, metav1.UpdateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "unable to add debug container")
+	}
+	kubeConf := getKubeConfig()
+	tctx, cancel := context.WithTimeout(ctx, kubeConf.PodRunningTimeout)
+	err = waitForEphemeralContainerRunning(tctx, client, pod.Name, container.Name, ns)
+	cancel()
+	if err != nil {
+		return err
+	}
+	var size *remotecommand.TerminalSize
+	if opts.Width != 0 && opts.Height != 0 {
+		size = &remotecommand.TerminalSize{
+			Width:  uint16(opts.Width),
+			Height: uint16(opts.Height),
+		}
+	}
+	return doAttach(ctx, client, opts.Stdin, opts.Stdout, opts.Stderr, pod.Name, container.Name, opts.Stdin != nil, size, ns)
+}
+
+func debugContainer(pod *apiv1.Pod, opts provision.DebugOptions) apiv1.EphemeralContainer {
+	container := apiv1.EphemeralContainer{
+		EphemeralContainerCommon: apiv1.EphemeralContainerCommon{
+			Name:                     debugContainerPrefix + rand.String(5),
+			Image:                    opts.Image,
+			ImagePullPolicy:          apiv1.PullIfNotPresent,
+			Stdin:                    opts.Stdin != nil,
+			StdinOnce:                opts.Stdin != nil,
+			TTY:                      opts.Stdin != nil,
+			TerminationMessagePolicy: apiv1.TerminationMessageFallbackToLogsOnError,
+		},
+		TargetContainerName: pod.Spec.Containers[0].Name,
+	}
+	if opts.Term != "" {
+		container.Env = []apiv1.EnvVar{{Name: "TERM", Value: opts.Term}}
+	}
+	return container
+}
+
+func waitForEphemeralContainerRunning(ctx context.Context, client *ClusterClient, podName, containerName, namespace string) error {
+	return waitFor(ctx, func() (bool, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+		for _, st := range pod.Status.EphemeralContainerStatuses {
+			if st.Name != containerName {
+				continue
+			}
+			switch {
+			case st.State.Running != nil:
+				return true, nil
+			case st.State.Terminated != nil:
+				return true, errors.Errorf("debug container finished: %s", containerStateMessage(st.State.Terminated.Reason, st.State.Terminated.Message))
+			case st.State.Waiting != nil && imagePullFailureReasons[st.State.Waiting.Reason]:
+				return true, errors.Errorf("unable to pull debug image: %s", containerStateMessage(st.State.Waiting.Reason, st.State.Waiting.Message))
+			}
+		}
+		return false, nil
+	}, nil)
+}
+
+func containerStateMessage(reason, message string) string {
+	if message == "" {
+		return reason
+	}
+	return fmt.Sprintf("%s: %s", reason, message)
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/tsuru/tsuru/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func (s *S) TestDebugContainer(c *check.C) {
+	pod := &apiv1.Pod{
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "myapp-web"}},
+		},
+	}
+	container := debugContainer(pod, provision.DebugOptions{
+		Image: "busybox",
+		Stdin: &bytes.Buffer{},
+		Term:  "xterm",
+	})
+	c.Assert(strings.HasPrefix(container.Name, debugContainerPrefix), check.Equals, true)
+	c.Assert(container.TargetContainerName, check.Equals, "myapp-web")
+	c.Assert(container.Image, check.Equals, "busybox")
+	c.Assert(container.Stdin, check.Equals, true)
+	c.Assert(container.StdinOnce, check.Equals, true)
+	c.Assert(container.TTY, check.Equals, true)
+	c.Assert(container.Env, check.DeepEquals, []apiv1.EnvVar{{Name: "TERM", Value: "xterm"}})
+	container = debugContainer(pod, provision.DebugOptions{Image: "busybox"})
+	c.Assert(container.Stdin, check.Equals, false)
+	c.Assert(container.TTY, check.Equals, false)
+	c.Assert(container.Env, check.IsNil)
+}
@@ -18,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/cli/cli/config/configfile"
@@ -27,6 +28,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/image"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/log"
 	tsuruNet "github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
@@ -72,10 +74,10 @@ type InspectData struct {
 	Procfile  string
 }
 
-func keepAliveSpdyExecutor(config *rest.Config, method string, url *url.URL) (remotecommand.Executor, error) {
+func keepAliveSpdyRoundTripper(config *rest.Config) (http.RoundTripper, *spdy.SpdyRoundTripper, error) {
 	tlsConfig, err := rest.TLSConfigFor(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	upgradeRoundTripper := spdy.NewRoundTripper(tlsConfig, true, false)
 	upgradeRoundTripper.Dialer = &net.Dialer{
@@ -83,6 +85,14 @@ func keepAliveSpdyExecutor(config *rest.Config, method string, url *url.URL) (re
 		KeepAlive: 10 * time.Second,
 	}
 	wrapper, err := rest.HTTPWrappersForConfig(config, upgradeRoundTripper)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapper, upgradeRoundTripper, nil
+}
+
+func keepAliveSpdyExecutor(config *rest.Config, method string, url *url.URL) (remotecommand.Executor, error) {
+	wrapper, upgradeRoundTripper, err := keepAliveSpdyRoundTripper(config)
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +195,62 @@ type createPodParams struct {
 	pod               *apiv1.Pod
 	quota             apiv1.ResourceRequirements
 	mainContainer     string
+	evt               *event.Event
+	phases            podPhases
+}
+
+// podPhases names the event phases recorded while running a deploy agent
+// pod, empty names are not recorded.
+type podPhases struct {
+	scheduling string
+	input      string
+	run        string
+	push       string
+}
+
+// phaseSequence records consecutive event phases, ending the current phase
+// when the next one starts.
+type phaseSequence struct {
+	mu  sync.Mutex
+	evt *event.Event
+	end func(error)
+}
+
+func (s *phaseSequence) next(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finish(nil)
+	if s.evt != nil && name != "" {
+		s.end = s.evt.StartPhase(name)
+	}
+}
+
+func (s *phaseSequence) done(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finish(err)
+}
+
+func (s *phaseSequence) finish(err error) {
+	if s.end != nil {
+		s.end(err)
+		s.end = nil
+	}
+}
+
+// eofReader calls onEOF once the underlying reader is exhausted.
+type eofReader struct {
+	io.Reader
+	once  sync.Once
+	onEOF func()
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.once.Do(r.onEOF)
+	}
+	return n, err
 }
 
 func createDeployPod(ctx context.Context, params createPodParams) error {
@@ -287,7 +353,9 @@ func ensureAuthSecret(ctx context.Context, client *ClusterClient, namespace stri
 	return secret.Name, err
 }
 
-func createPod(ctx context.Context, params createPodParams) error {
+func createPod(ctx context.Context, params createPodParams) (err error) {
+	phases := &phaseSequence{evt: params.evt}
+	defer func() { phases.done(err) }()
 	if params.mainContainer == "" {
 		params.mainContainer = "committer-cont"
 	}
@@ -317,6 +385,7 @@ func createPod(ctx context.Context, params createPodParams) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	phases.next(params.phases.scheduling)
 	_, err = params.client.CoreV1().Pods(ns).Create(ctx, params.pod, metav1.CreateOptions{})
 	if err != nil {
 		return errors.WithStack(err)
@@ -333,12 +402,18 @@ func createPod(ctx context.Context, params createPodParams) error {
 		return err
 	}
 	if params.attachInput != nil {
-		err = doAttach(ctx, params.client, params.attachInput, params.attachOutput, params.attachOutput, params.pod.Name, params.mainContainer, false, nil, ns)
+		phases.next(params.phases.input)
+		input := &eofReader{
+			Reader: params.attachInput,
+			onEOF:  func() { phases.next(params.phases.run) },
+		}
+		err = doAttach(ctx, params.client, input, params.attachOutput, params.attachOutput, params.pod.Name, params.mainContainer, false, nil, ns)
 		if err != nil {
 			return fmt.Errorf("error attaching to %s/%s: %v", params.pod.Name, params.mainContainer, err)
 		}
 		fmt.Fprintln(params.attachOutput, " ---> Cleaning up")
 	}
+	phases.next(params.phases.push)
 	tctx, cancel = context.WithTimeout(ctx, kubeConf.PodReadyTimeout)
 	defer cancel()
 	return waitForPod(tctx, params.client, params.pod, ns, false)
@@ -426,6 +501,7 @@ func logPodEvents(ctx context.Context, client *ClusterClient, initialResourceVer
 type hcResult struct {
 	liveness  *apiv1.Probe
 	readiness *apiv1.Probe
+	startup   *apiv1.Probe
 }
 
 func ensureHealthCheckDefaults(hc *provTypes.TsuruYamlHealthcheck) error {
@@ -491,16 +567,132 @@ func probesFromHC(hc *provTypes.TsuruYamlHealthcheck, client *ClusterClient, por
 	return result, nil
 }
 
+// probesFromProcessConfig replaces the probes derived from the healthcheck
+// with the ones explicitly declared for the process in tsuru.yaml.
+func probesFromProcessConfig(result hcResult, procConfig *provTypes.TsuruYamlKubernetesProcessConfig, defaultPort int) (hcResult, error) {
+	var err error
+	if procConfig.Liveness != nil {
+		result.liveness, err = probeFromConfig("liveness", procConfig.Liveness, defaultPort)
+		if err != nil {
+			return result, err
+		}
+	}
+	if procConfig.Readiness != nil {
+		result.readiness, err = probeFromConfig("readiness", procConfig.Readiness, defaultPort)
+		if err != nil {
+			return result, err
+		}
+	}
+	if procConfig.Startup != nil {
+		result.startup, err = probeFromConfig("startup", procConfig.Startup, defaultPort)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func probeFromConfig(kind string, p *provTypes.TsuruYamlKubernetesProbe, defaultPort int) (*apiv1.Probe, error) {
+	probe := &apiv1.Probe{
+		InitialDelaySeconds: int32(p.InitialDelaySeconds),
+		PeriodSeconds:       int32(p.PeriodSeconds),
+		TimeoutSeconds:      int32(p.TimeoutSeconds),
+		SuccessThreshold:    int32(p.SuccessThreshold),
+		FailureThreshold:    int32(p.FailureThreshold),
+	}
+	probePort := func(port int) (int, error) {
+		if port == 0 {
+			port = defaultPort
+		}
+		if port == 0 {
+			return 0, errors.Errorf("%s probe: port is required for processes without ports", kind)
+		}
+		return port, nil
+	}
+	handlers := 0
+	if p.HTTP != nil {
+		handlers++
+		port, err := probePort(p.HTTP.Port)
+		if err != nil {
+			return nil, err
+		}
+		scheme := strings.ToUpper(p.HTTP.Scheme)
+		if scheme == "" {
+			scheme = strings.ToUpper(provision.DefaultHealthcheckScheme)
+		}
+		headers := []apiv1.HTTPHeader{}
+		for header, value := range p.HTTP.Headers {
+			headers = append(headers, apiv1.HTTPHeader{Name: header, Value: value})
+		}
+		sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+		probe.Handler.HTTPGet = &apiv1.HTTPGetAction{
+			Path:        p.HTTP.Path,
+			Port:        intstr.FromInt(port),
+			Scheme:      apiv1.URIScheme(scheme),
+			HTTPHeaders: headers,
+		}
+	}
+	if p.TCP != nil {
+		handlers++
+		port, err := probePort(p.TCP.Port)
+		if err != nil {
+			return nil, err
+		}
+		probe.Handler.TCPSocket = &apiv1.TCPSocketAction{
+			Port: intstr.FromInt(port),
+		}
+	}
+	if p.Exec != nil {
+		handlers++
+		if len(p.Exec.Command) == 0 {
+			return nil, errors.Errorf("%s probe: exec command is required", kind)
+		}
+		probe.Handler.Exec = &apiv1.ExecAction{
+			Command: p.Exec.Command,
+		}
+	}
+	if p.GRPC != nil {
+		handlers++
+		port, err := probePort(p.GRPC.Port)
+		if err != nil {
+			return nil, err
+		}
+		// The kubernetes version supported does not have native gRPC probes,
+		// the grpc_health_probe binary must be available in the app image.
+		cmd := []string{"grpc_health_probe", fmt.Sprintf("-addr=:%d", port)}
+		if p.GRPC.Service != "" {
+			cmd = append(cmd, "-service="+p.GRPC.Service)
+		}
+		probe.Handler.Exec = &apiv1.ExecAction{
+			Command: cmd,
+		}
+	}
+	if handlers != 1 {
+		return nil, errors.Errorf("%s probe: exactly one of http, tcp, exec or grpc must be set", kind)
+	}
+	return probe, nil
+}
+
 func ensureNamespaceForApp(ctx context.Context, client *ClusterClient, app provision.App) error {
 	ns, err := client.AppNamespace(ctx, app)
 	if err != nil {
 		return err
 	}
+	if app != nil && client.teamNamespacesEnabled() && ns == client.TeamNamespace(app.GetTeamOwner()) {
+		return ensureTeamNamespace(ctx, client, app.GetTeamOwner())
+	}
 	return ensureNamespace(ctx, client, ns)
 }
 
 func ensurePoolNamespace(ctx context.Context, client *ClusterClient, pool string) error {
-	return ensureNamespace(ctx, client, client.PoolNamespace(pool))
+	ns := client.PoolNamespace(pool)
+	// Pools named like team-<team> would share the namespace of the team.
+	if client.teamNamespacesEnabled() && strings.HasPrefix(ns, client.TeamNamespace("")) {
+		return &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("namespace %q of pool %q is reserved for team namespaces", ns, pool),
+		}
+	}
+	return ensureNamespace(ctx, client, ns)
 }
 
 func ensureNamespace(ctx context.Context, client *ClusterClient, namespace string) error {
@@ -662,20 +854,27 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 		}
 	}
 
-	sleepSec := client.preStopSleepSeconds(a.GetPool())
-	terminationGracePeriod := int64(30 + sleepSec)
-
-	var lifecycle apiv1.Lifecycle
-	if sleepSec > 0 {
-		lifecycle.PreStop = &apiv1.Handler{
-			Exec: &apiv1.ExecAction{
-				// Allow some time for endpoints controller and kube-proxy to
-				// remove the endpoints for the pods before sending SIGTERM to
-				// app. This should reduce the number of failed connections due
-				// to pods stopping while their endpoints are still active.
-				Command: []string{"sh", "-c", fmt.Sprintf("sleep %d || true", sleepSec)},
-			},
+	var procConfig *provTypes.TsuruYamlKubernetesProcessConfig
+	if yamlData.Kubernetes != nil {
+		procConfig = yamlData.Kubernetes.GetProcessConfigs(process)
+	}
+	if procConfig != nil {
+		var defaultPort int
+		if len(processPorts) > 0 {
+			defaultPort = processPorts[0].TargetPort
 		}
+		hcData, err = probesFromProcessConfig(hcData, procConfig, defaultPort)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	rollout, err := rolloutConfigForProcess(client, a, process, procConfig, replicas)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lifecycle := apiv1.Lifecycle{
+		PreStop: rollout.preStopHandler(),
 	}
 
 	if yamlData.Hooks != nil && len(yamlData.Hooks.Restart.After) > 0 {
@@ -689,44 +888,39 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 			},
 		}
 	}
-	maxSurge := client.maxSurge(a.GetPool())
-	maxUnavailable := client.maxUnavailable(a.GetPool())
 	dnsConfig := dnsConfigNdots(client, a)
 	nodeSelector, affinity, err := defineSelectorAndAffinity(ctx, a, client)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	_, uid := dockercommon.UserForContainer()
-	overCommit, err := client.OvercommitFactor(a.GetPool())
+	affinity, topologySpread, err := spreadForProcess(ctx, a, process, procConfig, affinity)
 	if err != nil {
-		return nil, nil, errors.WithMessage(err, "misconfigured cluster overcommit factor")
+		return nil, nil, err
 	}
-	cpuOverCommit, err := client.CPUOvercommitFactor(a.GetPool())
+
+	_, uid := dockercommon.UserForContainer()
+	factors, err := requirementsFactorsForPool(client, a.GetPool())
 	if err != nil {
-		return nil, nil, errors.WithMessage(err, "misconfigured cluster cpu overcommit factor")
+		return nil, nil, err
 	}
-	cpuBurst, err := client.CPUBurstFactor(a.GetPool())
-	if err != nil {
-		return nil, nil, errors.WithMessage(err, "misconfigured cluster cpu burst factor")
+	var yamlResources *provTypes.TsuruYamlKubernetesProcessResources
+	if procConfig != nil {
+		yamlResources = procConfig.Resources
 	}
-	memoryOverCommit, err := client.MemoryOvercommitFactor(a.GetPool())
+	resourceRequirements, err := appResourceRequirements(a, process, yamlResources, client, factors)
 	if err != nil {
-		return nil, nil, errors.WithMessage(err, "misconfigured cluster memory overcommit factor")
+		return nil, nil, err
 	}
-	resourceRequirements, err := appResourceRequirements(a, client, requirementsFactors{
-		overCommit:       overCommit,
-		cpuOverCommit:    cpuOverCommit,
-		cpuBurst:         cpuBurst,
-		memoryOverCommit: memoryOverCommit,
-	})
+	volumes, mounts, err := createVolumesForApp(ctx, client, a)
 	if err != nil {
 		return nil, nil, err
 	}
-	volumes, mounts, err := createVolumesForApp(ctx, client, a)
+	extraContainers, err := containersForProcess(ctx, a, process, depName, procConfig, factors)
 	if err != nil {
 		return nil, nil, err
 	}
+	volumes = append(volumes, extraContainers.volumes...)
+	mounts = append(mounts, extraContainers.mounts...)
 	ns, err := client.AppNamespace(ctx, a)
 	if err != nil {
 		return nil, nil, err
@@ -748,7 +942,14 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 	}
 
 	depLabels := labels.WithoutVersion().ToLabels()
-	podLabels := labels.ToLabels()
+	podLabelSet := labels.DeepCopy()
+	if len(extraContainers.sidecars) > 0 {
+		podLabelSet.SetHasSidecars()
+	}
+	if len(extraContainers.initContainers) > 0 {
+		podLabelSet.SetHasInitContainers()
+	}
+	podLabels := podLabelSet.ToLabels()
 	containerPorts := make([]apiv1.ContainerPort, len(processPorts))
 	for i, port := range processPorts {
 		portInt := port.TargetPort
@@ -781,19 +982,25 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 		}
 	}
 
+	// The units set by tsuru are kept in the deployment, replicas changed
+	// outside of tsuru are reported as drift.
+	depAnnotations := map[string]string{tsuruUnitsAnnotation: strconv.Itoa(replicas)}
+	for k, v := range annotations {
+		depAnnotations[k] = v
+	}
 	deployment := appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        depName,
 			Namespace:   ns,
 			Labels:      depLabels,
-			Annotations: annotations,
+			Annotations: depAnnotations,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Strategy: appsv1.DeploymentStrategy{
 				Type: appsv1.RollingUpdateDeploymentStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateDeployment{
-					MaxSurge:       &maxSurge,
-					MaxUnavailable: &maxUnavailable,
+					MaxSurge:       &rollout.maxSurge,
+					MaxUnavailable: &rollout.maxUnavailable,
 				},
 			},
 			Replicas:             &realReplicas,
@@ -807,21 +1014,23 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 					Annotations: annotations,
 				},
 				Spec: apiv1.PodSpec{
-					TerminationGracePeriodSeconds: &terminationGracePeriod,
+					TerminationGracePeriodSeconds: &rollout.terminationGracePeriod,
 					EnableServiceLinks:            &serviceLinks,
 					ImagePullSecrets:              pullSecrets,
 					ServiceAccountName:            serviceAccountNameForApp(a),
 					SecurityContext: &apiv1.PodSecurityContext{
 						RunAsUser: uid,
 					},
-					RestartPolicy:  apiv1.RestartPolicyAlways,
-					NodeSelector:   nodeSelector,
-					Affinity:       affinity,
-					Volumes:        volumes,
-					Subdomain:      headlessServiceName(a, process),
-					ReadinessGates: readinessGates,
-					DNSConfig:      dnsConfig,
-					Containers: []apiv1.Container{
+					RestartPolicy:             apiv1.RestartPolicyAlways,
+					NodeSelector:              nodeSelector,
+					Affinity:                  affinity,
+					TopologySpreadConstraints: topologySpread,
+					Volumes:                   volumes,
+					Subdomain:                 headlessServiceName(a, process),
+					ReadinessGates:            readinessGates,
+					DNSConfig:                 dnsConfig,
+					InitContainers:            extraContainers.initContainers,
+					Containers: append([]apiv1.Container{
 						{
 							Name:           depName,
 							Image:          deployImage,
@@ -829,12 +1038,13 @@ func createAppDeployment(ctx context.Context, client *ClusterClient, depName str
 							Env:            appEnvs(a, process, version, false),
 							ReadinessProbe: hcData.readiness,
 							LivenessProbe:  hcData.liveness,
+							StartupProbe:   hcData.startup,
 							Resources:      resourceRequirements,
 							VolumeMounts:   mounts,
 							Ports:          containerPorts,
 							Lifecycle:      &lifecycle,
 						},
-					},
+					}, extraContainers.sidecars...),
 				},
 			},
 		},
@@ -863,6 +1073,9 @@ func appEnvs(a provision.App, process string, version appTypes.AppVersion, isDep
 type serviceManager struct {
 	client *ClusterClient
 	writer io.Writer
+	// dryRun indicates that client only validates writes, so there are no
+	// rollouts to wait for.
+	dryRun bool
 }
 
 var _ servicecommon.ServiceManager = &serviceManager{}
@@ -1243,11 +1456,13 @@ func (m *serviceManager) DeployService(ctx context.Context, opts servicecommon.D
 		m.writer = ioutil.Discard
 	}
 
-	err := ensureNodeContainers(opts.App)
-	if err != nil {
-		return err
+	if !m.dryRun {
+		err := ensureNodeContainers(opts.App)
+		if err != nil {
+			return err
+		}
 	}
-	err = ensureNamespaceForApp(ctx, m.client, opts.App)
+	err := ensureNamespaceForApp(ctx, m.client, opts.App)
 	if err != nil {
 		return err
 	}
@@ -1320,7 +1535,10 @@ func (m *serviceManager) DeployService(ctx context.Context, opts servicecommon.D
 	if err != nil {
 		return err
 	}
-	newRevision, err := monitorDeployment(ctx, m.client, newDep, opts.App, opts.ProcessName, m.writer, events.ResourceVersion, opts.Version)
+	var newRevision string
+	if !m.dryRun {
+		newRevision, err = monitorDeployment(ctx, m.client, newDep, opts.App, opts.ProcessName, m.writer, events.ResourceVersion, opts.Version)
+	}
 	if err != nil {
 		// We should only rollback if the updated deployment is a new revision.
 		var rollbackErr error
@@ -1372,10 +1590,20 @@ func (m *serviceManager) DeployService(ctx context.Context, opts servicecommon.D
 		return errors.Wrap(err, "unable to ensure auto scale is configured")
 	}
 
-	err = ensurePDB(ctx, m.client, opts.App, opts.ProcessName)
+	err = ensurePDB(ctx, m.client, ensurePDBArgs{
+		app:      opts.App,
+		process:  opts.ProcessName,
+		version:  opts.Version,
+		replicas: opts.Replicas,
+		writer:   m.writer,
+	})
 	if err != nil {
 		return errors.Wrap(err, "unable to ensure pod disruption budget")
 	}
+	err = ensureNetworkPolicy(ctx, m.client, opts.App)
+	if err != nil {
+		return errors.Wrap(err, "unable to ensure network policy")
+	}
 
 	return nil
 }
@@ -134,7 +134,7 @@ func (s *S) TestServiceManagerDeployService(c *check.C) {
 			Name:        "myapp-p1",
 			Namespace:   nsName,
 			Labels:      depLabels,
-			Annotations: map[string]string{},
+			Annotations: map[string]string{"tsuru.io/units": "1"},
 		},
 		Status: appsv1.DeploymentStatus{
 			UpdatedReplicas: 1,
@@ -1870,6 +1870,134 @@ func (s *S) TestServiceManagerDeployServiceWithKubernetesPorts(c *check.C) {
 	})
 }
 
+func (s *S) TestServiceManagerDeployServiceWithSidecars(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	s.clusterClient.CustomData[overcommitClusterKey] = "2"
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "proc1",
+		},
+		"kubernetes": provTypes.TsuruYamlKubernetesConfig{
+			Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+				"mypod1": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+					"web": {
+						VolumeMounts: []provTypes.TsuruYamlKubernetesVolumeMount{
+							{Name: "cache", MountPath: "/cache"},
+						},
+						Sidecars: []provTypes.TsuruYamlKubernetesContainer{
+							{
+								Name:      "proxy",
+								Image:     "gcr.io/cloudsql-docker/gce-proxy:1.28",
+								Command:   []string{"/cloud_sql_proxy"},
+								Env:       []provTypes.TsuruYamlKubernetesEnvVar{{Name: "PORT", Value: "5432"}},
+								Ports:     []provTypes.TsuruYamlKubernetesContainerPort{{Port: 5432}},
+								Resources: &provTypes.TsuruYamlKubernetesProcessResources{Memory: "64Mi"},
+							},
+						},
+						InitContainers: []provTypes.TsuruYamlKubernetesContainer{
+							{
+								Name:         "warmer",
+								Image:        "warmer:v1",
+								VolumeMounts: []provTypes.TsuruYamlKubernetesVolumeMount{{Name: "cache", MountPath: "/data"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	waitDep()
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.Clientset.AppsV1().Deployments(ns).Get(context.TODO(), "myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	podSpec := dep.Spec.Template.Spec
+	c.Assert(podSpec.Containers, check.HasLen, 2)
+	c.Assert(podSpec.Containers[0].Name, check.Equals, "myapp-web")
+	c.Assert(podSpec.Containers[0].VolumeMounts, check.DeepEquals, []apiv1.VolumeMount{
+		{Name: "tsuru-shared-cache", MountPath: "/cache"},
+	})
+	// containers without resources get the pool minimums, requests are
+	// divided by the overcommit factor like the process container
+	resources := apiv1.ResourceRequirements{
+		Limits: apiv1.ResourceList{
+			apiv1.ResourceMemory: *resource.NewQuantity(64*1024*1024, resource.BinarySI),
+			apiv1.ResourceCPU:    *resource.NewMilliQuantity(50, resource.DecimalSI),
+		},
+		Requests: apiv1.ResourceList{
+			apiv1.ResourceMemory: *resource.NewQuantity(32*1024*1024, resource.BinarySI),
+			apiv1.ResourceCPU:    *resource.NewMilliQuantity(25, resource.DecimalSI),
+		},
+	}
+	c.Assert(podSpec.Containers[1], check.DeepEquals, apiv1.Container{
+		Name:      "proxy",
+		Image:     "gcr.io/cloudsql-docker/gce-proxy:1.28",
+		Command:   []string{"/cloud_sql_proxy"},
+		Env:       []apiv1.EnvVar{{Name: "PORT", Value: "5432"}},
+		Ports:     []apiv1.ContainerPort{{ContainerPort: 5432, Protocol: apiv1.ProtocolTCP}},
+		Resources: resources,
+	})
+	c.Assert(podSpec.InitContainers, check.DeepEquals, []apiv1.Container{
+		{
+			Name:         "warmer",
+			Image:        "warmer:v1",
+			Resources:    resources,
+			VolumeMounts: []apiv1.VolumeMount{{Name: "tsuru-shared-cache", MountPath: "/data"}},
+		},
+	})
+	c.Assert(dep.Spec.Template.Labels["tsuru.io/has-sidecars"], check.Equals, "true")
+	c.Assert(dep.Spec.Template.Labels["tsuru.io/has-init-containers"], check.Equals, "true")
+	c.Assert(podSpec.Volumes, check.DeepEquals, []apiv1.Volume{
+		{Name: "tsuru-shared-cache", VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}}},
+	})
+}
+
+func (s *S) TestServiceManagerDeployServiceWithSidecarRegistryNotAllowed(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	err = pool.SetPoolConstraint(&pool.PoolConstraint{PoolExpr: a.Pool, Field: pool.ConstraintTypeRegistry, Values: []string{"registry.example.com"}})
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "proc1",
+		},
+		"kubernetes": provTypes.TsuruYamlKubernetesConfig{
+			Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+				"mypod1": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+					"web": {
+						Sidecars: []provTypes.TsuruYamlKubernetesContainer{
+							{Name: "shipper", Image: "fluent/fluent-bit:1.9"},
+						},
+					},
+				},
+			},
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.ErrorMatches, `.*registry "docker.io" of container "shipper" is not allowed in pool "test-default".*`)
+}
+
 func (s *S) TestServiceManagerDeployServiceWithKubernetesPortsDuplicatedProcess(c *check.C) {
 	waitDep := s.mock.DeploymentReactions(c)
 	defer waitDep()
@@ -2277,6 +2405,113 @@ func (s *S) TestServiceManagerDeployServiceWithNodeContainers(c *check.C) {
 	c.Assert(daemon, check.NotNil)
 }
 
+func (s *S) TestServiceManagerDeployServiceWithExplicitProbes(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "cm1",
+		},
+		"healthcheck": provTypes.TsuruYamlHealthcheck{
+			Path:         "/hc",
+			ForceRestart: true,
+		},
+		"kubernetes": provTypes.TsuruYamlKubernetesConfig{
+			Groups: map[string]provTypes.TsuruYamlKubernetesGroup{
+				"mypod": map[string]provTypes.TsuruYamlKubernetesProcessConfig{
+					"web": {
+						Liveness: &provTypes.TsuruYamlKubernetesProbe{
+							TCP:              &provTypes.TsuruYamlKubernetesTCPProbe{},
+							FailureThreshold: 5,
+						},
+						Startup: &provTypes.TsuruYamlKubernetesProbe{
+							HTTP:             &provTypes.TsuruYamlKubernetesHTTPProbe{Path: "/started"},
+							PeriodSeconds:    10,
+							FailureThreshold: 30,
+						},
+					},
+				},
+			},
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	waitDep()
+	nsName, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.Clientset.AppsV1().Deployments(nsName).Get(context.TODO(), "myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	container := dep.Spec.Template.Spec.Containers[0]
+	c.Assert(container.ReadinessProbe, check.DeepEquals, &apiv1.Probe{
+		PeriodSeconds:    10,
+		FailureThreshold: 3,
+		TimeoutSeconds:   60,
+		Handler: apiv1.Handler{
+			HTTPGet: &apiv1.HTTPGetAction{
+				Path:        "/hc",
+				Port:        intstr.FromInt(8888),
+				Scheme:      apiv1.URISchemeHTTP,
+				HTTPHeaders: []apiv1.HTTPHeader{},
+			},
+		},
+	})
+	c.Assert(container.LivenessProbe, check.DeepEquals, &apiv1.Probe{
+		FailureThreshold: 5,
+		Handler: apiv1.Handler{
+			TCPSocket: &apiv1.TCPSocketAction{Port: intstr.FromInt(8888)},
+		},
+	})
+	c.Assert(container.StartupProbe, check.DeepEquals, &apiv1.Probe{
+		PeriodSeconds:    10,
+		FailureThreshold: 30,
+		Handler: apiv1.Handler{
+			HTTPGet: &apiv1.HTTPGetAction{
+				Path:        "/started",
+				Port:        intstr.FromInt(8888),
+				Scheme:      apiv1.URISchemeHTTP,
+				HTTPHeaders: []apiv1.HTTPHeader{},
+			},
+		},
+	})
+}
+
+func (s *S) TestProbesFromProcessConfig(c *check.C) {
+	result, err := probesFromProcessConfig(hcResult{}, &provTypes.TsuruYamlKubernetesProcessConfig{
+		Readiness: &provTypes.TsuruYamlKubernetesProbe{
+			GRPC: &provTypes.TsuruYamlKubernetesGRPCProbe{Port: 9000, Service: "health"},
+		},
+		Liveness: &provTypes.TsuruYamlKubernetesProbe{
+			Exec: &provTypes.TsuruYamlKubernetesExecProbe{Command: []string{"check"}},
+		},
+	}, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.readiness.Handler.Exec.Command, check.DeepEquals, []string{"grpc_health_probe", "-addr=:9000", "-service=health"})
+	c.Assert(result.liveness.Handler.Exec.Command, check.DeepEquals, []string{"check"})
+	c.Assert(result.startup, check.IsNil)
+	_, err = probesFromProcessConfig(hcResult{}, &provTypes.TsuruYamlKubernetesProcessConfig{
+		Startup: &provTypes.TsuruYamlKubernetesProbe{
+			TCP: &provTypes.TsuruYamlKubernetesTCPProbe{},
+		},
+	}, 0)
+	c.Assert(err, check.ErrorMatches, "startup probe: port is required for processes without ports")
+	_, err = probesFromProcessConfig(hcResult{}, &provTypes.TsuruYamlKubernetesProcessConfig{
+		Liveness: &provTypes.TsuruYamlKubernetesProbe{
+			TCP:  &provTypes.TsuruYamlKubernetesTCPProbe{},
+			Exec: &provTypes.TsuruYamlKubernetesExecProbe{Command: []string{"check"}},
+		},
+	}, 8080)
+	c.Assert(err, check.ErrorMatches, "liveness probe: exactly one of http, tcp, exec or grpc must be set")
+}
+
 func (s *S) TestServiceManagerDeployServiceWithHCInvalidMethod(c *check.C) {
 	waitDep := s.mock.DeploymentReactions(c)
 	defer waitDep()
@@ -2741,7 +2976,7 @@ func (s *S) TestServiceManagerDeployServiceWithPreserveVersions(c *check.C) {
 			Name:        "myapp-p1-v2",
 			Namespace:   nsName,
 			Labels:      depLabels,
-			Annotations: map[string]string{},
+			Annotations: map[string]string{"tsuru.io/units": "1"},
 		},
 		Status: appsv1.DeploymentStatus{
 			UpdatedReplicas: 1,
@@ -2949,6 +3184,7 @@ func (s *S) TestServiceManagerDeployServiceWithLegacyDeploy(c *check.C) {
 		{Name: "PORT_p1", Value: "8888"},
 	}
 	expectedDep.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+	expectedDep.Annotations = map[string]string{"tsuru.io/units": "1"}
 
 	expectedSvc := legacySvc.DeepCopy()
 	expectedSvc.Labels["tsuru.io/restarts"] = "1"
@@ -3052,6 +3288,7 @@ func (s *S) TestServiceManagerDeployServiceWithLegacyDeployAndNewVersion(c *chec
 		{Name: "PORT_p1", Value: "8888"},
 	}
 	expectedDepV2.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+	expectedDepV2.Annotations = map[string]string{"tsuru.io/units": "1"}
 
 	expectedSvcBase := legacySvc.DeepCopy()
 	expectedSvcBase.Labels["tsuru.io/is-routable"] = "true"
@@ -0,0 +1,304 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/servicecommon"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	driftDetectedEventKind  = "drift-detected"
+	driftCorrectedEventKind = "drift-corrected"
+	driftResolvedEventKind  = "drift-resolved"
+)
+
+// driftKinds are the kinds of resources checked for drift.
+var driftKinds = map[string]bool{
+	"Deployment":              true,
+	"Service":                 true,
+	"HorizontalPodAutoscaler": true,
+	"PodDisruptionBudget":     true,
+}
+
+func (p *kubernetesProvisioner) Drift(ctx context.Context, a provision.App) ([]provision.ManifestChange, error) {
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return appDrift(ctx, client, a)
+}
+
+// appDrift returns the changes tsuru would apply to the deployments,
+// services, autoscalers and disruption budgets of the app to bring them back
+// to their expected state. Nothing is changed in the cluster.
+func appDrift(ctx context.Context, client *ClusterClient, a provision.App) ([]provision.ManifestChange, error) {
+	dryClient, recorder, err := newDryRunClusterClient(client)
+	if err != nil {
+		return nil, err
+	}
+	manager := &serviceManager{
+		client: dryClient,
+		dryRun: true,
+	}
+	err = redeployCurrentServices(ctx, client, manager, a)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := recorder.manifestChanges()
+	if err != nil {
+		return nil, err
+	}
+	var drift []provision.ManifestChange
+	for _, change := range changes {
+		if driftKinds[change.Kind] && change.Operation != provision.ManifestDelete {
+			drift = append(drift, change)
+		}
+	}
+	return drift, nil
+}
+
+// redeployCurrentServices deploys again the services of every version
+// currently running for the app, keeping the units set by tsuru and their
+// state.
+func redeployCurrentServices(ctx context.Context, client *ClusterClient, manager *serviceManager, a provision.App) error {
+	grouped, err := deploymentsDataForApp(ctx, client, a)
+	if err != nil {
+		return err
+	}
+	var versionNumbers []int
+	for v := range grouped.versioned {
+		versionNumbers = append(versionNumbers, v)
+	}
+	sort.Ints(versionNumbers)
+	for _, v := range versionNumbers {
+		version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, a, strconv.Itoa(v))
+		if err != nil {
+			if appTypes.IsInvalidVersionError(err) {
+				continue
+			}
+			return err
+		}
+		deps := grouped.versioned[v]
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].process < deps[j].process
+		})
+		for _, depData := range deps {
+			if depData.isLegacy {
+				continue
+			}
+			current, _, err := manager.CurrentLabels(ctx, a, depData.process, v)
+			if err != nil {
+				return err
+			}
+			units, err := expectedUnits(ctx, client, a, depData.process, v)
+			if err != nil {
+				return err
+			}
+			labels, realReplicas, err := servicecommon.ServiceLabelsForState(ctx, a, depData.process, version, current, units, servicecommon.ProcessState{})
+			if err != nil {
+				return err
+			}
+			err = manager.DeployService(ctx, servicecommon.DeployServiceOpts{
+				App:              a,
+				ProcessName:      depData.process,
+				Labels:           labels,
+				Replicas:         realReplicas,
+				Version:          version,
+				PreserveVersions: true,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "unable to check process %q version %d", depData.process, v)
+			}
+		}
+	}
+	return nil
+}
+
+// expectedUnits returns the units of the process version set by tsuru, which
+// are kept in the deployment annotations. Deployments created before the
+// annotation existed and processes scaled by an autoscaler keep their current
+// replicas.
+func expectedUnits(ctx context.Context, client *ClusterClient, a provision.App, process string, version int) (int, error) {
+	dep, err := deploymentForVersion(ctx, client, a, process, version)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var replicas int
+	if dep.Spec.Replicas != nil {
+		replicas = int(*dep.Spec.Replicas)
+	}
+	units, err := strconv.Atoi(dep.Annotations[tsuruUnitsAnnotation])
+	if err != nil {
+		return replicas, nil
+	}
+	autoScale, err := getAutoScale(ctx, client, a, process)
+	if err != nil {
+		return 0, err
+	}
+	if len(autoScale) > 0 {
+		return replicas, nil
+	}
+	return units, nil
+}
+
+// runDriftReconciler periodically checks the apps in the cluster for drift
+// while this controller is the leader.
+func (c *clusterController) runDriftReconciler(ctx context.Context, interval time.Duration) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			if !c.isLeader() {
+				continue
+			}
+			err := c.reconcileDrift(ctx)
+			if err != nil {
+				log.Errorf("[drift-reconciler] error checking drift in cluster %q: %v", c.cluster.Name, err)
+			}
+		}
+	}()
+}
+
+func (c *clusterController) reconcileDrift(ctx context.Context) error {
+	apps, err := clusterApps(ctx, c.cluster.Name)
+	if err != nil {
+		return err
+	}
+	for _, a := range apps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = reconcileAppDrift(ctx, c.cluster, a)
+		if err != nil {
+			log.Errorf("[drift-reconciler] error checking drift for app %q: %v", a.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// reconcileAppDrift registers an event when the resources of the app drifted
+// from their expected state, correcting them if the pool of the app is
+// configured to do so. Drift which is no longer found is registered as
+// resolved.
+func reconcileAppDrift(ctx context.Context, client *ClusterClient, a provision.App) (err error) {
+	changes, err := appDrift(ctx, client, a)
+	if err != nil {
+		return err
+	}
+	target := event.Target{Type: event.TargetTypeApp, Value: a.GetName()}
+	allowed := event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permTypes.CtxTeam, a.GetTeamsName()),
+		permission.Context(permTypes.CtxApp, a.GetName()),
+		permission.Context(permTypes.CtxPool, a.GetPool()),
+	)...)
+	if len(changes) == 0 {
+		unresolved, err := unresolvedDrift(target)
+		if err != nil || unresolved == nil {
+			return err
+		}
+		evt, err := event.NewInternal(&event.Opts{
+			Target:       target,
+			InternalKind: driftResolvedEventKind,
+			DisableLock:  true,
+			Allowed:      allowed,
+		})
+		if err != nil {
+			return err
+		}
+		evt.Done(nil)
+		return nil
+	}
+	p, err := pool.GetPoolByName(ctx, a.GetPool())
+	if err != nil {
+		return err
+	}
+	autoCorrect, err := p.GetDriftAutoCorrect()
+	if err != nil {
+		return err
+	}
+	if !autoCorrect {
+		// drift which is not corrected would be found again on every check,
+		// only changes to it are recorded
+		unresolved, err := unresolvedDrift(target)
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(unresolved, changes) {
+			return nil
+		}
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: driftDetectedEventKind,
+		CustomData:   changes,
+		DisableLock:  true,
+		Allowed:      allowed,
+	})
+	if err != nil {
+		return err
+	}
+	evt.Done(nil)
+	if !autoCorrect {
+		return nil
+	}
+	evt, err = event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: driftCorrectedEventKind,
+		CustomData:   changes,
+		Allowed:      allowed,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	manager := &serviceManager{
+		client: client,
+		writer: evt,
+	}
+	return redeployCurrentServices(ctx, client, manager, a)
+}
+
+// unresolvedDrift returns the changes recorded in the last drift-detected
+// event of the target, unless the drift was corrected or resolved after it.
+func unresolvedDrift(target event.Target) ([]provision.ManifestChange, error) {
+	evts, err := event.List(&event.Filter{
+		Target:    target,
+		KindType:  event.KindTypeInternal,
+		KindNames: []string{driftDetectedEventKind, driftCorrectedEventKind, driftResolvedEventKind},
+		Limit:     1,
+	})
+	if err != nil || len(evts) == 0 || evts[0].Kind.Name != driftDetectedEventKind {
+		return nil, err
+	}
+	var changes []provision.ManifestChange
+	err = evts[0].StartData(&changes)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
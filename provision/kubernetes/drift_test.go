@@ -0,0 +1,295 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/servicecommon"
+	check "gopkg.in/check.v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// dryRunAPIServer makes the clients created for dry-runs reach an API server
+// serving the objects of the fake clientset and replying to writes with the
+// written objects, as API servers do for dry-run requests.
+func (s *S) dryRunAPIServer(c *check.C) func() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			c.Check(r.URL.Query().Get("dryRun"), check.Equals, "All")
+			if r.Method == http.MethodDelete {
+				w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Success"}`))
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			w.Write(data)
+			return
+		}
+		obj, err := s.fakeAPIObject(r)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`))
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+	}))
+	clientForConfig := ClientForConfig
+	ClientForConfig = func(conf *rest.Config) (kubernetes.Interface, error) {
+		if conf.ContentType != "application/json" {
+			return clientForConfig(conf)
+		}
+		cfg := rest.CopyConfig(conf)
+		cfg.Host = srv.URL
+		cfg.TLSClientConfig = rest.TLSClientConfig{}
+		return kubernetes.NewForConfig(cfg)
+	}
+	return func() {
+		ClientForConfig = clientForConfig
+		srv.Close()
+	}
+}
+
+// fakeAPIObject returns the object, or the list of objects matching the label
+// selector, requested from the fake clientset.
+func (s *S) fakeAPIObject(r *http.Request) (runtime.Object, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var gv schema.GroupVersion
+	switch {
+	case len(parts) > 2 && parts[0] == "api":
+		gv, parts = schema.GroupVersion{Version: parts[1]}, parts[2:]
+	case len(parts) > 3 && parts[0] == "apis":
+		gv, parts = schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:]
+	default:
+		return nil, errors.Errorf("invalid path %q", r.URL.Path)
+	}
+	var ns string
+	if len(parts) > 2 && parts[0] == "namespaces" {
+		ns, parts = parts[1], parts[2:]
+	}
+	gvr := gv.WithResource(parts[0])
+	var gvk schema.GroupVersionKind
+	for kind := range scheme.Scheme.KnownTypes(gv) {
+		if plural, _ := meta.UnsafeGuessKindToResource(gv.WithKind(kind)); plural == gvr {
+			gvk = gv.WithKind(kind)
+		}
+	}
+	if gvk.Kind == "" {
+		return nil, errors.Errorf("unknown resource %v", gvr)
+	}
+	tracker := s.client.Clientset.Tracker()
+	if len(parts) > 1 {
+		obj, err := tracker.Get(gvr, ns, parts[1])
+		if err != nil {
+			return nil, err
+		}
+		obj = obj.DeepCopyObject()
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		return obj, nil
+	}
+	list, err := tracker.List(gvr, gvk, ns)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []runtime.Object
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Matches(labels.Set(accessor.GetLabels())) {
+			filtered = append(filtered, item)
+		}
+	}
+	err = meta.SetList(list, filtered)
+	if err != nil {
+		return nil, err
+	}
+	list.GetObjectKind().SetGroupVersionKind(gv.WithKind(gvk.Kind + "List"))
+	return list, nil
+}
+
+func (s *S) deployDriftApp(c *check.C) *app.App {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"p1": "cmd1",
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"p1": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+// scaleDriftApp changes the replicas of the app deployment as kubectl would,
+// without going through the deployment reactions of the mock.
+func (s *S) scaleDriftApp(c *check.C, a *app.App, replicas int32) {
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.AppsV1().Deployments(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	dep.Spec.Replicas = &replicas
+	err = s.client.Clientset.Tracker().Update(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, dep, ns)
+	c.Assert(err, check.IsNil)
+}
+
+func deploymentDrift(changes []provision.ManifestChange) []provision.ManifestChange {
+	var result []provision.ManifestChange
+	for _, change := range changes {
+		if change.Kind == "Deployment" {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func driftEvents(c *check.C, a *app.App, kind string) int {
+	evts, err := event.List(&event.Filter{
+		Target:    event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		KindType:  event.KindTypeInternal,
+		KindNames: []string{kind},
+	})
+	c.Assert(err, check.IsNil)
+	return len(evts)
+}
+
+func (s *S) TestAppDrift(c *check.C) {
+	a := s.deployDriftApp(c)
+	defer s.dryRunAPIServer(c)()
+	changes, err := appDrift(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	c.Assert(deploymentDrift(changes), check.HasLen, 0)
+	s.scaleDriftApp(c, a, 5)
+	changes, err = appDrift(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	changes = deploymentDrift(changes)
+	c.Assert(changes, check.HasLen, 1)
+	c.Assert(changes[0].Name, check.Equals, "myapp-p1")
+	c.Assert(changes[0].Operation, check.Equals, provision.ManifestUpdate)
+	c.Assert(changes[0].Diff, check.Matches, `(?s).*-   replicas: 5\n.*\+   replicas: 1\n.*`)
+	c.Assert(changes[0].Manifest, check.Not(check.Matches), `(?s).*tsuru.io/units.*`)
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.AppsV1().Deployments(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(5))
+}
+
+func (s *S) TestExpectedUnits(c *check.C) {
+	a := s.deployDriftApp(c)
+	units, err := expectedUnits(context.TODO(), s.clusterClient, a, "p1", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.Equals, 1)
+	s.scaleDriftApp(c, a, 5)
+	units, err = expectedUnits(context.TODO(), s.clusterClient, a, "p1", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.Equals, 1)
+	units, err = expectedUnits(context.TODO(), s.clusterClient, a, "p2", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.Equals, 0)
+	err = s.p.SetAutoScale(context.TODO(), a, provision.AutoScaleSpec{
+		Process:    "p1",
+		MinUnits:   1,
+		MaxUnits:   10,
+		AverageCPU: "500m",
+	})
+	c.Assert(err, check.IsNil)
+	s.scaleDriftApp(c, a, 5)
+	units, err = expectedUnits(context.TODO(), s.clusterClient, a, "p1", 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.Equals, 5)
+}
+
+func (s *S) TestReconcileAppDrift(c *check.C) {
+	a := s.deployDriftApp(c)
+	defer s.dryRunAPIServer(c)()
+	reconcile := func() {
+		err := reconcileAppDrift(context.TODO(), s.clusterClient, a)
+		c.Assert(err, check.IsNil)
+	}
+	reconcile()
+	c.Assert(driftEvents(c, a, driftDetectedEventKind), check.Equals, 0)
+	c.Assert(driftEvents(c, a, driftResolvedEventKind), check.Equals, 0)
+	s.scaleDriftApp(c, a, 5)
+	reconcile()
+	c.Assert(driftEvents(c, a, driftDetectedEventKind), check.Equals, 1)
+	unresolved, err := unresolvedDrift(event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(deploymentDrift(unresolved), check.HasLen, 1)
+	reconcile()
+	c.Assert(driftEvents(c, a, driftDetectedEventKind), check.Equals, 1)
+	s.scaleDriftApp(c, a, 1)
+	reconcile()
+	c.Assert(driftEvents(c, a, driftResolvedEventKind), check.Equals, 1)
+	unresolved, err = unresolvedDrift(event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(unresolved, check.IsNil)
+	reconcile()
+	c.Assert(driftEvents(c, a, driftResolvedEventKind), check.Equals, 1)
+	// the same drift happening again is recorded
+	s.scaleDriftApp(c, a, 5)
+	reconcile()
+	c.Assert(driftEvents(c, a, driftDetectedEventKind), check.Equals, 2)
+	c.Assert(driftEvents(c, a, driftCorrectedEventKind), check.Equals, 0)
+}
+
+func (s *S) TestReconcileAppDriftAutoCorrect(c *check.C) {
+	a := s.deployDriftApp(c)
+	defer s.dryRunAPIServer(c)()
+	err := pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"drift-auto-correct": "true"},
+	})
+	c.Assert(err, check.IsNil)
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	s.scaleDriftApp(c, a, 5)
+	err = reconcileAppDrift(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	c.Assert(driftEvents(c, a, driftDetectedEventKind), check.Equals, 1)
+	c.Assert(driftEvents(c, a, driftCorrectedEventKind), check.Equals, 1)
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.AppsV1().Deployments(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(1))
+	unresolved, err := unresolvedDrift(event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(unresolved, check.IsNil)
+}
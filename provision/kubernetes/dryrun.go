@@ -0,0 +1,386 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/servicecommon"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func (p *kubernetesProvisioner) DryRun(ctx context.Context, args provision.DeployArgs) ([]provision.ManifestChange, error) {
+	client, err := clusterForApp(ctx, args.App)
+	if err != nil {
+		return nil, err
+	}
+	dryClient, recorder, err := newDryRunClusterClient(client)
+	if err != nil {
+		return nil, err
+	}
+	if err = ensureAppCustomResourceSynced(ctx, dryClient, args.App); err != nil {
+		return nil, err
+	}
+	manager := &serviceManager{
+		client: dryClient,
+		dryRun: true,
+	}
+	var oldVersionNumber int
+	if !args.PreserveVersions {
+		oldVersionNumber, err = baseVersionForApp(ctx, client, args.App)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args.Event = nil
+	args.DryRun = true
+	err = servicecommon.RunServicePipeline(ctx, manager, oldVersionNumber, args, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return recorder.manifestChanges()
+}
+
+// newDryRunClusterClient returns a copy of client whose writes are sent to
+// the cluster with dryRun=All, so they are validated and defaulted by the
+// API server without being persisted. Each accepted write is recorded along
+// with the object currently live in the cluster.
+func newDryRunClusterClient(client *ClusterClient) (*ClusterClient, *dryRunRecorder, error) {
+	recorder := &dryRunRecorder{}
+	cfg := rest.CopyConfig(client.restConfig)
+	// Recorded objects are decoded as JSON regardless of their kind.
+	cfg.ContentType = "application/json"
+	cfg.AcceptContentTypes = "application/json"
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &dryRunTransport{base: rt, recorder: recorder}
+	})
+	cli, err := ClientForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ClusterClient{
+		Cluster:    client.Cluster,
+		Interface:  cli,
+		restConfig: cfg,
+	}, recorder, nil
+}
+
+type dryRunWrite struct {
+	method string
+	live   []byte
+	result []byte
+}
+
+type dryRunRecorder struct {
+	sync.Mutex
+	writes []dryRunWrite
+}
+
+func (r *dryRunRecorder) record(w dryRunWrite) {
+	r.Lock()
+	defer r.Unlock()
+	r.writes = append(r.writes, w)
+}
+
+type dryRunTransport struct {
+	base     http.RoundTripper
+	recorder *dryRunRecorder
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var live []byte
+	if req.Method != http.MethodPost {
+		var err error
+		live, err = t.liveObject(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dryReq := req.Clone(req.Context())
+	query := dryReq.URL.Query()
+	query.Set("dryRun", "All")
+	dryReq.URL.RawQuery = query.Encode()
+	dryReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	dryReq.ContentLength = int64(len(body))
+	rsp, err := t.base.RoundTrip(dryReq)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodPost && rsp.StatusCode == http.StatusNotFound && len(body) > 0 {
+		// Objects created in a namespace that would also be created in this
+		// dry-run are rejected by the API server, as the namespace does not
+		// exist yet. The request body is reported as the object instead.
+		rsp.Body.Close()
+		rsp.StatusCode = http.StatusCreated
+		rsp.Status = http.StatusText(http.StatusCreated)
+		rsp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		rsp.ContentLength = int64(len(body))
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp, nil
+	}
+	result, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(result))
+	t.recorder.record(dryRunWrite{method: req.Method, live: live, result: result})
+	return rsp, nil
+}
+
+func (t *dryRunTransport) liveObject(req *http.Request) ([]byte, error) {
+	getReq := req.Clone(req.Context())
+	getReq.Method = http.MethodGet
+	// Only selectors are kept, so a collection deletion lists the objects
+	// it would remove.
+	query := url.Values{}
+	for _, key := range []string{"labelSelector", "fieldSelector"} {
+		if v := req.URL.Query().Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	getReq.URL.RawQuery = query.Encode()
+	getReq.Body = nil
+	getReq.ContentLength = 0
+	getReq.Header.Del("Content-Type")
+	rsp, err := t.base.RoundTrip(getReq)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	return ioutil.ReadAll(rsp.Body)
+}
+
+// manifestChanges converts the recorded writes to manifest changes. Writes to
+// the same object are reported once, with its last written state, and writes
+// that do not change the live object are omitted.
+func (r *dryRunRecorder) manifestChanges() ([]provision.ManifestChange, error) {
+	r.Lock()
+	defer r.Unlock()
+	var changes []provision.ManifestChange
+	var liveManifests []string
+	indexes := map[string]int{}
+	add := func(change provision.ManifestChange, liveManifest string) {
+		key := strings.Join([]string{change.Kind, change.Namespace, change.Name}, "/")
+		idx, ok := indexes[key]
+		if !ok {
+			indexes[key] = len(changes)
+			changes = append(changes, change)
+			liveManifests = append(liveManifests, liveManifest)
+			return
+		}
+		if changes[idx].Operation == provision.ManifestCreate && change.Operation == provision.ManifestUpdate {
+			change.Operation = provision.ManifestCreate
+		}
+		changes[idx] = change
+	}
+	for _, w := range r.writes {
+		live, err := decodeDryRunObjects(w.live)
+		if err != nil {
+			return nil, err
+		}
+		if w.method == http.MethodDelete {
+			for _, obj := range live {
+				manifest, err := dryRunManifest(obj)
+				if err != nil {
+					return nil, err
+				}
+				add(provision.ManifestChange{
+					Kind:      obj.GetKind(),
+					Namespace: obj.GetNamespace(),
+					Name:      obj.GetName(),
+					Operation: provision.ManifestDelete,
+				}, manifest)
+			}
+			continue
+		}
+		results, err := decodeDryRunObjects(w.result)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) != 1 {
+			continue
+		}
+		obj := results[0]
+		manifest, err := dryRunManifest(obj)
+		if err != nil {
+			return nil, err
+		}
+		change := provision.ManifestChange{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Operation: provision.ManifestCreate,
+			Manifest:  manifest,
+		}
+		var liveManifest string
+		if len(live) == 1 {
+			change.Operation = provision.ManifestUpdate
+			liveManifest, err = dryRunManifest(live[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		add(change, liveManifest)
+	}
+	var result []provision.ManifestChange
+	for i, change := range changes {
+		if change.Operation == provision.ManifestUpdate && change.Manifest == liveManifests[i] {
+			continue
+		}
+		change.Diff = manifestDiff(liveManifests[i], change.Manifest)
+		result = append(result, change)
+	}
+	return result, nil
+}
+
+// decodeDryRunObjects decodes an object, or the items of a list, returned by
+// the API server. Status objects, returned by some deletions, are ignored.
+func decodeDryRunObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var raw map[string]interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode dry-run object")
+	}
+	obj := &unstructured.Unstructured{Object: raw}
+	if obj.GetKind() == "Status" {
+		return nil, nil
+	}
+	if !obj.IsList() {
+		return []*unstructured.Unstructured{obj}, nil
+	}
+	list, err := obj.ToList()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode dry-run object list")
+	}
+	var result []*unstructured.Unstructured
+	kind := strings.TrimSuffix(obj.GetKind(), "List")
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetKind() == "" {
+			item.SetKind(kind)
+			item.SetAPIVersion(obj.GetAPIVersion())
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// dryRunManifest returns the YAML manifest of obj, without the fields managed
+// by the API server or by controllers, without the units recorded by tsuru and
+// with the values of secrets redacted.
+func dryRunManifest(obj *unstructured.Unstructured) (string, error) {
+	obj = obj.DeepCopy()
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+	annotations := obj.GetAnnotations()
+	_, hasRevision := annotations[replicaDepRevision]
+	_, hasUnits := annotations[tsuruUnitsAnnotation]
+	if hasRevision || hasUnits {
+		delete(annotations, replicaDepRevision)
+		delete(annotations, tsuruUnitsAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		obj.SetAnnotations(annotations)
+	}
+	if obj.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			values, _, _ := unstructured.NestedMap(obj.Object, field)
+			for k := range values {
+				values[k] = "<redacted>"
+			}
+			if len(values) > 0 {
+				unstructured.SetNestedMap(obj.Object, values, field)
+			}
+		}
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// manifestDiff returns a line diff between two manifests, lines only present
+// in the old manifest are prefixed by "-" and lines only present in the new
+// manifest by "+".
+func manifestDiff(old, new string) string {
+	oldLines := splitLines(old)
+	newLines := splitLines(new)
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf strings.Builder
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			buf.WriteString("  " + oldLines[i] + "\n")
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			buf.WriteString("- " + oldLines[i] + "\n")
+			i++
+		default:
+			buf.WriteString("+ " + newLines[j] + "\n")
+			j++
+		}
+	}
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
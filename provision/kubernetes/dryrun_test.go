@@ -0,0 +1,172 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/provision"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestManifestDiff(c *check.C) {
+	c.Assert(manifestDiff("a: 1\nb: 2\nc: 3\n", "a: 1\nb: 4\nc: 3\nd: 5\n"), check.Equals, `  a: 1
+- b: 2
++ b: 4
+  c: 3
++ d: 5
+`)
+	c.Assert(manifestDiff("", "a: 1\n"), check.Equals, "+ a: 1\n")
+	c.Assert(manifestDiff("a: 1\n", ""), check.Equals, "- a: 1\n")
+}
+
+func (s *S) TestDryRunTransport(c *check.C) {
+	var writes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes = append(writes, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/default/services/myapp-web":
+			w.Write([]byte(`{"kind": "Service", "apiVersion": "v1", "metadata": {"name": "myapp-web", "namespace": "default", "resourceVersion": "10"}, "spec": {"type": "ClusterIP"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/default/serviceaccounts/myapp":
+			w.Write([]byte(`{"kind": "ServiceAccount", "apiVersion": "v1", "metadata": {"name": "myapp", "namespace": "default", "uid": "abc"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/default/services":
+			c.Check(r.URL.Query().Get("labelSelector"), check.Equals, "tsuru.io/app-name=myapp")
+			w.Write([]byte(`{"kind": "ServiceList", "apiVersion": "v1", "items": [{"metadata": {"name": "myapp-web-v1", "namespace": "default"}}]}`))
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/newns/configmaps":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete:
+			w.Write([]byte(`{"kind": "Status", "status": "Success"}`))
+		default:
+			data, _ := ioutil.ReadAll(r.Body)
+			w.Write(data)
+		}
+	}))
+	defer srv.Close()
+	recorder := &dryRunRecorder{}
+	cli := &http.Client{Transport: &dryRunTransport{base: http.DefaultTransport, recorder: recorder}}
+	do := func(method, path, body string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		rsp, err := cli.Do(req)
+		c.Assert(err, check.IsNil)
+		rsp.Body.Close()
+	}
+	do(http.MethodPut, "/api/v1/namespaces/default/services/myapp-web", `{"kind": "Service", "apiVersion": "v1", "metadata": {"name": "myapp-web", "namespace": "default", "resourceVersion": "10"}, "spec": {"type": "NodePort"}}`)
+	do(http.MethodPut, "/api/v1/namespaces/default/services/myapp-web", `{"kind": "Service", "apiVersion": "v1", "metadata": {"name": "myapp-web", "namespace": "default", "resourceVersion": "10"}, "spec": {"type": "LoadBalancer"}}`)
+	do(http.MethodPut, "/api/v1/namespaces/default/serviceaccounts/myapp", `{"kind": "ServiceAccount", "apiVersion": "v1", "metadata": {"name": "myapp", "namespace": "default"}}`)
+	do(http.MethodPost, "/api/v1/namespaces/newns/configmaps", `{"kind": "ConfigMap", "apiVersion": "v1", "metadata": {"name": "cm", "namespace": "newns"}}`)
+	do(http.MethodPost, "/api/v1/namespaces/default/secrets", `{"kind": "Secret", "apiVersion": "v1", "metadata": {"name": "sec", "namespace": "default"}, "data": {"password": "c2VjcmV0"}}`)
+	do(http.MethodDelete, "/api/v1/namespaces/default/services?labelSelector=tsuru.io%2Fapp-name%3Dmyapp", "")
+	c.Assert(writes, check.DeepEquals, []string{
+		"PUT /api/v1/namespaces/default/services/myapp-web?dryRun=All",
+		"PUT /api/v1/namespaces/default/services/myapp-web?dryRun=All",
+		"PUT /api/v1/namespaces/default/serviceaccounts/myapp?dryRun=All",
+		"POST /api/v1/namespaces/newns/configmaps?dryRun=All",
+		"POST /api/v1/namespaces/default/secrets?dryRun=All",
+		"DELETE /api/v1/namespaces/default/services?dryRun=All&labelSelector=tsuru.io%2Fapp-name%3Dmyapp",
+	})
+	changes, err := recorder.manifestChanges()
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, []provision.ManifestChange{
+		{
+			Kind:      "Service",
+			Namespace: "default",
+			Name:      "myapp-web",
+			Operation: provision.ManifestUpdate,
+			Manifest: `apiVersion: v1
+kind: Service
+metadata:
+  name: myapp-web
+  namespace: default
+spec:
+  type: LoadBalancer
+`,
+			Diff: `  apiVersion: v1
+  kind: Service
+  metadata:
+    name: myapp-web
+    namespace: default
+  spec:
+-   type: ClusterIP
++   type: LoadBalancer
+`,
+		},
+		{
+			Kind:      "ConfigMap",
+			Namespace: "newns",
+			Name:      "cm",
+			Operation: provision.ManifestCreate,
+			Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: newns
+`,
+			Diff: `+ apiVersion: v1
++ kind: ConfigMap
++ metadata:
++   name: cm
++   namespace: newns
+`,
+		},
+		{
+			Kind:      "Secret",
+			Namespace: "default",
+			Name:      "sec",
+			Operation: provision.ManifestCreate,
+			Manifest: `apiVersion: v1
+data:
+  password: <redacted>
+kind: Secret
+metadata:
+  name: sec
+  namespace: default
+`,
+			Diff: `+ apiVersion: v1
++ data:
++   password: <redacted>
++ kind: Secret
++ metadata:
++   name: sec
++   namespace: default
+`,
+		},
+		{
+			Kind:      "Service",
+			Namespace: "default",
+			Name:      "myapp-web-v1",
+			Operation: provision.ManifestDelete,
+			Diff: `- apiVersion: v1
+- kind: Service
+- metadata:
+-   name: myapp-web-v1
+-   namespace: default
+`,
+		},
+	})
+}
+
+func (s *S) TestDryRunManifestIgnoresDeploymentRevision(c *check.C) {
+	objs, err := decodeDryRunObjects([]byte(`{"kind": "Deployment", "apiVersion": "apps/v1", "metadata": {"name": "myapp-web", "namespace": "default", "resourceVersion": "3", "annotations": {"deployment.kubernetes.io/revision": "2"}}, "spec": {"replicas": 1}, "status": {"replicas": 1}}`))
+	c.Assert(err, check.IsNil)
+	c.Assert(objs, check.HasLen, 1)
+	manifest, err := dryRunManifest(objs[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(manifest, check.Equals, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp-web
+  namespace: default
+spec:
+  replicas: 1
+`)
+}
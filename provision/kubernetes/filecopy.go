@@ -0,0 +1,84 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+)
+
+func (p *kubernetesProvisioner) UploadToUnit(ctx context.Context, a provision.App, opts provision.UnitFileCopyOptions, tarStream io.Reader) error {
+	if opts.Path == "" {
+		return errors.New("path is required")
+	}
+	// The stream is extracted to a staging directory and only moved into
+	// Path once it's fully read, an upload interrupted or over the size
+	// limit leaves nothing behind.
+	staging := provision.FileUploadStagingPath(opts.Path)
+	err := execUnitFileCopy(ctx, a, opts, nil, nil, "mkdir", "--", staging)
+	if err != nil {
+		return err
+	}
+	reader := &provision.FileUploadReader{Reader: tarStream}
+	err = execUnitFileCopy(ctx, a, opts, reader, nil, "tar", "xf", "-", "-C", staging)
+	if readErr := reader.Err(); readErr != nil {
+		err = readErr
+	}
+	if err != nil {
+		if cleanupErr := execUnitFileCopy(ctx, a, opts, nil, nil, provision.FileUploadCleanupCmds(staging)...); cleanupErr != nil {
+			log.Errorf("unable to remove upload staging directory %q in unit %q: %v", staging, opts.Unit, cleanupErr)
+		}
+		return err
+	}
+	return execUnitFileCopy(ctx, a, opts, nil, nil, provision.FileUploadCommitCmds(staging, opts.Path)...)
+}
+
+func (p *kubernetesProvisioner) DownloadFromUnit(ctx context.Context, a provision.App, opts provision.UnitFileCopyOptions, tarStream io.Writer) error {
+	if opts.Path == "" {
+		return errors.New("path is required")
+	}
+	// Like kubectl cp, the archive holds the base name of the path instead
+	// of its full path. The name follows "--" so names starting with a dash
+	// are not parsed as tar options.
+	cleanPath := path.Clean(opts.Path)
+	return execUnitFileCopy(ctx, a, opts, nil, tarStream, "tar", "cf", "-", "-C", path.Dir(cleanPath), "--", path.Base(cleanPath))
+}
+
+// execUnitFileCopy runs the tar command in the unit, tar must be available
+// in the unit image.
+func execUnitFileCopy(ctx context.Context, a provision.App, opts provision.UnitFileCopyOptions, stdin io.Reader, stdout io.Writer, cmds ...string) error {
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return err
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	var stderr bytes.Buffer
+	err = execCommand(ctx, execOpts{
+		client: client,
+		app:    a,
+		unit:   opts.Unit,
+		cmds:   cmds,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: &stderr,
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.Wrapf(err, "unable to copy files of unit %q: %s", opts.Unit, msg)
+		}
+		return err
+	}
+	return nil
+}
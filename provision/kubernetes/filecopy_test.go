@@ -0,0 +1,115 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/safe"
+	check "gopkg.in/check.v1"
+)
+
+func (s *S) TestUploadToUnit(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	err := s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	err = s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: "myapp-web-pod-1-1",
+		Path: "/home/application/current",
+	}, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	rollback()
+	c.Assert(s.mock.Stream["myapp-web"].Stdin, check.Equals, "tar data")
+	urls := s.mock.Stream["myapp-web"].Urls
+	c.Assert(urls, check.HasLen, 3)
+	mkdir := urls[0].Query()["command"]
+	c.Assert(mkdir, check.HasLen, 3)
+	c.Assert(mkdir[:2], check.DeepEquals, []string{"mkdir", "--"})
+	staging := mkdir[2]
+	c.Assert(staging, check.Matches, `/home/application/current/\.tsuru-upload-[0-9a-f]{16}`)
+	c.Assert(urls[1].Query()["command"], check.DeepEquals, []string{"tar", "xf", "-", "-C", staging})
+	c.Assert(urls[2].Query()["command"], check.DeepEquals, provision.FileUploadCommitCmds(staging, "/home/application/current"))
+}
+
+type failingFileCopyReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingFileCopyReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func (s *S) TestUploadToUnitReadErrorRemovesStaging(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	err := s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	tooLarge := errors.New("too large")
+	err = s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: "myapp-web-pod-1-1",
+		Path: "/home/application/current",
+	}, &failingFileCopyReader{data: strings.NewReader("tar data"), err: tooLarge})
+	c.Assert(err, check.Equals, tooLarge)
+	rollback()
+	urls := s.mock.Stream["myapp-web"].Urls
+	c.Assert(urls, check.HasLen, 3)
+	staging := urls[0].Query()["command"][2]
+	c.Assert(urls[1].Query()["command"], check.DeepEquals, []string{"tar", "xf", "-", "-C", staging})
+	c.Assert(urls[2].Query()["command"], check.DeepEquals, []string{"rm", "-rf", "--", staging})
+}
+
+func (s *S) TestUploadToUnitRequiresPath(c *check.C) {
+	a, _, rollback := s.mock.NoNodeReactions(c)
+	defer rollback()
+	err := s.p.UploadToUnit(context.TODO(), a, provision.UnitFileCopyOptions{Unit: "myapp-web-pod-1-1"}, strings.NewReader("tar data"))
+	c.Assert(err, check.ErrorMatches, "path is required")
+}
+
+func (s *S) TestDownloadFromUnit(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	err := s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	buf := safe.NewBuffer(nil)
+	err = s.p.DownloadFromUnit(context.TODO(), a, provision.UnitFileCopyOptions{
+		Unit: "myapp-web-pod-1-1",
+		Path: "/home/application/-data/",
+	}, buf)
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	rollback()
+	c.Assert(buf.String(), check.Equals, "stdout data")
+	urls := s.mock.Stream["myapp-web"].Urls
+	c.Assert(urls, check.HasLen, 1)
+	c.Assert(urls[0].Path, check.Equals, "/api/v1/namespaces/default/pods/myapp-web-pod-1-1/exec")
+	c.Assert(urls[0].Query()["command"], check.DeepEquals, []string{"tar", "cf", "-", "-C", "/home/application", "--", "-data"})
+}
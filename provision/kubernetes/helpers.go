@@ -50,6 +50,7 @@ const (
 	tsuruLabelAppProcess      = tsuruLabelPrefix + provision.LabelAppProcess
 	tsuruLabelIsBuild         = tsuruLabelPrefix + provision.LabelIsBuild
 	tsuruLabelIsDeploy        = tsuruLabelPrefix + provision.LabelIsDeploy
+	tsuruUnitsAnnotation      = tsuruLabelPrefix + "units"
 	replicaDepRevision        = "deployment.kubernetes.io/revision"
 )
 
@@ -110,6 +111,10 @@ func pdbNameForApp(a provision.App, process string) string {
 	return provision.AppProcessName(a, process, 0, "")
 }
 
+func networkPolicyNameForApp(a provision.App) string {
+	return provision.ValidKubeName(a.GetName())
+}
+
 func execCommandPodNameForApp(a provision.App) string {
 	name := provision.ValidKubeName(a.GetName())
 	return fmt.Sprintf("%s-isolated-run", name)
@@ -1264,7 +1269,7 @@ func waitForContainerFinished(ctx context.Context, client *ClusterClient, podNam
 		case apiv1.PodFailed:
 			return true, nil
 		}
-		for _, contStatus := range pod.Status.ContainerStatuses {
+		for _, contStatus := range append(pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses...) {
 			if contStatus.Name == containerName && contStatus.State.Terminated != nil {
 				return true, nil
 			}
@@ -33,7 +33,7 @@ var (
 )
 
 func (p *kubernetesProvisioner) ListLogs(ctx context.Context, app appTypes.App, args appTypes.ListLogArgs) ([]appTypes.Applog, error) {
-	clusterClient, err := clusterForPool(ctx, app.GetPool())
+	clusterClient, err := clusterForApp(ctx, app)
 	if err != nil {
 		return nil, err
 	}
@@ -66,7 +66,7 @@ func (p *kubernetesProvisioner) ListLogs(ctx context.Context, app appTypes.App,
 }
 
 func (p *kubernetesProvisioner) WatchLogs(ctx context.Context, app appTypes.App, args appTypes.ListLogArgs) (appTypes.LogWatcher, error) {
-	clusterClient, err := clusterForPool(ctx, app.GetPool())
+	clusterClient, err := clusterForApp(ctx, app)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +132,7 @@ func (p *kubernetesProvisioner) WatchLogs(ctx context.Context, app appTypes.App,
 func listLogsFromPods(ctx context.Context, clusterClient *ClusterClient, ns string, pods []*apiv1.Pod, args appTypes.ListLogArgs) ([]appTypes.Applog, error) {
 	var wg sync.WaitGroup
 
-	errs := make([]error, len(pods))
+	errs := make([][]error, len(pods))
 	logs := make([][]appTypes.Applog, len(pods))
 	tailLimit := tailLines(args.Limit)
 	if args.Limit == 0 {
@@ -147,40 +147,18 @@ func listLogsFromPods(ctx context.Context, clusterClient *ClusterClient, ns stri
 		go func(index int, pod *apiv1.Pod) {
 			defer wg.Done()
 
-			request := clusterClient.CoreV1().Pods(ns).GetLogs(pod.ObjectMeta.Name, &apiv1.PodLogOptions{
-				TailLines:  tailLimit,
-				Timestamps: true,
-			})
-			stream, err := request.Stream(ctx)
-			if err != nil {
-				errs[index] = err
-				return
-			}
-
-			appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
-			appProcess := pod.ObjectMeta.Labels[tsuruLabelAppProcess]
-
-			reader := bufio.NewReader(stream)
 			tsuruLogs := make([]appTypes.Applog, 0)
-
-			for {
-				line, err := reader.ReadBytes('\n')
+			// A failure reading a container doesn't hide the logs of the
+			// other containers of the unit.
+			for _, container := range podLogContainers(pod) {
+				containerLogs, err := listLogsFromContainer(ctx, clusterClient, ns, pod, container, tailLimit)
+				tsuruLogs = append(tsuruLogs, containerLogs...)
 				if err != nil {
-					if !knet.IsProbableEOF(err) {
-						errs[index] = err
+					if container != "" {
+						err = errors.Wrapf(err, "container %q", container)
 					}
-					break
+					errs[index] = append(errs[index], err)
 				}
-
-				if len(line) == 0 {
-					continue
-				}
-
-				tsuruLog := parsek8sLogLine(strings.TrimSpace(string(line)))
-				tsuruLog.Unit = pod.ObjectMeta.Name
-				tsuruLog.AppName = appName
-				tsuruLog.Source = appProcess
-				tsuruLogs = append(tsuruLogs, tsuruLog)
 			}
 
 			logs[index] = tsuruLogs
@@ -196,18 +174,78 @@ func listLogsFromPods(ctx context.Context, clusterClient *ClusterClient, ns stri
 
 	sort.Slice(unifiedLog, func(i, j int) bool { return unifiedLog[i].Date.Before(unifiedLog[j].Date) })
 
-	for index, err := range errs {
-		if err == nil {
+	for index, podErrs := range errs {
+		pod := pods[index]
+		appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
+		for _, err := range podErrs {
+			unifiedLog = append(unifiedLog, errToLog(pod.ObjectMeta.Name, appName, err))
+		}
+	}
+
+	return unifiedLog, nil
+}
+
+func listLogsFromContainer(ctx context.Context, clusterClient *ClusterClient, ns string, pod *apiv1.Pod, container string, tailLimit *int64) ([]appTypes.Applog, error) {
+	request := clusterClient.CoreV1().Pods(ns).GetLogs(pod.ObjectMeta.Name, &apiv1.PodLogOptions{
+		Container:  container,
+		TailLines:  tailLimit,
+		Timestamps: true,
+	})
+	stream, err := request.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
+	appProcess := pod.ObjectMeta.Labels[tsuruLabelAppProcess]
+	var tsuruLogs []appTypes.Applog
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if !knet.IsProbableEOF(err) {
+				return tsuruLogs, err
+			}
+			return tsuruLogs, nil
+		}
+
+		if len(line) == 0 {
 			continue
 		}
 
-		pod := pods[index]
-		appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
+		tsuruLog := parsek8sLogLine(strings.TrimSpace(string(line)))
+		tsuruLog.Unit = pod.ObjectMeta.Name
+		tsuruLog.AppName = appName
+		tsuruLog.Source = appProcess
+		tsuruLog.Container = logContainerTag(pod, container)
+		tsuruLogs = append(tsuruLogs, tsuruLog)
+	}
+}
 
-		unifiedLog = append(unifiedLog, errToLog(pod.ObjectMeta.Name, appName, err))
+// podLogContainers returns the containers whose logs are read from a pod, an
+// empty name selects the only container of the pod.
+func podLogContainers(pod *apiv1.Pod) []string {
+	if len(pod.Spec.InitContainers) == 0 && len(pod.Spec.Containers) <= 1 {
+		return []string{""}
 	}
+	var names []string
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
 
-	return unifiedLog, nil
+// logContainerTag returns the container name tagged in the logs, the first
+// container of the pod runs the app process and is not tagged.
+func logContainerTag(pod *apiv1.Pod, container string) string {
+	if container == "" || (len(pod.Spec.Containers) > 0 && pod.Spec.Containers[0].Name == container) {
+		return ""
+	}
+	return container
 }
 
 func listPodsSelectorForLog(args appTypes.ListLogArgs) labels.Selector {
@@ -286,7 +324,6 @@ func (k *k8sLogsWatcher) watchPod(pod *apiv1.Pod, addedLater bool) {
 
 	defer k.wg.Done()
 	appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
-	appProcess := pod.ObjectMeta.Labels[tsuruLabelAppProcess]
 	var tailLines int64
 
 	if addedLater {
@@ -294,7 +331,23 @@ func (k *k8sLogsWatcher) watchPod(pod *apiv1.Pod, addedLater bool) {
 		tailLines = int64(k.logArgs.Limit) // shun that startup logs be forgotten
 	}
 
+	var wg sync.WaitGroup
+	for _, container := range podLogContainers(pod) {
+		wg.Add(1)
+		go func(container string) {
+			defer wg.Done()
+			k.watchContainer(pod, container, tailLines)
+		}(container)
+	}
+	wg.Wait()
+}
+
+func (k *k8sLogsWatcher) watchContainer(pod *apiv1.Pod, container string, tailLines int64) {
+	appName := pod.ObjectMeta.Labels[tsuruLabelAppName]
+	appProcess := pod.ObjectMeta.Labels[tsuruLabelAppProcess]
+
 	request := k.clusterClient.CoreV1().Pods(k.ns).GetLogs(pod.ObjectMeta.Name, &apiv1.PodLogOptions{
+		Container:  container,
 		Follow:     true,
 		TailLines:  &tailLines,
 		Timestamps: true,
@@ -324,6 +377,7 @@ func (k *k8sLogsWatcher) watchPod(pod *apiv1.Pod, addedLater bool) {
 		tsuruLog.Unit = pod.ObjectMeta.Name
 		tsuruLog.AppName = appName
 		tsuruLog.Source = appProcess
+		tsuruLog.Container = logContainerTag(pod, container)
 		k.ch <- tsuruLog
 	}
 }
@@ -77,6 +77,57 @@ func (s *S) Test_LogsProvisioner_ListLogs(c *check.C) {
 	c.Assert(logs[0].Unit, check.Equals, "myapp-web-pod-1-1")
 }
 
+func (s *S) Test_LogsProvisioner_ListLogsWithSidecars(c *check.C) {
+	s.mock.LogHook = func(w io.Writer, r *http.Request) {
+		fmt.Fprintf(w, "2019-05-06T15:04:05Z message from %s\n", r.URL.Query().Get("container"))
+	}
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg1",
+		},
+		"kubernetes": map[string]interface{}{
+			"groups": map[string]interface{}{
+				"web": map[string]interface{}{
+					"web": map[string]interface{}{
+						"sidecars": []interface{}{
+							map[string]interface{}{"name": "shipper", "image": "fluent/fluent-bit:1.9"},
+						},
+					},
+				},
+			},
+		},
+	}
+	version := newCommittedVersion(c, a, customData)
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: evt})
+	c.Assert(err, check.IsNil)
+	wait()
+	logs, err := s.p.ListLogs(context.TODO(), a, appTypes.ListLogArgs{
+		AppName: a.GetName(),
+		Limit:   10,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	messages := map[string]string{}
+	for _, l := range logs {
+		c.Assert(l.Source, check.Equals, "web")
+		messages[l.Container] = l.Message
+	}
+	c.Assert(messages, check.DeepEquals, map[string]string{
+		"":        "message from myapp-web",
+		"shipper": "message from shipper",
+	})
+}
+
 func (s *S) Test_LogsProvisioner_ListLongLogs(c *check.C) {
 	s.mock.LogHook = func(w io.Writer, r *http.Request) {
 		m := ""
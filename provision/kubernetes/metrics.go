@@ -14,7 +14,7 @@ import (
 )
 
 func (p *kubernetesProvisioner) UnitsMetrics(ctx context.Context, a provision.App) ([]provision.UnitMetric, error) {
-	clusterClient, err := clusterForPool(ctx, a.GetPool())
+	clusterClient, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
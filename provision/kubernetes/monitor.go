@@ -109,6 +109,9 @@ func getClusterController(p *kubernetesProvisioner, cluster *ClusterClient) (*cl
 		c.stop(ctx)
 		return nil, err
 	}
+	if interval := getKubeConfig().DriftCheckInterval; interval > 0 {
+		c.runDriftReconciler(ctx, interval)
+	}
 	p.clusterControllers[cluster.Name] = c
 	return c, nil
 }
@@ -196,6 +199,51 @@ func (c *clusterController) start() (v1informers.PodInformer, error) {
 		},
 	})
 
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if !c.isLeader() {
+				return
+			}
+			pod, ok := obj.(*apiv1.Pod)
+			if !ok {
+				return
+			}
+			// pods listed when the informer starts were already recorded
+			// by the previous leader
+			if pod.CreationTimestamp.Time.Before(c.startedAt) {
+				return
+			}
+			c.recordUnitEvents(nil, pod)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if !c.isLeader() {
+				return
+			}
+			oldPod, _ := oldObj.(*apiv1.Pod)
+			newPod, ok := newObj.(*apiv1.Pod)
+			if !ok {
+				return
+			}
+			c.recordUnitEvents(oldPod, newPod)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if !c.isLeader() {
+				return
+			}
+			pod, ok := obj.(*apiv1.Pod)
+			if !ok {
+				tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown)
+				if !isTombstone {
+					return
+				}
+				if pod, ok = tombstone.Obj.(*apiv1.Pod); !ok {
+					return
+				}
+			}
+			c.recordUnitDeletion(pod)
+		},
+	})
+
 	return informer, nil
 }
 
@@ -0,0 +1,292 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/service"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+func (p *kubernetesProvisioner) NetworkPolicy(ctx context.Context, a provision.App) (*provTypes.EffectiveNetworkPolicy, error) {
+	policy, err := effectiveNetworkPolicy(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *kubernetesProvisioner) EnsureNetworkPolicy(ctx context.Context, a provision.App) error {
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return err
+	}
+	return ensureNetworkPolicy(ctx, client, a)
+}
+
+func appNetworkPolicy(a provision.App) (*provTypes.NetworkPolicy, error) {
+	raw, ok := a.GetMetadata().Annotation(AnnotationNetworkPolicy)
+	if !ok {
+		return nil, nil
+	}
+	var policy provTypes.NetworkPolicy
+	err := json.Unmarshal([]byte(raw), &policy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s annotation", AnnotationNetworkPolicy)
+	}
+	err = policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// effectiveNetworkPolicy combines the default network policy of the app pool
+// with the peers declared in the app network policy annotation.
+func effectiveNetworkPolicy(ctx context.Context, a provision.App) (provTypes.EffectiveNetworkPolicy, error) {
+	var result provTypes.EffectiveNetworkPolicy
+	p, err := pool.GetPoolByName(ctx, a.GetPool())
+	if err != nil {
+		return result, err
+	}
+	mode, err := p.GetNetworkPolicyMode()
+	if err != nil {
+		return result, err
+	}
+	declared, err := appNetworkPolicy(a)
+	if err != nil {
+		return result, err
+	}
+	err = declared.ValidateMode(mode, a.GetTeamOwner())
+	if err != nil {
+		return result, err
+	}
+	if declared != nil {
+		for _, peer := range append(append([]provTypes.NetworkPolicyPeer{}, declared.Ingress...), declared.Egress...) {
+			if peer.ServiceInstance == "" {
+				continue
+			}
+			if _, err = peerServiceInstance(ctx, a, peer); err != nil {
+				return result, err
+			}
+		}
+	}
+	return declared.Effective(mode, a.GetTeamOwner()), nil
+}
+
+// peerServiceInstance returns the service instance of a peer, only instances
+// bound to the app and running in a cluster, as multi-cluster service
+// instances do, may be used as peers.
+func peerServiceInstance(ctx context.Context, a provision.App, peer provTypes.NetworkPolicyPeer) (*service.ServiceInstance, error) {
+	si, err := service.GetServiceInstance(ctx, peer.Service, peer.ServiceInstance)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find service instance %s/%s", peer.Service, peer.ServiceInstance)
+	}
+	if si.FindApp(a.GetName()) == -1 {
+		return nil, errors.Errorf("app %s is not bound to service instance %s/%s", a.GetName(), peer.Service, peer.ServiceInstance)
+	}
+	if si.Pool == "" {
+		return nil, errors.Errorf("service instance %s/%s is not running in a cluster, use a cidr peer instead", peer.Service, peer.ServiceInstance)
+	}
+	return si, nil
+}
+
+func ensureNetworkPolicy(ctx context.Context, client *ClusterClient, a provision.App) error {
+	policy, err := effectiveNetworkPolicy(ctx, a)
+	if err != nil {
+		return err
+	}
+	if policy.Ingress.AllowAll && policy.Egress.AllowAll {
+		return removeNetworkPolicy(ctx, client, a)
+	}
+	ns, err := client.AppNamespace(ctx, a)
+	if err != nil {
+		return err
+	}
+	np, err := newNetworkPolicy(ctx, client, a, ns, policy)
+	if err != nil {
+		return err
+	}
+	existing, err := client.NetworkingV1().NetworkPolicies(ns).Get(ctx, np.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = client.NetworkingV1().NetworkPolicies(ns).Create(ctx, np, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(np.Spec, existing.Spec) && reflect.DeepEqual(np.Labels, existing.Labels) {
+		return nil
+	}
+	np.ResourceVersion = existing.ResourceVersion
+	_, err = client.NetworkingV1().NetworkPolicies(ns).Update(ctx, np, metav1.UpdateOptions{})
+	return err
+}
+
+func removeNetworkPolicy(ctx context.Context, client *ClusterClient, a provision.App) error {
+	ns, err := client.AppNamespace(ctx, a)
+	if err != nil {
+		return err
+	}
+	return removeNetworkPolicyFromNamespace(ctx, client, ns, a)
+}
+
+func removeNetworkPolicyFromNamespace(ctx context.Context, client *ClusterClient, ns string, a provision.App) error {
+	err := client.NetworkingV1().NetworkPolicies(ns).Delete(ctx, networkPolicyNameForApp(a), metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func newNetworkPolicy(ctx context.Context, client *ClusterClient, a provision.App, ns string, policy provTypes.EffectiveNetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+	ls := provision.NetworkPolicyLabels(provision.NetworkPolicyLabelsOpts{
+		App:         a,
+		Provisioner: provisionerName,
+		Prefix:      tsuruLabelPrefix,
+	})
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      networkPolicyNameForApp(a),
+			Namespace: ns,
+			Labels:    ls.ToLabels(),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: ls.ToAppSelector(),
+			},
+		},
+	}
+	if !policy.Ingress.AllowAll {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		np.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{}
+		if namespaces := client.networkPolicyAllowedNamespaces(a.GetPool()); len(namespaces) > 0 {
+			np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{
+							Key:      namespaceNameLabel,
+							Operator: metav1.LabelSelectorOpIn,
+							Values:   namespaces,
+						}},
+					},
+				}},
+			})
+		}
+		for _, peer := range policy.Ingress.Peers {
+			from, ports, err := toNetworkPolicyPeer(ctx, client, a, peer)
+			if err != nil {
+				return nil, err
+			}
+			np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+				From:  []networkingv1.NetworkPolicyPeer{from},
+				Ports: ports,
+			})
+		}
+	}
+	if !policy.Egress.AllowAll {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		// DNS resolution is always allowed, otherwise units would not be able
+		// to resolve the addresses of the allowed peers.
+		np.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(provTypes.NetworkPolicyPort{Port: 53, Protocol: "UDP"}),
+				networkPolicyPort(provTypes.NetworkPolicyPort{Port: 53, Protocol: "TCP"}),
+			},
+		}}
+		for _, peer := range policy.Egress.Peers {
+			to, ports, err := toNetworkPolicyPeer(ctx, client, a, peer)
+			if err != nil {
+				return nil, err
+			}
+			np.Spec.Egress = append(np.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				To:    []networkingv1.NetworkPolicyPeer{to},
+				Ports: ports,
+			})
+		}
+	}
+	return np, nil
+}
+
+// toNetworkPolicyPeer converts a peer to the kubernetes representation, peers
+// other than CIDRs may be running in any namespace, except for teams in
+// clusters with namespaces per team and for service instances, which run in
+// the namespace of their pool.
+func toNetworkPolicyPeer(ctx context.Context, client *ClusterClient, a provision.App, peer provTypes.NetworkPolicyPeer) (networkingv1.NetworkPolicyPeer, []networkingv1.NetworkPolicyPort, error) {
+	var result networkingv1.NetworkPolicyPeer
+	var ports []networkingv1.NetworkPolicyPort
+	for _, port := range peer.Ports {
+		ports = append(ports, networkPolicyPort(port))
+	}
+	if peer.CIDR != "" {
+		result.IPBlock = &networkingv1.IPBlock{CIDR: peer.CIDR}
+		return result, ports, nil
+	}
+	result.NamespaceSelector = &metav1.LabelSelector{}
+	opts := provision.NetworkPolicyPeerLabelsOpts{Prefix: tsuruLabelPrefix}
+	switch {
+	case peer.ServiceInstance != "":
+		si, err := peerServiceInstance(ctx, a, peer)
+		if err != nil {
+			return result, nil, err
+		}
+		opts.Service = peer.Service
+		opts.ServiceInstance = peer.ServiceInstance
+		result.PodSelector = &metav1.LabelSelector{
+			MatchLabels: provision.NetworkPolicyPeerLabels(opts).ToServiceInstanceSelector(),
+		}
+		result.NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{namespaceNameLabel: client.PoolNamespace(si.Pool)},
+		}
+	case peer.Team != "":
+		opts.Team = peer.Team
+		result.PodSelector = &metav1.LabelSelector{
+			MatchLabels: provision.NetworkPolicyPeerLabels(opts).ToTeamSelector(),
+		}
+		if client.teamNamespacesEnabled() {
+			result.NamespaceSelector = &metav1.LabelSelector{
+				MatchLabels: teamNamespaceSelector(peer.Team),
+			}
+		}
+	default:
+		opts.App = peer.App
+		if opts.App == "" {
+			opts.App = a.GetName()
+		}
+		selector := provision.NetworkPolicyPeerLabels(opts).ToAppSelector()
+		if peer.Process != "" {
+			opts.Process = peer.Process
+			selector = provision.NetworkPolicyPeerLabels(opts).ToAppProcessSelector()
+		}
+		result.PodSelector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return result, ports, nil
+}
+
+func networkPolicyPort(port provTypes.NetworkPolicyPort) networkingv1.NetworkPolicyPort {
+	protocol := apiv1.ProtocolTCP
+	if port.Protocol != "" {
+		protocol = apiv1.Protocol(strings.ToUpper(port.Protocol))
+	}
+	p := intstr.FromInt(port.Port)
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &p,
+	}
+}
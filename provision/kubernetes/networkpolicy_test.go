@@ -0,0 +1,228 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/service"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func (s *S) TestEffectiveNetworkPolicy(c *check.C) {
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Pool: "test-default"}
+	policy, err := effectiveNetworkPolicy(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	c.Assert(policy, check.DeepEquals, provTypes.EffectiveNetworkPolicy{
+		Mode:    "open",
+		Ingress: provTypes.NetworkPolicyRules{AllowAll: true},
+		Egress:  provTypes.NetworkPolicyRules{AllowAll: true},
+	})
+	err = pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"network-policy": "team-isolated"},
+	})
+	c.Assert(err, check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationNetworkPolicy, Value: `{"ingress": [{"app": "other"}], "egress": [{"cidr": "10.0.0.0/8", "ports": [{"port": 5432}]}]}`},
+	}}
+	policy, err = effectiveNetworkPolicy(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	c.Assert(policy, check.DeepEquals, provTypes.EffectiveNetworkPolicy{
+		Mode: "team-isolated",
+		Ingress: provTypes.NetworkPolicyRules{
+			Peers: []provTypes.NetworkPolicyPeer{{Team: "admin"}, {App: "other"}},
+		},
+		Egress: provTypes.NetworkPolicyRules{
+			Peers: []provTypes.NetworkPolicyPeer{{CIDR: "10.0.0.0/8", Ports: []provTypes.NetworkPolicyPort{{Port: 5432}}}},
+		},
+	})
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationNetworkPolicy, Value: `{"ingress": [{"app": "other", "cidr": "10.0.0.0/8"}]}`},
+	}}
+	_, err = effectiveNetworkPolicy(context.TODO(), a)
+	c.Assert(err, check.ErrorMatches, `network policy peer must have exactly one of app, process, team, service_instance or cidr`)
+	err = pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"network-policy": "deny-all"},
+	})
+	c.Assert(err, check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationNetworkPolicy, Value: `{"ingress": [{"app": "other"}], "egress": [{"process": "worker"}, {"team": "admin"}]}`},
+	}}
+	policy, err = effectiveNetworkPolicy(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	c.Assert(policy.Egress, check.DeepEquals, provTypes.NetworkPolicyRules{
+		Peers: []provTypes.NetworkPolicyPeer{{Process: "worker"}, {Team: "admin"}},
+	})
+	for _, egress := range []string{`{"cidr": "0.0.0.0/0"}`, `{"app": "other"}`, `{"team": "other-team"}`} {
+		a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationNetworkPolicy, Value: `{"egress": [` + egress + `]}`},
+		}}
+		_, err = effectiveNetworkPolicy(context.TODO(), a)
+		c.Assert(err, check.ErrorMatches, `apps in deny-all pools may only declare egress peers for their own processes, their team owner or their service instances`)
+	}
+}
+
+func (s *S) TestEnsureNetworkPolicy(c *check.C) {
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	err = ensureNetworkPolicy(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	_, err = s.client.NetworkingV1().NetworkPolicies("default").Get(context.TODO(), "myapp", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	err = pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"network-policy": "deny-all"},
+	})
+	c.Assert(err, check.IsNil)
+	s.clusterClient.CustomData[networkPolicyNamespacesKey] = "ingress-nginx"
+	defer delete(s.clusterClient.CustomData, networkPolicyNamespacesKey)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationNetworkPolicy, Value: `{"ingress": [{"process": "worker"}], "egress": [{"process": "web", "ports": [{"port": 8080}]}]}`},
+	}}
+	err = ensureNetworkPolicy(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	np, err := s.client.NetworkingV1().NetworkPolicies("default").Get(context.TODO(), "myapp", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	tcp := apiv1.ProtocolTCP
+	udp := apiv1.ProtocolUDP
+	dnsPort := intstr.FromInt(53)
+	appPort := intstr.FromInt(8080)
+	c.Assert(np.Labels, check.DeepEquals, map[string]string{
+		"tsuru.io/is-tsuru":    "true",
+		"tsuru.io/provisioner": "kubernetes",
+		"tsuru.io/app-name":    "myapp",
+		"tsuru.io/app-team":    "admin",
+	})
+	c.Assert(np.Spec, check.DeepEquals, networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: map[string]string{"tsuru.io/app-name": "myapp"},
+		},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{
+			{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{
+							Key:      "kubernetes.io/metadata.name",
+							Operator: metav1.LabelSelectorOpIn,
+							Values:   []string{"ingress-nginx"},
+						}},
+					},
+				}},
+			},
+			{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"tsuru.io/app-name":    "myapp",
+							"tsuru.io/app-process": "worker",
+						},
+					},
+				}},
+			},
+		},
+		Egress: []networkingv1.NetworkPolicyEgressRule{
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					{Protocol: &udp, Port: &dnsPort},
+					{Protocol: &tcp, Port: &dnsPort},
+				},
+			},
+			{
+				To: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"tsuru.io/app-name":    "myapp",
+							"tsuru.io/app-process": "web",
+						},
+					},
+				}},
+				Ports: []networkingv1.NetworkPolicyPort{
+					{Protocol: &tcp, Port: &appPort},
+				},
+			},
+		},
+	})
+	err = pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"network-policy": "open"},
+	})
+	c.Assert(err, check.IsNil)
+	a.Metadata = appTypes.Metadata{}
+	err = ensureNetworkPolicy(context.TODO(), s.clusterClient, a)
+	c.Assert(err, check.IsNil)
+	_, err = s.client.NetworkingV1().NetworkPolicies("default").Get(context.TODO(), "myapp", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+}
+
+func (s *S) TestEnsureNetworkPolicyServiceInstancePeer(c *check.C) {
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	for _, si := range []service.ServiceInstance{
+		{Name: "db1", ServiceName: "mysql", Apps: []string{"myapp"}, Pool: "test-default"},
+		{Name: "db2", ServiceName: "mysql", Pool: "test-default"},
+		{Name: "db3", ServiceName: "mysql", Apps: []string{"myapp"}},
+	} {
+		err = s.conn.ServiceInstances().Insert(si)
+		c.Assert(err, check.IsNil)
+	}
+	err = pool.PoolUpdate(context.TODO(), "test-default", pool.UpdatePoolOptions{
+		Labels: map[string]string{"network-policy": "deny-all"},
+	})
+	c.Assert(err, check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationNetworkPolicy, Value: `{"egress": [{"service": "mysql", "service_instance": "db1", "ports": [{"port": 3306}]}]}`},
+	}}
+	err = s.p.EnsureNetworkPolicy(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	np, err := s.client.NetworkingV1().NetworkPolicies("default").Get(context.TODO(), "myapp", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	tcp := apiv1.ProtocolTCP
+	dbPort := intstr.FromInt(3306)
+	c.Assert(np.Spec.Egress, check.HasLen, 2)
+	c.Assert(np.Spec.Egress[1], check.DeepEquals, networkingv1.NetworkPolicyEgressRule{
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"kubernetes.io/metadata.name": s.clusterClient.PoolNamespace("test-default")},
+			},
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/service-name":          "mysql",
+					"tsuru.io/service-instance-name": "db1",
+				},
+			},
+		}},
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &tcp, Port: &dbPort},
+		},
+	})
+	tests := []struct {
+		peer string
+		err  string
+	}{
+		{peer: `{"service": "mysql", "service_instance": "db2"}`, err: `app myapp is not bound to service instance mysql/db2`},
+		{peer: `{"service": "mysql", "service_instance": "db3"}`, err: `service instance mysql/db3 is not running in a cluster, use a cidr peer instead`},
+		{peer: `{"service": "mysql", "service_instance": "db4"}`, err: `unable to find service instance mysql/db4: .*`},
+		{peer: `{"service_instance": "db1"}`, err: `network policy peer service and service_instance must be used together`},
+	}
+	for _, tt := range tests {
+		a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationNetworkPolicy, Value: `{"ingress": [` + tt.peer + `]}`},
+		}}
+		_, err = effectiveNetworkPolicy(context.TODO(), a)
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+}
@@ -33,7 +33,7 @@ type nodeContainerManager struct {
 func (m *nodeContainerManager) DeployNodeContainer(config *nodecontainer.NodeContainerConfig, pool string, filter servicecommon.PoolFilter, placementOnly bool) error {
 	ctx := context.TODO()
 	if m.app != nil {
-		client, err := clusterForPool(ctx, m.app.GetPool())
+		client, err := clusterForApp(ctx, m.app)
 		if err != nil {
 			return err
 		}
@@ -6,9 +6,18 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"strconv"
 
+	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -16,13 +25,29 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-func ensurePDB(ctx context.Context, client *ClusterClient, app provision.App, process string) error {
-	pdb, err := newPDB(ctx, client, app, process)
+type ensurePDBArgs struct {
+	app      provision.App
+	process  string
+	version  appTypes.AppVersion
+	replicas int
+	writer   io.Writer
+}
+
+func ensurePDB(ctx context.Context, client *ClusterClient, args ensurePDBArgs) error {
+	budget, err := disruptionBudgetForProcess(args.app, args.process, args.version)
+	if err != nil {
+		return err
+	}
+	pdb, err := newPDB(ctx, client, args.app, args.process, budget)
 	if err != nil {
 		return err
 	}
 	if pdb == nil {
-		return nil
+		return removePDB(ctx, client, args.app, args.process)
+	}
+	err = checkPDBDisruptions(ctx, client, args, pdb)
+	if err != nil {
+		return err
 	}
 	existingPDB, err := client.PolicyV1beta1().PodDisruptionBudgets(pdb.Namespace).Get(ctx, pdb.Name, metav1.GetOptions{})
 	if k8sErrors.IsNotFound(err) {
@@ -45,6 +70,255 @@ func ensurePDB(ctx context.Context, client *ClusterClient, app provision.App, pr
 	return err
 }
 
+func removePDB(ctx context.Context, client *ClusterClient, app provision.App, process string) error {
+	ns, err := client.AppNamespace(ctx, app)
+	if err != nil {
+		return err
+	}
+	err = client.PolicyV1beta1().PodDisruptionBudgets(ns).Delete(ctx, pdbNameForApp(app, process), metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// disruptionBudgetForProcess returns the PodDisruptionBudget settings of a
+// process, settings from the app disruption budget annotation take precedence
+// over the ones from tsuru.yaml.
+func disruptionBudgetForProcess(app provision.App, process string, version appTypes.AppVersion) (*provTypes.TsuruYamlKubernetesDisruptionBudget, error) {
+	var budget *provTypes.TsuruYamlKubernetesDisruptionBudget
+	if version != nil {
+		yamlData, err := version.TsuruYamlData()
+		if err != nil {
+			return nil, err
+		}
+		if yamlData.Kubernetes != nil {
+			if procConfig := yamlData.Kubernetes.GetProcessConfigs(process); procConfig != nil {
+				budget = procConfig.DisruptionBudget
+			}
+		}
+	}
+	budgets, err := annotationDisruptionBudgets(app)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := budgets[process]; ok {
+		budget = &b
+	}
+	return budget, nil
+}
+
+// annotationDisruptionBudgets returns the disruption budgets set by process in
+// the app disruption budget annotation.
+func annotationDisruptionBudgets(app provision.App) (map[string]provTypes.TsuruYamlKubernetesDisruptionBudget, error) {
+	raw, ok := app.GetMetadata().Annotation(AnnotationDisruptionBudget)
+	if !ok {
+		return nil, nil
+	}
+	var budgets map[string]provTypes.TsuruYamlKubernetesDisruptionBudget
+	err := json.Unmarshal([]byte(raw), &budgets)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s annotation", AnnotationDisruptionBudget)
+	}
+	return budgets, nil
+}
+
+// validateAppDisruptionBudget checks the app disruption budget annotation, so
+// invalid settings are refused when the app is updated instead of failing the
+// next deploy. Budgets allowing no disruptions with the current units of a
+// process, or with its autoscale minimum, are refused as they block node
+// drains.
+func validateAppDisruptionBudget(ctx context.Context, a provision.App) error {
+	budgets, err := annotationDisruptionBudgets(a)
+	if err != nil || len(budgets) == 0 {
+		return err
+	}
+	processes := make([]string, 0, len(budgets))
+	for process, budget := range budgets {
+		_, _, err = budgetSpec(process, &budget)
+		if err != nil {
+			return err
+		}
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return err
+	}
+	if client.disablePDB(a.GetPool()) {
+		return nil
+	}
+	for _, process := range processes {
+		budget := budgets[process]
+		minAvailable, maxUnavailable, err := budgetSpec(process, &budget)
+		if err != nil {
+			return err
+		}
+		if minAvailable == nil && maxUnavailable == nil {
+			continue
+		}
+		deps, err := allDeploymentsForAppProcess(ctx, client, a, process)
+		if err != nil {
+			return err
+		}
+		var replicas int
+		for _, dep := range deps {
+			if dep.Spec.Replicas != nil {
+				replicas += int(*dep.Spec.Replicas)
+			}
+		}
+		units, err := minProcessUnits(ctx, client, a, process, replicas)
+		if err != nil {
+			return err
+		}
+		if units == 0 {
+			continue
+		}
+		allowed, err := allowedDisruptions(units, minAvailable, maxUnavailable)
+		if err != nil {
+			return err
+		}
+		if allowed <= 0 {
+			return errors.Errorf("the disruption budget of process %q allows no disruptions with %d unit(s), node drains would be blocked", process, units)
+		}
+	}
+	return nil
+}
+
+// ensureAppPDBs reconciles the PodDisruptionBudgets of every deployed process
+// of the app, using the version with the most units of each process.
+func ensureAppPDBs(ctx context.Context, client *ClusterClient, a provision.App, w io.Writer) error {
+	deps, err := allDeploymentsForApp(ctx, client, a)
+	if err != nil {
+		return err
+	}
+	replicas := map[string]int{}
+	versions := map[string]int{}
+	versionReplicas := map[string]int{}
+	for _, dep := range deps {
+		ls := labelSetFromMeta(&dep.ObjectMeta)
+		process := ls.AppProcess()
+		var depReplicas int
+		if dep.Spec.Replicas != nil {
+			depReplicas = int(*dep.Spec.Replicas)
+		}
+		replicas[process] += depReplicas
+		if _, ok := versions[process]; !ok || depReplicas > versionReplicas[process] {
+			versions[process] = ls.AppVersion()
+			versionReplicas[process] = depReplicas
+		}
+	}
+	processes := make([]string, 0, len(versions))
+	for process := range versions {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	for _, process := range processes {
+		version, err := servicemanager.AppVersion.VersionByImageOrVersion(ctx, a, strconv.Itoa(versions[process]))
+		if err != nil {
+			return err
+		}
+		err = ensurePDB(ctx, client, ensurePDBArgs{
+			app:      a,
+			process:  process,
+			version:  version,
+			replicas: replicas[process],
+			writer:   w,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// budgetSpec returns the minAvailable and maxUnavailable values of a
+// disruption budget, both are nil when the budget doesn't change the
+// defaults.
+func budgetSpec(process string, budget *provTypes.TsuruYamlKubernetesDisruptionBudget) (*intstr.IntOrString, *intstr.IntOrString, error) {
+	if budget == nil || budget.Disabled {
+		return nil, nil, nil
+	}
+	if budget.MinAvailable != "" && budget.MaxUnavailable != "" {
+		return nil, nil, errors.Errorf("only one of min_available and max_unavailable may be set in the disruption budget of process %q", process)
+	}
+	minAvailable, err := budgetValue("min_available", budget.MinAvailable)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxUnavailable, err := budgetValue("max_unavailable", budget.MaxUnavailable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return minAvailable, maxUnavailable, nil
+}
+
+// minProcessUnits returns the lowest number of units of a process, between its
+// replicas and the minimum units of its autoscale.
+func minProcessUnits(ctx context.Context, client *ClusterClient, a provision.App, process string, replicas int) (int, error) {
+	units := replicas
+	specs, err := getAutoScale(ctx, client, a, process)
+	if err != nil {
+		return 0, err
+	}
+	for _, spec := range specs {
+		if units == 0 || int(spec.MinUnits) < units {
+			units = int(spec.MinUnits)
+		}
+	}
+	return units, nil
+}
+
+// allowedDisruptions returns the number of units that may be voluntarily
+// disrupted with the given budget.
+func allowedDisruptions(units int, minAvailable, maxUnavailable *intstr.IntOrString) (int, error) {
+	if minAvailable != nil {
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(minAvailable, units, true)
+		if err != nil {
+			return 0, err
+		}
+		return units - scaled, nil
+	}
+	return intstr.GetScaledValueFromIntOrPercent(maxUnavailable, units, true)
+}
+
+func budgetValue(field, value string) (*intstr.IntOrString, error) {
+	if value == "" {
+		return nil, nil
+	}
+	v := intstr.Parse(value)
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&v, 100, true)
+	if err != nil || scaled < 0 || (v.Type == intstr.String && scaled > 100) {
+		return nil, errors.Errorf("invalid %s %q, must be a number of units or a percentage", field, value)
+	}
+	return &v, nil
+}
+
+// checkPDBDisruptions warns when the PodDisruptionBudget allows no voluntary
+// disruptions with the minimum number of units of the process, which blocks
+// node drains.
+func checkPDBDisruptions(ctx context.Context, client *ClusterClient, args ensurePDBArgs, pdb *policyv1beta1.PodDisruptionBudget) error {
+	if args.writer == nil {
+		return nil
+	}
+	units, err := minProcessUnits(ctx, client, args.app, args.process, args.replicas)
+	if err != nil {
+		return err
+	}
+	if units == 0 {
+		return nil
+	}
+	allowed, err := allowedDisruptions(units, pdb.Spec.MinAvailable, pdb.Spec.MaxUnavailable)
+	if err != nil {
+		return err
+	}
+	if allowed <= 0 {
+		fmt.Fprintf(args.writer, " ---> WARNING: PodDisruptionBudget %s allows no disruptions with %d unit(s) of process %q, node drains will be blocked\n", pdb.Name, units, args.process)
+	}
+	return nil
+}
+
 func allPDBsForApp(ctx context.Context, client *ClusterClient, app provision.App) ([]policyv1beta1.PodDisruptionBudget, error) {
 	ns, err := client.AppNamespace(ctx, app)
 	if err != nil {
@@ -81,11 +355,20 @@ func removeAllPDBs(ctx context.Context, client *ClusterClient, app provision.App
 	return nil
 }
 
-func newPDB(ctx context.Context, client *ClusterClient, app provision.App, process string) (*policyv1beta1.PodDisruptionBudget, error) {
+func newPDB(ctx context.Context, client *ClusterClient, app provision.App, process string, budget *provTypes.TsuruYamlKubernetesDisruptionBudget) (*policyv1beta1.PodDisruptionBudget, error) {
 	if client.disablePDB(app.GetPool()) {
 		return nil, nil
 	}
-	maxUnavailableByProcess := intstr.FromString("10%")
+	if budget != nil && budget.Disabled {
+		return nil, nil
+	}
+	minAvailable, maxUnavailable, err := budgetSpec(process, budget)
+	if err != nil {
+		return nil, err
+	}
+	if minAvailable == nil && maxUnavailable == nil {
+		maxUnavailable = intOrStringPtr(intstr.FromString("10%"))
+	}
 
 	ns, err := client.AppNamespace(ctx, app)
 	if err != nil {
@@ -101,7 +384,8 @@ func newPDB(ctx context.Context, client *ClusterClient, app provision.App, proce
 			Labels:    pdbLabels(app, process).ToLabels(),
 		},
 		Spec: policyv1beta1.PodDisruptionBudgetSpec{
-			MaxUnavailable: &maxUnavailableByProcess,
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
 			Selector:       &metav1.LabelSelector{MatchLabels: routableLabels.ToRoutableSelector()},
 		},
 	}, nil
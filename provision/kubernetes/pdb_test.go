@@ -5,11 +5,18 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
 
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/provision/servicecommon"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 	check "gopkg.in/check.v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -20,6 +27,7 @@ func (s *S) TestNewPDB(c *check.C) {
 	c.Assert(err, check.IsNil)
 	tests := map[string]struct {
 		setup    func() (teardown func())
+		budget   *provTypes.TsuruYamlKubernetesDisruptionBudget
 		expected *policyv1beta1.PodDisruptionBudget
 	}{
 		"with default values": {
@@ -56,13 +64,69 @@ func (s *S) TestNewPDB(c *check.C) {
 			},
 			expected: nil,
 		},
+		"with min available": {
+			budget: &provTypes.TsuruYamlKubernetesDisruptionBudget{MinAvailable: "2"},
+			expected: &policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myapp-p1",
+					Namespace: "default",
+					Labels: map[string]string{
+						"tsuru.io/is-tsuru":    "true",
+						"tsuru.io/app-name":    "myapp",
+						"tsuru.io/app-process": "p1",
+						"tsuru.io/app-team":    "admin",
+						"tsuru.io/provisioner": "kubernetes",
+					},
+				},
+				Spec: policyv1beta1.PodDisruptionBudgetSpec{
+					MinAvailable: intOrStringPtr(intstr.FromInt(2)),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"tsuru.io/app-name":    "myapp",
+							"tsuru.io/app-process": "p1",
+							"tsuru.io/is-routable": "true",
+						},
+					},
+				},
+			},
+		},
+		"with max unavailable": {
+			budget: &provTypes.TsuruYamlKubernetesDisruptionBudget{MaxUnavailable: "50%"},
+			expected: &policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myapp-p1",
+					Namespace: "default",
+					Labels: map[string]string{
+						"tsuru.io/is-tsuru":    "true",
+						"tsuru.io/app-name":    "myapp",
+						"tsuru.io/app-process": "p1",
+						"tsuru.io/app-team":    "admin",
+						"tsuru.io/provisioner": "kubernetes",
+					},
+				},
+				Spec: policyv1beta1.PodDisruptionBudgetSpec{
+					MaxUnavailable: intOrStringPtr(intstr.FromString("50%")),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"tsuru.io/app-name":    "myapp",
+							"tsuru.io/app-process": "p1",
+							"tsuru.io/is-routable": "true",
+						},
+					},
+				},
+			},
+		},
+		"when disabled for the process": {
+			budget:   &provTypes.TsuruYamlKubernetesDisruptionBudget{Disabled: true},
+			expected: nil,
+		},
 	}
 	for _, tt := range tests {
 		var teardown func()
 		if tt.setup != nil {
 			teardown = tt.setup()
 		}
-		pdb, err := newPDB(context.TODO(), s.clusterClient, a, "p1")
+		pdb, err := newPDB(context.TODO(), s.clusterClient, a, "p1", tt.budget)
 		c.Assert(err, check.IsNil)
 		c.Assert(pdb, check.DeepEquals, tt.expected)
 		if teardown != nil {
@@ -70,3 +134,149 @@ func (s *S) TestNewPDB(c *check.C) {
 		}
 	}
 }
+
+func (s *S) TestNewPDBInvalidBudget(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	_, err := newPDB(context.TODO(), s.clusterClient, a, "p1", &provTypes.TsuruYamlKubernetesDisruptionBudget{MinAvailable: "1", MaxUnavailable: "1"})
+	c.Assert(err, check.ErrorMatches, `only one of min_available and max_unavailable may be set in the disruption budget of process "p1"`)
+	_, err = newPDB(context.TODO(), s.clusterClient, a, "p1", &provTypes.TsuruYamlKubernetesDisruptionBudget{MaxUnavailable: "150%"})
+	c.Assert(err, check.ErrorMatches, `invalid max_unavailable "150%", must be a number of units or a percentage`)
+	_, err = newPDB(context.TODO(), s.clusterClient, a, "p1", &provTypes.TsuruYamlKubernetesDisruptionBudget{MinAvailable: "-1"})
+	c.Assert(err, check.ErrorMatches, `invalid min_available "-1", must be a number of units or a percentage`)
+}
+
+func (s *S) TestDisruptionBudgetForProcess(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	budget, err := disruptionBudgetForProcess(a, "web", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(budget, check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"worker": {"disabled": true}, "web": {"min_available": "50%"}}`},
+	}}
+	budget, err = disruptionBudgetForProcess(a, "worker", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(budget, check.DeepEquals, &provTypes.TsuruYamlKubernetesDisruptionBudget{Disabled: true})
+	budget, err = disruptionBudgetForProcess(a, "web", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(budget, check.DeepEquals, &provTypes.TsuruYamlKubernetesDisruptionBudget{MinAvailable: "50%"})
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"web": 1}`},
+	}}
+	_, err = disruptionBudgetForProcess(a, "web", nil)
+	c.Assert(err, check.ErrorMatches, `unable to parse app.tsuru.io/disruption-budget annotation: .*`)
+}
+
+func (s *S) TestEnsurePDBWarnsWhenBlockingDrains(c *check.C) {
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"p1": {"min_available": "100%"}}`},
+	}}
+	buf := bytes.NewBuffer(nil)
+	err = ensurePDB(context.TODO(), s.clusterClient, ensurePDBArgs{app: a, process: "p1", replicas: 2, writer: buf})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, " ---> WARNING: PodDisruptionBudget myapp-p1 allows no disruptions with 2 unit(s) of process \"p1\", node drains will be blocked\n")
+	pdb, err := s.client.PolicyV1beta1().PodDisruptionBudgets("default").Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(pdb.Spec.MinAvailable, check.DeepEquals, intOrStringPtr(intstr.FromString("100%")))
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"p1": {"disabled": true}}`},
+	}}
+	buf.Reset()
+	err = ensurePDB(context.TODO(), s.clusterClient, ensurePDBArgs{app: a, process: "p1", replicas: 2, writer: buf})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+	_, err = s.client.PolicyV1beta1().PodDisruptionBudgets("default").Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+}
+
+func (s *S) TestValidateAppDisruptionBudget(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"p1": "cmd1",
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"p1": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	waitDep()
+	tests := []struct {
+		budget      string
+		expectedErr string
+	}{
+		{budget: `{"p1": 1}`, expectedErr: `unable to parse app.tsuru.io/disruption-budget annotation: .*`},
+		{budget: `{"p1": {"min_available": "1", "max_unavailable": "1"}}`, expectedErr: `only one of min_available and max_unavailable may be set in the disruption budget of process "p1"`},
+		{budget: `{"p1": {"max_unavailable": "150%"}}`, expectedErr: `invalid max_unavailable "150%", must be a number of units or a percentage`},
+		{budget: `{"p1": {"min_available": "1"}}`, expectedErr: `the disruption budget of process "p1" allows no disruptions with 1 unit\(s\), node drains would be blocked`},
+		{budget: `{"p1": {"min_available": "1"}, "p2": {"min_available": "3"}}`, expectedErr: `the disruption budget of process "p1" allows no disruptions with 1 unit\(s\), node drains would be blocked`},
+		{budget: `{"p1": {"max_unavailable": "1"}, "p2": {"min_available": "3"}}`},
+		{budget: `{"p1": {"disabled": true}}`},
+	}
+	for _, tt := range tests {
+		a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+			{Name: AnnotationDisruptionBudget, Value: tt.budget},
+		}}
+		err = s.p.ValidateApp(context.TODO(), a)
+		if tt.expectedErr == "" {
+			c.Check(err, check.IsNil, check.Commentf("budget %s", tt.budget))
+			continue
+		}
+		c.Check(err, check.ErrorMatches, tt.expectedErr, check.Commentf("budget %s", tt.budget))
+	}
+}
+
+func (s *S) TestUpdateAppReconcilesPDB(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(context.TODO(), a, s.user)
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"p1": "cmd1",
+		},
+	})
+	err = servicecommon.RunServicePipeline(context.TODO(), &m, 0, provision.DeployArgs{
+		App:     a,
+		Version: version,
+	}, servicecommon.ProcessSpec{
+		"p1": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	waitDep()
+	ns, err := s.client.AppNamespace(context.TODO(), a)
+	c.Assert(err, check.IsNil)
+	pdb, err := s.client.PolicyV1beta1().PodDisruptionBudgets(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(pdb.Spec.MaxUnavailable, check.DeepEquals, intOrStringPtr(intstr.FromString("10%")))
+	newApp := *a
+	newApp.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"p1": {"max_unavailable": "1"}}`},
+	}}
+	err = s.p.UpdateApp(context.TODO(), a, &newApp, bytes.NewBuffer(nil))
+	c.Assert(err, check.IsNil)
+	pdb, err = s.client.PolicyV1beta1().PodDisruptionBudgets(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(pdb.Spec.MaxUnavailable, check.DeepEquals, intOrStringPtr(intstr.FromInt(1)))
+	c.Assert(pdb.Spec.MinAvailable, check.IsNil)
+	otherApp := newApp
+	otherApp.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationDisruptionBudget, Value: `{"p1": {"disabled": true}}`},
+	}}
+	err = s.p.UpdateApp(context.TODO(), &newApp, &otherApp, bytes.NewBuffer(nil))
+	c.Assert(err, check.IsNil)
+	_, err = s.client.PolicyV1beta1().PodDisruptionBudgets(ns).Get(context.TODO(), "myapp-p1", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+}
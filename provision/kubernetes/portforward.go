@@ -0,0 +1,118 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	spdyTransport "k8s.io/client-go/transport/spdy"
+)
+
+func (p *kubernetesProvisioner) PortForward(ctx context.Context, a provision.App, opts provision.PortForwardOptions) error {
+	if opts.Port < 1 || opts.Port > 65535 {
+		return errors.Errorf("invalid port %d", opts.Port)
+	}
+	client, err := clusterForApp(ctx, a)
+	if err != nil {
+		return err
+	}
+	ns, err := client.AppNamespace(ctx, a)
+	if err != nil {
+		return err
+	}
+	pod, err := client.CoreV1().Pods(ns).Get(ctx, opts.Unit, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return &provision.UnitNotFoundError{ID: opts.Unit}
+		}
+		return errors.WithStack(err)
+	}
+	l := labelSetFromMeta(&pod.ObjectMeta)
+	if l.AppName() != a.GetName() {
+		return errors.Errorf("pod %q do not belong to app %q", pod.Name, a.GetName())
+	}
+	if pod.Status.Phase != apiv1.PodRunning {
+		return errors.Errorf("unit %q is not running", pod.Name)
+	}
+	restCli, err := rest.RESTClientFor(client.restConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req := restCli.Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(ns).
+		SubResource("portforward")
+	wrapper, upgradeRoundTripper, err := keepAliveSpdyRoundTripper(client.restConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dialer := spdyTransport.NewDialer(upgradeRoundTripper, &http.Client{Transport: wrapper}, http.MethodPost, req.URL())
+	streamConn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return errors.Wrap(err, "unable to upgrade port forward connection")
+	}
+	defer streamConn.Close()
+
+	// The streams below follow the protocol used by kubectl port-forward, an
+	// error stream, only read by us, and a data stream for the connection.
+	headers := http.Header{}
+	headers.Set(apiv1.StreamType, apiv1.StreamTypeError)
+	headers.Set(apiv1.PortHeader, strconv.Itoa(opts.Port))
+	headers.Set(apiv1.PortForwardRequestIDHeader, "0")
+	errorStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		return errors.Wrap(err, "unable to create port forward error stream")
+	}
+	errorStream.Close()
+	errCh := make(chan error, 1)
+	go func() {
+		message, readErr := ioutil.ReadAll(errorStream)
+		switch {
+		case readErr != nil:
+			errCh <- errors.Wrap(readErr, "unable to read port forward error stream")
+		case len(message) > 0:
+			errCh <- errors.Errorf("unable to forward port %d of unit %q: %s", opts.Port, pod.Name, message)
+		}
+		close(errCh)
+	}()
+	headers.Set(apiv1.StreamType, apiv1.StreamTypeData)
+	dataStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		return errors.Wrap(err, "unable to create port forward data stream")
+	}
+	remoteDone := make(chan struct{})
+	go func() {
+		io.Copy(opts.Stream, dataStream)
+		close(remoteDone)
+	}()
+	localDone := make(chan struct{})
+	go func() {
+		defer dataStream.Close()
+		io.Copy(dataStream, opts.Stream)
+		close(localDone)
+	}()
+	select {
+	case <-remoteDone:
+		return <-errCh
+	case <-localDone:
+		// The client is gone, closing the connection stops the copy from
+		// the unit.
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
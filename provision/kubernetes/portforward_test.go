@@ -0,0 +1,130 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/safe"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/tools/portforward"
+)
+
+type portForwardStream struct {
+	io.Reader
+	io.Writer
+}
+
+func (s *S) TestPortForward(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	version := newSuccessfulVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	err := s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	var path, port string
+	s.mock.DefaultHook = func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, err := httpstream.Handshake(r, w, []string{portforward.PortForwardProtocolV1Name})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		streams := make(chan httpstream.Stream, 2)
+		conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+			streams <- stream
+			return nil
+		})
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 2; i++ {
+			select {
+			case stream := <-streams:
+				port = stream.Headers().Get(apiv1.PortHeader)
+				if stream.Headers().Get(apiv1.StreamType) == apiv1.StreamTypeData {
+					stream.Write([]byte("pong"))
+				}
+				stream.Close()
+			case <-time.After(5 * time.Second):
+				c.Fatal("timeout waiting for port forward streams")
+			}
+		}
+	}
+	defer func() { s.mock.DefaultHook = nil }()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	out := safe.NewBuffer(nil)
+	err = s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{
+		Unit:   "myapp-web-pod-1-1",
+		Port:   8080,
+		Stream: &portForwardStream{Reader: pr, Writer: out},
+	})
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	c.Assert(out.String(), check.Equals, "pong")
+	c.Assert(path, check.Equals, "/api/v1/namespaces/default/pods/myapp-web-pod-1-1/portforward")
+	c.Assert(port, check.Equals, "8080")
+}
+
+func (s *S) TestPortForwardInvalidPort(c *check.C) {
+	a, _, rollback := s.mock.NoNodeReactions(c)
+	defer rollback()
+	err := s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{Unit: "myapp-web-pod-1-1", Port: 0})
+	c.Assert(err, check.ErrorMatches, "invalid port 0")
+	err = s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{Unit: "myapp-web-pod-1-1", Port: 65536})
+	c.Assert(err, check.ErrorMatches, "invalid port 65536")
+}
+
+func (s *S) TestPortForwardUnitNotFound(c *check.C) {
+	a, _, rollback := s.mock.NoNodeReactions(c)
+	defer rollback()
+	err := s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{Unit: "myapp-web-pod-1-1", Port: 8080})
+	c.Assert(err, check.DeepEquals, &provision.UnitNotFoundError{ID: "myapp-web-pod-1-1"})
+}
+
+func (s *S) TestPortForwardOtherAppUnit(c *check.C) {
+	a, _, rollback := s.mock.NoNodeReactions(c)
+	defer rollback()
+	_, err := s.client.CoreV1().Pods("default").Create(context.TODO(), &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "otherapp-web-pod-1-1",
+			Namespace: "default",
+			Labels:    map[string]string{"tsuru.io/app-name": "otherapp"},
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+	}, metav1.CreateOptions{})
+	c.Assert(err, check.IsNil)
+	err = s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{Unit: "otherapp-web-pod-1-1", Port: 8080})
+	c.Assert(err, check.ErrorMatches, `pod "otherapp-web-pod-1-1" do not belong to app "myapp"`)
+}
+
+func (s *S) TestPortForwardUnitNotRunning(c *check.C) {
+	a, _, rollback := s.mock.NoNodeReactions(c)
+	defer rollback()
+	_, err := s.client.CoreV1().Pods("default").Create(context.TODO(), &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-web-pod-1-1",
+			Namespace: "default",
+			Labels:    map[string]string{"tsuru.io/app-name": "myapp"},
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodPending},
+	}, metav1.CreateOptions{})
+	c.Assert(err, check.IsNil)
+	err = s.p.PortForward(context.TODO(), a, provision.PortForwardOptions{Unit: "myapp-web-pod-1-1", Port: 8080})
+	c.Assert(err, check.ErrorMatches, `unit "myapp-web-pod-1-1" is not running`)
+}
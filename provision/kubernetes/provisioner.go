@@ -102,8 +102,15 @@ var (
 	_ provision.AutoScaleProvisioner     = &kubernetesProvisioner{}
 	_ cluster.ClusteredProvisioner       = &kubernetesProvisioner{}
 	_ provision.UpdatableProvisioner     = &kubernetesProvisioner{}
+	_ provision.AppValidatorProvisioner  = &kubernetesProvisioner{}
 	_ provision.MultiRegistryProvisioner = &kubernetesProvisioner{}
 	_ provision.KillUnitProvisioner      = &kubernetesProvisioner{}
+	_ provision.DryRunProvisioner        = &kubernetesProvisioner{}
+	_ provision.DriftProvisioner         = &kubernetesProvisioner{}
+	_ provision.PortForwardProvisioner   = &kubernetesProvisioner{}
+	_ provision.UnitFileCopyProvisioner  = &kubernetesProvisioner{}
+	_ provision.DebugProvisioner         = &kubernetesProvisioner{}
+	_ provision.OvercommitProvisioner    = &kubernetesProvisioner{}
 
 	mainKubernetesProvisioner *kubernetesProvisioner
 )
@@ -145,6 +152,10 @@ type kubernetesConfig struct {
 	// RegisterNode if set will make tsuru add a node object to the kubernetes
 	// API. Otherwise tsuru will expect the node to be already registered.
 	RegisterNode bool
+	// DriftCheckInterval is the interval between checks for changes made to
+	// app resources outside of tsuru. Drift is not checked periodically if
+	// it is zero.
+	DriftCheckInterval time.Duration
 }
 
 func getKubeConfig() kubernetesConfig {
@@ -193,6 +204,10 @@ func getKubeConfig() kubernetesConfig {
 		conf.HeadlessServicePort, _ = strconv.Atoi(provision.WebProcessDefaultPort())
 	}
 	conf.RegisterNode, _ = config.GetBool("kubernetes:register-node")
+	driftInterval, _ := config.GetFloat("kubernetes:drift-check-interval")
+	if driftInterval > 0 {
+		conf.DriftCheckInterval = time.Duration(driftInterval * float64(time.Second))
+	}
 	return conf
 }
 
@@ -280,7 +295,10 @@ func (p *kubernetesProvisioner) InitializeCluster(ctx context.Context, c *provTy
 	}
 	stopClusterController(ctx, p, clusterClient)
 	_, err = getClusterController(p, clusterClient)
-	return err
+	if err != nil {
+		return err
+	}
+	return ensureAppsInTeamNamespaces(ctx, p, clusterClient, c.Writer)
 }
 
 func (p *kubernetesProvisioner) ValidateCluster(c *provTypes.Cluster) error {
@@ -290,6 +308,14 @@ func (p *kubernetesProvisioner) ValidateCluster(c *provTypes.Cluster) error {
 		multiErrors.Add(errors.Errorf("only one pool is allowed to use entire cluster as single-pool. %d pools found", len(c.Pools)))
 	}
 
+	for key, value := range c.CustomData {
+		if key == teamNamespaceQuotaKey || strings.HasSuffix(key, ":"+teamNamespaceQuotaKey) {
+			if _, err := parseTeamResourceQuota(value); err != nil {
+				multiErrors.Add(err)
+			}
+		}
+	}
+
 	if c.KubeConfig != nil {
 		if len(c.Addresses) > 1 {
 			multiErrors.Add(errors.New("when kubeConfig is set the use of addresses is not used"))
@@ -328,7 +354,7 @@ func (p *kubernetesProvisioner) GetName() string {
 }
 
 func (p *kubernetesProvisioner) Provision(ctx context.Context, a provision.App) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -336,7 +362,7 @@ func (p *kubernetesProvisioner) Provision(ctx context.Context, a provision.App)
 }
 
 func (p *kubernetesProvisioner) Destroy(ctx context.Context, a provision.App) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -346,16 +372,23 @@ func (p *kubernetesProvisioner) Destroy(ctx context.Context, a provision.App) er
 	}
 	app, err := tclient.TsuruV1().Apps(client.Namespace()).Get(ctx, a.GetName(), metav1.GetOptions{})
 	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return provision.ErrAppNotProvisioned
+		}
 		return err
 	}
 	if err := p.removeResources(ctx, client, app, a); err != nil {
 		return err
 	}
-	return tclient.TsuruV1().Apps(client.Namespace()).Delete(ctx, a.GetName(), metav1.DeleteOptions{})
+	err = tclient.TsuruV1().Apps(client.Namespace()).Delete(ctx, a.GetName(), metav1.DeleteOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return provision.ErrAppNotProvisioned
+	}
+	return err
 }
 
 func (p *kubernetesProvisioner) DestroyVersion(ctx context.Context, a provision.App, version appTypes.AppVersion) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -487,6 +520,9 @@ func (p *kubernetesProvisioner) removeResources(ctx context.Context, client *Clu
 	if err = removeAllPDBs(ctx, client, app); err != nil {
 		multiErrors.Add(errors.WithStack(err))
 	}
+	if err = removeNetworkPolicyFromNamespace(ctx, client, tsuruApp.Spec.NamespaceName, app); err != nil {
+		multiErrors.Add(errors.WithStack(err))
+	}
 	err = client.CoreV1().ServiceAccounts(tsuruApp.Spec.NamespaceName).Delete(ctx, tsuruApp.Spec.ServiceAccountName, metav1.DeleteOptions{})
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		multiErrors.Add(errors.WithStack(err))
@@ -536,7 +572,7 @@ func versionsForAppProcess(ctx context.Context, client *ClusterClient, a provisi
 }
 
 func changeState(ctx context.Context, a provision.App, process string, version appTypes.AppVersion, state servicecommon.ProcessState, w io.Writer) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -617,7 +653,7 @@ func ensureProcessName(processName string, version appTypes.AppVersion) (string,
 }
 
 func changeUnits(ctx context.Context, a provision.App, units int, processName string, version appTypes.AppVersion, w io.Writer) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -659,17 +695,20 @@ func changeUnits(ctx context.Context, a provision.App, units int, processName st
 }
 
 func replicasPatch(replicas int, process string) (types.PatchType, []byte, error) {
-	patch, err := json.Marshal([]interface{}{
-		map[string]interface{}{
-			"op":    "replace",
-			"path":  "/spec/replicas",
-			"value": replicas,
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				tsuruUnitsAnnotation: strconv.Itoa(replicas),
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
 		},
 	})
 	if err != nil {
 		return "", nil, errors.WithStack(err)
 	}
-	return types.JSONPatchType, patch, nil
+	return types.MergePatchType, patch, nil
 }
 
 func (p *kubernetesProvisioner) AddUnits(ctx context.Context, a provision.App, units uint, processName string, version appTypes.AppVersion, w io.Writer) error {
@@ -931,7 +970,7 @@ func (p *kubernetesProvisioner) podsForApps(ctx context.Context, client *Cluster
 }
 
 func (p *kubernetesProvisioner) RoutableAddresses(ctx context.Context, a provision.App) ([]appTypes.RoutableAddresses, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
@@ -1054,7 +1093,7 @@ func (p *kubernetesProvisioner) addressesForApp(ctx context.Context, client *Clu
 }
 
 func (p *kubernetesProvisioner) RegisterUnit(ctx context.Context, a provision.App, unitID string, customData map[string]interface{}) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -1114,7 +1153,7 @@ func (p *kubernetesProvisioner) ListNodes(ctx context.Context, addressFilter []s
 }
 
 func (p *kubernetesProvisioner) InternalAddresses(ctx context.Context, a provision.App) ([]provision.AppInternalAddress, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
@@ -1446,7 +1485,7 @@ func (p *kubernetesProvisioner) internalNodeUpdate(ctx context.Context, opts pro
 }
 
 func (p *kubernetesProvisioner) Deploy(ctx context.Context, args provision.DeployArgs) (string, error) {
-	client, err := clusterForPool(ctx, args.App.GetPool())
+	client, err := clusterForApp(ctx, args.App)
 	if err != nil {
 		return "", err
 	}
@@ -1473,6 +1512,12 @@ func (p *kubernetesProvisioner) Deploy(ctx context.Context, args provision.Deplo
 			attachOutput:      args.Event,
 			attachInput:       strings.NewReader("."),
 			inputFile:         "/dev/null",
+			evt:               args.Event,
+			phases: podPhases{
+				scheduling: provision.DeployPhaseDeployPodScheduling,
+				run:        provision.DeployPhaseHooks,
+				push:       provision.DeployPhaseImagePush,
+			},
 		}
 		err = createDeployPod(ctx, params)
 		if err != nil {
@@ -1521,7 +1566,7 @@ func (p *kubernetesProvisioner) RemoveNodeContainer(ctx context.Context, name st
 }
 
 func (p *kubernetesProvisioner) ExecuteCommand(ctx context.Context, opts provision.ExecOptions) error {
-	client, err := clusterForPool(ctx, opts.App.GetPool())
+	client, err := clusterForApp(ctx, opts.App)
 	if err != nil {
 		return err
 	}
@@ -1587,7 +1632,7 @@ func runIsolatedCmdPod(ctx context.Context, client *ClusterClient, opts execOpts
 		envs = append(envs, apiv1.EnvVar{Name: envData.Name, Value: envData.Value})
 	}
 
-	requirements, err := appResourceRequirements(opts.app, client, requirementsFactors{
+	requirements, err := appResourceRequirements(opts.app, "", nil, client, requirementsFactors{
 		overCommit: 1,
 	})
 	if err != nil {
@@ -1660,20 +1705,61 @@ func (p *kubernetesProvisioner) ValidateVolume(ctx context.Context, vol *volumeT
 	return err
 }
 
+func (p *kubernetesProvisioner) ValidateApp(ctx context.Context, a provision.App) error {
+	err := validateAppRollout(a)
+	if err != nil {
+		return err
+	}
+	_, err = effectiveNetworkPolicy(ctx, a)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	err = validateAppDisruptionBudget(ctx, a)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	return nil
+}
+
 func (p *kubernetesProvisioner) UpdateApp(ctx context.Context, old, new provision.App, w io.Writer) error {
-	if old.GetPool() == new.GetPool() {
-		return nil
+	if old.GetPool() == new.GetPool() && old.GetTeamOwner() == new.GetTeamOwner() {
+		oldPolicy, _ := old.GetMetadata().Annotation(AnnotationNetworkPolicy)
+		newPolicy, _ := new.GetMetadata().Annotation(AnnotationNetworkPolicy)
+		oldBudget, _ := old.GetMetadata().Annotation(AnnotationDisruptionBudget)
+		newBudget, _ := new.GetMetadata().Annotation(AnnotationDisruptionBudget)
+		if oldPolicy == newPolicy && oldBudget == newBudget {
+			return nil
+		}
+		client, err := clusterForApp(ctx, new)
+		if err != nil {
+			return err
+		}
+		if oldBudget != newBudget {
+			err = ensureAppPDBs(ctx, client, new, w)
+			if err != nil {
+				return err
+			}
+		}
+		if oldPolicy == newPolicy {
+			return nil
+		}
+		return ensureNetworkPolicy(ctx, client, new)
 	}
-	client, err := clusterForPool(ctx, old.GetPool())
+	client, err := clusterForApp(ctx, old)
 	if err != nil {
 		return err
 	}
-	newClient, err := clusterForPool(ctx, new.GetPool())
+	newClient, err := clusterForApp(ctx, new)
 	if err != nil {
 		return err
 	}
 	sameCluster := client.GetCluster().Name == newClient.GetCluster().Name
-	sameNamespace := client.PoolNamespace(old.GetPool()) == client.PoolNamespace(new.GetPool())
+	oldNamespace, err := client.AppNamespace(ctx, old)
+	if err != nil {
+		return err
+	}
+	newNamespace := client.namespaceForApp(new)
+	sameNamespace := oldNamespace == newNamespace
 	if sameCluster && !sameNamespace {
 		var volumes []volumeTypes.Volume
 		volumes, err = servicemanager.Volume.ListByApp(ctx, old.GetName())
@@ -1690,11 +1776,13 @@ func (p *kubernetesProvisioner) UpdateApp(ctx context.Context, old, new provisio
 	}
 
 	params := updatePipelineParams{
-		old:      old,
-		new:      new,
-		w:        w,
-		p:        p,
-		versions: versions,
+		old:          old,
+		new:          new,
+		oldNamespace: oldNamespace,
+		newNamespace: newNamespace,
+		w:            w,
+		p:            p,
+		versions:     versions,
 	}
 	if !sameCluster {
 		if len(versions) > 1 {
@@ -1841,7 +1929,7 @@ func ensureAppCustomResource(ctx context.Context, client *ClusterClient, a provi
 	}
 	_, err = tclient.TsuruV1().Apps(client.Namespace()).Create(ctx, &tsuruv1.App{
 		ObjectMeta: metav1.ObjectMeta{Name: a.GetName()},
-		Spec:       tsuruv1.AppSpec{NamespaceName: client.PoolNamespace(a.GetPool())},
+		Spec:       tsuruv1.AppSpec{NamespaceName: client.namespaceForApp(a)},
 	}, metav1.CreateOptions{})
 	return err
 }
@@ -2044,7 +2132,7 @@ func (p *kubernetesProvisioner) HandlesHC() bool {
 }
 
 func (p *kubernetesProvisioner) ToggleRoutable(ctx context.Context, a provision.App, version appTypes.AppVersion, isRoutable bool) error {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return err
 	}
@@ -2127,7 +2215,7 @@ func toggleRoutableDeployment(ctx context.Context, client *ClusterClient, versio
 }
 
 func (p *kubernetesProvisioner) DeployedVersions(ctx context.Context, a provision.App) ([]int, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return nil, err
 	}
@@ -2143,7 +2231,7 @@ func (p *kubernetesProvisioner) DeployedVersions(ctx context.Context, a provisio
 }
 
 func (p *kubernetesProvisioner) RegistryForApp(ctx context.Context, a provision.App) (imgTypes.ImageRegistry, error) {
-	client, err := clusterForPool(ctx, a.GetPool())
+	client, err := clusterForApp(ctx, a)
 	if err != nil {
 		return "", err
 	}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -1521,6 +1522,86 @@ func (s *S) TestDeploy(c *check.C) {
 	})
 }
 
+func (s *S) TestDeployRecordsPhases(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "run mycmd arg1",
+			"worker": "run mycmd arg2",
+		},
+	})
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: evt})
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	wait()
+	phases := evt.Phases()
+	var names []string
+	for _, phase := range phases {
+		names = append(names, phase.Name+":"+phase.Process)
+		c.Assert(phase.Error, check.Equals, "")
+		c.Assert(phase.EndTime.IsZero(), check.Equals, false, check.Commentf("phase %q", phase.Name))
+		c.Assert(phase.EndTime.Before(phase.StartTime), check.Equals, false, check.Commentf("phase %q", phase.Name))
+	}
+	c.Assert(names, check.DeepEquals, []string{
+		provision.DeployPhaseDeployPodScheduling + ":",
+		provision.DeployPhaseHooks + ":",
+		provision.DeployPhaseImagePush + ":",
+		provision.DeployPhaseRollout + ":web",
+		provision.DeployPhaseRollout + ":worker",
+	})
+	var stored struct {
+		Phases []event.Phase
+	}
+	dbEvt, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	err = dbEvt.OtherData(&stored)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.Phases, check.HasLen, len(phases))
+}
+
+func (s *S) TestDeployRecordsFailedPhase(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	s.client.PrependReactor("create", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+		dep := action.(ktesting.CreateAction).GetObject().(*appsv1.Deployment)
+		if dep.Name == "myapp-worker" {
+			return true, nil, errors.New("deployment rejected")
+		}
+		return false, nil, nil
+	})
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "run mycmd arg1",
+			"worker": "run mycmd arg2",
+		},
+	})
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: evt})
+	c.Assert(err, check.ErrorMatches, "(?s).*deployment rejected.*")
+	wait()
+	phases := evt.Phases()
+	c.Assert(len(phases) >= 2, check.Equals, true)
+	web, worker := phases[len(phases)-2], phases[len(phases)-1]
+	c.Assert(web.Name+":"+web.Process, check.Equals, provision.DeployPhaseRollout+":web")
+	c.Assert(web.Error, check.Equals, "")
+	c.Assert(worker.Name+":"+worker.Process, check.Equals, provision.DeployPhaseRollout+":worker")
+	c.Assert(worker.Error, check.Matches, "(?s).*deployment rejected.*")
+	c.Assert(worker.EndTime.IsZero(), check.Equals, false)
+}
+
 func (s *S) TestDeployWithDisabledUnitRegister(c *check.C) {
 	s.clusterClient.CustomData[disableUnitRegisterCmdKey] = "true"
 	a, wait, rollback := s.mock.DefaultReactions(c)
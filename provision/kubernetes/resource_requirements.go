@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/provision"
+	provTypes "github.com/tsuru/tsuru/types/provision"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -17,11 +19,31 @@ type requirementsFactors struct {
 	cpuBurst         float64
 }
 
-func (f *requirementsFactors) memoryLimits(memory int64) resource.Quantity {
-	return *resource.NewQuantity(memory, resource.BinarySI)
+// requirementsFactorsForPool returns the overcommit and burst factors set in
+// the cluster for the pool.
+func requirementsFactorsForPool(client *ClusterClient, pool string) (requirementsFactors, error) {
+	var factors requirementsFactors
+	var err error
+	factors.overCommit, err = client.OvercommitFactor(pool)
+	if err != nil {
+		return factors, errors.WithMessage(err, "misconfigured cluster overcommit factor")
+	}
+	factors.cpuOverCommit, err = client.CPUOvercommitFactor(pool)
+	if err != nil {
+		return factors, errors.WithMessage(err, "misconfigured cluster cpu overcommit factor")
+	}
+	factors.cpuBurst, err = client.CPUBurstFactor(pool)
+	if err != nil {
+		return factors, errors.WithMessage(err, "misconfigured cluster cpu burst factor")
+	}
+	factors.memoryOverCommit, err = client.MemoryOvercommitFactor(pool)
+	if err != nil {
+		return factors, errors.WithMessage(err, "misconfigured cluster memory overcommit factor")
+	}
+	return factors, nil
 }
 
-func (f *requirementsFactors) memoryRequests(memory int64) resource.Quantity {
+func (f *requirementsFactors) memoryOvercommitFactor() float64 {
 	memoryOvercommit := f.overCommit
 	if f.memoryOverCommit != 0 {
 		memoryOvercommit = f.memoryOverCommit
@@ -29,18 +51,10 @@ func (f *requirementsFactors) memoryRequests(memory int64) resource.Quantity {
 	if memoryOvercommit < 1 {
 		memoryOvercommit = 1 // memory cannot be less than 1
 	}
-	return *resource.NewQuantity(overcommitedValue(memory, memoryOvercommit), resource.BinarySI)
+	return memoryOvercommit
 }
 
-func (f *requirementsFactors) cpuLimits(cpuMilli int64) resource.Quantity {
-	cpuBurst := f.cpuBurst
-	if cpuBurst < 1 {
-		cpuBurst = 1.0 // cpu cannot be less than 1
-	}
-	return *resource.NewMilliQuantity(burstValue(cpuMilli, cpuBurst), resource.DecimalSI)
-}
-
-func (f *requirementsFactors) cpuRequests(cpuMilli int64) resource.Quantity {
+func (f *requirementsFactors) cpuOvercommitFactor() float64 {
 	cpuOvercommit := f.overCommit
 	if f.cpuOverCommit != 0 {
 		cpuOvercommit = f.cpuOverCommit
@@ -48,7 +62,30 @@ func (f *requirementsFactors) cpuRequests(cpuMilli int64) resource.Quantity {
 	if cpuOvercommit < 1 {
 		cpuOvercommit = 1 // cpu cannot be less than 1
 	}
-	return *resource.NewMilliQuantity(overcommitedValue(cpuMilli, cpuOvercommit), resource.DecimalSI)
+	return cpuOvercommit
+}
+
+func (f *requirementsFactors) cpuBurstFactor() float64 {
+	if f.cpuBurst < 1 {
+		return 1.0 // cpu cannot be less than 1
+	}
+	return f.cpuBurst
+}
+
+func (f *requirementsFactors) memoryLimits(memory int64) resource.Quantity {
+	return *resource.NewQuantity(memory, resource.BinarySI)
+}
+
+func (f *requirementsFactors) memoryRequests(memory int64) resource.Quantity {
+	return *resource.NewQuantity(overcommitedValue(memory, f.memoryOvercommitFactor()), resource.BinarySI)
+}
+
+func (f *requirementsFactors) cpuLimits(cpuMilli int64) resource.Quantity {
+	return *resource.NewMilliQuantity(burstValue(cpuMilli, f.cpuBurstFactor()), resource.DecimalSI)
+}
+
+func (f *requirementsFactors) cpuRequests(cpuMilli int64) resource.Quantity {
+	return *resource.NewMilliQuantity(overcommitedValue(cpuMilli, f.cpuOvercommitFactor()), resource.DecimalSI)
 }
 
 func overcommitedValue(v int64, overcommit float64) int64 {
@@ -65,15 +102,18 @@ func burstValue(v int64, burst float64) int64 {
 	return int64(float64(v) * burst)
 }
 
-func appResourceRequirements(app provision.App, client *ClusterClient, factors requirementsFactors) (apiv1.ResourceRequirements, error) {
+func appResourceRequirements(app provision.App, process string, yamlResources *provTypes.TsuruYamlKubernetesProcessResources, client *ClusterClient, factors requirementsFactors) (apiv1.ResourceRequirements, error) {
 	resourceLimits := apiv1.ResourceList{}
 	resourceRequests := apiv1.ResourceList{}
-	memory := app.GetMemory()
+	memory, processCPUMilli, err := provision.ProcessResources(app, process, yamlResources)
+	if err != nil {
+		return apiv1.ResourceRequirements{}, err
+	}
+	cpuMilli := int64(processCPUMilli)
 	if memory != 0 {
 		resourceLimits[apiv1.ResourceMemory] = factors.memoryLimits(memory)
 		resourceRequests[apiv1.ResourceMemory] = factors.memoryRequests(memory)
 	}
-	cpuMilli := int64(app.GetMilliCPU())
 	if cpuMilli != 0 {
 		resourceLimits[apiv1.ResourceCPU] = factors.cpuLimits(cpuMilli)
 		resourceRequests[apiv1.ResourceCPU] = factors.cpuRequests(cpuMilli)
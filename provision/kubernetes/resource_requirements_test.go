@@ -89,7 +89,7 @@ func (s *S) TestGetAppResourceRequirements(c *check.C) {
 	}
 
 	for _, testCase := range testsCases {
-		requirements, err := appResourceRequirements(a, clusterClient, testCase.factors)
+		requirements, err := appResourceRequirements(a, "", nil, clusterClient, testCase.factors)
 		c.Assert(err, check.IsNil)
 
 		memoryLimits := requirements.Limits["memory"]
@@ -105,3 +105,53 @@ func (s *S) TestGetAppResourceRequirements(c *check.C) {
 		c.Assert(cpuRequests.String(), check.Equals, testCase.expectedRequestsCPU)
 	}
 }
+
+func (s *S) TestGetAppResourceRequirementsProcessOverride(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "plat", 1)
+	a.Memory = 10 * 1024
+	a.MilliCPU = 1000
+	a.ProcessMemory = map[string]int64{"worker": 2 * 1024}
+	a.ProcessMilliCPU = map[string]int{"worker": 100}
+	clusterClient := &ClusterClient{
+		Cluster: &provTypes.Cluster{},
+	}
+	requirements, err := appResourceRequirements(a, "worker", nil, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.IsNil)
+	memoryLimits := requirements.Limits["memory"]
+	c.Assert(memoryLimits.String(), check.Equals, "2Ki")
+	cpuLimits := requirements.Limits["cpu"]
+	c.Assert(cpuLimits.String(), check.Equals, "100m")
+	requirements, err = appResourceRequirements(a, "web", nil, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.IsNil)
+	memoryLimits = requirements.Limits["memory"]
+	c.Assert(memoryLimits.String(), check.Equals, "10Ki")
+}
+
+func (s *S) TestGetAppResourceRequirementsTsuruYaml(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "plat", 1)
+	a.Memory = 10 * 1024
+	a.MilliCPU = 1000
+	a.ProcessMilliCPU = map[string]int{"worker": 100}
+	clusterClient := &ClusterClient{
+		Cluster: &provTypes.Cluster{},
+	}
+	yamlResources := &provTypes.TsuruYamlKubernetesProcessResources{Memory: "4Ki", CPU: "300m"}
+	requirements, err := appResourceRequirements(a, "worker", yamlResources, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.IsNil)
+	memoryLimits := requirements.Limits["memory"]
+	c.Assert(memoryLimits.String(), check.Equals, "4Ki")
+	cpuLimits := requirements.Limits["cpu"]
+	c.Assert(cpuLimits.String(), check.Equals, "100m")
+	requirements, err = appResourceRequirements(a, "web", yamlResources, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.IsNil)
+	cpuLimits = requirements.Limits["cpu"]
+	c.Assert(cpuLimits.String(), check.Equals, "300m")
+	requirements, err = appResourceRequirements(a, "web", &provTypes.TsuruYamlKubernetesProcessResources{Memory: "1Gi", CPU: "2"}, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.IsNil)
+	memoryLimits = requirements.Limits["memory"]
+	c.Assert(memoryLimits.String(), check.Equals, "10Ki")
+	cpuLimits = requirements.Limits["cpu"]
+	c.Assert(cpuLimits.String(), check.Equals, "1")
+	_, err = appResourceRequirements(a, "web", &provTypes.TsuruYamlKubernetesProcessResources{Memory: "lots"}, clusterClient, requirementsFactors{overCommit: 1})
+	c.Assert(err, check.ErrorMatches, `invalid memory "lots" for process "web" in tsuru.yaml: .*`)
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const defaultTerminationGracePeriodSeconds = 30
+
+type rolloutConfig struct {
+	maxSurge               intstr.IntOrString
+	maxUnavailable         intstr.IntOrString
+	preStopSleepSeconds    int
+	terminationGracePeriod int64
+	preStop                []string
+}
+
+// preStopHandler returns the preStop lifecycle hook of the process units, if
+// any.
+func (r *rolloutConfig) preStopHandler() *apiv1.Handler {
+	var cmds []string
+	if r.preStopSleepSeconds > 0 {
+		// Allow some time for endpoints controller and kube-proxy to
+		// remove the endpoints for the pods before sending SIGTERM to
+		// app. This should reduce the number of failed connections due
+		// to pods stopping while their endpoints are still active.
+		cmds = append(cmds, fmt.Sprintf("sleep %d || true", r.preStopSleepSeconds))
+	}
+	cmds = append(cmds, r.preStop...)
+	if len(cmds) == 0 {
+		return nil
+	}
+	return &apiv1.Handler{
+		Exec: &apiv1.ExecAction{
+			Command: []string{"sh", "-c", strings.Join(cmds, " && ")},
+		},
+	}
+}
+
+func appRolloutOverrides(a provision.App) (map[string]provTypes.TsuruYamlKubernetesRollout, error) {
+	raw, ok := a.GetMetadata().Annotation(AnnotationRollout)
+	if !ok {
+		return nil, nil
+	}
+	var overrides map[string]provTypes.TsuruYamlKubernetesRollout
+	err := json.Unmarshal([]byte(raw), &overrides)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s annotation", AnnotationRollout)
+	}
+	return overrides, nil
+}
+
+// validateAppRollout checks the app rollout annotation, so invalid settings
+// are rejected when the app is updated instead of failing the next deploy.
+func validateAppRollout(a provision.App) error {
+	overrides, err := appRolloutOverrides(a)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	for process, override := range overrides {
+		err = validateRollout(&override)
+		if err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid %s annotation for process %q: %v", AnnotationRollout, process, err)}
+		}
+	}
+	return nil
+}
+
+func validateRollout(r *provTypes.TsuruYamlKubernetesRollout) error {
+	for _, v := range []string{r.MaxSurge, r.MaxUnavailable} {
+		if v == "" {
+			continue
+		}
+		value := intstr.Parse(v)
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&value, 1, true); err != nil {
+			return err
+		}
+	}
+	if r.PreStopSleepSeconds != nil && *r.PreStopSleepSeconds < 0 {
+		return errors.New("pre stop sleep seconds must not be negative")
+	}
+	if r.TerminationGracePeriodSeconds != nil {
+		if *r.TerminationGracePeriodSeconds < 0 {
+			return errors.New("termination grace period seconds must not be negative")
+		}
+		if r.PreStopSleepSeconds != nil && *r.TerminationGracePeriodSeconds < *r.PreStopSleepSeconds {
+			return errors.Errorf("termination grace period of %d seconds is shorter than the pre stop sleep of %d seconds", *r.TerminationGracePeriodSeconds, *r.PreStopSleepSeconds)
+		}
+	}
+	return nil
+}
+
+func mergeRollout(dst *provTypes.TsuruYamlKubernetesRollout, src *provTypes.TsuruYamlKubernetesRollout) {
+	if src == nil {
+		return
+	}
+	if src.MaxSurge != "" {
+		dst.MaxSurge = src.MaxSurge
+	}
+	if src.MaxUnavailable != "" {
+		dst.MaxUnavailable = src.MaxUnavailable
+	}
+	if src.TerminationGracePeriodSeconds != nil {
+		dst.TerminationGracePeriodSeconds = src.TerminationGracePeriodSeconds
+	}
+	if src.PreStopSleepSeconds != nil {
+		dst.PreStopSleepSeconds = src.PreStopSleepSeconds
+	}
+	if src.PreStop != nil {
+		dst.PreStop = src.PreStop
+	}
+}
+
+// rolloutConfigForProcess returns the rollout settings of a process. Settings
+// from the app rollout annotation take precedence over the ones from
+// tsuru.yaml, which take precedence over the pool configuration. Settings
+// above the bounds defined for the pool are rejected.
+func rolloutConfigForProcess(client *ClusterClient, a provision.App, process string, procConfig *provTypes.TsuruYamlKubernetesProcessConfig, replicas int) (rolloutConfig, error) {
+	pool := a.GetPool()
+	sleepSec := client.preStopSleepSeconds(pool)
+	result := rolloutConfig{
+		maxSurge:               client.maxSurge(pool),
+		maxUnavailable:         client.maxUnavailable(pool),
+		preStopSleepSeconds:    sleepSec,
+		terminationGracePeriod: int64(defaultTerminationGracePeriodSeconds + sleepSec),
+	}
+	var custom provTypes.TsuruYamlKubernetesRollout
+	if procConfig != nil {
+		mergeRollout(&custom, procConfig.Rollout)
+	}
+	overrides, err := appRolloutOverrides(a)
+	if err != nil {
+		return result, err
+	}
+	if override, ok := overrides[process]; ok {
+		mergeRollout(&custom, &override)
+	}
+	if custom.MaxSurge != "" {
+		result.maxSurge = intstr.Parse(custom.MaxSurge)
+		err = checkRolloutLimit(client, pool, maxSurgeLimitKey, result.maxSurge, replicas)
+		if err != nil {
+			return result, err
+		}
+	}
+	if custom.MaxUnavailable != "" {
+		result.maxUnavailable = intstr.Parse(custom.MaxUnavailable)
+		err = checkRolloutLimit(client, pool, maxUnavailableLimitKey, result.maxUnavailable, replicas)
+		if err != nil {
+			return result, err
+		}
+	}
+	if custom.PreStopSleepSeconds != nil {
+		result.preStopSleepSeconds = *custom.PreStopSleepSeconds
+		err = checkRolloutLimit(client, pool, preStopSleepLimitKey, intstr.FromInt(result.preStopSleepSeconds), replicas)
+		if err != nil {
+			return result, err
+		}
+		result.terminationGracePeriod = int64(defaultTerminationGracePeriodSeconds + result.preStopSleepSeconds)
+	}
+	if custom.TerminationGracePeriodSeconds != nil {
+		err = checkRolloutLimit(client, pool, gracePeriodLimitKey, intstr.FromInt(*custom.TerminationGracePeriodSeconds), replicas)
+		if err != nil {
+			return result, err
+		}
+		result.terminationGracePeriod = int64(*custom.TerminationGracePeriodSeconds)
+	}
+	if result.terminationGracePeriod < int64(result.preStopSleepSeconds) {
+		return result, errors.Errorf("termination grace period of %d seconds is shorter than the pre stop sleep of %d seconds", result.terminationGracePeriod, result.preStopSleepSeconds)
+	}
+	result.preStop = custom.PreStop
+	return result, nil
+}
+
+func checkRolloutLimit(client *ClusterClient, pool, key string, value intstr.IntOrString, replicas int) error {
+	limit := client.rolloutLimit(pool, key)
+	if limit == nil {
+		return nil
+	}
+	// percentages of a process without units are scaled as if it had a
+	// single unit, otherwise any value would be above a percentage limit
+	if replicas < 1 {
+		replicas = 1
+	}
+	scaledLimit, err := intstr.GetScaledValueFromIntOrPercent(limit, replicas, true)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s for pool %q", key, pool)
+	}
+	scaledValue, err := intstr.GetScaledValueFromIntOrPercent(&value, replicas, true)
+	if err != nil {
+		return errors.Wrapf(err, "invalid value %q", value.String())
+	}
+	if scaledValue > scaledLimit {
+		return errors.Errorf("value %q is above the %s of %q for pool %q", value.String(), key, limit.String(), pool)
+	}
+	return nil
+}
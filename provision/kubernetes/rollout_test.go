@@ -0,0 +1,123 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func (s *S) TestRolloutConfigForProcess(c *check.C) {
+	client := &ClusterClient{Cluster: &provTypes.Cluster{CustomData: map[string]string{
+		"pool1:" + maxSurgeKey:            "50%",
+		"pool1:" + preStopSleepKey:        "5",
+		"pool1:" + gracePeriodLimitKey:    "600",
+		"pool1:" + maxUnavailableLimitKey: "1",
+	}}}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Pool = "pool1"
+	rollout, err := rolloutConfigForProcess(client, a, "web", nil, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(rollout, check.DeepEquals, rolloutConfig{
+		maxSurge:               intstr.FromString("50%"),
+		maxUnavailable:         intstr.FromInt(0),
+		preStopSleepSeconds:    5,
+		terminationGracePeriod: 35,
+	})
+	grace := 300
+	sleep := 20
+	procConfig := &provTypes.TsuruYamlKubernetesProcessConfig{
+		Rollout: &provTypes.TsuruYamlKubernetesRollout{
+			MaxSurge:                      "1",
+			PreStopSleepSeconds:           &sleep,
+			TerminationGracePeriodSeconds: &grace,
+			PreStop:                       []string{"kill -USR1 1"},
+		},
+	}
+	rollout, err = rolloutConfigForProcess(client, a, "worker", procConfig, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(rollout, check.DeepEquals, rolloutConfig{
+		maxSurge:               intstr.FromInt(1),
+		maxUnavailable:         intstr.FromInt(0),
+		preStopSleepSeconds:    20,
+		terminationGracePeriod: 300,
+		preStop:                []string{"kill -USR1 1"},
+	})
+	c.Assert(rollout.preStopHandler(), check.DeepEquals, &apiv1.Handler{
+		Exec: &apiv1.ExecAction{
+			Command: []string{"sh", "-c", "sleep 20 || true && kill -USR1 1"},
+		},
+	})
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"worker": {"max_unavailable": "25%", "termination_grace_period_seconds": 60}}`},
+	}}
+	rollout, err = rolloutConfigForProcess(client, a, "worker", procConfig, 4)
+	c.Assert(err, check.IsNil)
+	c.Assert(rollout.maxUnavailable, check.DeepEquals, intstr.FromString("25%"))
+	c.Assert(rollout.maxSurge, check.DeepEquals, intstr.FromInt(1))
+	c.Assert(rollout.terminationGracePeriod, check.Equals, int64(60))
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"worker": {"max_unavailable": "50%"}}`},
+	}}
+	_, err = rolloutConfigForProcess(client, a, "worker", procConfig, 4)
+	c.Assert(err, check.ErrorMatches, `value "50%" is above the max-unavailable-limit of "1" for pool "pool1"`)
+	grace = 900
+	a.Metadata = appTypes.Metadata{}
+	_, err = rolloutConfigForProcess(client, a, "worker", procConfig, 4)
+	c.Assert(err, check.ErrorMatches, `value "900" is above the termination-grace-period-limit of "600" for pool "pool1"`)
+}
+
+func (s *S) TestRolloutConfigForProcessInvalidAnnotation(c *check.C) {
+	client := &ClusterClient{Cluster: &provTypes.Cluster{}}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"worker": 1}`},
+	}}
+	_, err := rolloutConfigForProcess(client, a, "worker", nil, 1)
+	c.Assert(err, check.ErrorMatches, `unable to parse app.tsuru.io/rollout annotation: .*`)
+}
+
+func (s *S) TestRolloutConfigForProcessGracePeriodShorterThanPreStopSleep(c *check.C) {
+	client := &ClusterClient{Cluster: &provTypes.Cluster{}}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"web": {"pre_stop_sleep_seconds": 60, "termination_grace_period_seconds": 30}}`},
+	}}
+	_, err := rolloutConfigForProcess(client, a, "web", nil, 1)
+	c.Assert(err, check.ErrorMatches, `termination grace period of 30 seconds is shorter than the pre stop sleep of 60 seconds`)
+}
+
+func (s *S) TestRolloutConfigForProcessWithoutUnits(c *check.C) {
+	client := &ClusterClient{Cluster: &provTypes.Cluster{CustomData: map[string]string{
+		"pool1:" + maxSurgeLimitKey: "50%",
+	}}}
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Pool = "pool1"
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"web": {"max_surge": "1"}}`},
+	}}
+	rollout, err := rolloutConfigForProcess(client, a, "web", nil, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(rollout.maxSurge, check.DeepEquals, intstr.FromInt(1))
+}
+
+func (s *S) TestValidateAppRollout(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	c.Assert(validateAppRollout(a), check.IsNil)
+	a.Metadata = appTypes.Metadata{Annotations: []appTypes.MetadataItem{
+		{Name: AnnotationRollout, Value: `{"web": {"max_surge": "25%", "pre_stop_sleep_seconds": 10, "termination_grace_period_seconds": 30}}`},
+	}}
+	c.Assert(validateAppRollout(a), check.IsNil)
+	a.Metadata.Annotations[0].Value = `{"web": 1}`
+	c.Assert(validateAppRollout(a), check.ErrorMatches, `unable to parse app.tsuru.io/rollout annotation: .*`)
+	a.Metadata.Annotations[0].Value = `{"web": {"max_surge": "abc%"}}`
+	c.Assert(validateAppRollout(a), check.ErrorMatches, `invalid app.tsuru.io/rollout annotation for process "web": .*`)
+	a.Metadata.Annotations[0].Value = `{"web": {"pre_stop_sleep_seconds": 60, "termination_grace_period_seconds": 30}}`
+	c.Assert(validateAppRollout(a), check.ErrorMatches, `invalid app.tsuru.io/rollout annotation for process "web": termination grace period of 30 seconds is shorter than the pre stop sleep of 60 seconds`)
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	sharedVolumePrefix = "tsuru-shared-"
+	defaultRegistry    = "docker.io"
+)
+
+type processContainers struct {
+	sidecars       []apiv1.Container
+	initContainers []apiv1.Container
+	volumes        []apiv1.Volume
+	mounts         []apiv1.VolumeMount
+}
+
+// containersForProcess renders the sidecars and init containers declared in
+// tsuru.yaml for a process, along with the volumes shared by them and the
+// mounts of the shared volumes in the process container. The resources of
+// each container default to the pool sidecar minimums, are bounded by the
+// process plan and the pool sidecar maximums, and get the same overcommit and
+// burst factors as the process container.
+func containersForProcess(ctx context.Context, a provision.App, process, mainContainer string, procConfig *provTypes.TsuruYamlKubernetesProcessConfig, factors requirementsFactors) (processContainers, error) {
+	var result processContainers
+	if procConfig == nil {
+		return result, nil
+	}
+	names := map[string]struct{}{mainContainer: {}}
+	sharedVolumes := map[string]struct{}{}
+	var err error
+	result.mounts, err = sharedVolumeMounts(procConfig.VolumeMounts, sharedVolumes)
+	if err != nil {
+		return result, err
+	}
+	var p *pool.Pool
+	var bounds pool.ResourceBounds
+	toContainers := func(containers []provTypes.TsuruYamlKubernetesContainer) ([]apiv1.Container, error) {
+		var rendered []apiv1.Container
+		for _, c := range containers {
+			if errs := validation.IsDNS1123Label(c.Name); len(errs) > 0 {
+				return nil, errors.Errorf("invalid container name %q: %s", c.Name, strings.Join(errs, ", "))
+			}
+			if _, ok := names[c.Name]; ok {
+				return nil, errors.Errorf("duplicated container name %q", c.Name)
+			}
+			names[c.Name] = struct{}{}
+			if c.Image == "" {
+				return nil, errors.Errorf("image is required for container %q", c.Name)
+			}
+			if p == nil {
+				p, err = pool.GetPoolByName(ctx, a.GetPool())
+				if err != nil {
+					return nil, err
+				}
+				bounds, err = p.GetSidecarBounds()
+				if err != nil {
+					return nil, err
+				}
+			}
+			registry, _, _ := image.ParseImageParts(c.Image)
+			if registry == "" {
+				registry = defaultRegistry
+			}
+			allowed, err := p.AllowsRegistry(registry)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				return nil, errors.Errorf("registry %q of container %q is not allowed in pool %q", registry, c.Name, p.Name)
+			}
+			memory, cpuMilli, err := bounds.ContainerResources(a.GetProcessMemory(process), a.GetProcessMilliCPU(process), c.Resources)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid resources for container %q", c.Name)
+			}
+			container, err := renderContainer(c, memory, int64(cpuMilli), factors, sharedVolumes)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, container)
+		}
+		return rendered, nil
+	}
+	result.initContainers, err = toContainers(procConfig.InitContainers)
+	if err != nil {
+		return result, err
+	}
+	result.sidecars, err = toContainers(procConfig.Sidecars)
+	if err != nil {
+		return result, err
+	}
+	volumeNames := make([]string, 0, len(sharedVolumes))
+	for name := range sharedVolumes {
+		volumeNames = append(volumeNames, name)
+	}
+	sort.Strings(volumeNames)
+	for _, name := range volumeNames {
+		result.volumes = append(result.volumes, apiv1.Volume{
+			Name: name,
+			VolumeSource: apiv1.VolumeSource{
+				EmptyDir: &apiv1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	return result, nil
+}
+
+func renderContainer(c provTypes.TsuruYamlKubernetesContainer, memory, cpuMilli int64, factors requirementsFactors, sharedVolumes map[string]struct{}) (apiv1.Container, error) {
+	container := apiv1.Container{
+		Name:    c.Name,
+		Image:   c.Image,
+		Command: c.Command,
+	}
+	for _, env := range c.Env {
+		container.Env = append(container.Env, apiv1.EnvVar{Name: env.Name, Value: env.Value})
+	}
+	for _, port := range c.Ports {
+		protocol := apiv1.ProtocolTCP
+		if port.Protocol != "" {
+			protocol = apiv1.Protocol(strings.ToUpper(port.Protocol))
+		}
+		container.Ports = append(container.Ports, apiv1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: int32(port.Port),
+			Protocol:      protocol,
+		})
+	}
+	limits := apiv1.ResourceList{}
+	requests := apiv1.ResourceList{}
+	if memory > 0 {
+		limits[apiv1.ResourceMemory] = factors.memoryLimits(memory)
+		requests[apiv1.ResourceMemory] = factors.memoryRequests(memory)
+	}
+	if cpuMilli > 0 {
+		limits[apiv1.ResourceCPU] = factors.cpuLimits(cpuMilli)
+		requests[apiv1.ResourceCPU] = factors.cpuRequests(cpuMilli)
+	}
+	if len(limits) > 0 {
+		container.Resources = apiv1.ResourceRequirements{Limits: limits, Requests: requests}
+	}
+	var err error
+	container.VolumeMounts, err = sharedVolumeMounts(c.VolumeMounts, sharedVolumes)
+	return container, err
+}
+
+func sharedVolumeMounts(mounts []provTypes.TsuruYamlKubernetesVolumeMount, sharedVolumes map[string]struct{}) ([]apiv1.VolumeMount, error) {
+	var result []apiv1.VolumeMount
+	for _, m := range mounts {
+		name := sharedVolumePrefix + m.Name
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, errors.Errorf("invalid volume name %q: %s", m.Name, strings.Join(errs, ", "))
+		}
+		if m.MountPath == "" {
+			return nil, errors.Errorf("mount path is required for volume %q", m.Name)
+		}
+		sharedVolumes[name] = struct{}{}
+		result = append(result, apiv1.VolumeMount{
+			Name:      name,
+			MountPath: m.MountPath,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+	return result, nil
+}
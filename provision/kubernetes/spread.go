@@ -0,0 +1,144 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	topologyZoneKey = "topology.kubernetes.io/zone"
+	topologyNodeKey = "kubernetes.io/hostname"
+)
+
+func topologyKey(topology string) string {
+	switch topology {
+	case provTypes.SpreadTopologyZone:
+		return topologyZoneKey
+	case "", provTypes.SpreadTopologyNode:
+		return topologyNodeKey
+	}
+	return topology
+}
+
+func maxSkew(ts provTypes.TsuruYamlKubernetesTopologySpread) int {
+	if ts.MaxSkew == 0 {
+		return 1
+	}
+	return ts.MaxSkew
+}
+
+// processSpread merges the spread declared for the process in tsuru.yaml on
+// top of the spread of the pool. Processes may add topologies and tighten the
+// ones defined by the pool, but never weaken a required pool constraint or
+// drop a pool topology.
+func processSpread(ctx context.Context, a provision.App, procConfig *provTypes.TsuruYamlKubernetesProcessConfig) (*provTypes.TsuruYamlKubernetesSpread, error) {
+	p, err := pool.GetPoolByName(ctx, a.GetPool())
+	if err != nil {
+		return nil, err
+	}
+	poolSpread, err := p.GetSpread()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid spread for pool %q", p.Name)
+	}
+	var spread provTypes.TsuruYamlKubernetesSpread
+	if poolSpread != nil {
+		spread.TopologySpread = append(spread.TopologySpread, poolSpread.TopologySpread...)
+		spread.AntiAffinity = poolSpread.AntiAffinity
+		spread.AntiAffinityTopology = poolSpread.AntiAffinityTopology
+	}
+	if procConfig == nil || procConfig.Spread == nil {
+		return &spread, nil
+	}
+	for _, ts := range procConfig.Spread.TopologySpread {
+		idx := -1
+		for i := range spread.TopologySpread {
+			if topologyKey(spread.TopologySpread[i].Topology) == topologyKey(ts.Topology) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			spread.TopologySpread = append(spread.TopologySpread, ts)
+			continue
+		}
+		current := &spread.TopologySpread[idx]
+		current.Required = current.Required || ts.Required
+		if ts.MaxSkew < 0 || maxSkew(ts) < maxSkew(*current) {
+			current.MaxSkew = ts.MaxSkew
+		}
+	}
+	if procConfig.Spread.AntiAffinity != "" && spread.AntiAffinity != provTypes.AntiAffinityRequired {
+		spread.AntiAffinity = procConfig.Spread.AntiAffinity
+		spread.AntiAffinityTopology = procConfig.Spread.AntiAffinityTopology
+	}
+	return &spread, nil
+}
+
+// spreadForProcess returns the topology spread constraints of the units of a
+// process, along with the affinity extended with their pod anti-affinity.
+func spreadForProcess(ctx context.Context, a provision.App, process string, procConfig *provTypes.TsuruYamlKubernetesProcessConfig, affinity *apiv1.Affinity) (*apiv1.Affinity, []apiv1.TopologySpreadConstraint, error) {
+	spread, err := processSpread(ctx, a, procConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			tsuruLabelAppName:    a.GetName(),
+			tsuruLabelAppProcess: process,
+		},
+	}
+	var constraints []apiv1.TopologySpreadConstraint
+	for _, ts := range spread.TopologySpread {
+		skew := maxSkew(ts)
+		if skew < 0 {
+			return nil, nil, errors.Errorf("invalid max skew %d for topology %q", ts.MaxSkew, ts.Topology)
+		}
+		whenUnsatisfiable := apiv1.ScheduleAnyway
+		if ts.Required {
+			whenUnsatisfiable = apiv1.DoNotSchedule
+		}
+		constraints = append(constraints, apiv1.TopologySpreadConstraint{
+			MaxSkew:           int32(skew),
+			TopologyKey:       topologyKey(ts.Topology),
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     selector,
+		})
+	}
+	if spread.AntiAffinity == "" {
+		return affinity, constraints, nil
+	}
+	if affinity == nil {
+		affinity = &apiv1.Affinity{}
+	} else {
+		affinity = affinity.DeepCopy()
+	}
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &apiv1.PodAntiAffinity{}
+	}
+	term := apiv1.PodAffinityTerm{
+		LabelSelector: selector,
+		TopologyKey:   topologyKey(spread.AntiAffinityTopology),
+	}
+	switch spread.AntiAffinity {
+	case provTypes.AntiAffinityRequired:
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	case provTypes.AntiAffinityPreferred:
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, apiv1.WeightedPodAffinityTerm{
+			Weight:          100,
+			PodAffinityTerm: term,
+		})
+	default:
+		return nil, nil, errors.Errorf("invalid anti affinity %q, must be either %q or %q", spread.AntiAffinity, provTypes.AntiAffinityRequired, provTypes.AntiAffinityPreferred)
+	}
+	return affinity, constraints, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *S) TestSpreadForProcess(c *check.C) {
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{
+		Name:        "spread-pool",
+		Provisioner: provisionerName,
+		Labels: map[string]string{
+			"spread": `{"topology_spread": [{"topology": "zone", "max_skew": 2}]}`,
+		},
+	})
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Pool = "spread-pool"
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"tsuru.io/app-name":    "myapp",
+			"tsuru.io/app-process": "web",
+		},
+	}
+	affinity, constraints, err := spreadForProcess(context.TODO(), a, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(affinity, check.IsNil)
+	c.Assert(constraints, check.DeepEquals, []apiv1.TopologySpreadConstraint{
+		{MaxSkew: 2, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: apiv1.ScheduleAnyway, LabelSelector: selector},
+	})
+	poolAffinity := &apiv1.Affinity{NodeAffinity: &apiv1.NodeAffinity{}}
+	procConfig := &provTypes.TsuruYamlKubernetesProcessConfig{
+		Spread: &provTypes.TsuruYamlKubernetesSpread{
+			TopologySpread: []provTypes.TsuruYamlKubernetesTopologySpread{
+				{Topology: "node", Required: true},
+			},
+			AntiAffinity: "required",
+		},
+	}
+	affinity, constraints, err = spreadForProcess(context.TODO(), a, "web", procConfig, poolAffinity)
+	c.Assert(err, check.IsNil)
+	c.Assert(constraints, check.DeepEquals, []apiv1.TopologySpreadConstraint{
+		{MaxSkew: 2, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: apiv1.ScheduleAnyway, LabelSelector: selector},
+		{MaxSkew: 1, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: apiv1.DoNotSchedule, LabelSelector: selector},
+	})
+	c.Assert(affinity, check.DeepEquals, &apiv1.Affinity{
+		NodeAffinity: &apiv1.NodeAffinity{},
+		PodAntiAffinity: &apiv1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []apiv1.PodAffinityTerm{
+				{LabelSelector: selector, TopologyKey: "kubernetes.io/hostname"},
+			},
+		},
+	})
+	c.Assert(poolAffinity.PodAntiAffinity, check.IsNil)
+	procConfig.Spread.AntiAffinity = "sometimes"
+	_, _, err = spreadForProcess(context.TODO(), a, "web", procConfig, nil)
+	c.Assert(err, check.ErrorMatches, `invalid anti affinity "sometimes", must be either "required" or "preferred"`)
+}
+
+func (s *S) TestSpreadForProcessCannotWeakenPoolSpread(c *check.C) {
+	err := pool.AddPool(context.TODO(), pool.AddPoolOptions{
+		Name:        "spread-pool",
+		Provisioner: provisionerName,
+		Labels: map[string]string{
+			"spread": `{"topology_spread": [{"topology": "zone", "required": true}], "anti_affinity": "required", "anti_affinity_topology": "zone"}`,
+		},
+	})
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Pool = "spread-pool"
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"tsuru.io/app-name":    "myapp",
+			"tsuru.io/app-process": "web",
+		},
+	}
+	procConfig := &provTypes.TsuruYamlKubernetesProcessConfig{
+		Spread: &provTypes.TsuruYamlKubernetesSpread{
+			TopologySpread: []provTypes.TsuruYamlKubernetesTopologySpread{
+				{Topology: "zone", MaxSkew: 5},
+			},
+			AntiAffinity: "preferred",
+		},
+	}
+	affinity, constraints, err := spreadForProcess(context.TODO(), a, "web", procConfig, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(constraints, check.DeepEquals, []apiv1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: apiv1.DoNotSchedule, LabelSelector: selector},
+	})
+	c.Assert(affinity, check.DeepEquals, &apiv1.Affinity{
+		PodAntiAffinity: &apiv1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []apiv1.PodAffinityTerm{
+				{LabelSelector: selector, TopologyKey: "topology.kubernetes.io/zone"},
+			},
+		},
+	})
+}
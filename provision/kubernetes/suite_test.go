@@ -23,6 +23,7 @@ import (
 	faketsuru "github.com/tsuru/tsuru/provision/kubernetes/pkg/client/clientset/versioned/fake"
 	kTesting "github.com/tsuru/tsuru/provision/kubernetes/testing"
 	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/unitevent"
 	"github.com/tsuru/tsuru/router/routertest"
 	"github.com/tsuru/tsuru/servicemanager"
 	servicemock "github.com/tsuru/tsuru/servicemanager/mock"
@@ -234,6 +235,8 @@ func (s *S) SetUpTest(c *check.C) {
 	c.Assert(err, check.IsNil)
 	servicemanager.Volume, err = volume.VolumeService()
 	c.Assert(err, check.IsNil)
+	servicemanager.UnitEvent, err = unitevent.UnitEventService()
+	c.Assert(err, check.IsNil)
 }
 
 func (s *S) waitNodeUpdate(c *check.C, fn func()) {
@@ -0,0 +1,491 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/action"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"github.com/tsuru/tsuru/types/quota"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	teamNamespaceLabel       = tsuruLabelPrefix + "team"
+	teamResourceQuotaName    = "tsuru-team-quota"
+	teamRoleBindingName      = "tsuru-team"
+	teamRoleBindingGroupKind = "Group"
+	teamLimitRangeName       = "tsuru-team-limits"
+)
+
+func teamNamespaceSelector(team string) map[string]string {
+	return map[string]string{
+		teamNamespaceLabel: provision.ValidKubeName(team),
+	}
+}
+
+// ensureTeamNamespace creates the namespace of the team, along with its
+// resource quota and the binding granting the team access to it.
+func ensureTeamNamespace(ctx context.Context, client *ClusterClient, team string) error {
+	name := client.TeamNamespace(team)
+	pools, err := servicemanager.Pool.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		if client.PoolNamespace(p.Name) == name {
+			return &tsuruErrors.ValidationError{
+				Message: fmt.Sprintf("namespace %q of team %q is also the namespace of pool %q", name, team, p.Name),
+			}
+		}
+	}
+	nsLabels, err := client.namespaceLabels(name)
+	if err != nil {
+		return err
+	}
+	for k, v := range teamNamespaceSelector(team) {
+		nsLabels[k] = v
+	}
+	ns, err := client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		ns = &apiv1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: nsLabels,
+			},
+		}
+		_, err = client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+		if err != nil && !k8sErrors.IsAlreadyExists(err) {
+			return errors.WithStack(err)
+		}
+	} else if err != nil {
+		return errors.WithStack(err)
+	} else if ns.Labels[teamNamespaceLabel] != nsLabels[teamNamespaceLabel] {
+		if ns.Labels == nil {
+			ns.Labels = map[string]string{}
+		}
+		ns.Labels[teamNamespaceLabel] = nsLabels[teamNamespaceLabel]
+		_, err = client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	err = ensureTeamResourceQuota(ctx, client, team)
+	if err != nil {
+		return err
+	}
+	return ensureTeamRoleBinding(ctx, client, team)
+}
+
+func parseTeamResourceQuota(raw string) (apiv1.ResourceList, error) {
+	hard := apiv1.ResourceList{}
+	for _, item := range strings.Split(raw, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid team namespace quota %q, expected <resource>=<quantity>", item)
+		}
+		value, err := resource.ParseQuantity(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid team namespace quota %q", item)
+		}
+		hard[apiv1.ResourceName(strings.TrimSpace(parts[0]))] = value
+	}
+	return hard, nil
+}
+
+// ensureTeamResourceQuota creates the resource quota of the team namespace
+// from the cluster configuration and, when enabled, the tsuru resource quotas
+// of the team.
+func ensureTeamResourceQuota(ctx context.Context, client *ClusterClient, team string) error {
+	hard, err := parseTeamResourceQuota(client.configForContext(team, teamNamespaceQuotaKey))
+	if err != nil {
+		return err
+	}
+	limits, err := teamQuotaLimits(ctx, client, team)
+	if err != nil {
+		return err
+	}
+	for name, quantity := range limits {
+		hard[name] = quantity
+	}
+	err = syncTeamResourceQuota(ctx, client, team, hard)
+	if err != nil {
+		return err
+	}
+	return ensureTeamLimitRange(ctx, client, team, len(limits) > 0)
+}
+
+func syncTeamResourceQuota(ctx context.Context, client *ClusterClient, team string, hard apiv1.ResourceList) error {
+	ns := client.TeamNamespace(team)
+	existing, err := client.CoreV1().ResourceQuotas(ns).Get(ctx, teamResourceQuotaName, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+	if len(hard) == 0 {
+		if err == nil {
+			err = client.CoreV1().ResourceQuotas(ns).Delete(ctx, teamResourceQuotaName, metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	}
+	resourceQuota := &apiv1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      teamResourceQuotaName,
+			Namespace: ns,
+			Labels:    teamNamespaceSelector(team),
+		},
+		Spec: apiv1.ResourceQuotaSpec{Hard: hard},
+	}
+	if err != nil {
+		_, err = client.CoreV1().ResourceQuotas(ns).Create(ctx, resourceQuota, metav1.CreateOptions{})
+		return errors.WithStack(err)
+	}
+	if sameResourceList(existing.Spec.Hard, hard) {
+		return nil
+	}
+	resourceQuota.ResourceVersion = existing.ResourceVersion
+	_, err = client.CoreV1().ResourceQuotas(ns).Update(ctx, resourceQuota, metav1.UpdateOptions{})
+	return errors.WithStack(err)
+}
+
+// teamQuotaLimits returns the CPU and memory limits of the team namespace,
+// the sum of the tsuru resource quotas of the team in the pools whose apps
+// run in the cluster. A resource is only limited if it's limited in all of
+// these pools. Quotas are raised by the max surge of the pool, as the new
+// pods of a rollout run along with the old ones, tsuru itself enforces the
+// exact quota.
+func teamQuotaLimits(ctx context.Context, client *ClusterClient, team string) (apiv1.ResourceList, error) {
+	if !client.teamResourceQuotasEnabled() {
+		return nil, nil
+	}
+	t, err := servicemanager.Team.FindByName(ctx, team)
+	if err == authTypes.ErrTeamNotFound || t == nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pools := map[string]struct{}{}
+	for _, q := range t.ResourceQuotas {
+		poolClient, err := clusterForPool(ctx, q.Pool)
+		if err == nil && poolClient.Name == client.Name {
+			pools[q.Pool] = struct{}{}
+		}
+	}
+	apps, err := servicemanager.App.List(ctx, &appTypes.Filter{TeamOwner: team})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range apps {
+		appClient, err := clusterForApp(ctx, a)
+		if err == nil && appClient.Name == client.Name {
+			pools[a.GetPool()] = struct{}{}
+		}
+	}
+	if len(pools) == 0 {
+		return nil, nil
+	}
+	var cpu, memory int64
+	cpuLimited, memoryLimited := true, true
+	for poolName := range pools {
+		q := t.ResourceQuota(poolName)
+		if q.MilliCPU < 0 {
+			cpuLimited = false
+		}
+		if q.Memory < 0 {
+			memoryLimited = false
+		}
+		surge := int64(teamQuotaSurgePercent(client, poolName))
+		cpu += q.MilliCPU * (100 + surge) / 100
+		memory += q.Memory * (100 + surge) / 100
+	}
+	limits := apiv1.ResourceList{}
+	if cpuLimited {
+		limits[apiv1.ResourceLimitsCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+	}
+	if memoryLimited {
+		limits[apiv1.ResourceLimitsMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+	}
+	return limits, nil
+}
+
+// teamQuotaSurgePercent returns the max surge of rollouts in the pool as a
+// percentage of the units. Apps may raise their max surge up to the pool
+// limit, absolute surges are counted as 100%.
+func teamQuotaSurgePercent(client *ClusterClient, pool string) int {
+	values := []intstr.IntOrString{client.maxSurge(pool)}
+	if limit := client.rolloutLimit(pool, maxSurgeLimitKey); limit != nil {
+		values = append(values, *limit)
+	}
+	var percent int
+	for _, v := range values {
+		p := 100
+		if v.Type == intstr.String && strings.HasSuffix(v.StrVal, "%") {
+			if parsed, err := strconv.Atoi(strings.TrimSuffix(v.StrVal, "%")); err == nil {
+				p = parsed
+			}
+		}
+		if p > percent {
+			percent = p
+		}
+	}
+	return percent
+}
+
+// ensureTeamLimitRange sets default container limits, from the default plan,
+// in namespaces with limits in their quota, as pods without limits would be
+// rejected. It's mostly relevant to pods created by the team itself.
+func ensureTeamLimitRange(ctx context.Context, client *ClusterClient, team string, limited bool) error {
+	ns := client.TeamNamespace(team)
+	existing, err := client.CoreV1().LimitRanges(ns).Get(ctx, teamLimitRangeName, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+	defaults := apiv1.ResourceList{}
+	if limited {
+		plan, planErr := servicemanager.Plan.DefaultPlan(ctx)
+		if planErr != nil {
+			return planErr
+		}
+		if plan.CPUMilli > 0 {
+			defaults[apiv1.ResourceCPU] = *resource.NewMilliQuantity(int64(plan.CPUMilli), resource.DecimalSI)
+		}
+		if plan.Memory > 0 {
+			defaults[apiv1.ResourceMemory] = *resource.NewQuantity(plan.Memory, resource.BinarySI)
+		}
+	}
+	if len(defaults) == 0 {
+		if err == nil {
+			err = client.CoreV1().LimitRanges(ns).Delete(ctx, teamLimitRangeName, metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	}
+	limitRange := &apiv1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      teamLimitRangeName,
+			Namespace: ns,
+			Labels:    teamNamespaceSelector(team),
+		},
+		Spec: apiv1.LimitRangeSpec{
+			Limits: []apiv1.LimitRangeItem{{
+				Type:    apiv1.LimitTypeContainer,
+				Default: defaults,
+			}},
+		},
+	}
+	if err != nil {
+		_, err = client.CoreV1().LimitRanges(ns).Create(ctx, limitRange, metav1.CreateOptions{})
+		return errors.WithStack(err)
+	}
+	if len(existing.Spec.Limits) == 1 && sameResourceList(existing.Spec.Limits[0].Default, defaults) {
+		return nil
+	}
+	limitRange.ResourceVersion = existing.ResourceVersion
+	_, err = client.CoreV1().LimitRanges(ns).Update(ctx, limitRange, metav1.UpdateOptions{})
+	return errors.WithStack(err)
+}
+
+func sameResourceList(a, b apiv1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, quantity := range a {
+		other, ok := b[name]
+		if !ok || quantity.Cmp(other) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func ensureTeamRoleBinding(ctx context.Context, client *ClusterClient, team string) error {
+	ns := client.TeamNamespace(team)
+	role := client.configForContext(team, teamNamespaceRoleKey)
+	existing, err := client.RbacV1().RoleBindings(ns).Get(ctx, teamRoleBindingName, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+	if err == nil {
+		if role != "" && existing.RoleRef.Name == role {
+			return nil
+		}
+		// The role of a binding can't be changed, it's recreated instead.
+		err = client.RbacV1().RoleBindings(ns).Delete(ctx, teamRoleBindingName, metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return errors.WithStack(err)
+		}
+	}
+	if role == "" {
+		return nil
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      teamRoleBindingName,
+			Namespace: ns,
+			Labels:    teamNamespaceSelector(team),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     role,
+		},
+		Subjects: []rbacv1.Subject{{
+			APIGroup: rbacv1.GroupName,
+			Kind:     teamRoleBindingGroupKind,
+			Name:     team,
+		}},
+	}
+	_, err = client.RbacV1().RoleBindings(ns).Create(ctx, binding, metav1.CreateOptions{})
+	return errors.WithStack(err)
+}
+
+// ensureAppsInTeamNamespaces moves the apps running in the cluster to the
+// namespaces of their teams, once the cluster places apps in namespaces per
+// team.
+func ensureAppsInTeamNamespaces(ctx context.Context, p *kubernetesProvisioner, client *ClusterClient, w io.Writer) error {
+	if !client.teamNamespacesEnabled() {
+		return nil
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	apps, err := clusterApps(ctx, client.Name)
+	if err != nil {
+		return err
+	}
+	multiErr := tsuruErrors.NewMultiError()
+	for _, a := range apps {
+		err = moveAppToTeamNamespace(ctx, p, client, a, w)
+		if err != nil {
+			multiErr.Add(errors.Wrapf(err, "unable to move app %q to its team namespace", a.GetName()))
+		}
+	}
+	return multiErr.ToError()
+}
+
+func moveAppToTeamNamespace(ctx context.Context, p *kubernetesProvisioner, client *ClusterClient, a provision.App, w io.Writer) error {
+	appCR, err := getAppCR(ctx, client, a.GetName())
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	newNamespace := client.namespaceForApp(a)
+	if appCR.Spec.NamespaceName == newNamespace {
+		return nil
+	}
+	volumes, err := servicemanager.Volume.ListByApp(ctx, a.GetName())
+	if err != nil {
+		return err
+	}
+	if len(volumes) > 0 {
+		return errors.New("can't change the namespace of an app with binded volumes")
+	}
+	versions, err := versionsForAppProcess(ctx, client, a, "", false)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 1 {
+		return &tsuruErrors.ValidationError{Message: "can't provision new app with multiple versions, please unify them and try again"}
+	}
+	fmt.Fprintf(w, "---- Moving app %q from namespace %q to %q ----\n", a.GetName(), appCR.Spec.NamespaceName, newNamespace)
+	params := updatePipelineParams{
+		old:          a,
+		new:          a,
+		oldNamespace: appCR.Spec.NamespaceName,
+		newNamespace: newNamespace,
+		w:            w,
+		p:            p,
+		versions:     versions,
+	}
+	return action.NewPipeline(
+		&updateAppCR,
+		&restartApp,
+		&rebuildAppRoutes,
+		&removeOldAppResources,
+	).Execute(ctx, params)
+}
+
+// SyncTeamResourceQuotas updates the resource quotas of the team namespaces
+// in clusters enforcing tsuru resource quotas.
+func (p *kubernetesProvisioner) SyncTeamResourceQuotas(ctx context.Context, team string) error {
+	clusters, err := allClusters(ctx)
+	if err != nil {
+		return err
+	}
+	multiErr := tsuruErrors.NewMultiError()
+	for _, client := range clusters {
+		if !client.teamNamespacesEnabled() || !client.teamResourceQuotasEnabled() {
+			continue
+		}
+		_, err = client.CoreV1().Namespaces().Get(ctx, client.TeamNamespace(team), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err == nil {
+			err = ensureTeamResourceQuota(ctx, client, team)
+		}
+		if err != nil {
+			multiErr.Add(errors.Wrapf(err, "[cluster %s]", client.Name))
+		}
+	}
+	return multiErr.ToError()
+}
+
+// TeamResourceRequests returns the sum of the resource requests of the pods
+// of the team apps in the pool, over all clusters.
+func (p *kubernetesProvisioner) TeamResourceRequests(ctx context.Context, team, pool string) (quota.Resources, error) {
+	var requested quota.Resources
+	clusters, err := allClusters(ctx)
+	if err != nil {
+		return requested, err
+	}
+	selector := labels.SelectorFromSet(labels.Set{
+		tsuruLabelPrefix + provision.LabelAppTeamOwner: team,
+		tsuruLabelPrefix + provision.LabelAppPool:      pool,
+	}).String()
+	for _, client := range clusters {
+		pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return requested, errors.WithStack(err)
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+				continue
+			}
+			for _, container := range pod.Spec.Containers {
+				requested.MilliCPU += container.Resources.Requests.Cpu().MilliValue()
+				requested.Memory += container.Resources.Requests.Memory().Value()
+			}
+		}
+	}
+	return requested, nil
+}
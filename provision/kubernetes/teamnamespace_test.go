@@ -0,0 +1,393 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	"github.com/tsuru/tsuru/types/quota"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func (s *S) TestNamespaceForApp(c *check.C) {
+	a := provisiontest.NewFakeAppWithPool("myapp", "python", "test-default", 0)
+	a.TeamOwner = "My_Team"
+	c.Assert(s.clusterClient.namespaceForApp(a), check.Equals, s.clusterClient.PoolNamespace("test-default"))
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	defer delete(s.clusterClient.CustomData, teamNamespacesKey)
+	c.Assert(s.clusterClient.namespaceForApp(a), check.Equals, "tsuru-team-my-team")
+	s.clusterClient.CustomData[namespaceClusterKey] = "custom"
+	defer delete(s.clusterClient.CustomData, namespaceClusterKey)
+	c.Assert(s.clusterClient.namespaceForApp(a), check.Equals, "custom-team-my-team")
+}
+
+func (s *S) TestParseTeamResourceQuota(c *check.C) {
+	hard, err := parseTeamResourceQuota("cpu=10, memory=20Gi,pods=100")
+	c.Assert(err, check.IsNil)
+	c.Assert(hard, check.DeepEquals, apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("10"),
+		apiv1.ResourceMemory: resource.MustParse("20Gi"),
+		apiv1.ResourcePods:   resource.MustParse("100"),
+	})
+	hard, err = parseTeamResourceQuota("")
+	c.Assert(err, check.IsNil)
+	c.Assert(hard, check.HasLen, 0)
+	_, err = parseTeamResourceQuota("cpu")
+	c.Assert(err, check.ErrorMatches, `invalid team namespace quota "cpu", expected <resource>=<quantity>`)
+	_, err = parseTeamResourceQuota("cpu=lots")
+	c.Assert(err, check.ErrorMatches, `invalid team namespace quota "cpu=lots": .*`)
+}
+
+func (s *S) TestEnsureTeamNamespace(c *check.C) {
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	s.clusterClient.CustomData[teamNamespaceQuotaKey] = "pods=10"
+	s.clusterClient.CustomData["other:"+teamNamespaceQuotaKey] = "pods=20"
+	s.clusterClient.CustomData[teamNamespaceRoleKey] = "edit"
+	defer func() {
+		delete(s.clusterClient.CustomData, teamNamespacesKey)
+		delete(s.clusterClient.CustomData, teamNamespaceQuotaKey)
+		delete(s.clusterClient.CustomData, "other:"+teamNamespaceQuotaKey)
+		delete(s.clusterClient.CustomData, teamNamespaceRoleKey)
+	}()
+	for _, team := range []string{"myteam", "other"} {
+		err := ensureTeamNamespace(context.TODO(), s.clusterClient, team)
+		c.Assert(err, check.IsNil)
+	}
+	ns, err := s.client.CoreV1().Namespaces().Get(context.TODO(), "tsuru-team-myteam", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(ns.Labels, check.DeepEquals, map[string]string{
+		"name":          "tsuru-team-myteam",
+		"tsuru.io/team": "myteam",
+	})
+	rq, err := s.client.CoreV1().ResourceQuotas("tsuru-team-myteam").Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(rq.Spec.Hard, check.DeepEquals, apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("10")})
+	rq, err = s.client.CoreV1().ResourceQuotas("tsuru-team-other").Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(rq.Spec.Hard, check.DeepEquals, apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("20")})
+	binding, err := s.client.RbacV1().RoleBindings("tsuru-team-myteam").Get(context.TODO(), teamRoleBindingName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(binding.RoleRef, check.DeepEquals, rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "edit"})
+	c.Assert(binding.Subjects, check.DeepEquals, []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: "Group", Name: "myteam"}})
+
+	s.clusterClient.CustomData[teamNamespaceRoleKey] = "view"
+	delete(s.clusterClient.CustomData, teamNamespaceQuotaKey)
+	err = ensureTeamNamespace(context.TODO(), s.clusterClient, "myteam")
+	c.Assert(err, check.IsNil)
+	_, err = s.client.CoreV1().ResourceQuotas("tsuru-team-myteam").Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	binding, err = s.client.RbacV1().RoleBindings("tsuru-team-myteam").Get(context.TODO(), teamRoleBindingName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(binding.RoleRef.Name, check.Equals, "view")
+}
+
+func (s *S) TestValidateClusterTeamNamespaceQuota(c *check.C) {
+	clust := *s.clusterClient.Cluster
+	clust.CustomData = map[string]string{"myteam:" + teamNamespaceQuotaKey: "cpu"}
+	err := s.p.ValidateCluster(&clust)
+	c.Assert(err, check.ErrorMatches, `(?s).*invalid team namespace quota "cpu".*`)
+}
+
+func (s *S) TestEnsureTeamNamespaceResourceQuotas(c *check.C) {
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	s.clusterClient.CustomData[teamResourceQuotasKey] = "true"
+	s.clusterClient.CustomData[teamNamespaceQuotaKey] = "pods=10"
+	defer func() {
+		delete(s.clusterClient.CustomData, teamNamespacesKey)
+		delete(s.clusterClient.CustomData, teamResourceQuotasKey)
+		delete(s.clusterClient.CustomData, teamNamespaceQuotaKey)
+	}()
+	s.team.ResourceQuotas = []quota.ResourceQuota{{Pool: "test-default", MilliCPU: 2000, Memory: -1}}
+	defer func() { s.team.ResourceQuotas = nil }()
+	s.mockService.Plan.OnDefaultPlan = func() (*appTypes.Plan, error) {
+		return &appTypes.Plan{Name: "default", Default: true, CPUMilli: 500, Memory: 512 * 1024 * 1024}, nil
+	}
+	err := ensureTeamNamespace(context.TODO(), s.clusterClient, s.team.Name)
+	c.Assert(err, check.IsNil)
+	ns := s.clusterClient.TeamNamespace(s.team.Name)
+	rq, err := s.client.CoreV1().ResourceQuotas(ns).Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(sameResourceList(rq.Spec.Hard, apiv1.ResourceList{
+		apiv1.ResourcePods:      resource.MustParse("10"),
+		apiv1.ResourceLimitsCPU: resource.MustParse("4"),
+	}), check.Equals, true)
+	limitRange, err := s.client.CoreV1().LimitRanges(ns).Get(context.TODO(), teamLimitRangeName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(limitRange.Spec.Limits, check.HasLen, 1)
+	c.Assert(sameResourceList(limitRange.Spec.Limits[0].Default, apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("500m"),
+		apiv1.ResourceMemory: resource.MustParse("512Mi"),
+	}), check.Equals, true)
+
+	s.team.ResourceQuotas = nil
+	err = s.p.SyncTeamResourceQuotas(context.TODO(), s.team.Name)
+	c.Assert(err, check.IsNil)
+	rq, err = s.client.CoreV1().ResourceQuotas(ns).Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(sameResourceList(rq.Spec.Hard, apiv1.ResourceList{apiv1.ResourcePods: resource.MustParse("10")}), check.Equals, true)
+	_, err = s.client.CoreV1().LimitRanges(ns).Get(context.TODO(), teamLimitRangeName, metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+}
+
+func (s *S) TestEnsureTeamNamespaceResourceQuotasMaxSurge(c *check.C) {
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	s.clusterClient.CustomData[teamResourceQuotasKey] = "true"
+	s.clusterClient.CustomData[maxSurgeKey] = "25%"
+	s.clusterClient.CustomData["test-default:"+maxSurgeLimitKey] = "50%"
+	defer func() {
+		delete(s.clusterClient.CustomData, teamNamespacesKey)
+		delete(s.clusterClient.CustomData, teamResourceQuotasKey)
+		delete(s.clusterClient.CustomData, maxSurgeKey)
+		delete(s.clusterClient.CustomData, "test-default:"+maxSurgeLimitKey)
+	}()
+	s.team.ResourceQuotas = []quota.ResourceQuota{{Pool: "test-default", MilliCPU: 2000, Memory: 1024 * 1024 * 1024}}
+	defer func() { s.team.ResourceQuotas = nil }()
+	err := ensureTeamNamespace(context.TODO(), s.clusterClient, s.team.Name)
+	c.Assert(err, check.IsNil)
+	rq, err := s.client.CoreV1().ResourceQuotas(s.clusterClient.TeamNamespace(s.team.Name)).Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(sameResourceList(rq.Spec.Hard, apiv1.ResourceList{
+		apiv1.ResourceLimitsCPU:    resource.MustParse("3"),
+		apiv1.ResourceLimitsMemory: resource.MustParse("1536Mi"),
+	}), check.Equals, true)
+}
+
+func (s *S) TestDeployAtTeamResourceQuota(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	a.TeamOwner = s.team.Name
+	a.Memory = 256 * 1024 * 1024
+	dbApp := &app.App{Name: a.GetName(), Pool: a.GetPool(), TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(dbApp)
+	c.Assert(err, check.IsNil)
+	newEvent := func() *event.Event {
+		evt, err := event.New(&event.Opts{
+			Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+			Kind:    permission.PermAppDeploy,
+			Owner:   s.token,
+			Allowed: event.Allowed(permission.PermAppDeploy),
+		})
+		c.Assert(err, check.IsNil)
+		return evt
+	}
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg1",
+		},
+	})
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: newEvent()})
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	wait()
+	err = s.p.AddUnits(context.TODO(), a, 1, "web", version, nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	s.clusterClient.CustomData[teamResourceQuotasKey] = "true"
+	defer func() {
+		delete(s.clusterClient.CustomData, teamNamespacesKey)
+		delete(s.clusterClient.CustomData, teamResourceQuotasKey)
+	}()
+	// the team quota is exactly what its two units use
+	s.team.ResourceQuotas = []quota.ResourceQuota{{Pool: "test-default", MilliCPU: -1, Memory: 2 * a.Memory}}
+	defer func() { s.team.ResourceQuotas = nil }()
+	s.client.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	err = ensureAppsInTeamNamespaces(context.TODO(), s.p, s.clusterClient, new(bytes.Buffer))
+	c.Assert(err, check.IsNil)
+	ns := s.clusterClient.TeamNamespace(s.team.Name)
+	version = newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg2",
+		},
+	})
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: newEvent()})
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	wait()
+	dep, err := s.client.AppsV1().Deployments(ns).Get(context.TODO(), "myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(2))
+	surge, err := intstr.GetScaledValueFromIntOrPercent(dep.Spec.Strategy.RollingUpdate.MaxSurge, int(*dep.Spec.Replicas), true)
+	c.Assert(err, check.IsNil)
+	podMemory := resource.Quantity{}
+	for _, container := range dep.Spec.Template.Spec.Containers {
+		podMemory.Add(*container.Resources.Limits.Memory())
+	}
+	c.Assert(podMemory.Value() >= a.Memory, check.Equals, true)
+	rq, err := s.client.CoreV1().ResourceQuotas(ns).Get(context.TODO(), teamResourceQuotaName, metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	hard := rq.Spec.Hard[apiv1.ResourceLimitsMemory]
+	rolloutMemory := podMemory.Value() * int64(int(*dep.Spec.Replicas)+surge)
+	c.Assert(hard.Value() >= rolloutMemory, check.Equals, true, check.Commentf("quota %s, rollout needs %d", hard.String(), rolloutMemory))
+}
+
+func (s *S) TestTeamResourceRequests(c *check.C) {
+	newPod := func(name, pool string, phase apiv1.PodPhase) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					"tsuru.io/app-team": "admin",
+					"tsuru.io/app-pool": pool,
+				},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{{
+					Name: "c",
+					Resources: apiv1.ResourceRequirements{
+						Requests: apiv1.ResourceList{
+							apiv1.ResourceCPU:    resource.MustParse("250m"),
+							apiv1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+					},
+				}},
+			},
+			Status: apiv1.PodStatus{Phase: phase},
+		}
+	}
+	for _, pod := range []*apiv1.Pod{
+		newPod("p1", "test-default", apiv1.PodRunning),
+		newPod("p2", "test-default", apiv1.PodPending),
+		newPod("p3", "test-default", apiv1.PodSucceeded),
+		newPod("p4", "other", apiv1.PodRunning),
+	} {
+		_, err := s.client.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		c.Assert(err, check.IsNil)
+	}
+	requested, err := s.p.TeamResourceRequests(context.TODO(), "admin", "test-default")
+	c.Assert(err, check.IsNil)
+	c.Assert(requested, check.DeepEquals, quota.Resources{MilliCPU: 500, Memory: 256 * 1024 * 1024})
+}
+
+func (s *S) TestEnsureTeamNamespacePoolCollision(c *check.C) {
+	config.Set("kubernetes:use-pool-namespaces", true)
+	defer config.Unset("kubernetes:use-pool-namespaces")
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	defer delete(s.clusterClient.CustomData, teamNamespacesKey)
+	s.mockService.Pool.OnList = func() ([]provTypes.Pool, error) {
+		return []provTypes.Pool{{Name: "test-default"}, {Name: "team-myteam"}}, nil
+	}
+	err := ensureTeamNamespace(context.TODO(), s.clusterClient, "myteam")
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `namespace "tsuru-team-myteam" of team "myteam" is also the namespace of pool "team-myteam"`)
+	_, err = s.client.CoreV1().Namespaces().Get(context.TODO(), "tsuru-team-myteam", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	err = ensureTeamNamespace(context.TODO(), s.clusterClient, "other")
+	c.Assert(err, check.IsNil)
+	err = ensurePoolNamespace(context.TODO(), s.clusterClient, "team-myteam")
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `namespace "tsuru-team-myteam" of pool "team-myteam" is reserved for team namespaces`)
+	err = ensurePoolNamespace(context.TODO(), s.clusterClient, "test-default")
+	c.Assert(err, check.IsNil)
+	delete(s.clusterClient.CustomData, teamNamespacesKey)
+	err = ensurePoolNamespace(context.TODO(), s.clusterClient, "team-myteam")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTeamNetworkPolicyPeerNamespaceSelector(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	peer := provTypes.NetworkPolicyPeer{Team: "My_Team"}
+	result, _, err := toNetworkPolicyPeer(context.TODO(), s.clusterClient, a, peer)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.NamespaceSelector, check.DeepEquals, &metav1.LabelSelector{})
+	c.Assert(result.PodSelector, check.DeepEquals, &metav1.LabelSelector{
+		MatchLabels: map[string]string{"tsuru.io/is-tsuru": "true", "tsuru.io/app-team": "My_Team"},
+	})
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	defer delete(s.clusterClient.CustomData, teamNamespacesKey)
+	result, _, err = toNetworkPolicyPeer(context.TODO(), s.clusterClient, a, peer)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.NamespaceSelector, check.DeepEquals, &metav1.LabelSelector{
+		MatchLabels: map[string]string{"tsuru.io/team": "my-team"},
+	})
+	// the selector matches the labels of the team namespace
+	err = ensureTeamNamespace(context.TODO(), s.clusterClient, "My_Team")
+	c.Assert(err, check.IsNil)
+	ns, err := s.client.CoreV1().Namespaces().Get(context.TODO(), "tsuru-team-my-team", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	selector, err := metav1.LabelSelectorAsSelector(result.NamespaceSelector)
+	c.Assert(err, check.IsNil)
+	c.Assert(selector.Matches(labels.Set(ns.Labels)), check.Equals, true)
+}
+
+func (s *S) TestEnsureAppsInTeamNamespaces(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	dbApp := &app.App{Name: a.GetName(), Pool: a.GetPool(), TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(dbApp)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	version := newCommittedVersion(c, a, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg1",
+		},
+	})
+	_, err = s.p.Deploy(context.TODO(), provision.DeployArgs{App: a, Version: version, Event: evt})
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	wait()
+	appSelector := metav1.ListOptions{LabelSelector: "tsuru.io/app-name=myapp"}
+	sList, err := s.client.CoreV1().Services("default").List(context.TODO(), appSelector)
+	c.Assert(err, check.IsNil)
+	c.Assert(sList.Items, check.HasLen, 2)
+	buf := new(bytes.Buffer)
+	// namespaces per team disabled
+	err = ensureAppsInTeamNamespaces(context.TODO(), s.p, s.clusterClient, buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+	s.clusterClient.CustomData[teamNamespacesKey] = "true"
+	defer delete(s.clusterClient.CustomData, teamNamespacesKey)
+	s.client.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	err = ensureAppsInTeamNamespaces(context.TODO(), s.p, s.clusterClient, buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s)---- Moving app "myapp" from namespace "default" to "tsuru-team-admin" ----.*`)
+	appCR, err := s.client.TsuruV1().Apps("tsuru").Get(context.TODO(), a.GetName(), metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(appCR.Spec.NamespaceName, check.Equals, "tsuru-team-admin")
+	ns, err := s.client.CoreV1().Namespaces().Get(context.TODO(), "tsuru-team-admin", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(ns.Labels["tsuru.io/team"], check.Equals, "admin")
+	sList, err = s.client.CoreV1().Services("default").List(context.TODO(), appSelector)
+	c.Assert(err, check.IsNil)
+	c.Assert(sList.Items, check.HasLen, 0)
+	sList, err = s.client.CoreV1().Services("tsuru-team-admin").List(context.TODO(), appSelector)
+	c.Assert(err, check.IsNil)
+	c.Assert(sList.Items, check.HasLen, 2)
+	dep, err := s.client.AppsV1().Deployments("tsuru-team-admin").Get(context.TODO(), "myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(dep.Spec.Template.Labels["tsuru.io/app-name"], check.Equals, "myapp")
+	// apps already in their team namespace are left alone
+	buf.Reset()
+	err = ensureAppsInTeamNamespaces(context.TODO(), s.p, s.clusterClient, buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+}
@@ -15,7 +15,7 @@ import (
 )
 
 func (p *kubernetesProvisioner) KillUnit(ctx context.Context, app provision.App, unitName string, force bool) error {
-	clusterClient, err := clusterForPool(ctx, app.GetPool())
+	clusterClient, err := clusterForApp(ctx, app)
 	if err != nil {
 		return err
 	}
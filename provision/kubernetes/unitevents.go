@@ -0,0 +1,156 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/servicemanager"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	oomKilledReason  = "OOMKilled"
+	crashLoopReason  = "CrashLoopBackOff"
+	podEvictedReason = "Evicted"
+)
+
+var imagePullFailureReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// recordUnitEvents stores the lifecycle events of the unit between the old
+// and new states of its pod.
+func (c *clusterController) recordUnitEvents(oldPod, newPod *apiv1.Pod) {
+	c.storeUnitEvents(unitEventsForPod(oldPod, newPod))
+}
+
+// recordUnitDeletion stores the removal of the unit of the pod. Units may be
+// removed without ever reporting not ready, the deletion ends the time they
+// ran.
+func (c *clusterController) recordUnitDeletion(pod *apiv1.Pod) {
+	c.storeUnitEvents(unitEventsForDeletedPod(pod))
+}
+
+func (c *clusterController) storeUnitEvents(events []provTypes.UnitEvent) {
+	if len(events) == 0 || servicemanager.UnitEvent == nil {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for _, evt := range events {
+			err := servicemanager.UnitEvent.Add(context.Background(), evt)
+			if err != nil {
+				log.Errorf("[unit-events] unable to record %s event for unit %q: %v", evt.Kind, evt.Unit, err)
+			}
+		}
+	}()
+}
+
+// unitEventsForPod returns the lifecycle events of an app unit between the
+// old and new states of its pod, oldPod is nil for new pods.
+func unitEventsForPod(oldPod, newPod *apiv1.Pod) []provTypes.UnitEvent {
+	base, ok := baseUnitEvent(newPod)
+	if !ok {
+		return nil
+	}
+	if oldPod == nil {
+		oldPod = &apiv1.Pod{}
+	}
+	var events []provTypes.UnitEvent
+	add := func(kind, reason, message string, restartCount int) {
+		evt := base
+		evt.Kind = kind
+		evt.Reason = reason
+		evt.Message = message
+		evt.RestartCount = restartCount
+		events = append(events, evt)
+	}
+	if newPod.Status.Phase == apiv1.PodFailed && newPod.Status.Reason == podEvictedReason && oldPod.Status.Reason != podEvictedReason {
+		add(provTypes.UnitEventEvicted, newPod.Status.Reason, newPod.Status.Message, 0)
+	}
+	oldStatuses := map[string]apiv1.ContainerStatus{}
+	for _, st := range append(oldPod.Status.InitContainerStatuses, oldPod.Status.ContainerStatuses...) {
+		oldStatuses[st.Name] = st
+	}
+	for _, st := range append(newPod.Status.InitContainerStatuses, newPod.Status.ContainerStatuses...) {
+		oldSt := oldStatuses[st.Name]
+		if st.RestartCount > oldSt.RestartCount {
+			kind := provTypes.UnitEventRestarted
+			var reason, message string
+			if term := st.LastTerminationState.Terminated; term != nil {
+				reason = term.Reason
+				message = fmt.Sprintf("container %q exited with code %d", st.Name, term.ExitCode)
+				if term.Reason == oomKilledReason {
+					kind = provTypes.UnitEventOOMKilled
+				}
+			}
+			add(kind, reason, message, int(st.RestartCount))
+		}
+		if st.State.Waiting == nil {
+			continue
+		}
+		var oldReason string
+		if oldSt.State.Waiting != nil {
+			oldReason = oldSt.State.Waiting.Reason
+		}
+		reason := st.State.Waiting.Reason
+		switch {
+		case reason == crashLoopReason && oldReason != crashLoopReason:
+			add(provTypes.UnitEventCrashLoop, reason, st.State.Waiting.Message, int(st.RestartCount))
+		case imagePullFailureReasons[reason] && !imagePullFailureReasons[oldReason]:
+			add(provTypes.UnitEventImagePullFailed, reason, st.State.Waiting.Message, int(st.RestartCount))
+		}
+	}
+	if ready := isPodConditionReady(newPod); ready != isPodConditionReady(oldPod) {
+		if ready {
+			add(provTypes.UnitEventReady, "", "", 0)
+		} else if oldPod.Name != "" {
+			add(provTypes.UnitEventNotReady, "", "", 0)
+		}
+	}
+	return events
+}
+
+// unitEventsForDeletedPod returns the deletion event of an app unit.
+func unitEventsForDeletedPod(pod *apiv1.Pod) []provTypes.UnitEvent {
+	evt, ok := baseUnitEvent(pod)
+	if !ok {
+		return nil
+	}
+	evt.Kind = provTypes.UnitEventDeleted
+	return []provTypes.UnitEvent{evt}
+}
+
+// baseUnitEvent returns the unit event fields identifying the unit of the
+// pod, pods not running app units have no events.
+func baseUnitEvent(pod *apiv1.Pod) (provTypes.UnitEvent, bool) {
+	labelSet := labelSetFromMeta(&pod.ObjectMeta)
+	if labelSet.AppName() == "" || labelSet.IsDeploy() || labelSet.IsIsolatedRun() {
+		return provTypes.UnitEvent{}, false
+	}
+	return provTypes.UnitEvent{
+		App:     labelSet.AppName(),
+		Unit:    pod.Name,
+		Process: labelSet.AppProcess(),
+		Version: labelSet.AppVersion(),
+	}, true
+}
+
+func isPodConditionReady(pod *apiv1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == apiv1.PodReady {
+			return cond.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
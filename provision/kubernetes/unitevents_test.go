@@ -0,0 +1,160 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *S) TestUnitEventsForPod(c *check.C) {
+	newPod := func(mutate func(*apiv1.Pod)) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "myapp-web-pod-1",
+				Labels: map[string]string{
+					"tsuru.io/app-name":    "myapp",
+					"tsuru.io/app-process": "web",
+					"tsuru.io/app-version": "2",
+				},
+			},
+			Status: apiv1.PodStatus{
+				Phase:             apiv1.PodRunning,
+				Conditions:        []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionTrue}},
+				ContainerStatuses: []apiv1.ContainerStatus{{Name: "myapp-web", Ready: true}},
+			},
+		}
+		if mutate != nil {
+			mutate(pod)
+		}
+		return pod
+	}
+	base := provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-pod-1", Process: "web", Version: 2}
+	withKind := func(kind, reason, message string, restarts int) provTypes.UnitEvent {
+		evt := base
+		evt.Kind = kind
+		evt.Reason = reason
+		evt.Message = message
+		evt.RestartCount = restarts
+		return evt
+	}
+	notReady := func(pod *apiv1.Pod) {
+		pod.Status.Conditions[0].Status = apiv1.ConditionFalse
+	}
+	tests := []struct {
+		old, new *apiv1.Pod
+		expected []provTypes.UnitEvent
+	}{
+		{
+			old: newPod(nil),
+			new: newPod(nil),
+		},
+		{
+			old:      newPod(notReady),
+			new:      newPod(nil),
+			expected: []provTypes.UnitEvent{withKind(provTypes.UnitEventReady, "", "", 0)},
+		},
+		{
+			old:      newPod(nil),
+			new:      newPod(notReady),
+			expected: []provTypes.UnitEvent{withKind(provTypes.UnitEventNotReady, "", "", 0)},
+		},
+		{
+			old: newPod(nil),
+			new: newPod(func(pod *apiv1.Pod) {
+				notReady(pod)
+				pod.Status.ContainerStatuses[0].RestartCount = 1
+				pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &apiv1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}
+			}),
+			expected: []provTypes.UnitEvent{
+				withKind(provTypes.UnitEventOOMKilled, "OOMKilled", `container "myapp-web" exited with code 137`, 1),
+				withKind(provTypes.UnitEventNotReady, "", "", 0),
+			},
+		},
+		{
+			old: newPod(notReady),
+			new: newPod(func(pod *apiv1.Pod) {
+				notReady(pod)
+				pod.Status.ContainerStatuses[0].RestartCount = 3
+				pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &apiv1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 40s restarting failed container"}
+			}),
+			expected: []provTypes.UnitEvent{
+				withKind(provTypes.UnitEventRestarted, "Error", `container "myapp-web" exited with code 1`, 3),
+				withKind(provTypes.UnitEventCrashLoop, "CrashLoopBackOff", "back-off 40s restarting failed container", 3),
+			},
+		},
+		{
+			old: newPod(func(pod *apiv1.Pod) {
+				notReady(pod)
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+			}),
+			new: newPod(func(pod *apiv1.Pod) {
+				notReady(pod)
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+			}),
+		},
+		{
+			old: nil,
+			new: newPod(func(pod *apiv1.Pod) {
+				pod.Status.Phase = apiv1.PodPending
+				pod.Status.Conditions = nil
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "not found"}
+			}),
+			expected: []provTypes.UnitEvent{withKind(provTypes.UnitEventImagePullFailed, "ErrImagePull", "not found", 0)},
+		},
+		{
+			old: newPod(func(pod *apiv1.Pod) {
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "ErrImagePull"}
+			}),
+			new: newPod(func(pod *apiv1.Pod) {
+				pod.Status.ContainerStatuses[0].State.Waiting = &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"}
+			}),
+		},
+		{
+			old: newPod(nil),
+			new: newPod(func(pod *apiv1.Pod) {
+				notReady(pod)
+				pod.Status.Phase = apiv1.PodFailed
+				pod.Status.Reason = "Evicted"
+				pod.Status.Message = "The node was low on resource: memory."
+			}),
+			expected: []provTypes.UnitEvent{
+				withKind(provTypes.UnitEventEvicted, "Evicted", "The node was low on resource: memory.", 0),
+				withKind(provTypes.UnitEventNotReady, "", "", 0),
+			},
+		},
+		{
+			old: newPod(notReady),
+			new: newPod(func(pod *apiv1.Pod) {
+				pod.Labels["tsuru.io/is-deploy"] = "true"
+			}),
+		},
+	}
+	for i, tt := range tests {
+		c.Check(unitEventsForPod(tt.old, tt.new), check.DeepEquals, tt.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestUnitEventsForDeletedPod(c *check.C) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "myapp-web-pod-1",
+			Labels: map[string]string{
+				"tsuru.io/app-name":    "myapp",
+				"tsuru.io/app-process": "web",
+				"tsuru.io/app-version": "2",
+			},
+		},
+	}
+	c.Assert(unitEventsForDeletedPod(pod), check.DeepEquals, []provTypes.UnitEvent{
+		{App: "myapp", Unit: "myapp-web-pod-1", Process: "web", Version: 2, Kind: provTypes.UnitEventDeleted},
+	})
+	pod.Labels["tsuru.io/is-isolated-run"] = "true"
+	c.Assert(unitEventsForDeletedPod(pod), check.IsNil)
+	c.Assert(unitEventsForDeletedPod(&apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other"}}), check.IsNil)
+}
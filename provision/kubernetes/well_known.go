@@ -14,4 +14,20 @@ const (
 	// AnnotationEnableVPA is used to enable the creation of a recommendation
 	// only VPA for the application. Its value must be a boolean.
 	AnnotationEnableVPA = "app.tsuru.io/enable-vpa"
+
+	// AnnotationRollout overrides the rollout and shutdown settings of the
+	// app processes, its value must be a serialized json object mapping
+	// process names to settings in the same format used in tsuru.yaml.
+	AnnotationRollout = "app.tsuru.io/rollout"
+
+	// AnnotationDisruptionBudget overrides the PodDisruptionBudget settings
+	// of the app processes, its value must be a serialized json object
+	// mapping process names to settings in the same format used in
+	// tsuru.yaml.
+	AnnotationDisruptionBudget = "app.tsuru.io/disruption-budget"
+
+	// AnnotationNetworkPolicy declares the peers allowed to communicate with
+	// the app units, its value must be a serialized json object with the
+	// ingress and egress peers.
+	AnnotationNetworkPolicy = "app.tsuru.io/network-policy"
 )
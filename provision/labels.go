@@ -29,6 +29,8 @@ const (
 	labelIsService         = "is-service"
 	labelIsHeadlessService = "is-headless-service"
 	labelIsRoutable        = "is-routable"
+	labelHasSidecars       = "has-sidecars"
+	labelHasInitContainers = "has-init-containers"
 
 	LabelAppName      = "app-name"
 	LabelAppProcess   = "app-process"
@@ -45,6 +47,9 @@ const (
 	LabelNodePool           = PoolMetadataName
 	labelNodeIaaSID         = IaaSIDMetadataName
 
+	labelServiceName         = "service-name"
+	labelServiceInstanceName = "service-instance-name"
+
 	labelVolumeName = "volume-name"
 	labelVolumePool = "volume-pool"
 	labelVolumePlan = "volume-plan"
@@ -129,6 +134,18 @@ func (s *LabelSet) ToAppSelector() map[string]string {
 	return withPrefix(subMap(s.Labels, LabelAppName), s.Prefix)
 }
 
+func (s *LabelSet) ToAppProcessSelector() map[string]string {
+	return withPrefix(subMap(s.Labels, LabelAppName, LabelAppProcess), s.Prefix)
+}
+
+func (s *LabelSet) ToTeamSelector() map[string]string {
+	return withPrefix(subMap(s.Labels, labelIsTsuru, LabelAppTeamOwner), s.Prefix)
+}
+
+func (s *LabelSet) ToServiceInstanceSelector() map[string]string {
+	return withPrefix(subMap(s.Labels, labelServiceName, labelServiceInstanceName), s.Prefix)
+}
+
 func (s *LabelSet) ToNodeContainerSelector() map[string]string {
 	return withPrefix(subMap(s.Labels, labelNodeContainerName, labelNodeContainerPool), s.Prefix)
 }
@@ -322,6 +339,14 @@ func (s *LabelSet) IsHeadlessService() bool {
 	return s.getBoolLabel(labelIsHeadlessService)
 }
 
+func (s *LabelSet) HasSidecars() bool {
+	return s.getBoolLabel(labelHasSidecars)
+}
+
+func (s *LabelSet) HasInitContainers() bool {
+	return s.getBoolLabel(labelHasInitContainers)
+}
+
 func (s *LabelSet) SetRestarts(count int) {
 	s.addLabel(labelRestarts, strconv.Itoa(count))
 }
@@ -346,6 +371,14 @@ func (s *LabelSet) SetIsRoutable() {
 	s.addLabel(labelIsRoutable, strconv.FormatBool(true))
 }
 
+func (s *LabelSet) SetHasSidecars() {
+	s.addLabel(labelHasSidecars, strconv.FormatBool(true))
+}
+
+func (s *LabelSet) SetHasInitContainers() {
+	s.addLabel(labelHasInitContainers, strconv.FormatBool(true))
+}
+
 func (s *LabelSet) ToggleIsRoutable(isRoutable bool) {
 	s.addLabel(labelIsRoutable, strconv.FormatBool(isRoutable))
 }
@@ -634,6 +667,56 @@ func PDBLabels(opts PDBLabelsOpts) *LabelSet {
 	}
 }
 
+type NetworkPolicyLabelsOpts struct {
+	App         App
+	Prefix      string
+	Provisioner string
+}
+
+func NetworkPolicyLabels(opts NetworkPolicyLabelsOpts) *LabelSet {
+	return &LabelSet{
+		Labels: map[string]string{
+			labelIsTsuru:      strconv.FormatBool(true),
+			labelProvisioner:  opts.Provisioner,
+			LabelAppName:      opts.App.GetName(),
+			LabelAppTeamOwner: opts.App.GetTeamOwner(),
+		},
+		Prefix: opts.Prefix,
+	}
+}
+
+type NetworkPolicyPeerLabelsOpts struct {
+	App             string
+	Process         string
+	Team            string
+	Service         string
+	ServiceInstance string
+	Prefix          string
+}
+
+// NetworkPolicyPeerLabels returns the labels identifying the units of a
+// network policy peer. Units of service instances running in the cluster are
+// expected to be labeled with the service and instance names.
+func NetworkPolicyPeerLabels(opts NetworkPolicyPeerLabelsOpts) *LabelSet {
+	labels := map[string]string{
+		labelIsTsuru: strconv.FormatBool(true),
+	}
+	if opts.App != "" {
+		labels[LabelAppName] = opts.App
+	}
+	if opts.Process != "" {
+		labels[LabelAppProcess] = opts.Process
+	}
+	if opts.Team != "" {
+		labels[LabelAppTeamOwner] = opts.Team
+	}
+	if opts.ServiceInstance != "" {
+		labels[labelServiceName] = opts.Service
+		labels[labelServiceInstanceName] = opts.ServiceInstance
+	}
+	return &LabelSet{Labels: labels, Prefix: opts.Prefix}
+}
+
 func withPrefix(m map[string]string, prefix string) map[string]string {
 	result := make(map[string]string, len(m))
 	for k, v := range m {
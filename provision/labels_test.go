@@ -211,3 +211,32 @@ func (s *S) TestPDBLabels(c *check.C) {
 		Prefix: "tsuru.io/",
 	})
 }
+
+func (s *S) TestNetworkPolicyPeerLabels(c *check.C) {
+	ls := provision.NetworkPolicyPeerLabels(provision.NetworkPolicyPeerLabelsOpts{
+		App:     "myapp",
+		Process: "web",
+		Prefix:  "tsuru.io/",
+	})
+	c.Assert(ls.ToAppProcessSelector(), check.DeepEquals, map[string]string{
+		"tsuru.io/app-name":    "myapp",
+		"tsuru.io/app-process": "web",
+	})
+	ls = provision.NetworkPolicyPeerLabels(provision.NetworkPolicyPeerLabelsOpts{
+		Team:   "team-one",
+		Prefix: "tsuru.io/",
+	})
+	c.Assert(ls.ToTeamSelector(), check.DeepEquals, map[string]string{
+		"tsuru.io/is-tsuru": "true",
+		"tsuru.io/app-team": "team-one",
+	})
+	ls = provision.NetworkPolicyPeerLabels(provision.NetworkPolicyPeerLabelsOpts{
+		Service:         "mysql",
+		ServiceInstance: "db1",
+		Prefix:          "tsuru.io/",
+	})
+	c.Assert(ls.ToServiceInstanceSelector(), check.DeepEquals, map[string]string{
+		"tsuru.io/service-name":          "mysql",
+		"tsuru.io/service-instance-name": "db1",
+	})
+}
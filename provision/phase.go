@@ -0,0 +1,18 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+// Names of the phases recorded in deploy events, see event.Event.StartPhase.
+const (
+	DeployPhaseArchiveUpload       = "archive-upload"
+	DeployPhaseBuildPodScheduling  = "build-pod-scheduling"
+	DeployPhaseBuild               = "build"
+	DeployPhaseImagePush           = "image-push"
+	DeployPhaseInspect             = "inspect"
+	DeployPhaseDeployPodScheduling = "deploy-pod-scheduling"
+	DeployPhaseHooks               = "hooks"
+	DeployPhaseRollout             = "rollout"
+	DeployPhaseRouterUpdate        = "router-update"
+)
@@ -19,7 +19,7 @@ import (
 
 var (
 	ErrInvalidConstraintType = errors.Errorf("invalid constraint type. Valid types are: %s", validConstraintTypes)
-	validConstraintTypes     = []poolConstraintType{ConstraintTypeTeam, ConstraintTypeService, ConstraintTypeRouter, ConstraintTypePlan, ConstraintTypeVolumePlan}
+	validConstraintTypes     = []poolConstraintType{ConstraintTypeTeam, ConstraintTypeService, ConstraintTypeRouter, ConstraintTypePlan, ConstraintTypeVolumePlan, ConstraintTypeRegistry, ConstraintTypeDebugImage}
 )
 
 type poolConstraintType string
@@ -30,6 +30,8 @@ const (
 	ConstraintTypeService    = poolConstraintType("service")
 	ConstraintTypePlan       = poolConstraintType("plan")
 	ConstraintTypeVolumePlan = poolConstraintType("volume-plan")
+	ConstraintTypeRegistry   = poolConstraintType("registry")
+	ConstraintTypeDebugImage = poolConstraintType("debug-image")
 )
 
 type regexpCache struct {
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/ghodss/yaml"
@@ -26,6 +27,7 @@ import (
 	provisionTypes "github.com/tsuru/tsuru/types/provision"
 	"github.com/tsuru/tsuru/validation"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var (
@@ -43,8 +45,22 @@ var (
 
 const (
 	affinityKey         = "affinity"
+	spreadKey           = "spread"
+	networkPolicyKey    = "network-policy"
+	driftAutoCorrectKey = "drift-auto-correct"
 	buildPlanKey        = "build-plan"
 	buildPlanSideCarKey = "build-plan-sidecar"
+	vpaMinMemoryKey     = "vpa-min-memory"
+	vpaMaxMemoryKey     = "vpa-max-memory"
+	vpaMinCPUKey        = "vpa-min-cpu"
+	vpaMaxCPUKey        = "vpa-max-cpu"
+	sidecarMinMemoryKey = "sidecar-min-memory"
+	sidecarMaxMemoryKey = "sidecar-max-memory"
+	sidecarMinCPUKey    = "sidecar-min-cpu"
+	sidecarMaxCPUKey    = "sidecar-max-cpu"
+
+	defaultSidecarMinMemory   = 64 * 1024 * 1024
+	defaultSidecarMinCPUMilli = 50
 )
 
 type Pool struct {
@@ -57,6 +73,77 @@ type Pool struct {
 	ctx context.Context
 }
 
+// ResourceBounds limits the resources applied to the processes of an app by
+// the vertical autoscaling recommendations, or the resources of sidecar and
+// init containers. Zero values mean no limit.
+type ResourceBounds struct {
+	MinMemory   int64
+	MaxMemory   int64
+	MinCPUMilli int
+	MaxCPUMilli int
+}
+
+// Clamp returns the memory and cpu values adjusted to the bounds.
+func (b ResourceBounds) Clamp(memory int64, cpuMilli int) (int64, int) {
+	if b.MinMemory > 0 && memory < b.MinMemory {
+		memory = b.MinMemory
+	}
+	if b.MaxMemory > 0 && memory > b.MaxMemory {
+		memory = b.MaxMemory
+	}
+	if b.MinCPUMilli > 0 && cpuMilli < b.MinCPUMilli {
+		cpuMilli = b.MinCPUMilli
+	}
+	if b.MaxCPUMilli > 0 && cpuMilli > b.MaxCPUMilli {
+		cpuMilli = b.MaxCPUMilli
+	}
+	return memory, cpuMilli
+}
+
+// ContainerResources returns the memory and cpu limits of a sidecar or init
+// container running alongside a process with the given plan. Values not
+// declared by the container default to the minimum values of the bounds,
+// declared values are raised to them, and every value is bounded by both the
+// plan and the maximum values of the bounds.
+func (b ResourceBounds) ContainerResources(planMemory int64, planCPUMilli int, r *provisionTypes.TsuruYamlKubernetesProcessResources) (int64, int, error) {
+	memory, cpuMilli := b.MinMemory, b.MinCPUMilli
+	if r != nil && r.Memory != "" {
+		q, err := resource.ParseQuantity(r.Memory)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid memory %q: %v", r.Memory, err)
+		}
+		if q.Value() > memory {
+			memory = q.Value()
+		}
+	}
+	if r != nil && r.CPU != "" {
+		q, err := resource.ParseQuantity(r.CPU)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid cpu %q: %v", r.CPU, err)
+		}
+		if int(q.MilliValue()) > cpuMilli {
+			cpuMilli = int(q.MilliValue())
+		}
+	}
+	maxMemory := minLimit(planMemory, b.MaxMemory)
+	maxCPUMilli := int(minLimit(int64(planCPUMilli), int64(b.MaxCPUMilli)))
+	if maxMemory > 0 && (memory == 0 || memory > maxMemory) {
+		memory = maxMemory
+	}
+	if maxCPUMilli > 0 && (cpuMilli == 0 || cpuMilli > maxCPUMilli) {
+		cpuMilli = maxCPUMilli
+	}
+	return memory, cpuMilli, nil
+}
+
+// minLimit returns the lowest of two limits, where zero means no limit.
+func minLimit(a, b int64) int64 {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
 type AddPoolOptions struct {
 	Name        string
 	Public      bool
@@ -87,6 +174,47 @@ func (p *Pool) GetAffinity() (*apiv1.Affinity, error) {
 	return nil, nil
 }
 
+// GetSpread returns the default spread of the units of apps in the pool, read
+// from the spread label in the same format used in tsuru.yaml.
+func (p *Pool) GetSpread() (*provisionTypes.TsuruYamlKubernetesSpread, error) {
+	spread, ok := p.Labels[spreadKey]
+	if !ok {
+		return nil, nil
+	}
+	var result provisionTypes.TsuruYamlKubernetesSpread
+	if err := yaml.Unmarshal([]byte(spread), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetNetworkPolicyMode returns the default network policy of apps in the
+// pool, read from the network-policy label.
+func (p *Pool) GetNetworkPolicyMode() (string, error) {
+	mode, ok := p.Labels[networkPolicyKey]
+	if !ok {
+		return provisionTypes.NetworkPolicyOpen, nil
+	}
+	if !provisionTypes.ValidNetworkPolicyMode(mode) {
+		return "", errors.Errorf("invalid network policy %q, must be one of: %s, %s, %s", mode, provisionTypes.NetworkPolicyOpen, provisionTypes.NetworkPolicyTeamIsolated, provisionTypes.NetworkPolicyDenyAll)
+	}
+	return mode, nil
+}
+
+// GetDriftAutoCorrect returns whether the resources of apps in the pool
+// changed outside of tsuru must be reverted to the ones tsuru generates.
+func (p *Pool) GetDriftAutoCorrect() (bool, error) {
+	value, ok := p.Labels[driftAutoCorrectKey]
+	if !ok {
+		return false, nil
+	}
+	autoCorrect, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Errorf("invalid drift auto correct %q, must be a boolean", value)
+	}
+	return autoCorrect, nil
+}
+
 func (p *Pool) GetBuildPlan() map[string]string {
 	if _, ok := p.Labels[buildPlanKey]; !ok {
 		return nil
@@ -100,6 +228,60 @@ func (p *Pool) GetBuildPlan() map[string]string {
 	return plans
 }
 
+// GetVPABounds returns the bounds for the vertical autoscaling
+// recommendations applied to apps in the pool, read from the vpa-min-memory,
+// vpa-max-memory, vpa-min-cpu and vpa-max-cpu labels.
+func (p *Pool) GetVPABounds() (ResourceBounds, error) {
+	return p.resourceBounds(vpaMinMemoryKey, vpaMaxMemoryKey, vpaMinCPUKey, vpaMaxCPUKey)
+}
+
+// GetSidecarBounds returns the minimum and maximum resources of each sidecar
+// and init container declared in tsuru.yaml by the apps in the pool, read
+// from the sidecar-min-memory, sidecar-max-memory, sidecar-min-cpu and
+// sidecar-max-cpu labels. The minimums default to 64Mi and 50m.
+func (p *Pool) GetSidecarBounds() (ResourceBounds, error) {
+	bounds, err := p.resourceBounds(sidecarMinMemoryKey, sidecarMaxMemoryKey, sidecarMinCPUKey, sidecarMaxCPUKey)
+	if err != nil {
+		return bounds, err
+	}
+	if _, ok := p.Labels[sidecarMinMemoryKey]; !ok {
+		bounds.MinMemory = defaultSidecarMinMemory
+	}
+	if _, ok := p.Labels[sidecarMinCPUKey]; !ok {
+		bounds.MinCPUMilli = defaultSidecarMinCPUMilli
+	}
+	return bounds, nil
+}
+
+func (p *Pool) resourceBounds(minMemoryKey, maxMemoryKey, minCPUKey, maxCPUKey string) (ResourceBounds, error) {
+	var bounds ResourceBounds
+	values := map[string]*resource.Quantity{}
+	for _, key := range []string{minMemoryKey, maxMemoryKey, minCPUKey, maxCPUKey} {
+		raw, ok := p.Labels[key]
+		if key == "" || !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(raw)
+		if err != nil {
+			return bounds, errors.Errorf("invalid value %q for pool label %q: %v", raw, key, err)
+		}
+		values[key] = &q
+	}
+	if q := values[minMemoryKey]; q != nil {
+		bounds.MinMemory = q.Value()
+	}
+	if q := values[maxMemoryKey]; q != nil {
+		bounds.MaxMemory = q.Value()
+	}
+	if q := values[minCPUKey]; q != nil {
+		bounds.MinCPUMilli = int(q.MilliValue())
+	}
+	if q := values[maxCPUKey]; q != nil {
+		bounds.MaxCPUMilli = int(q.MilliValue())
+	}
+	return bounds, nil
+}
+
 func (p *Pool) GetProvisioner() (provision.Provisioner, error) {
 	if p.Provisioner != "" {
 		return provision.Get(p.Provisioner)
@@ -153,6 +335,32 @@ func (p *Pool) GetPlans() ([]string, error) {
 	return nil, ErrPoolHasNoPlan
 }
 
+// AllowsRegistry returns whether images from the registry may be used by the
+// additional containers of apps in the pool. All registries are allowed when
+// the pool has no registry constraint.
+func (p *Pool) AllowsRegistry(registry string) (bool, error) {
+	constraints, err := getConstraintsForPool(p.Name, ConstraintTypeRegistry)
+	if err != nil {
+		return false, err
+	}
+	constraint := constraints[ConstraintTypeRegistry]
+	if constraint == nil || len(constraint.Values) == 0 {
+		return true, nil
+	}
+	return constraint.check(registry), nil
+}
+
+// AllowsDebugImage returns whether the image may be used by debug containers
+// attached to units of apps in the pool. No image is allowed when the pool
+// has no debug-image constraint.
+func (p *Pool) AllowsDebugImage(image string) (bool, error) {
+	constraints, err := getConstraintsForPool(p.Name, ConstraintTypeDebugImage)
+	if err != nil {
+		return false, err
+	}
+	return constraints[ConstraintTypeDebugImage].check(image), nil
+}
+
 func (p *Pool) GetDefaultPlan() (*appTypes.Plan, error) {
 	constraints, err := getConstraintsForPool(p.Name, ConstraintTypePlan)
 	if err != nil {
@@ -377,6 +585,22 @@ func validateLabels(labels map[string]string) error {
 			return err
 		}
 	}
+	if spreadStr, ok := labels[spreadKey]; ok {
+		var spread provisionTypes.TsuruYamlKubernetesSpread
+		if err := json.Unmarshal([]byte(spreadStr), &spread); err != nil {
+			return err
+		}
+	}
+	if _, ok := labels[networkPolicyKey]; ok {
+		if _, err := (&Pool{Labels: labels}).GetNetworkPolicyMode(); err != nil {
+			return err
+		}
+	}
+	if _, ok := labels[driftAutoCorrectKey]; ok {
+		if _, err := (&Pool{Labels: labels}).GetDriftAutoCorrect(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
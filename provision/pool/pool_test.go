@@ -22,6 +22,7 @@ import (
 	_ "github.com/tsuru/tsuru/storage/mongodb"
 	appTypes "github.com/tsuru/tsuru/types/app"
 	authTypes "github.com/tsuru/tsuru/types/auth"
+	provisionTypes "github.com/tsuru/tsuru/types/provision"
 	volumeTypes "github.com/tsuru/tsuru/types/volume"
 	check "gopkg.in/check.v1"
 	apiv1 "k8s.io/api/core/v1"
@@ -718,6 +719,48 @@ func (s *S) TestGetPlans(c *check.C) {
 	c.Assert(plans, check.DeepEquals, []string{"plan1", "plan2"})
 }
 
+func (s *S) TestAllowsRegistry(c *check.C) {
+	err := AddPool(context.TODO(), AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	pool, err := GetPoolByName(context.TODO(), "pool1")
+	c.Assert(err, check.IsNil)
+	allowed, err := pool.AllowsRegistry("docker.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	err = SetPoolConstraint(&PoolConstraint{PoolExpr: "pool*", Field: ConstraintTypeRegistry, Values: []string{"*.gcr.io", "registry.example.com"}})
+	c.Assert(err, check.IsNil)
+	allowed, err = pool.AllowsRegistry("docker.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+	allowed, err = pool.AllowsRegistry("us.gcr.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	allowed, err = pool.AllowsRegistry("registry.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+}
+
+func (s *S) TestAllowsDebugImage(c *check.C) {
+	err := AddPool(context.TODO(), AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	pool, err := GetPoolByName(context.TODO(), "pool1")
+	c.Assert(err, check.IsNil)
+	allowed, err := pool.AllowsDebugImage("busybox")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+	err = SetPoolConstraint(&PoolConstraint{PoolExpr: "pool*", Field: ConstraintTypeDebugImage, Values: []string{"busybox", "nicolaka/netshoot:*"}})
+	c.Assert(err, check.IsNil)
+	allowed, err = pool.AllowsDebugImage("busybox")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	allowed, err = pool.AllowsDebugImage("nicolaka/netshoot:v0.8")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	allowed, err = pool.AllowsDebugImage("ubuntu")
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+}
+
 func (s *S) TestGetDefaultRouterFromConstraint(c *check.C) {
 	config.Set("routers:router1:type", "hipache")
 	config.Set("routers:router2:type", "hipache")
@@ -874,6 +917,55 @@ func (s *S) TestGetProvisionerForPool(c *check.C) {
 	c.Assert(err, check.Equals, ErrPoolNotFound)
 }
 
+func (s *S) TestGetSpread(c *check.C) {
+	p := Pool{Name: "pool1"}
+	spread, err := p.GetSpread()
+	c.Assert(err, check.IsNil)
+	c.Assert(spread, check.IsNil)
+	p.Labels = map[string]string{spreadKey: `{"topology_spread": [{"topology": "zone", "max_skew": 1}], "anti_affinity": "preferred"}`}
+	spread, err = p.GetSpread()
+	c.Assert(err, check.IsNil)
+	c.Assert(spread, check.DeepEquals, &provisionTypes.TsuruYamlKubernetesSpread{
+		TopologySpread: []provisionTypes.TsuruYamlKubernetesTopologySpread{
+			{Topology: "zone", MaxSkew: 1},
+		},
+		AntiAffinity: "preferred",
+	})
+	p.Labels = map[string]string{spreadKey: `{"topology_spread": 1}`}
+	_, err = p.GetSpread()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestGetNetworkPolicyMode(c *check.C) {
+	p := Pool{Name: "pool1"}
+	mode, err := p.GetNetworkPolicyMode()
+	c.Assert(err, check.IsNil)
+	c.Assert(mode, check.Equals, "open")
+	p.Labels = map[string]string{networkPolicyKey: "team-isolated"}
+	mode, err = p.GetNetworkPolicyMode()
+	c.Assert(err, check.IsNil)
+	c.Assert(mode, check.Equals, "team-isolated")
+	p.Labels = map[string]string{networkPolicyKey: "closed"}
+	_, err = p.GetNetworkPolicyMode()
+	c.Assert(err, check.ErrorMatches, `invalid network policy "closed", must be one of: open, team-isolated, deny-all`)
+	c.Assert(validateLabels(p.Labels), check.NotNil)
+}
+
+func (s *S) TestGetDriftAutoCorrect(c *check.C) {
+	p := Pool{Name: "pool1"}
+	autoCorrect, err := p.GetDriftAutoCorrect()
+	c.Assert(err, check.IsNil)
+	c.Assert(autoCorrect, check.Equals, false)
+	p.Labels = map[string]string{driftAutoCorrectKey: "true"}
+	autoCorrect, err = p.GetDriftAutoCorrect()
+	c.Assert(err, check.IsNil)
+	c.Assert(autoCorrect, check.Equals, true)
+	p.Labels = map[string]string{driftAutoCorrectKey: "sometimes"}
+	_, err = p.GetDriftAutoCorrect()
+	c.Assert(err, check.ErrorMatches, `invalid drift auto correct "sometimes", must be a boolean`)
+	c.Assert(validateLabels(p.Labels), check.NotNil)
+}
+
 func (s *S) TestGetAffinity(c *check.C) {
 	tt := []struct {
 		testName  string
@@ -928,3 +1020,79 @@ func (s *S) TestGetAffinity(c *check.C) {
 		t.assertion(t.testName, c, affinity, err)
 	}
 }
+
+func (s *S) TestGetVPABounds(c *check.C) {
+	p := Pool{Name: "pool1", Labels: map[string]string{
+		"vpa-min-memory": "128Mi",
+		"vpa-max-memory": "2Gi",
+		"vpa-max-cpu":    "2",
+	}}
+	bounds, err := p.GetVPABounds()
+	c.Assert(err, check.IsNil)
+	c.Assert(bounds, check.DeepEquals, ResourceBounds{
+		MinMemory:   128 * 1024 * 1024,
+		MaxMemory:   2 * 1024 * 1024 * 1024,
+		MaxCPUMilli: 2000,
+	})
+	memory, cpu := bounds.Clamp(64*1024*1024, 3000)
+	c.Assert(memory, check.Equals, int64(128*1024*1024))
+	c.Assert(cpu, check.Equals, 2000)
+	memory, cpu = bounds.Clamp(512*1024*1024, 50)
+	c.Assert(memory, check.Equals, int64(512*1024*1024))
+	c.Assert(cpu, check.Equals, 50)
+	p.Labels["vpa-min-cpu"] = "abc"
+	_, err = p.GetVPABounds()
+	c.Assert(err, check.ErrorMatches, `invalid value "abc" for pool label "vpa-min-cpu".*`)
+}
+
+func (s *S) TestGetSidecarBounds(c *check.C) {
+	p := Pool{Name: "pool1", Labels: map[string]string{
+		"sidecar-max-memory": "256Mi",
+		"sidecar-max-cpu":    "500m",
+		"vpa-max-cpu":        "2",
+	}}
+	bounds, err := p.GetSidecarBounds()
+	c.Assert(err, check.IsNil)
+	c.Assert(bounds, check.DeepEquals, ResourceBounds{
+		MinMemory:   64 * 1024 * 1024,
+		MaxMemory:   256 * 1024 * 1024,
+		MinCPUMilli: 50,
+		MaxCPUMilli: 500,
+	})
+	p.Labels["sidecar-min-memory"] = "32Mi"
+	p.Labels["sidecar-min-cpu"] = "0"
+	bounds, err = p.GetSidecarBounds()
+	c.Assert(err, check.IsNil)
+	c.Assert(bounds, check.DeepEquals, ResourceBounds{
+		MinMemory:   32 * 1024 * 1024,
+		MaxMemory:   256 * 1024 * 1024,
+		MaxCPUMilli: 500,
+	})
+}
+
+func (s *S) TestResourceBoundsContainerResources(c *check.C) {
+	bounds := ResourceBounds{MaxMemory: 256 * 1024 * 1024, MaxCPUMilli: 500}
+	memory, cpu, err := bounds.ContainerResources(1024*1024*1024, 200, &provisionTypes.TsuruYamlKubernetesProcessResources{Memory: "64Mi", CPU: "1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(memory, check.Equals, int64(64*1024*1024))
+	c.Assert(cpu, check.Equals, 200)
+	memory, cpu, err = bounds.ContainerResources(1024*1024*1024, 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(memory, check.Equals, int64(256*1024*1024))
+	c.Assert(cpu, check.Equals, 500)
+	memory, cpu, err = ResourceBounds{}.ContainerResources(0, 0, &provisionTypes.TsuruYamlKubernetesProcessResources{Memory: "64Mi"})
+	c.Assert(err, check.IsNil)
+	c.Assert(memory, check.Equals, int64(64*1024*1024))
+	c.Assert(cpu, check.Equals, 0)
+	bounds = ResourceBounds{MinMemory: 64 * 1024 * 1024, MaxMemory: 256 * 1024 * 1024, MinCPUMilli: 50, MaxCPUMilli: 500}
+	memory, cpu, err = bounds.ContainerResources(1024*1024*1024, 1000, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(memory, check.Equals, int64(64*1024*1024))
+	c.Assert(cpu, check.Equals, 50)
+	memory, cpu, err = bounds.ContainerResources(1024*1024*1024, 20, &provisionTypes.TsuruYamlKubernetesProcessResources{Memory: "32Mi", CPU: "100m"})
+	c.Assert(err, check.IsNil)
+	c.Assert(memory, check.Equals, int64(64*1024*1024))
+	c.Assert(cpu, check.Equals, 20)
+	_, _, err = bounds.ContainerResources(0, 0, &provisionTypes.TsuruYamlKubernetesProcessResources{Memory: "lots"})
+	c.Assert(err, check.ErrorMatches, `invalid memory "lots".*`)
+}
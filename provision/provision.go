@@ -25,7 +25,9 @@ import (
 	appTypes "github.com/tsuru/tsuru/types/app"
 	imgTypes "github.com/tsuru/tsuru/types/app/image"
 	provTypes "github.com/tsuru/tsuru/types/provision"
+	"github.com/tsuru/tsuru/types/quota"
 	volumeTypes "github.com/tsuru/tsuru/types/volume"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
@@ -43,6 +45,10 @@ var (
 	ErrEmptyApp      = errors.New("no units for this app")
 	ErrNodeNotFound  = errors.New("node not found")
 
+	// ErrAppNotProvisioned is returned by provisioners destroying an app
+	// which does not exist in them.
+	ErrAppNotProvisioned = errors.New("app is not provisioned")
+
 	ErrLogsUnavailable = errors.New("logs from provisioner are unavailable")
 	DefaultProvisioner = defaultDockerProvisioner
 )
@@ -246,6 +252,9 @@ type App interface {
 
 	GetMemory() int64
 	GetMilliCPU() int
+	GetProcessMemory(process string) int64
+	GetProcessMilliCPU(process string) int
+	GetProcessPlanOverride(process string) *appTypes.PlanOverride
 	GetSwap() int64
 	GetCpuShare() int
 
@@ -255,6 +264,10 @@ type App interface {
 
 	GetPool() string
 
+	// GetCluster returns the cluster the app is pinned to, apps not pinned
+	// to a cluster run in the cluster serving their pool.
+	GetCluster() string
+
 	GetTeamOwner() string
 	GetTeamsName() []string
 
@@ -314,6 +327,9 @@ type DeployArgs struct {
 	Event            *event.Event
 	PreserveVersions bool
 	OverrideVersions bool
+	// DryRun indicates that the changes to the provisioner resources must
+	// only be computed, without being applied.
+	DryRun bool
 }
 
 // BuilderDeploy is a provisioner that allows deploy builded image.
@@ -404,6 +420,57 @@ type ExecutableProvisioner interface {
 	ExecuteCommand(ctx context.Context, opts ExecOptions) error
 }
 
+// PortForwardOptions holds the unit and port a connection is forwarded to,
+// data read from Stream is sent to the unit port and data received from it
+// is written to Stream.
+type PortForwardOptions struct {
+	Unit   string
+	Port   int
+	Stream io.ReadWriter
+}
+
+// PortForwardProvisioner is a provisioner able to forward a connection to a
+// port of an app unit.
+type PortForwardProvisioner interface {
+	PortForward(ctx context.Context, a App, opts PortForwardOptions) error
+}
+
+// DebugOptions holds the options to attach a debug container to a unit, the
+// container shares the process namespace of the app container and its
+// terminal is attached to the given streams.
+type DebugOptions struct {
+	Unit   string
+	Image  string
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	Width  int
+	Height int
+	Term   string
+}
+
+// DebugProvisioner is a provisioner able to attach ephemeral debug containers
+// to app units.
+type DebugProvisioner interface {
+	Debug(ctx context.Context, a App, opts DebugOptions) error
+}
+
+// UnitFileCopyOptions holds the unit and the path in it files are copied to
+// or from, files are transferred as a tar stream.
+type UnitFileCopyOptions struct {
+	Unit string
+	Path string
+}
+
+// UnitFileCopyProvisioner is a provisioner able to copy files to and from
+// app units.
+type UnitFileCopyProvisioner interface {
+	// UploadToUnit extracts the tar stream into the directory at Path.
+	UploadToUnit(ctx context.Context, a App, opts UnitFileCopyOptions, tarStream io.Reader) error
+	// DownloadFromUnit writes the file or directory at Path as a tar stream.
+	DownloadFromUnit(ctx context.Context, a App, opts UnitFileCopyOptions, tarStream io.Writer) error
+}
+
 // LogsProvisioner is a provisioner that is self responsible for storage logs.
 type LogsProvisioner interface {
 	ListLogs(ctx context.Context, app appTypes.App, args appTypes.ListLogArgs) ([]appTypes.Applog, error)
@@ -431,12 +498,70 @@ type UpdatableProvisioner interface {
 	UpdateApp(ctx context.Context, old, new App, w io.Writer) error
 }
 
+// AppValidatorProvisioner is a provisioner that validates the provisioner
+// specific settings of apps, like annotations, before they are saved.
+type AppValidatorProvisioner interface {
+	ValidateApp(ctx context.Context, a App) error
+}
+
 // InterAppProvisioner is a provisioner that allows an app to comunicate with each other
 // using internal dns and own load balancers provided by provisioner.
 type InterAppProvisioner interface {
 	InternalAddresses(ctx context.Context, a App) ([]AppInternalAddress, error)
 }
 
+// NetworkPolicyProvisioner is a provisioner that isolates the network traffic
+// of apps.
+type NetworkPolicyProvisioner interface {
+	NetworkPolicy(ctx context.Context, a App) (*provTypes.EffectiveNetworkPolicy, error)
+	EnsureNetworkPolicy(ctx context.Context, a App) error
+}
+
+const (
+	ManifestCreate = "create"
+	ManifestUpdate = "update"
+	ManifestDelete = "delete"
+)
+
+// ManifestChange is a change to a provisioner resource, reported by a
+// dry-run. Manifest holds the resource as it would be after the change and
+// Diff holds the differences to the resource currently live.
+type ManifestChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Manifest  string `json:"manifest,omitempty"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// DryRunProvisioner is a provisioner that reports the changes a deploy would
+// apply to its resources, without applying them.
+type DryRunProvisioner interface {
+	DryRun(ctx context.Context, args DeployArgs) ([]ManifestChange, error)
+}
+
+// DriftProvisioner is a provisioner that reports the changes made to the
+// resources of an app outside of tsuru, as the changes tsuru would apply to
+// bring them back to the expected state.
+type DriftProvisioner interface {
+	Drift(ctx context.Context, a App) ([]ManifestChange, error)
+}
+
+// TeamResourceQuotaProvisioner is a provisioner that enforces the resource
+// quotas of teams in its clusters and reports the resources reserved for
+// their units.
+type TeamResourceQuotaProvisioner interface {
+	SyncTeamResourceQuotas(ctx context.Context, team string) error
+	TeamResourceRequests(ctx context.Context, team, pool string) (quota.Resources, error)
+}
+
+// CapacityProvisioner is a provisioner that reports the capacity of the
+// nodes of a cluster and how it's allocated to units.
+type CapacityProvisioner interface {
+	ClusterCapacity(ctx context.Context, cluster *provTypes.Cluster) (*provTypes.ClusterCapacity, error)
+}
+
 type AppInternalAddress struct {
 	Domain   string
 	Protocol string
@@ -577,11 +702,85 @@ type CleanImageProvisioner interface {
 }
 
 type AutoScaleSpec struct {
-	Process    string `json:"process"`
-	MinUnits   uint   `json:"minUnits"`
-	MaxUnits   uint   `json:"maxUnits"`
-	AverageCPU string `json:"averageCPU"`
-	Version    int    `json:"version"`
+	Process    string            `json:"process"`
+	MinUnits   uint              `json:"minUnits"`
+	MaxUnits   uint              `json:"maxUnits"`
+	AverageCPU string            `json:"averageCPU"`
+	Metrics    []AutoScaleMetric `json:"metrics,omitempty"`
+	Version    int               `json:"version"`
+}
+
+type AutoScaleMetricType string
+
+const (
+	// AutoScaleMetricMemory scales on the memory used by the units, the
+	// target is either a percentage of the memory limit ("80%") or an
+	// average amount of memory per unit ("512Mi").
+	AutoScaleMetricMemory = AutoScaleMetricType("memory")
+	// AutoScaleMetricPods scales on a custom metric reported for each unit,
+	// like requests per second, the target is the average value per unit.
+	AutoScaleMetricPods = AutoScaleMetricType("pods")
+	// AutoScaleMetricExternal scales on a metric not related to the units,
+	// like the length of a queue. The target is the total value, or the
+	// value per unit when Average is set.
+	AutoScaleMetricExternal = AutoScaleMetricType("external")
+)
+
+type AutoScaleMetric struct {
+	Type     AutoScaleMetricType `json:"type"`
+	Name     string              `json:"name,omitempty"`
+	Selector map[string]string   `json:"selector,omitempty"`
+	Target   string              `json:"target"`
+	Average  bool                `json:"average,omitempty"`
+}
+
+// MemoryUtilization returns the memory target as a percentage of the memory
+// limit, ok is false when the target is an absolute value.
+func (m AutoScaleMetric) MemoryUtilization() (value int, ok bool, err error) {
+	if !strings.HasSuffix(m.Target, "%") {
+		return 0, false, nil
+	}
+	value, err = strconv.Atoi(strings.TrimSuffix(m.Target, "%"))
+	if err != nil || value <= 0 || value > 100 {
+		return 0, true, errors.Errorf("unable to parse value %q as autoscale memory percentage", m.Target)
+	}
+	return value, true, nil
+}
+
+// TargetQuantity returns the absolute target value of the metric.
+func (m AutoScaleMetric) TargetQuantity() (resource.Quantity, error) {
+	q, err := resource.ParseQuantity(m.Target)
+	if err != nil {
+		return q, errors.Errorf("unable to parse value %q as autoscale %s metric target", m.Target, m.Type)
+	}
+	if q.Sign() <= 0 {
+		return q, errors.Errorf("autoscale %s metric target must be greater than 0", m.Type)
+	}
+	return q, nil
+}
+
+func (m AutoScaleMetric) Validate(a App, process string) error {
+	switch m.Type {
+	case AutoScaleMetricMemory:
+		_, isUtilization, err := m.MemoryUtilization()
+		if err != nil {
+			return err
+		}
+		if isUtilization {
+			if a == nil || a.GetProcessMemory(process) == 0 {
+				return errors.New("autoscale memory percentage requires the app to have a memory limit")
+			}
+			return nil
+		}
+	case AutoScaleMetricPods, AutoScaleMetricExternal:
+		if m.Name == "" {
+			return errors.Errorf("autoscale %s metric requires a name", m.Type)
+		}
+	default:
+		return errors.Errorf("invalid autoscale metric type %q, must be one of: memory, pods, external", m.Type)
+	}
+	_, err := m.TargetQuantity()
+	return err
 }
 
 type RecommendedResources struct {
@@ -595,6 +794,38 @@ type RecommendedProcessResources struct {
 	Memory string `json:"memory"`
 }
 
+// ProcessResources returns the memory and cpu limits of a process. The
+// resources declared in tsuru.yaml apply when no plan override is set for the
+// process through the API, and they're bounded by the app plan, so deploying
+// can only lower the resources the app team is charged for.
+func ProcessResources(a App, process string, r *provTypes.TsuruYamlKubernetesProcessResources) (int64, int, error) {
+	memory := a.GetProcessMemory(process)
+	cpuMilli := a.GetProcessMilliCPU(process)
+	if r == nil {
+		return memory, cpuMilli, nil
+	}
+	override := a.GetProcessPlanOverride(process)
+	if r.Memory != "" && (override == nil || override.Memory == nil) {
+		q, err := resource.ParseQuantity(r.Memory)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid memory %q for process %q in tsuru.yaml: %v", r.Memory, process, err)
+		}
+		if q.Value() > 0 && (memory == 0 || q.Value() < memory) {
+			memory = q.Value()
+		}
+	}
+	if r.CPU != "" && (override == nil || override.CPUMilli == nil) {
+		q, err := resource.ParseQuantity(r.CPU)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid cpu %q for process %q in tsuru.yaml: %v", r.CPU, process, err)
+		}
+		if q.MilliValue() > 0 && (cpuMilli == 0 || int(q.MilliValue()) < cpuMilli) {
+			cpuMilli = int(q.MilliValue())
+		}
+	}
+	return memory, cpuMilli, nil
+}
+
 func (s AutoScaleSpec) ToCPUValue(a App) (int, error) {
 	rawCPU := strings.TrimSuffix(s.AverageCPU, "%")
 	cpu, err := strconv.Atoi(rawCPU)
@@ -607,7 +838,7 @@ func (s AutoScaleSpec) ToCPUValue(a App) (int, error) {
 		cpu = cpu / 10
 	}
 
-	cpuLimit := a.GetMilliCPU()
+	cpuLimit := a.GetProcessMilliCPU(s.Process)
 	if cpuLimit == 0 {
 		// No cpu limit is set in app, the AverageCPU value must be considered
 		// as absolute milli cores and we cannot validate it.
@@ -635,9 +866,20 @@ func (s AutoScaleSpec) Validate(quotaLimit int, a App) error {
 	if quotaLimit > 0 && s.MaxUnits > uint(quotaLimit) {
 		return errors.New("maximum units cannot be greater than quota limit")
 	}
-	_, err := s.ToCPUValue(a)
-	if err != nil {
-		return err
+	if s.AverageCPU == "" && len(s.Metrics) == 0 {
+		return errors.New("at least one autoscale metric is required")
+	}
+	if s.AverageCPU != "" {
+		_, err := s.ToCPUValue(a)
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range s.Metrics {
+		err := m.Validate(a, s.Process)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -649,6 +891,19 @@ type AutoScaleProvisioner interface {
 	RemoveAutoScale(ctx context.Context, a App, process string) error
 }
 
+// OvercommitFactors are the ratios between the plan of a process, which is
+// the limit of its units, and the resources requested by each unit.
+type OvercommitFactors struct {
+	Memory float64
+	CPU    float64
+}
+
+// OvercommitProvisioner is a provisioner whose units request a fraction of
+// the resources in their plan.
+type OvercommitProvisioner interface {
+	OvercommitFactors(ctx context.Context, a App) (OvercommitFactors, error)
+}
+
 type Node interface {
 	Pool() string
 	IaaSID() string
@@ -235,3 +235,29 @@ func (ProvisionSuite) TestValidate(c *check.C) {
 		c.Check(err, check.ErrorMatches, test.expected)
 	}
 }
+
+func (ProvisionSuite) TestValidateMetrics(c *check.C) {
+	var tests = []struct {
+		metrics  []AutoScaleMetric
+		expected string
+	}{
+		{nil, "at least one autoscale metric is required"},
+		{[]AutoScaleMetric{{Type: "disk", Target: "1"}}, `invalid autoscale metric type "disk", must be one of: memory, pods, external`},
+		{[]AutoScaleMetric{{Type: AutoScaleMetricMemory, Target: "120%"}}, `unable to parse value "120%" as autoscale memory percentage`},
+		{[]AutoScaleMetric{{Type: AutoScaleMetricMemory, Target: "80%"}}, "autoscale memory percentage requires the app to have a memory limit"},
+		{[]AutoScaleMetric{{Type: AutoScaleMetricMemory, Target: "abc"}}, `unable to parse value "abc" as autoscale memory metric target`},
+		{[]AutoScaleMetric{{Type: AutoScaleMetricPods, Target: "10"}}, "autoscale pods metric requires a name"},
+		{[]AutoScaleMetric{{Type: AutoScaleMetricExternal, Name: "queue", Target: "0"}}, "autoscale external metric target must be greater than 0"},
+	}
+	for _, test := range tests {
+		spec := AutoScaleSpec{MinUnits: 1, MaxUnits: 2, Metrics: test.metrics}
+		err := spec.Validate(10, nil)
+		c.Check(err, check.ErrorMatches, test.expected)
+	}
+	spec := AutoScaleSpec{MinUnits: 1, MaxUnits: 2, Metrics: []AutoScaleMetric{
+		{Type: AutoScaleMetricMemory, Target: "512Mi"},
+		{Type: AutoScaleMetricPods, Name: "rps", Target: "100"},
+		{Type: AutoScaleMetricExternal, Name: "queue", Target: "30"},
+	}}
+	c.Assert(spec.Validate(10, nil), check.IsNil)
+}
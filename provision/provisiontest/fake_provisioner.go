@@ -41,6 +41,12 @@ var (
 	_ provision.NodeProvisioner          = &FakeProvisioner{}
 	_ provision.NodeContainerProvisioner = &FakeProvisioner{}
 	_ provision.InterAppProvisioner      = &FakeProvisioner{}
+	_ provision.NetworkPolicyProvisioner = &FakeProvisioner{}
+	_ provision.DryRunProvisioner        = &FakeProvisioner{}
+	_ provision.DriftProvisioner         = &FakeProvisioner{}
+	_ provision.PortForwardProvisioner   = &FakeProvisioner{}
+	_ provision.UnitFileCopyProvisioner  = &FakeProvisioner{}
+	_ provision.DebugProvisioner         = &FakeProvisioner{}
 	_ provision.UpdatableProvisioner     = &FakeProvisioner{}
 	_ provision.Provisioner              = &FakeProvisioner{}
 	_ provision.LogsProvisioner          = &FakeProvisioner{}
@@ -77,6 +83,8 @@ type FakeApp struct {
 	Swap              int64
 	CpuShare          int
 	MilliCPU          int
+	ProcessMemory     map[string]int64
+	ProcessMilliCPU   map[string]int
 	commMut           sync.Mutex
 	Deploys           uint
 	env               map[string]bind.EnvVar
@@ -85,6 +93,7 @@ type FakeApp struct {
 	serviceEnvs       []bind.ServiceEnvVar
 	serviceLock       sync.Mutex
 	Pool              string
+	Cluster           string
 	UpdatePlatform    bool
 	TeamOwner         string
 	Teams             []string
@@ -131,6 +140,36 @@ func (a *FakeApp) GetMemory() int64 {
 	return a.Memory
 }
 
+func (a *FakeApp) GetProcessMilliCPU(process string) int {
+	if cpu, ok := a.ProcessMilliCPU[process]; ok {
+		return cpu
+	}
+	return a.MilliCPU
+}
+
+func (a *FakeApp) GetProcessMemory(process string) int64 {
+	if memory, ok := a.ProcessMemory[process]; ok {
+		return memory
+	}
+	return a.Memory
+}
+
+func (a *FakeApp) GetProcessPlanOverride(process string) *appTypes.PlanOverride {
+	memory, hasMemory := a.ProcessMemory[process]
+	cpu, hasCPU := a.ProcessMilliCPU[process]
+	if !hasMemory && !hasCPU {
+		return nil
+	}
+	var po appTypes.PlanOverride
+	if hasMemory {
+		po.Memory = &memory
+	}
+	if hasCPU {
+		po.CPUMilli = &cpu
+	}
+	return &po
+}
+
 func (a *FakeApp) GetSwap() int64 {
 	return a.Swap
 }
@@ -273,6 +312,10 @@ func (a *FakeApp) GetPool() string {
 	return a.Pool
 }
 
+func (a *FakeApp) GetCluster() string {
+	return a.Cluster
+}
+
 func (a *FakeApp) GetPlatform() string {
 	return a.platform
 }
@@ -397,6 +440,7 @@ type FakeProvisioner struct {
 	mut            sync.RWMutex
 	execs          map[string][]provision.ExecOptions
 	execsMut       sync.Mutex
+	debugs         map[string][]provision.DebugOptions
 	nodes          map[string]FakeNode
 	nodeContainers map[string]int
 }
@@ -407,6 +451,7 @@ func NewFakeProvisioner() *FakeProvisioner {
 	p.failures = make(chan failure, 8)
 	p.apps = make(map[string]provisionedApp)
 	p.execs = make(map[string][]provision.ExecOptions)
+	p.debugs = make(map[string][]provision.DebugOptions)
 	p.nodes = make(map[string]FakeNode)
 	p.nodeContainers = make(map[string]int)
 	return &p
@@ -786,6 +831,13 @@ func (p *FakeProvisioner) Execs(unit string) []provision.ExecOptions {
 	return p.execs[unit]
 }
 
+// Debugs returns the debug sessions of the unit.
+func (p *FakeProvisioner) Debugs(unit string) []provision.DebugOptions {
+	p.execsMut.Lock()
+	defer p.execsMut.Unlock()
+	return p.debugs[unit]
+}
+
 // AllExecs return all exec calls to all units.
 func (p *FakeProvisioner) AllExecs() map[string][]provision.ExecOptions {
 	p.execsMut.Lock()
@@ -856,6 +908,7 @@ func (p *FakeProvisioner) Reset() {
 
 	p.execsMut.Lock()
 	p.execs = make(map[string][]provision.ExecOptions)
+	p.debugs = make(map[string][]provision.DebugOptions)
 	p.execsMut.Unlock()
 
 	p.mut.Lock()
@@ -1318,6 +1371,99 @@ func (p *FakeProvisioner) RegisterUnit(ctx context.Context, a provision.App, uni
 	return &provision.UnitNotFoundError{ID: unitId}
 }
 
+// PortForward forwards the connection to a fake unit that echoes back the data
+// it receives.
+func (p *FakeProvisioner) PortForward(ctx context.Context, app provision.App, opts provision.PortForwardOptions) error {
+	if err := p.getError("PortForward"); err != nil {
+		return err
+	}
+	p.mut.RLock()
+	pApp, ok := p.apps[app.GetName()]
+	p.mut.RUnlock()
+	if !ok {
+		return errNotProvisioned
+	}
+	for _, u := range pApp.units {
+		if u.ID == opts.Unit {
+			_, err := io.Copy(opts.Stream, opts.Stream)
+			return err
+		}
+	}
+	return &provision.UnitNotFoundError{ID: opts.Unit}
+}
+
+// UploadToUnit stores the tar stream, it's returned by DownloadFromUnit for
+// the same unit and path.
+func (p *FakeProvisioner) UploadToUnit(ctx context.Context, app provision.App, opts provision.UnitFileCopyOptions, tarStream io.Reader) error {
+	if err := p.getError("UploadToUnit"); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(tarStream)
+	if err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, err := p.appWithUnit(app, opts.Unit)
+	if err != nil {
+		return err
+	}
+	if pApp.files == nil {
+		pApp.files = make(map[string][]byte)
+	}
+	pApp.files[opts.Unit+":"+opts.Path] = data
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+func (p *FakeProvisioner) DownloadFromUnit(ctx context.Context, app provision.App, opts provision.UnitFileCopyOptions, tarStream io.Writer) error {
+	if err := p.getError("DownloadFromUnit"); err != nil {
+		return err
+	}
+	p.mut.RLock()
+	pApp, err := p.appWithUnit(app, opts.Unit)
+	p.mut.RUnlock()
+	if err != nil {
+		return err
+	}
+	data, ok := pApp.files[opts.Unit+":"+opts.Path]
+	if !ok {
+		return errors.Errorf("%s: no such file or directory", opts.Path)
+	}
+	_, err = tarStream.Write(data)
+	return err
+}
+
+func (p *FakeProvisioner) appWithUnit(app provision.App, unitID string) (provisionedApp, error) {
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return pApp, errNotProvisioned
+	}
+	for _, u := range pApp.units {
+		if u.ID == unitID {
+			return pApp, nil
+		}
+	}
+	return pApp, &provision.UnitNotFoundError{ID: unitID}
+}
+
+// Debug records the debug session, returned by Debugs for the unit.
+func (p *FakeProvisioner) Debug(ctx context.Context, app provision.App, opts provision.DebugOptions) error {
+	if err := p.getError("Debug"); err != nil {
+		return err
+	}
+	p.mut.RLock()
+	_, err := p.appWithUnit(app, opts.Unit)
+	p.mut.RUnlock()
+	if err != nil {
+		return err
+	}
+	p.execsMut.Lock()
+	defer p.execsMut.Unlock()
+	p.debugs[opts.Unit] = append(p.debugs[opts.Unit], opts)
+	return nil
+}
+
 func (p *FakeProvisioner) ExecuteCommand(ctx context.Context, opts provision.ExecOptions) error {
 	p.execsMut.Lock()
 	defer p.execsMut.Unlock()
@@ -1411,6 +1557,72 @@ func (p *FakeProvisioner) UpdateApp(ctx context.Context, old, new provision.App,
 	return nil
 }
 
+func (p *FakeProvisioner) NetworkPolicy(ctx context.Context, a provision.App) (*provTypes.EffectiveNetworkPolicy, error) {
+	policy := (&provTypes.NetworkPolicy{}).Effective(provTypes.NetworkPolicyOpen, a.GetTeamOwner())
+	return &policy, nil
+}
+
+func (p *FakeProvisioner) EnsureNetworkPolicy(ctx context.Context, a provision.App) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[a.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	pApp.networkPolicyUpdates++
+	p.apps[a.GetName()] = pApp
+	return nil
+}
+
+// NetworkPolicyUpdates returns the number of times the network policy of the
+// app was reconciled.
+func (p *FakeProvisioner) NetworkPolicyUpdates(a provision.App) int {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[a.GetName()].networkPolicyUpdates
+}
+
+func (p *FakeProvisioner) MockDrift(app provision.App, changes []provision.ManifestChange) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	a := p.apps[app.GetName()]
+	a.drift = changes
+	p.apps[app.GetName()] = a
+}
+
+func (p *FakeProvisioner) Drift(ctx context.Context, app provision.App) ([]provision.ManifestChange, error) {
+	if err := p.getError("Drift"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].drift, nil
+}
+
+func (p *FakeProvisioner) DryRun(ctx context.Context, args provision.DeployArgs) ([]provision.ManifestChange, error) {
+	if err := p.getError("DryRun"); err != nil {
+		return nil, err
+	}
+	processes, err := args.Version.Processes()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var changes []provision.ManifestChange
+	for _, name := range names {
+		changes = append(changes, provision.ManifestChange{
+			Kind:      "Deployment",
+			Name:      fmt.Sprintf("%s-%s", args.App.GetName(), name),
+			Operation: provision.ManifestUpdate,
+		})
+	}
+	return changes, nil
+}
+
 func (p *FakeProvisioner) InternalAddresses(ctx context.Context, a provision.App) ([]provision.AppInternalAddress, error) {
 	return []provision.AppInternalAddress{
 		{
@@ -1526,14 +1738,30 @@ type provisionedApp struct {
 	lastData  map[string]interface{}
 	image     string
 	mockAddrs []appTypes.RoutableAddresses
+	drift     []provision.ManifestChange
+	files     map[string][]byte
+
+	networkPolicyUpdates int
 }
 
 type AutoScaleProvisioner struct {
 	*FakeProvisioner
-	autoscales map[string][]provision.AutoScaleSpec
+	autoscales      map[string][]provision.AutoScaleSpec
+	Recommendations []provision.RecommendedResources
+	Overcommit      *provision.OvercommitFactors
 }
 
-var _ provision.AutoScaleProvisioner = &AutoScaleProvisioner{}
+var (
+	_ provision.AutoScaleProvisioner  = &AutoScaleProvisioner{}
+	_ provision.OvercommitProvisioner = &AutoScaleProvisioner{}
+)
+
+func (p *AutoScaleProvisioner) OvercommitFactors(ctx context.Context, app provision.App) (provision.OvercommitFactors, error) {
+	if p.Overcommit != nil {
+		return *p.Overcommit, nil
+	}
+	return provision.OvercommitFactors{Memory: 1, CPU: 1}, nil
+}
 
 func (p *AutoScaleProvisioner) GetAutoScale(ctx context.Context, app provision.App) ([]provision.AutoScaleSpec, error) {
 	if p.autoscales == nil {
@@ -1543,6 +1771,9 @@ func (p *AutoScaleProvisioner) GetAutoScale(ctx context.Context, app provision.A
 }
 
 func (p *AutoScaleProvisioner) GetVerticalAutoScaleRecommendations(ctx context.Context, app provision.App) ([]provision.RecommendedResources, error) {
+	if p.Recommendations != nil {
+		return p.Recommendations, nil
+	}
 	if p.autoscales == nil {
 		return nil, nil
 	}
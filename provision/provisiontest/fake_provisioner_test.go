@@ -10,6 +10,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/globalsign/mgo/bson"
@@ -693,6 +694,77 @@ func (s *S) TestRemoveUnitsFailure(c *check.C) {
 	c.Assert(err.Error(), check.Equals, "This program has performed an illegal operation.")
 }
 
+func (s *S) TestPortForward(c *check.C) {
+	app := NewFakeApp("grand-designs", "rush", 0)
+	p := NewFakeProvisioner()
+	err := p.Provision(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	err = p.AddUnits(context.TODO(), app, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units := p.GetUnits(app)
+	var buf bytes.Buffer
+	buf.WriteString("some data")
+	err = p.PortForward(context.TODO(), app, provision.PortForwardOptions{
+		Unit:   units[0].ID,
+		Port:   8080,
+		Stream: &buf,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "some data")
+}
+
+func (s *S) TestPortForwardUnitNotFound(c *check.C) {
+	app := NewFakeApp("grand-designs", "rush", 0)
+	p := NewFakeProvisioner()
+	err := p.Provision(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	err = p.PortForward(context.TODO(), app, provision.PortForwardOptions{
+		Unit:   "myunit",
+		Port:   8080,
+		Stream: &bytes.Buffer{},
+	})
+	c.Assert(err, check.DeepEquals, &provision.UnitNotFoundError{ID: "myunit"})
+}
+
+func (s *S) TestUploadAndDownloadFromUnit(c *check.C) {
+	app := NewFakeApp("grand-designs", "rush", 0)
+	p := NewFakeProvisioner()
+	err := p.Provision(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	err = p.AddUnits(context.TODO(), app, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units := p.GetUnits(app)
+	opts := provision.UnitFileCopyOptions{Unit: units[0].ID, Path: "/tmp"}
+	err = p.UploadToUnit(context.TODO(), app, opts, strings.NewReader("tar data"))
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = p.DownloadFromUnit(context.TODO(), app, opts, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "tar data")
+	opts.Path = "/home"
+	err = p.DownloadFromUnit(context.TODO(), app, opts, &buf)
+	c.Assert(err, check.ErrorMatches, "/home: no such file or directory")
+	opts.Unit = "myunit"
+	err = p.UploadToUnit(context.TODO(), app, opts, strings.NewReader("tar data"))
+	c.Assert(err, check.DeepEquals, &provision.UnitNotFoundError{ID: "myunit"})
+}
+
+func (s *S) TestDebug(c *check.C) {
+	app := NewFakeApp("grand-designs", "rush", 0)
+	p := NewFakeProvisioner()
+	err := p.Provision(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	err = p.AddUnits(context.TODO(), app, 1, "web", nil, nil)
+	c.Assert(err, check.IsNil)
+	units := p.GetUnits(app)
+	opts := provision.DebugOptions{Unit: units[0].ID, Image: "busybox"}
+	err = p.Debug(context.TODO(), app, opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Debugs(units[0].ID), check.DeepEquals, []provision.DebugOptions{opts})
+	err = p.Debug(context.TODO(), app, provision.DebugOptions{Unit: "myunit", Image: "busybox"})
+	c.Assert(err, check.DeepEquals, &provision.UnitNotFoundError{ID: "myunit"})
+}
+
 func (s *S) TestExecuteCommand(c *check.C) {
 	var buf bytes.Buffer
 	output := []byte("myoutput!")
@@ -42,6 +42,7 @@ type pipelineArgs struct {
 	event            *event.Event
 	preserveVersions bool
 	overrideVersions bool
+	dryRun           bool
 }
 
 type labelReplicas struct {
@@ -91,11 +92,11 @@ func RunServicePipeline(ctx context.Context, manager ServiceManager, oldVersionN
 			newSpec[p] = updateSpec[p]
 		}
 	}
-	pipeline := action.NewPipeline(
-		updateServices,
-		updateImageInDB,
-		removeOldServices,
-	)
+	actions := []*action.Action{updateServices, updateImageInDB, removeOldServices}
+	if args.DryRun {
+		actions = []*action.Action{updateServices, removeOldServices}
+	}
+	pipeline := action.NewPipeline(actions...)
 	return pipeline.Execute(ctx, &pipelineArgs{
 		manager:          manager,
 		app:              args.App,
@@ -106,6 +107,7 @@ func RunServicePipeline(ctx context.Context, manager ServiceManager, oldVersionN
 		newVersionSpec:   newSpec,
 		event:            args.Event,
 		overrideVersions: args.OverrideVersions,
+		dryRun:           args.DryRun,
 	})
 }
 
@@ -158,37 +160,48 @@ func rawLabelsAndReplicas(ctx context.Context, args *pipelineArgs, processName s
 }
 
 func labelsForService(ctx context.Context, args *pipelineArgs, oldLabels labelReplicas, newVersion appTypes.AppVersion, processName string, pState ProcessState) (labelReplicas, error) {
+	labels, replicas, err := ServiceLabelsForState(ctx, args.app, processName, newVersion, oldLabels.labels, oldLabels.realReplicas, pState)
+	if err != nil {
+		return oldLabels, err
+	}
+	return labelReplicas{labels: labels, realReplicas: replicas}, nil
+}
+
+// ServiceLabelsForState returns the labels and replicas of the service of a
+// process version after applying pState to the current labels and replicas
+// of the service, current labels may be nil if the service does not exist.
+func ServiceLabelsForState(ctx context.Context, a provision.App, processName string, version appTypes.AppVersion, current *provision.LabelSet, replicas int, pState ProcessState) (*provision.LabelSet, int, error) {
 	restartCount := 0
 	isStopped := false
 	isAsleep := false
-	if oldLabels.labels != nil {
-		restartCount = oldLabels.labels.Restarts()
-		isStopped = oldLabels.labels.IsStopped()
-		isAsleep = oldLabels.labels.IsAsleep()
+	if current != nil {
+		restartCount = current.Restarts()
+		isStopped = current.IsStopped()
+		isAsleep = current.IsAsleep()
 	}
 	if pState.Increment != 0 {
-		oldLabels.realReplicas += pState.Increment
-		if oldLabels.realReplicas < 0 {
-			return oldLabels, errors.New("cannot have less than 0 units")
+		replicas += pState.Increment
+		if replicas < 0 {
+			return nil, 0, errors.New("cannot have less than 0 units")
 		}
 	}
 	if pState.Start || pState.Restart {
-		if oldLabels.realReplicas == 0 {
-			oldLabels.realReplicas = 1
+		if replicas == 0 {
+			replicas = 1
 		}
 		isStopped = false
 		isAsleep = false
 	}
 	labels, err := provision.ServiceLabels(ctx, provision.ServiceLabelsOpts{
-		App:     args.app,
+		App:     a,
 		Process: processName,
-		Version: newVersion.Version(),
+		Version: version.Version(),
 	})
 	if err != nil {
-		return oldLabels, err
+		return nil, 0, err
 	}
 	if isStopped || pState.Stop {
-		oldLabels.realReplicas = 0
+		replicas = 0
 		labels.SetStopped()
 	}
 	if isAsleep || pState.Sleep {
@@ -198,12 +211,11 @@ func labelsForService(ctx context.Context, args *pipelineArgs, oldLabels labelRe
 		restartCount++
 		labels.SetRestarts(restartCount)
 	}
-	appMetadata := args.app.GetMetadata()
+	appMetadata := a.GetMetadata()
 	for _, l := range appMetadata.Labels {
 		labels.RawLabels[l.Name] = l.Value
 	}
-	oldLabels.labels = labels
-	return oldLabels, nil
+	return labels, replicas, nil
 }
 
 var updateServices = &action.Action{
@@ -236,6 +248,10 @@ var updateServices = &action.Action{
 		var err error
 		for _, processName := range toDeployProcesses {
 			labels := newLabelsMap[processName]
+			endRollout := func(error) {}
+			if args.event != nil {
+				endRollout = args.event.StartProcessPhase(provision.DeployPhaseRollout, processName)
+			}
 			err = args.manager.DeployService(ctx.Context, DeployServiceOpts{
 				App:              args.app,
 				ProcessName:      processName,
@@ -245,24 +261,30 @@ var updateServices = &action.Action{
 				PreserveVersions: args.preserveVersions,
 				OverrideVersions: args.overrideVersions,
 			})
-
+			endRollout(err)
 			if err != nil {
 				break
 			}
 			deployedProcesses[processName] = oldLabelsMap[processName]
 		}
 		errs := tsuruErrors.NewMultiError()
+		// Nothing is applied in a dry-run, so there is nothing to roll back.
 		if err != nil {
 			errs.Add(err)
-			rollbackCtx := tsuruNet.WithoutCancel(ctx.Context)
-			if nerr := rollbackAddedProcesses(rollbackCtx, args, deployedProcesses); nerr != nil {
-				errs.Add(nerr)
+			if !args.dryRun {
+				rollbackCtx := tsuruNet.WithoutCancel(ctx.Context)
+				if nerr := rollbackAddedProcesses(rollbackCtx, args, deployedProcesses); nerr != nil {
+					errs.Add(nerr)
+				}
 			}
 		}
 		return deployedProcesses, errs.ToError()
 	},
 	Backward: func(ctx action.BWContext) {
 		args := ctx.Params[0].(*pipelineArgs)
+		if args.dryRun {
+			return
+		}
 		deployedProcesses := ctx.FWResult.(map[string]*labelReplicas)
 		rollbackAddedProcesses(ctx.Context, args, deployedProcesses)
 	},
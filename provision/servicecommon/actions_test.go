@@ -269,6 +269,51 @@ func (s *S) TestRunServicePipelineNilSpec(c *check.C) {
 	c.Assert(newVersion.VersionInfo().DeploySuccessful, check.Equals, true)
 }
 
+func (s *S) TestRunServicePipelineDryRun(c *check.C) {
+	m := &recordManager{}
+	fakeApp := provisiontest.NewFakeApp("myapp", "whitespace", 1)
+	oldVersion := newSuccessfulVersion(c, fakeApp, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":     "python web1",
+			"worker1": "python worker1",
+		},
+	})
+	newVersion := newVersion(c, fakeApp, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python web2",
+		},
+	})
+	err := RunServicePipeline(context.TODO(), m, oldVersion.Version(), provision.DeployArgs{
+		App:     fakeApp,
+		Version: newVersion,
+		DryRun:  true,
+	}, nil)
+	c.Assert(err, check.IsNil)
+	labelsWeb, err := provision.ServiceLabels(context.TODO(), provision.ServiceLabelsOpts{
+		App:     fakeApp,
+		Process: "web",
+		Version: 2,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.calls, check.DeepEquals, []managerCall{
+		{action: "deploy", app: fakeApp, processName: "web", version: newVersion, replicas: 1, labels: labelsWeb},
+		{action: "remove", app: fakeApp, processName: "worker1", versionNumber: oldVersion.Version()},
+		{action: "cleanup", app: fakeApp, versionNumber: newVersion.Version()},
+	})
+	c.Assert(newVersion.VersionInfo().DeploySuccessful, check.Equals, false)
+	m.reset()
+	m.deployErrMap = map[string]error{"web": errors.New("my deploy error")}
+	err = RunServicePipeline(context.TODO(), m, oldVersion.Version(), provision.DeployArgs{
+		App:     fakeApp,
+		Version: newVersion,
+		DryRun:  true,
+	}, nil)
+	c.Assert(err, check.ErrorMatches, "(?s).*my deploy error.*")
+	c.Assert(m.calls, check.DeepEquals, []managerCall{
+		{action: "deploy", app: fakeApp, processName: "web", version: newVersion, replicas: 1, labels: labelsWeb},
+	})
+}
+
 func (s *S) TestRunServicePipelineSingleProcess(c *check.C) {
 	m := &recordManager{}
 	fakeApp := provisiontest.NewFakeApp("myapp", "whitespace", 1)
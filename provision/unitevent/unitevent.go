@@ -0,0 +1,166 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package unitevent keeps the lifecycle history of app units and raises
+// alerts when units keep failing.
+package unitevent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	"github.com/tsuru/tsuru/storage"
+	permTypes "github.com/tsuru/tsuru/types/permission"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+)
+
+const (
+	// AlertEventKind prefixes the kind of the events created when a unit
+	// event threshold is crossed, e.g. unit-alert.oom-killed.
+	AlertEventKind = "unit-alert"
+
+	defaultListLimit = 100
+)
+
+// Threshold is the number of unit events of an app, in a time window, from
+// which an alert is raised.
+type Threshold struct {
+	Count  int
+	Window time.Duration
+}
+
+var defaultThresholds = map[string]Threshold{
+	provTypes.UnitEventOOMKilled:       {Count: 3, Window: 10 * time.Minute},
+	provTypes.UnitEventCrashLoop:       {Count: 3, Window: 10 * time.Minute},
+	provTypes.UnitEventEvicted:         {Count: 3, Window: 10 * time.Minute},
+	provTypes.UnitEventImagePullFailed: {Count: 3, Window: 10 * time.Minute},
+}
+
+// ThresholdFor returns the alert threshold for the unit event kind, it may be
+// overridden by the unit-events:thresholds:<kind>:count and
+// unit-events:thresholds:<kind>:window config entries, the window in
+// seconds. A count lower than one disables the alert.
+func ThresholdFor(kind string) (Threshold, bool) {
+	threshold := defaultThresholds[kind]
+	prefix := fmt.Sprintf("unit-events:thresholds:%s", kind)
+	if count, err := config.GetInt(prefix + ":count"); err == nil {
+		threshold.Count = count
+	}
+	if window, err := config.GetFloat(prefix + ":window"); err == nil {
+		threshold.Window = time.Duration(window * float64(time.Second))
+	}
+	if threshold.Count < 1 || threshold.Window <= 0 {
+		return Threshold{}, false
+	}
+	return threshold, true
+}
+
+type unitEventService struct {
+	storage provTypes.UnitEventStorage
+}
+
+var _ provTypes.UnitEventService = &unitEventService{}
+
+func UnitEventStorage() (provTypes.UnitEventStorage, error) {
+	dbDriver, err := storage.GetCurrentDbDriver()
+	if err != nil {
+		dbDriver, err = storage.GetDefaultDbDriver()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dbDriver.UnitEventStorage, nil
+}
+
+func UnitEventService() (provTypes.UnitEventService, error) {
+	storage, err := UnitEventStorage()
+	if err != nil {
+		return nil, err
+	}
+	return &unitEventService{storage: storage}, nil
+}
+
+// Add records the unit event, raising an alert for the app if the threshold
+// for the event kind is crossed by it.
+func (s *unitEventService) Add(ctx context.Context, evt provTypes.UnitEvent) error {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now().UTC()
+	}
+	err := s.storage.Insert(ctx, evt)
+	if err != nil {
+		return err
+	}
+	return s.checkThreshold(ctx, evt)
+}
+
+func (s *unitEventService) List(ctx context.Context, filter provTypes.UnitEventFilter) ([]provTypes.UnitEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	return s.storage.Find(ctx, filter)
+}
+
+func (s *unitEventService) Retention(ctx context.Context) (time.Duration, error) {
+	return s.storage.Retention(ctx)
+}
+
+func (s *unitEventService) checkThreshold(ctx context.Context, evt provTypes.UnitEvent) error {
+	threshold, ok := ThresholdFor(evt.Kind)
+	if !ok {
+		return nil
+	}
+	events, err := s.storage.Find(ctx, provTypes.UnitEventFilter{
+		App:   evt.App,
+		Kinds: []string{evt.Kind},
+		Since: evt.Time.Add(-threshold.Window),
+		Limit: threshold.Count,
+	})
+	if err != nil {
+		return err
+	}
+	if len(events) < threshold.Count {
+		return nil
+	}
+	target := event.Target{Type: event.TargetTypeApp, Value: evt.App}
+	kind := AlertEventKind + "." + evt.Kind
+	// An alert is raised at most once per window for each kind, the events
+	// following it in the window are covered by it.
+	alerts, err := event.List(&event.Filter{
+		Target:    target,
+		KindType:  event.KindTypeInternal,
+		KindNames: []string{kind},
+		Since:     time.Now().Add(-threshold.Window),
+		Limit:     1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(alerts) > 0 {
+		return nil
+	}
+	a, err := servicemanager.App.GetByName(ctx, evt.App)
+	if err != nil {
+		return err
+	}
+	alert, err := event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: kind,
+		CustomData:   events,
+		DisableLock:  true,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permTypes.CtxTeam, a.GetTeamsName()),
+			permission.Context(permTypes.CtxApp, evt.App),
+			permission.Context(permTypes.CtxPool, a.GetPool()),
+		)...),
+	})
+	if err != nil {
+		return err
+	}
+	return alert.Done(errors.Errorf("%d %s unit events in %v", len(events), evt.Kind, threshold.Window))
+}
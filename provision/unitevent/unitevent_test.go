@@ -0,0 +1,147 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unitevent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/servicemanager"
+	_ "github.com/tsuru/tsuru/storage/mongodb"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+)
+
+type S struct {
+	conn *db.Storage
+}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:driver", "mongodb")
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "provision_unitevent_tests_s")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Apps().Database)
+	c.Assert(err, check.IsNil)
+	servicemanager.App = &appTypes.MockAppService{
+		Apps: []appTypes.App{&appTypes.MockApp{Name: "myapp", Pool: "pool1", TeamsName: []string{"team1"}}},
+	}
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("unit-events")
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.conn.Close()
+}
+
+func (s *S) TestThresholdFor(c *check.C) {
+	threshold, ok := ThresholdFor(provTypes.UnitEventOOMKilled)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(threshold, check.Equals, Threshold{Count: 3, Window: 10 * time.Minute})
+	_, ok = ThresholdFor(provTypes.UnitEventReady)
+	c.Assert(ok, check.Equals, false)
+	config.Set("unit-events:thresholds:oom-killed:count", 5)
+	config.Set("unit-events:thresholds:oom-killed:window", 60)
+	threshold, ok = ThresholdFor(provTypes.UnitEventOOMKilled)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(threshold, check.Equals, Threshold{Count: 5, Window: time.Minute})
+	config.Set("unit-events:thresholds:restarted:count", 10)
+	config.Set("unit-events:thresholds:restarted:window", 300)
+	threshold, ok = ThresholdFor(provTypes.UnitEventRestarted)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(threshold, check.Equals, Threshold{Count: 10, Window: 5 * time.Minute})
+	config.Set("unit-events:thresholds:crash-loop:count", 0)
+	_, ok = ThresholdFor(provTypes.UnitEventCrashLoop)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestAddAndList(c *check.C) {
+	svc, err := UnitEventService()
+	c.Assert(err, check.IsNil)
+	err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventReady})
+	c.Assert(err, check.IsNil)
+	err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventNotReady})
+	c.Assert(err, check.IsNil)
+	events, err := svc.List(context.TODO(), provTypes.UnitEventFilter{App: "myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(events, check.HasLen, 2)
+	c.Assert(events[0].Time.IsZero(), check.Equals, false)
+	kinds := []string{events[0].Kind, events[1].Kind}
+	c.Assert(kinds, check.DeepEquals, []string{provTypes.UnitEventNotReady, provTypes.UnitEventReady})
+}
+
+func (s *S) TestAddRaisesAlertWhenThresholdIsCrossed(c *check.C) {
+	svc, err := UnitEventService()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	for i := 0; i < 2; i++ {
+		err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventOOMKilled, Time: now.Add(time.Duration(i-3) * time.Minute)})
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(eventtest.EventDesc{IsEmpty: true}, eventtest.HasEvent)
+	err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-2", Kind: provTypes.UnitEventOOMKilled, Time: now})
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:         "unit-alert.oom-killed",
+		ErrorMatches: `3 oom-killed unit events in 10m0s`,
+	}, eventtest.HasEvent)
+	err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-2", Kind: provTypes.UnitEventOOMKilled, Time: now})
+	c.Assert(err, check.IsNil)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestAddRaisesAlertWhenThresholdWasAlreadyExceeded(c *check.C) {
+	storage, err := UnitEventStorage()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	for i := 0; i < 4; i++ {
+		err = storage.Insert(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventEvicted, Time: now.Add(time.Duration(i-4) * time.Minute)})
+		c.Assert(err, check.IsNil)
+	}
+	svc, err := UnitEventService()
+	c.Assert(err, check.IsNil)
+	err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventEvicted, Time: now})
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:         "unit-alert.evicted",
+		ErrorMatches: `3 evicted unit events in 10m0s`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddIgnoresEventsOutOfThresholdWindow(c *check.C) {
+	svc, err := UnitEventService()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		err = svc.Add(context.TODO(), provTypes.UnitEvent{App: "myapp", Unit: "myapp-web-1", Kind: provTypes.UnitEventCrashLoop, Time: now.Add(time.Duration(i-2) * 8 * time.Minute)})
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(eventtest.EventDesc{IsEmpty: true}, eventtest.HasEvent)
+}
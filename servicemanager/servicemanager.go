@@ -9,6 +9,7 @@ import (
 	"github.com/tsuru/tsuru/types/app/image"
 	"github.com/tsuru/tsuru/types/auth"
 	"github.com/tsuru/tsuru/types/cache"
+	"github.com/tsuru/tsuru/types/cost"
 	"github.com/tsuru/tsuru/types/event"
 	"github.com/tsuru/tsuru/types/provision"
 	"github.com/tsuru/tsuru/types/quota"
@@ -40,4 +41,7 @@ var (
 	AuthGroup                 auth.GroupService
 	Pool                      provision.PoolService
 	Volume                    volume.VolumeService
+	Pipeline                  app.PipelineService
+	UnitEvent                 provision.UnitEventService
+	CostPrice                 cost.PriceService
 )
@@ -13,6 +13,7 @@ import (
 	"github.com/tsuru/tsuru/types/app/image"
 	"github.com/tsuru/tsuru/types/auth"
 	"github.com/tsuru/tsuru/types/cache"
+	"github.com/tsuru/tsuru/types/cost"
 	"github.com/tsuru/tsuru/types/event"
 	"github.com/tsuru/tsuru/types/provision"
 	"github.com/tsuru/tsuru/types/quota"
@@ -42,6 +43,9 @@ type DbDriver struct {
 	AuthGroupStorage                 auth.GroupStorage
 	PoolStorage                      provision.PoolStorage
 	VolumeStorage                    volume.VolumeStorage
+	PipelineStorage                  app.PipelineStorage
+	UnitEventStorage                 provision.UnitEventStorage
+	CostPriceStorage                 cost.PriceStorage
 }
 
 var (
@@ -197,6 +197,7 @@ func (s *appVersionStorage) NewAppVersion(ctx context.Context, args appTypes.New
 		Version:        currentCount,
 		EventID:        args.EventID,
 		CustomBuildTag: args.CustomBuildTag,
+		Provenance:     args.Provenance,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
@@ -243,6 +244,7 @@ func (s *appVersionStorage) DeleteVersions(ctx context.Context, appName string,
 	err = s.baseUpdate(ctx, appName, bson.M{
 		"$set": bson.M{
 			"versions":        map[int]appTypes.AppVersionInfo{},
+			"channels":        map[string]int{},
 			"updatedhash":     uuidV4.String(),
 			"markedtoremoval": false,
 		},
@@ -324,7 +326,35 @@ func (s *appVersionStorage) DeleteVersionIDs(ctx context.Context, appName string
 	if len(unset) > 0 {
 		fullChange["$unset"] = unset
 	}
-	return s.baseUpdate(ctx, appName, fullChange, opts...)
+	where := bson.M{"appname": appName}
+	if len(opts) > 0 && opts[0].PreviousUpdatedHash != "" {
+		where["updatedhash"] = opts[0].PreviousUpdatedHash
+	}
+	current, err := s.versionChannels(where)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		for _, version := range versions {
+			if current.IsReferencedByChannel(version) {
+				return appTypes.ErrVersionReferencedByChannel
+			}
+		}
+		// the channels may not change between the check and the removal
+		where["updatedhash"] = current.UpdatedHash
+	}
+	return s.baseUpdateWhere(ctx, where, fullChange)
+}
+
+func (s *appVersionStorage) versionChannels(where bson.M) (appTypes.AppVersions, error) {
+	var appVersions appTypes.AppVersions
+	coll, err := s.collection()
+	if err != nil {
+		return appVersions, err
+	}
+	defer coll.Close()
+	err = coll.Find(where).Select(bson.M{"channels": 1, "updatedhash": 1}).One(&appVersions)
+	return appVersions, err
 }
 
 func (s *appVersionStorage) MarkToRemoval(ctx context.Context, appName string, opts ...*appTypes.AppVersionWriteOptions) error {
@@ -374,6 +404,43 @@ func (s *appVersionStorage) MarkVersionsToRemoval(ctx context.Context, appName s
 	return s.baseUpdateWhere(ctx, where, update)
 }
 
+func (s *appVersionStorage) SetVersionChannel(ctx context.Context, appName, channel string, version int, opts ...*appTypes.AppVersionWriteOptions) error {
+	uuidV4, err := uuid.NewV4()
+	if err != nil {
+		return errors.WithMessage(err, "failed to generate uuid v4")
+	}
+	where := bson.M{
+		"appname":                           appName,
+		fmt.Sprintf("versions.%d", version): bson.M{"$exists": true},
+	}
+	if len(opts) > 0 && opts[0].PreviousUpdatedHash != "" {
+		where["updatedhash"] = opts[0].PreviousUpdatedHash
+	}
+	return s.baseUpdateWhere(ctx, where, bson.M{
+		"$set": bson.M{
+			"channels." + channel: version,
+			"updatedat":           time.Now().UTC(),
+			"updatedhash":         uuidV4.String(),
+		},
+	})
+}
+
+func (s *appVersionStorage) UnsetVersionChannel(ctx context.Context, appName, channel string, opts ...*appTypes.AppVersionWriteOptions) error {
+	uuidV4, err := uuid.NewV4()
+	if err != nil {
+		return errors.WithMessage(err, "failed to generate uuid v4")
+	}
+	return s.baseUpdate(ctx, appName, bson.M{
+		"$unset": bson.M{
+			"channels." + channel: "",
+		},
+		"$set": bson.M{
+			"updatedat":   time.Now().UTC(),
+			"updatedhash": uuidV4.String(),
+		},
+	}, opts...)
+}
+
 func (s *appVersionStorage) importLegacyVersions(app appTypes.App) error {
 	imgData, err := s.legacyImagesData(app.GetName())
 	if err != nil {
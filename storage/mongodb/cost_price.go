@@ -0,0 +1,116 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mongodb
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	costTypes "github.com/tsuru/tsuru/types/cost"
+)
+
+const costPriceCollectionName = "cost_prices"
+
+type costPrice struct {
+	ID           string `bson:"_id"`
+	Kind         string
+	Pool         string
+	Service      string
+	Plan         string
+	Hourly       float64
+	CPUHourly    float64
+	MemoryHourly float64
+}
+
+type costPriceStorage struct{}
+
+var _ costTypes.PriceStorage = &costPriceStorage{}
+
+func (s *costPriceStorage) coll(conn *db.Storage) *dbStorage.Collection {
+	return conn.Collection(costPriceCollectionName)
+}
+
+func (s *costPriceStorage) Upsert(ctx context.Context, p costTypes.Price) error {
+	span := newMongoDBSpan(ctx, mongoSpanUpsertID, costPriceCollectionName)
+	span.SetMongoID(p.ID())
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	_, err = s.coll(conn).UpsertId(p.ID(), costPrice{
+		ID:           p.ID(),
+		Kind:         p.Kind,
+		Pool:         p.Pool,
+		Service:      p.Service,
+		Plan:         p.Plan,
+		Hourly:       p.Hourly,
+		CPUHourly:    p.CPUHourly,
+		MemoryHourly: p.MemoryHourly,
+	})
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *costPriceStorage) Delete(ctx context.Context, p costTypes.Price) error {
+	span := newMongoDBSpan(ctx, mongoSpanDeleteID, costPriceCollectionName)
+	span.SetMongoID(p.ID())
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	err = s.coll(conn).RemoveId(p.ID())
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return costTypes.ErrPriceNotFound
+		}
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *costPriceStorage) FindAll(ctx context.Context) (costTypes.Prices, error) {
+	span := newMongoDBSpan(ctx, mongoSpanFind, costPriceCollectionName)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer conn.Close()
+	var prices []costPrice
+	err = s.coll(conn).Find(nil).Sort("_id").All(&prices)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	result := make(costTypes.Prices, len(prices))
+	for i, p := range prices {
+		result[i] = costTypes.Price{
+			Kind:         p.Kind,
+			Pool:         p.Pool,
+			Service:      p.Service,
+			Plan:         p.Plan,
+			Hourly:       p.Hourly,
+			CPUHourly:    p.CPUHourly,
+			MemoryHourly: p.MemoryHourly,
+		}
+	}
+	return result, nil
+}
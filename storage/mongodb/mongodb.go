@@ -29,6 +29,9 @@ func init() {
 		AuthGroupStorage:                 &authGroupStorage{},
 		PoolStorage:                      &PoolStorage{},
 		VolumeStorage:                    &volumeStorage{},
+		PipelineStorage:                  &pipelineStorage{},
+		UnitEventStorage:                 &unitEventStorage{},
+		CostPriceStorage:                 &costPriceStorage{},
 	}
 	storage.RegisterDbDriver("mongodb", mongodbDriver)
 }
@@ -0,0 +1,275 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+const pipelineCollectionName = "pipelines"
+
+type pipeline struct {
+	Name      string `bson:"_id"`
+	TeamOwner string
+	Stages    []pipelineStage
+	Approvals []pipelineApproval `bson:",omitempty"`
+}
+
+type pipelineStage struct {
+	App            string
+	ManualApproval bool
+	Verification   pipelineVerification
+}
+
+type pipelineVerification struct {
+	MinAge       time.Duration
+	HealthyUnits bool
+}
+
+type pipelineApproval struct {
+	Stage       string
+	Version     int
+	RequestedBy string
+	RequestedAt time.Time
+	ApprovedBy  string
+	ApprovedAt  time.Time
+}
+
+type pipelineStorage struct{}
+
+var _ appTypes.PipelineStorage = &pipelineStorage{}
+
+func (s *pipelineStorage) coll(conn *db.Storage) *dbStorage.Collection {
+	return conn.Collection(pipelineCollectionName)
+}
+
+func toPipeline(p appTypes.Pipeline) pipeline {
+	result := pipeline{Name: p.Name, TeamOwner: p.TeamOwner}
+	for _, stage := range p.Stages {
+		result.Stages = append(result.Stages, pipelineStage{
+			App:            stage.App,
+			ManualApproval: stage.ManualApproval,
+			Verification:   pipelineVerification(stage.Verification),
+		})
+	}
+	for _, approval := range p.Approvals {
+		result.Approvals = append(result.Approvals, pipelineApproval(approval))
+	}
+	return result
+}
+
+func (p pipeline) toPipelineType() appTypes.Pipeline {
+	result := appTypes.Pipeline{Name: p.Name, TeamOwner: p.TeamOwner}
+	for _, stage := range p.Stages {
+		result.Stages = append(result.Stages, appTypes.PipelineStage{
+			App:            stage.App,
+			ManualApproval: stage.ManualApproval,
+			Verification:   appTypes.PipelineVerification(stage.Verification),
+		})
+	}
+	for _, approval := range p.Approvals {
+		result.Approvals = append(result.Approvals, appTypes.PipelineApproval(approval))
+	}
+	return result
+}
+
+func (s *pipelineStorage) Insert(ctx context.Context, p appTypes.Pipeline) error {
+	span := newMongoDBSpan(ctx, mongoSpanInsert, pipelineCollectionName)
+	span.SetMongoID(p.Name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	err = s.coll(conn).Insert(toPipeline(p))
+	if err != nil {
+		if mgo.IsDup(err) {
+			return appTypes.ErrPipelineAlreadyExists
+		}
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *pipelineStorage) Update(ctx context.Context, p appTypes.Pipeline) error {
+	span := newMongoDBSpan(ctx, mongoSpanUpdateID, pipelineCollectionName)
+	span.SetMongoID(p.Name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	// approvals are kept untouched as they are handled by their own methods
+	dbPipeline := toPipeline(p)
+	err = s.coll(conn).UpdateId(p.Name, bson.M{"$set": bson.M{
+		"teamowner": dbPipeline.TeamOwner,
+		"stages":    dbPipeline.Stages,
+	}})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return appTypes.ErrPipelineNotFound
+		}
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *pipelineStorage) Get(ctx context.Context, name string) (*appTypes.Pipeline, error) {
+	span := newMongoDBSpan(ctx, mongoSpanFindID, pipelineCollectionName)
+	span.SetMongoID(name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer conn.Close()
+	var p pipeline
+	err = s.coll(conn).FindId(name).One(&p)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, appTypes.ErrPipelineNotFound
+		}
+		span.SetError(err)
+		return nil, err
+	}
+	result := p.toPipelineType()
+	return &result, nil
+}
+
+func (s *pipelineStorage) FindByTeams(ctx context.Context, teams []string) ([]appTypes.Pipeline, error) {
+	query := bson.M{}
+	if teams != nil {
+		query["teamowner"] = bson.M{"$in": teams}
+	}
+	span := newMongoDBSpan(ctx, mongoSpanFind, pipelineCollectionName)
+	span.SetQueryStatement(query)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer conn.Close()
+	var pipelines []pipeline
+	err = s.coll(conn).Find(query).Sort("_id").All(&pipelines)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	result := make([]appTypes.Pipeline, len(pipelines))
+	for i := range pipelines {
+		result[i] = pipelines[i].toPipelineType()
+	}
+	return result, nil
+}
+
+func (s *pipelineStorage) Remove(ctx context.Context, name string) error {
+	span := newMongoDBSpan(ctx, mongoSpanDeleteID, pipelineCollectionName)
+	span.SetMongoID(name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	err = s.coll(conn).RemoveId(name)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return appTypes.ErrPipelineNotFound
+		}
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *pipelineStorage) AddApproval(ctx context.Context, name string, approval appTypes.PipelineApproval) error {
+	span := newMongoDBSpan(ctx, mongoSpanUpdateID, pipelineCollectionName)
+	span.SetMongoID(name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{
+		"_id":       name,
+		"approvals": bson.M{"$not": bson.M{"$elemMatch": bson.M{"stage": approval.Stage, "version": approval.Version}}},
+	}
+	err = s.coll(conn).Update(query, bson.M{"$push": bson.M{"approvals": pipelineApproval(approval)}})
+	if err == mgo.ErrNotFound {
+		// either the pipeline is gone or the approval was already requested
+		return nil
+	}
+	span.SetError(err)
+	return err
+}
+
+func (s *pipelineStorage) Approve(ctx context.Context, name, stage string, version int, user string) error {
+	span := newMongoDBSpan(ctx, mongoSpanUpdate, pipelineCollectionName)
+	span.SetMongoID(name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{
+		"_id":       name,
+		"approvals": bson.M{"$elemMatch": bson.M{"stage": stage, "version": version, "approvedby": ""}},
+	}
+	err = s.coll(conn).Update(query, bson.M{"$set": bson.M{
+		"approvals.$.approvedby": user,
+		"approvals.$.approvedat": time.Now().UTC(),
+	}})
+	if err == mgo.ErrNotFound {
+		return appTypes.ErrPipelineApprovalNotFound
+	}
+	span.SetError(err)
+	return err
+}
+
+func (s *pipelineStorage) RemoveApproval(ctx context.Context, name, stage string, version int) error {
+	span := newMongoDBSpan(ctx, mongoSpanUpdateID, pipelineCollectionName)
+	span.SetMongoID(name)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	err = s.coll(conn).UpdateId(name, bson.M{"$pull": bson.M{"approvals": bson.M{"stage": stage, "version": version}}})
+	if err == mgo.ErrNotFound {
+		return appTypes.ErrPipelineNotFound
+	}
+	span.SetError(err)
+	return err
+}
@@ -28,6 +28,8 @@ type plan struct {
 	CPUMilli int
 	Default  bool
 	Override app.PlanOverride `bson:"-"`
+
+	ProcessOverride map[string]app.PlanOverride `bson:"-"`
 }
 
 func plansCollection(conn *db.Storage) *dbStorage.Collection {
@@ -22,10 +22,11 @@ type TeamStorage struct{}
 var _ auth.TeamStorage = &TeamStorage{}
 
 type team struct {
-	Name         string `bson:"_id"`
-	CreatingUser string
-	Tags         []string
-	Quota        quota.Quota
+	Name           string `bson:"_id"`
+	CreatingUser   string
+	Tags           []string
+	Quota          quota.Quota
+	ResourceQuotas []quota.ResourceQuota `bson:",omitempty"`
 }
 
 func teamsCollection(conn *db.Storage) *dbStorage.Collection {
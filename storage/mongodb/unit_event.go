@@ -0,0 +1,181 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+)
+
+const (
+	unitEventCollectionName = "unit_events"
+
+	// defaultUnitEventRetention is how long unit events are kept when
+	// unit-events:retention is not set, enough for cost reports of the
+	// previous month until the end of the current one.
+	defaultUnitEventRetention = 62 * 24 * time.Hour
+
+	// indexOptionsConflictCode is returned when creating an index existing
+	// with other options.
+	indexOptionsConflictCode = 85
+)
+
+func unitEventRetention() time.Duration {
+	retention, err := config.GetFloat("unit-events:retention")
+	if err != nil || retention <= 0 {
+		return defaultUnitEventRetention
+	}
+	return time.Duration(retention * float64(time.Second))
+}
+
+type unitEvent struct {
+	App          string
+	Unit         string
+	Process      string
+	Version      int
+	Kind         string
+	Reason       string
+	Message      string
+	RestartCount int
+	Time         time.Time
+}
+
+type unitEventStorage struct{}
+
+var _ provTypes.UnitEventStorage = &unitEventStorage{}
+
+func (s *unitEventStorage) coll(conn *db.Storage) *dbStorage.Collection {
+	coll := conn.Collection(unitEventCollectionName)
+	ensureUnitEventIndexes(coll)
+	return coll
+}
+
+// ensureUnitEventIndexes creates the indexes of unit events. The TTL index is
+// changed in place when the retention changes, as creating it again with
+// another TTL fails.
+func ensureUnitEventIndexes(coll *dbStorage.Collection) error {
+	err := coll.EnsureIndex(mgo.Index{Key: []string{"app", "-time"}})
+	if err != nil {
+		return err
+	}
+	retention := unitEventRetention()
+	err = coll.EnsureIndex(mgo.Index{Key: []string{"time"}, ExpireAfter: retention})
+	if queryErr, ok := err.(*mgo.QueryError); ok && queryErr.Code == indexOptionsConflictCode {
+		return setUnitEventTTL(coll, retention)
+	}
+	return err
+}
+
+func setUnitEventTTL(coll *dbStorage.Collection, retention time.Duration) error {
+	return coll.Database.Run(bson.D{
+		{Name: "collMod", Value: unitEventCollectionName},
+		{Name: "index", Value: bson.M{
+			"keyPattern":         bson.M{"time": 1},
+			"expireAfterSeconds": int(retention / time.Second),
+		}},
+	}, nil)
+}
+
+// Retention returns the TTL of the index expiring unit events, after
+// updating it to the configured retention. Indexes are only ensured once by
+// process, the TTL is checked here so a retention changed since is applied.
+func (s *unitEventStorage) Retention(ctx context.Context) (time.Duration, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Collection(unitEventCollectionName)
+	err = ensureUnitEventIndexes(coll)
+	if err != nil {
+		return 0, err
+	}
+	indexes, err := coll.Indexes()
+	if err != nil {
+		return 0, err
+	}
+	retention := unitEventRetention()
+	for _, index := range indexes {
+		if len(index.Key) != 1 || index.Key[0] != "time" || index.ExpireAfter <= 0 {
+			continue
+		}
+		if index.ExpireAfter == retention.Truncate(time.Second) {
+			return index.ExpireAfter, nil
+		}
+		err = setUnitEventTTL(coll, retention)
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to update the TTL of unit events")
+		}
+		return retention.Truncate(time.Second), nil
+	}
+	return 0, errors.New("unit events TTL index not found")
+}
+
+func (s *unitEventStorage) Insert(ctx context.Context, evt provTypes.UnitEvent) error {
+	span := newMongoDBSpan(ctx, mongoSpanInsert, unitEventCollectionName)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer conn.Close()
+	err = s.coll(conn).Insert(unitEvent(evt))
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *unitEventStorage) Find(ctx context.Context, filter provTypes.UnitEventFilter) ([]provTypes.UnitEvent, error) {
+	query := bson.M{}
+	if filter.App != "" {
+		query["app"] = filter.App
+	}
+	if filter.Unit != "" {
+		query["unit"] = filter.Unit
+	}
+	if len(filter.Kinds) > 0 {
+		query["kind"] = bson.M{"$in": filter.Kinds}
+	}
+	if !filter.Since.IsZero() {
+		query["time"] = bson.M{"$gte": filter.Since}
+	}
+	span := newMongoDBSpan(ctx, mongoSpanFind, unitEventCollectionName)
+	span.SetQueryStatement(query)
+	defer span.Finish()
+
+	conn, err := db.Conn()
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer conn.Close()
+	q := s.coll(conn).Find(query).Sort("-time")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	var events []unitEvent
+	err = q.All(&events)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	result := make([]provTypes.UnitEvent, len(events))
+	for i := range events {
+		result[i] = provTypes.UnitEvent(events[i])
+	}
+	return result, nil
+}
@@ -138,6 +138,43 @@ func (s *AppVersionSuite) TestAppVersionStorage_DeleteVersions(c *check.C) {
 	c.Assert(appVersion.Versions, check.DeepEquals, map[int]appTypes.AppVersionInfo{})
 }
 
+func (s *AppVersionSuite) TestAppVersionStorage_VersionChannels(c *check.C) {
+	app := &appTypes.MockApp{Name: "myapp"}
+
+	err := s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "stable", 1)
+	c.Assert(err, check.Equals, appTypes.ErrNoVersionsAvailable)
+
+	_, err = s.AppVersionStorage.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	_, err = s.AppVersionStorage.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "stable", 3)
+	c.Assert(err, check.Equals, appTypes.ErrNoVersionsAvailable)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "stable", 1)
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "candidate", 2)
+	c.Assert(err, check.IsNil)
+	appVersions, err := s.AppVersionStorage.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(appVersions.Channels, check.DeepEquals, map[string]int{"stable": 1, "candidate": 2})
+
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "stable", 2, &appTypes.AppVersionWriteOptions{
+		PreviousUpdatedHash: "outdated",
+	})
+	c.Assert(err, check.Equals, appTypes.ErrTransactionCancelledByChange)
+	err = s.AppVersionStorage.UnsetVersionChannel(context.TODO(), app.Name, "stable")
+	c.Assert(err, check.IsNil)
+	appVersions, err = s.AppVersionStorage.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(appVersions.Channels, check.DeepEquals, map[string]int{"candidate": 2})
+
+	err = s.AppVersionStorage.DeleteVersions(context.TODO(), app.Name)
+	c.Assert(err, check.IsNil)
+	appVersions, err = s.AppVersionStorage.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(appVersions.Channels, check.DeepEquals, map[string]int{})
+}
+
 func (s *AppVersionSuite) TestAppVersionStorage_AllAppVersions(c *check.C) {
 	allVersions, err := s.AppVersionStorage.AllAppVersions(context.TODO())
 	c.Assert(err, check.IsNil)
@@ -210,6 +247,35 @@ func (s *AppVersionSuite) TestAppVersionStorage_DeleteVersionIDs(c *check.C) {
 	})
 }
 
+func (s *AppVersionSuite) TestAppVersionStorage_DeleteVersionIDsReferencedByChannel(c *check.C) {
+	app := &appTypes.MockApp{Name: "myapp"}
+	_, err := s.AppVersionStorage.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	_, err = s.AppVersionStorage.NewAppVersion(context.TODO(), appTypes.NewVersionArgs{App: app})
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "stable", 1)
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "approved", 1)
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.SetVersionChannel(context.TODO(), app.Name, "candidate", 2)
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.DeleteVersionIDs(context.TODO(), app.Name, []int{1})
+	c.Assert(err, check.Equals, appTypes.ErrVersionReferencedByChannel)
+	err = s.AppVersionStorage.DeleteVersionIDs(context.TODO(), app.Name, []int{2, 3})
+	c.Assert(err, check.Equals, appTypes.ErrVersionReferencedByChannel)
+	versions, err := s.AppVersionStorage.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Versions, check.HasLen, 2)
+	c.Assert(versions.Channels, check.DeepEquals, map[string]int{"stable": 1, "approved": 1, "candidate": 2})
+	err = s.AppVersionStorage.UnsetVersionChannel(context.TODO(), app.Name, "candidate")
+	c.Assert(err, check.IsNil)
+	err = s.AppVersionStorage.DeleteVersionIDs(context.TODO(), app.Name, []int{2})
+	c.Assert(err, check.IsNil)
+	versions, err = s.AppVersionStorage.AppVersions(context.TODO(), app)
+	c.Assert(err, check.IsNil)
+	c.Assert(versions.Versions, check.HasLen, 1)
+}
+
 func (s *AppVersionSuite) TestAppVersionStorage_ConcurrencyDeletes(c *check.C) {
 	app := &appTypes.MockApp{Name: "myapp-concurrent"}
 
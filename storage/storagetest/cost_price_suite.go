@@ -0,0 +1,45 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storagetest
+
+import (
+	"context"
+
+	costTypes "github.com/tsuru/tsuru/types/cost"
+	check "gopkg.in/check.v1"
+)
+
+type CostPriceSuite struct {
+	SuiteHooks
+	PriceStorage costTypes.PriceStorage
+}
+
+func (s *CostPriceSuite) TestUpsertCostPrice(c *check.C) {
+	unit := costTypes.Price{Kind: costTypes.KindUnit, Pool: "pool1", Plan: "small", Hourly: 0.01, CPUHourly: 0.02}
+	err := s.PriceStorage.Upsert(context.TODO(), unit)
+	c.Assert(err, check.IsNil)
+	volume := costTypes.Price{Kind: costTypes.KindVolume, Hourly: 0.005}
+	err = s.PriceStorage.Upsert(context.TODO(), volume)
+	c.Assert(err, check.IsNil)
+	unit.Hourly = 0.03
+	err = s.PriceStorage.Upsert(context.TODO(), unit)
+	c.Assert(err, check.IsNil)
+	prices, err := s.PriceStorage.FindAll(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(prices, check.DeepEquals, costTypes.Prices{unit, volume})
+}
+
+func (s *CostPriceSuite) TestDeleteCostPrice(c *check.C) {
+	p := costTypes.Price{Kind: costTypes.KindServiceInstance, Service: "mysql", Hourly: 1}
+	err := s.PriceStorage.Upsert(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	err = s.PriceStorage.Delete(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	prices, err := s.PriceStorage.FindAll(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(prices, check.HasLen, 0)
+	err = s.PriceStorage.Delete(context.TODO(), p)
+	c.Assert(err, check.Equals, costTypes.ErrPriceNotFound)
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storagetest
+
+import (
+	"context"
+	"time"
+
+	appTypes "github.com/tsuru/tsuru/types/app"
+	check "gopkg.in/check.v1"
+)
+
+type PipelineSuite struct {
+	SuiteHooks
+	PipelineStorage appTypes.PipelineStorage
+}
+
+func (s *PipelineSuite) TestInsertPipeline(c *check.C) {
+	p := appTypes.Pipeline{
+		Name:      "my-pipeline",
+		TeamOwner: "team1",
+		Stages: []appTypes.PipelineStage{
+			{App: "app-dev"},
+			{App: "app-prod", ManualApproval: true, Verification: appTypes.PipelineVerification{MinAge: time.Hour, HealthyUnits: true}},
+		},
+	}
+	err := s.PipelineStorage.Insert(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	dbPipeline, err := s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline, check.DeepEquals, &p)
+	err = s.PipelineStorage.Insert(context.TODO(), p)
+	c.Assert(err, check.Equals, appTypes.ErrPipelineAlreadyExists)
+}
+
+func (s *PipelineSuite) TestGetPipelineNotFound(c *check.C) {
+	_, err := s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *PipelineSuite) TestUpdatePipeline(c *check.C) {
+	p := appTypes.Pipeline{
+		Name:      "my-pipeline",
+		TeamOwner: "team1",
+		Stages:    []appTypes.PipelineStage{{App: "app-dev"}, {App: "app-prod"}},
+	}
+	err := s.PipelineStorage.Insert(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	p.Stages = append(p.Stages, appTypes.PipelineStage{App: "app-other", ManualApproval: true})
+	err = s.PipelineStorage.Update(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	dbPipeline, err := s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline, check.DeepEquals, &p)
+	err = s.PipelineStorage.Update(context.TODO(), appTypes.Pipeline{Name: "other"})
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *PipelineSuite) TestFindPipelinesByTeams(c *check.C) {
+	p1 := appTypes.Pipeline{Name: "p1", TeamOwner: "team1", Stages: []appTypes.PipelineStage{{App: "a1"}, {App: "a2"}}}
+	p2 := appTypes.Pipeline{Name: "p2", TeamOwner: "team2", Stages: []appTypes.PipelineStage{{App: "a3"}, {App: "a4"}}}
+	err := s.PipelineStorage.Insert(context.TODO(), p1)
+	c.Assert(err, check.IsNil)
+	err = s.PipelineStorage.Insert(context.TODO(), p2)
+	c.Assert(err, check.IsNil)
+	pipelines, err := s.PipelineStorage.FindByTeams(context.TODO(), nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(pipelines, check.DeepEquals, []appTypes.Pipeline{p1, p2})
+	pipelines, err = s.PipelineStorage.FindByTeams(context.TODO(), []string{"team2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(pipelines, check.DeepEquals, []appTypes.Pipeline{p2})
+	pipelines, err = s.PipelineStorage.FindByTeams(context.TODO(), []string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(pipelines, check.HasLen, 0)
+}
+
+func (s *PipelineSuite) TestRemovePipeline(c *check.C) {
+	p := appTypes.Pipeline{Name: "my-pipeline", TeamOwner: "team1", Stages: []appTypes.PipelineStage{{App: "a1"}, {App: "a2"}}}
+	err := s.PipelineStorage.Insert(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	err = s.PipelineStorage.Remove(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	_, err = s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+	err = s.PipelineStorage.Remove(context.TODO(), "my-pipeline")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineNotFound)
+}
+
+func (s *PipelineSuite) TestPipelineApprovals(c *check.C) {
+	p := appTypes.Pipeline{Name: "my-pipeline", TeamOwner: "team1", Stages: []appTypes.PipelineStage{{App: "a1"}, {App: "a2", ManualApproval: true}}}
+	err := s.PipelineStorage.Insert(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	approval := appTypes.PipelineApproval{Stage: "a2", Version: 3, RequestedBy: "me@tsuru.io"}
+	err = s.PipelineStorage.AddApproval(context.TODO(), "my-pipeline", approval)
+	c.Assert(err, check.IsNil)
+	err = s.PipelineStorage.AddApproval(context.TODO(), "my-pipeline", appTypes.PipelineApproval{Stage: "a2", Version: 3, RequestedBy: "other@tsuru.io"})
+	c.Assert(err, check.IsNil)
+	dbPipeline, err := s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline.Approvals, check.DeepEquals, []appTypes.PipelineApproval{approval})
+	err = s.PipelineStorage.Update(context.TODO(), p)
+	c.Assert(err, check.IsNil)
+	err = s.PipelineStorage.Approve(context.TODO(), "my-pipeline", "a2", 3, "boss@tsuru.io")
+	c.Assert(err, check.IsNil)
+	err = s.PipelineStorage.Approve(context.TODO(), "my-pipeline", "a2", 3, "boss@tsuru.io")
+	c.Assert(err, check.Equals, appTypes.ErrPipelineApprovalNotFound)
+	dbPipeline, err = s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline.Approvals, check.HasLen, 1)
+	c.Assert(dbPipeline.Approvals[0].ApprovedBy, check.Equals, "boss@tsuru.io")
+	c.Assert(dbPipeline.Approvals[0].ApprovedAt.IsZero(), check.Equals, false)
+	err = s.PipelineStorage.RemoveApproval(context.TODO(), "my-pipeline", "a2", 3)
+	c.Assert(err, check.IsNil)
+	dbPipeline, err = s.PipelineStorage.Get(context.TODO(), "my-pipeline")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPipeline.Approvals, check.HasLen, 0)
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storagetest
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsuru/config"
+	provTypes "github.com/tsuru/tsuru/types/provision"
+	check "gopkg.in/check.v1"
+)
+
+type UnitEventSuite struct {
+	SuiteHooks
+	UnitEventStorage provTypes.UnitEventStorage
+}
+
+func (s *UnitEventSuite) TestFindUnitEvents(c *check.C) {
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	events := []provTypes.UnitEvent{
+		{App: "myapp", Unit: "myapp-web-1", Process: "web", Version: 1, Kind: provTypes.UnitEventReady, Time: now.Add(-time.Hour)},
+		{App: "myapp", Unit: "myapp-web-1", Process: "web", Version: 1, Kind: provTypes.UnitEventOOMKilled, Reason: "OOMKilled", RestartCount: 1, Time: now.Add(-time.Minute)},
+		{App: "myapp", Unit: "myapp-worker-1", Process: "worker", Version: 1, Kind: provTypes.UnitEventCrashLoop, Reason: "CrashLoopBackOff", Time: now},
+		{App: "otherapp", Unit: "otherapp-web-1", Process: "web", Version: 2, Kind: provTypes.UnitEventOOMKilled, Time: now},
+	}
+	for _, evt := range events {
+		err := s.UnitEventStorage.Insert(context.TODO(), evt)
+		c.Assert(err, check.IsNil)
+	}
+	find := func(filter provTypes.UnitEventFilter) []provTypes.UnitEvent {
+		result, err := s.UnitEventStorage.Find(context.TODO(), filter)
+		c.Assert(err, check.IsNil)
+		for i := range result {
+			result[i].Time = result[i].Time.UTC()
+		}
+		return result
+	}
+	c.Assert(find(provTypes.UnitEventFilter{App: "myapp"}), check.DeepEquals, []provTypes.UnitEvent{events[2], events[1], events[0]})
+	c.Assert(find(provTypes.UnitEventFilter{App: "myapp", Unit: "myapp-web-1"}), check.DeepEquals, []provTypes.UnitEvent{events[1], events[0]})
+	c.Assert(find(provTypes.UnitEventFilter{Kinds: []string{provTypes.UnitEventOOMKilled}}), check.DeepEquals, []provTypes.UnitEvent{events[3], events[1]})
+	c.Assert(find(provTypes.UnitEventFilter{App: "myapp", Since: now.Add(-10 * time.Minute)}), check.DeepEquals, []provTypes.UnitEvent{events[2], events[1]})
+	c.Assert(find(provTypes.UnitEventFilter{App: "myapp", Limit: 1}), check.DeepEquals, []provTypes.UnitEvent{events[2]})
+	c.Assert(find(provTypes.UnitEventFilter{App: "none"}), check.HasLen, 0)
+}
+
+func (s *UnitEventSuite) TestUnitEventRetention(c *check.C) {
+	config.Set("unit-events:retention", 3600)
+	defer config.Unset("unit-events:retention")
+	retention, err := s.UnitEventStorage.Retention(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(retention, check.Equals, time.Hour)
+	config.Set("unit-events:retention", 7200)
+	retention, err = s.UnitEventStorage.Retention(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(retention, check.Equals, 2*time.Hour)
+	// the index keeps the new TTL
+	retention, err = s.UnitEventStorage.Retention(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(retention, check.Equals, 2*time.Hour)
+}
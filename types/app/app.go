@@ -14,6 +14,7 @@ import (
 type App interface {
 	GetName() string
 	GetPool() string
+	GetCluster() string
 	GetTeamOwner() string
 	GetTeamsName() []string
 	GetPlatform() string
@@ -33,6 +34,15 @@ type AppRouter struct {
 	StatusDetail string            `json:"status-detail,omitempty" bson:"-"`
 }
 
+// GitDeploy maps pushes to a branch of a git repository to deploys of an
+// app. The secret is used to validate webhooks sent by the git provider and
+// is never exposed after being set.
+type GitDeploy struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Secret     string `json:"-"`
+}
+
 type RoutableAddresses struct {
 	Prefix    string
 	Addresses []*url.URL
@@ -11,11 +11,11 @@ import (
 )
 
 type MockApp struct {
-	Name, TeamOwner, Platform, PlatformVersion, Pool string
-	Deploys                                          uint
-	UpdatePlatform                                   bool
-	TeamsName                                        []string
-	Registry                                         imgTypes.ImageRegistry
+	Name, TeamOwner, Platform, PlatformVersion, Pool, Cluster string
+	Deploys                                                   uint
+	UpdatePlatform                                            bool
+	TeamsName                                                 []string
+	Registry                                                  imgTypes.ImageRegistry
 }
 
 func (a *MockApp) GetName() string {
@@ -26,6 +26,10 @@ func (a *MockApp) GetPool() string {
 	return a.Pool
 }
 
+func (a *MockApp) GetCluster() string {
+	return a.Cluster
+}
+
 func (a *MockApp) GetTeamsName() []string {
 	return a.TeamsName
 }
@@ -46,4 +46,6 @@ type Applog struct {
 	Source  string
 	AppName string
 	Unit    string
+	// Container is set on logs from the additional containers of a unit.
+	Container string `bson:",omitempty" json:",omitempty"`
 }
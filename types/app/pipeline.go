@@ -0,0 +1,110 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPipelineNotFound         = errors.New("pipeline not found")
+	ErrPipelineAlreadyExists    = errors.New("pipeline already exists")
+	ErrPipelineStageNotFound    = errors.New("pipeline stage not found")
+	ErrPipelineApprovalNotFound = errors.New("no pending approval for this stage and version")
+	ErrPipelineSelfApproval     = errors.New("promotions must be approved by a user other than the one requesting it")
+)
+
+// Pipeline is an ordered list of apps, e.g. dev, staging and prod, through
+// which the very same app version is promoted.
+type Pipeline struct {
+	Name      string             `json:"name"`
+	TeamOwner string             `json:"teamOwner"`
+	Stages    []PipelineStage    `json:"stages"`
+	Approvals []PipelineApproval `json:"approvals,omitempty"`
+}
+
+// PipelineStage is an app in a pipeline. ManualApproval and Verification
+// guard the promotion of a version into the stage and are ignored for the
+// first stage, which receives regular deploys. With ManualApproval, every
+// promotion must be approved by a user other than the one requesting it.
+type PipelineStage struct {
+	App            string               `json:"app"`
+	ManualApproval bool                 `json:"manualApproval"`
+	Verification   PipelineVerification `json:"verification"`
+}
+
+// PipelineVerification holds the checks performed on the previous stage
+// before a version can be promoted out of it.
+type PipelineVerification struct {
+	// MinAge is how long the version must have been deployed on the previous
+	// stage, counted from the last successful deploy of the version.
+	MinAge time.Duration `json:"minAge"`
+	// HealthyUnits requires every unit running the version on the previous
+	// stage to be available.
+	HealthyUnits bool `json:"healthyUnits"`
+}
+
+// PipelineApproval is a promotion into a stage with ManualApproval. It's
+// created pending by the user requesting the promotion and must be approved by
+// another user before the promotion is carried out.
+type PipelineApproval struct {
+	Stage       string    `json:"stage"`
+	Version     int       `json:"version"`
+	RequestedBy string    `json:"requestedBy"`
+	RequestedAt time.Time `json:"requestedAt"`
+	ApprovedBy  string    `json:"approvedBy,omitempty"`
+	ApprovedAt  time.Time `json:"approvedAt,omitempty"`
+}
+
+// Approved returns whether the promotion was already approved.
+func (a *PipelineApproval) Approved() bool {
+	return a.ApprovedBy != ""
+}
+
+// Approval returns the approval for promoting version into the stage running
+// appName, or nil when there is none.
+func (p *Pipeline) Approval(appName string, version int) *PipelineApproval {
+	for i := range p.Approvals {
+		if p.Approvals[i].Stage == appName && p.Approvals[i].Version == version {
+			return &p.Approvals[i]
+		}
+	}
+	return nil
+}
+
+// StageIndex returns the position of the stage for appName, or -1 when the
+// app is not part of the pipeline.
+func (p *Pipeline) StageIndex(appName string) int {
+	for i, stage := range p.Stages {
+		if stage.App == appName {
+			return i
+		}
+	}
+	return -1
+}
+
+type PipelineService interface {
+	Create(ctx context.Context, pipeline Pipeline) error
+	Update(ctx context.Context, pipeline Pipeline) error
+	Get(ctx context.Context, name string) (*Pipeline, error)
+	List(ctx context.Context, teams []string) ([]Pipeline, error)
+	Remove(ctx context.Context, name string) error
+	RequestApproval(ctx context.Context, name, stage string, version int, user string) (*PipelineApproval, error)
+	Approve(ctx context.Context, name, stage string, version int, user string) error
+	ConsumeApproval(ctx context.Context, name, stage string, version int) error
+}
+
+type PipelineStorage interface {
+	Insert(ctx context.Context, pipeline Pipeline) error
+	Update(ctx context.Context, pipeline Pipeline) error
+	Get(ctx context.Context, name string) (*Pipeline, error)
+	FindByTeams(ctx context.Context, teams []string) ([]Pipeline, error)
+	Remove(ctx context.Context, name string) error
+	AddApproval(ctx context.Context, name string, approval PipelineApproval) error
+	Approve(ctx context.Context, name, stage string, version int, user string) error
+	RemoveApproval(ctx context.Context, name, stage string, version int) error
+}
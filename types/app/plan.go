@@ -15,6 +15,9 @@ type Plan struct {
 	CPUMilli int          `json:"cpumilli"`
 	Default  bool         `json:"default,omitempty"`
 	Override PlanOverride `json:"override,omitempty"`
+	// ProcessOverride holds overrides applied to a single process of the
+	// app, on top of Override.
+	ProcessOverride map[string]PlanOverride `json:"processOverride,omitempty"`
 }
 
 type PlanOverride struct {
@@ -39,6 +42,64 @@ func (p *Plan) MergeOverride(po PlanOverride) {
 	}
 }
 
+// MergeProcessOverride merges the override of a single process, zero values
+// remove the overridden value. The ProcessOverride map is copied, never
+// changed in place.
+func (p *Plan) MergeProcessOverride(process string, po PlanOverride) {
+	current := p.ProcessOverride[process]
+	if po.Memory != nil {
+		if *po.Memory == 0 {
+			current.Memory = nil
+		} else {
+			current.Memory = po.Memory
+		}
+	}
+	if po.CPUMilli != nil {
+		if *po.CPUMilli == 0 {
+			current.CPUMilli = nil
+		} else {
+			current.CPUMilli = po.CPUMilli
+		}
+	}
+	overrides := make(map[string]PlanOverride, len(p.ProcessOverride)+1)
+	for k, v := range p.ProcessOverride {
+		overrides[k] = v
+	}
+	if current == (PlanOverride{}) {
+		delete(overrides, process)
+	} else {
+		overrides[process] = current
+	}
+	if len(overrides) == 0 {
+		overrides = nil
+	}
+	p.ProcessOverride = overrides
+}
+
+// GetMemory returns the memory limit of a process, considering both the app
+// and the process overrides.
+func (p *Plan) GetMemory(process string) int64 {
+	if po, ok := p.ProcessOverride[process]; ok && po.Memory != nil {
+		return *po.Memory
+	}
+	if p.Override.Memory != nil {
+		return *p.Override.Memory
+	}
+	return p.Memory
+}
+
+// GetMilliCPU returns the cpu limit of a process, considering both the app
+// and the process overrides.
+func (p *Plan) GetMilliCPU(process string) int {
+	if po, ok := p.ProcessOverride[process]; ok && po.CPUMilli != nil {
+		return *po.CPUMilli
+	}
+	if p.Override.CPUMilli != nil {
+		return *p.Override.CPUMilli
+	}
+	return p.CPUMilli
+}
+
 type PlanService interface {
 	Create(ctx context.Context, plan Plan) error
 	List(context.Context) ([]Plan, error)
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"gopkg.in/check.v1"
+)
+
+func (s S) TestPlanMergeProcessOverride(c *check.C) {
+	memory := int64(1024)
+	cpu := 200
+	zeroMemory := int64(0)
+	plan := Plan{Memory: 2048, CPUMilli: 1000}
+	plan.MergeProcessOverride("worker", PlanOverride{Memory: &memory})
+	original := plan.ProcessOverride
+	plan.MergeProcessOverride("worker", PlanOverride{CPUMilli: &cpu})
+	c.Assert(plan.ProcessOverride, check.DeepEquals, map[string]PlanOverride{
+		"worker": {Memory: &memory, CPUMilli: &cpu},
+	})
+	c.Assert(original, check.DeepEquals, map[string]PlanOverride{
+		"worker": {Memory: &memory},
+	})
+	c.Assert(plan.GetMemory("worker"), check.Equals, int64(1024))
+	c.Assert(plan.GetMilliCPU("worker"), check.Equals, 200)
+	c.Assert(plan.GetMemory("web"), check.Equals, int64(2048))
+	c.Assert(plan.GetMilliCPU("web"), check.Equals, 1000)
+	plan.MergeProcessOverride("worker", PlanOverride{Memory: &zeroMemory})
+	c.Assert(plan.ProcessOverride, check.DeepEquals, map[string]PlanOverride{
+		"worker": {CPUMilli: &cpu},
+	})
+	zeroCPU := 0
+	plan.MergeProcessOverride("worker", PlanOverride{CPUMilli: &zeroCPU})
+	c.Assert(plan.ProcessOverride, check.IsNil)
+}
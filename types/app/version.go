@@ -17,6 +17,9 @@ var (
 	ErrNoVersionsAvailable          = errors.New("no versions available for app")
 	ErrTransactionCancelledByChange = errors.New("The update has been cancelled by a previous change")
 	ErrVersionMarkedToRemoval       = errors.New("the selected version is marked to removal")
+	ErrInvalidVersionChannel        = errors.New("invalid version channel name, it must start with a letter and contain only lower case letters, numbers or dashes")
+	ErrVersionChannelNotFound       = errors.New("version channel not found")
+	ErrVersionReferencedByChannel   = errors.New("the version is referenced by a channel and can't be removed")
 )
 
 type ErrInvalidVersion struct {
@@ -67,6 +70,18 @@ type AppVersions struct {
 	UpdatedAt             time.Time              `json:"updatedAt"`
 	UpdatedHash           string                 `json:"updatedHash"`
 	MarkedToRemoval       bool                   `json:"markedToRemoval"`
+	Channels              map[string]int         `json:"channels"`
+}
+
+// IsReferencedByChannel returns whether at least one channel points to the
+// given version.
+func (v AppVersions) IsReferencedByChannel(version int) bool {
+	for _, channelVersion := range v.Channels {
+		if channelVersion == version {
+			return true
+		}
+	}
+	return false
 }
 
 type AppVersionInfo struct {
@@ -81,11 +96,21 @@ type AppVersionInfo struct {
 	EventID          string                 `json:"eventID"`
 	CreatedAt        time.Time              `json:"createdAt"`
 	UpdatedAt        time.Time              `json:"updatedAt"`
+	DeployedAt       time.Time              `json:"deployedAt"`
 	DisabledReason   string                 `json:"disabledReason"`
 	Disabled         bool                   `json:"disabled"`
 	DeploySuccessful bool                   `json:"deploySuccessful"`
 	MarkedToRemoval  bool                   `json:"markedToRemoval"`
 	PastUnits        map[string]int         `json:"pastUnits"`
+	Provenance       *AppVersionProvenance  `json:"provenance,omitempty"`
+}
+
+// AppVersionProvenance identifies the app version from which a version was
+// promoted, allowing to track that the very same image tested on an app is
+// the one running on another.
+type AppVersionProvenance struct {
+	App     string `json:"app"`
+	Version int    `json:"version"`
 }
 
 type NewVersionArgs struct {
@@ -93,6 +118,7 @@ type NewVersionArgs struct {
 	App            App
 	CustomBuildTag string
 	Description    string
+	Provenance     *AppVersionProvenance
 }
 
 type AppVersionWriteOptions struct {
@@ -107,6 +133,8 @@ type AppVersionService interface {
 	LatestSuccessfulVersion(ctx context.Context, app App) (AppVersion, error)
 	NewAppVersion(ctx context.Context, args NewVersionArgs) (AppVersion, error)
 	AppVersionFromInfo(context.Context, App, AppVersionInfo) (AppVersion, error)
+	SetVersionChannel(ctx context.Context, app App, channel string, version int) error
+	UnsetVersionChannel(ctx context.Context, app App, channel string) error
 }
 
 type AppVersionStorage interface {
@@ -114,6 +142,8 @@ type AppVersionStorage interface {
 	UpdateVersion(ctx context.Context, appName string, vi *AppVersionInfo, opts ...*AppVersionWriteOptions) error
 	UpdateVersionSuccess(ctx context.Context, appName string, vi *AppVersionInfo, opts ...*AppVersionWriteOptions) error
 	NewAppVersion(ctx context.Context, args NewVersionArgs) (*AppVersionInfo, error)
+	SetVersionChannel(ctx context.Context, appName, channel string, version int, opts ...*AppVersionWriteOptions) error
+	UnsetVersionChannel(ctx context.Context, appName, channel string, opts ...*AppVersionWriteOptions) error
 }
 
 type commonAppVersion interface {
@@ -16,10 +16,22 @@ var _ quota.QuotaItem = &Team{}
 
 // Team represents a real world team, a team has one creating user and a name.
 type Team struct {
-	Name         string      `json:"name"`
-	CreatingUser string      `json:"creatingUser"`
-	Tags         []string    `json:"tags"`
-	Quota        quota.Quota `json:"quota"`
+	Name           string                `json:"name"`
+	CreatingUser   string                `json:"creatingUser"`
+	Tags           []string              `json:"tags"`
+	Quota          quota.Quota           `json:"quota"`
+	ResourceQuotas []quota.ResourceQuota `json:"resourceQuotas,omitempty"`
+}
+
+// ResourceQuota returns the resource quota of the team in the pool, which is
+// unlimited unless it has been set.
+func (t Team) ResourceQuota(pool string) quota.ResourceQuota {
+	for _, q := range t.ResourceQuotas {
+		if q.Pool == pool {
+			return q
+		}
+	}
+	return quota.ResourceQuota{Pool: pool, MilliCPU: -1, Memory: -1}
 }
 
 func (t Team) GetName() string {
@@ -33,6 +45,7 @@ type TeamService interface {
 	FindByName(context.Context, string) (*Team, error)
 	FindByNames(context.Context, []string) ([]Team, error)
 	Remove(context.Context, string) error
+	SetResourceQuota(context.Context, string, quota.ResourceQuota) error
 }
 
 type TeamStorage interface {
@@ -4,7 +4,11 @@
 
 package auth
 
-import "context"
+import (
+	"context"
+
+	"github.com/tsuru/tsuru/types/quota"
+)
 
 var _ TeamStorage = &MockTeamStorage{}
 var _ TeamService = &MockTeamService{}
@@ -50,6 +54,8 @@ type MockTeamService struct {
 	OnFindByName  func(string) (*Team, error)
 	OnFindByNames func([]string) ([]Team, error)
 	OnRemove      func(string) error
+
+	OnSetResourceQuota func(string, quota.ResourceQuota) error
 }
 
 func (m *MockTeamService) Create(ctx context.Context, teamName string, tags []string, user *User) error {
@@ -93,3 +99,10 @@ func (m *MockTeamService) Remove(ctx context.Context, teamName string) error {
 	}
 	return m.OnRemove(teamName)
 }
+
+func (m *MockTeamService) SetResourceQuota(ctx context.Context, teamName string, q quota.ResourceQuota) error {
+	if m.OnSetResourceQuota == nil {
+		return nil
+	}
+	return m.OnSetResourceQuota(teamName, q)
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cost
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// KindUnit prices the units of apps, by pool and plan.
+	KindUnit = "unit"
+	// KindVolume prices volumes, by pool and volume plan.
+	KindVolume = "volume"
+	// KindServiceInstance prices service instances, by service and plan.
+	KindServiceInstance = "service-instance"
+)
+
+var (
+	ErrPriceNotFound    = errors.New("price not found")
+	ErrInvalidPriceKind = errors.New("invalid price kind, must be one of: unit, volume, service-instance")
+	ErrNegativePrice    = errors.New("prices cannot be negative")
+	ErrInvalidPrice     = errors.New("cpu and memory prices are only valid for units")
+	ErrInvalidPricePool = errors.New("service instance prices are set by service, not by pool")
+)
+
+// Price is the hourly price of a unit, volume or service instance. Empty
+// Pool, Service or Plan fields match any of them. Units are also charged
+// for the size of their plan, CPUHourly per core and MemoryHourly per GiB.
+type Price struct {
+	Kind         string  `json:"kind"`
+	Pool         string  `json:"pool,omitempty"`
+	Service      string  `json:"service,omitempty"`
+	Plan         string  `json:"plan,omitempty"`
+	Hourly       float64 `json:"hourly"`
+	CPUHourly    float64 `json:"cpuHourly,omitempty"`
+	MemoryHourly float64 `json:"memoryHourly,omitempty"`
+}
+
+func (p Price) Validate() error {
+	switch p.Kind {
+	case KindUnit, KindVolume, KindServiceInstance:
+	default:
+		return ErrInvalidPriceKind
+	}
+	if p.Hourly < 0 || p.CPUHourly < 0 || p.MemoryHourly < 0 {
+		return ErrNegativePrice
+	}
+	if p.Kind != KindUnit && (p.CPUHourly != 0 || p.MemoryHourly != 0) {
+		return ErrInvalidPrice
+	}
+	if p.Kind == KindServiceInstance && p.Pool != "" {
+		return ErrInvalidPricePool
+	}
+	return nil
+}
+
+// ID identifies the price among the prices of the same kind, pool, service
+// and plan.
+func (p Price) ID() string {
+	return strings.Join([]string{p.Kind, p.Pool, p.Service, p.Plan}, "/")
+}
+
+// UnitHourly returns the hourly price of a unit with the given amount of CPU,
+// in thousandths of a core, and memory, in bytes.
+func (p Price) UnitHourly(milliCPU, memory int64) float64 {
+	return p.Hourly + p.CPUHourly*float64(milliCPU)/1000 + p.MemoryHourly*float64(memory)/(1024*1024*1024)
+}
+
+func (p Price) scope() string {
+	if p.Kind == KindServiceInstance {
+		return p.Service
+	}
+	return p.Pool
+}
+
+type Prices []Price
+
+// Find returns the most specific price of the kind for the scope, a pool for
+// units and volumes or a service for service instances, and plan. Prices
+// matching both scope and plan come first, then the ones matching only the
+// plan, then only the scope and at last the default price of the kind.
+func (ps Prices) Find(kind, scope, plan string) (Price, bool) {
+	candidates := [][2]string{{scope, plan}, {"", plan}, {scope, ""}, {"", ""}}
+	for _, candidate := range candidates {
+		for _, p := range ps {
+			if p.Kind == kind && p.scope() == candidate[0] && p.Plan == candidate[1] {
+				return p, true
+			}
+		}
+	}
+	return Price{}, false
+}
+
+// Item is the cost of an app process, volume or service instance in the
+// period of a report. Units is the number of units currently running, it's
+// only set for app processes.
+type Item struct {
+	Kind        string  `json:"kind"`
+	Name        string  `json:"name"`
+	Team        string  `json:"team"`
+	Process     string  `json:"process,omitempty"`
+	Pool        string  `json:"pool,omitempty"`
+	Service     string  `json:"service,omitempty"`
+	Plan        string  `json:"plan,omitempty"`
+	Units       int     `json:"units,omitempty"`
+	Hours       float64 `json:"hours"`
+	HourlyPrice float64 `json:"hourlyPrice"`
+	Cost        float64 `json:"cost"`
+	Forecast    float64 `json:"forecast"`
+}
+
+// Report is the cost of the resources of a team or app from Start to End.
+// Forecast is the cost at End if the current allocation is kept until then.
+type Report struct {
+	Team        string    `json:"team,omitempty"`
+	App         string    `json:"app,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Currency    string    `json:"currency,omitempty"`
+	Items       []Item    `json:"items"`
+	Cost        float64   `json:"cost"`
+	Forecast    float64   `json:"forecast"`
+}
+
+type PriceService interface {
+	Set(ctx context.Context, p Price) error
+	Remove(ctx context.Context, p Price) error
+	List(ctx context.Context) (Prices, error)
+}
+
+type PriceStorage interface {
+	Upsert(ctx context.Context, p Price) error
+	Delete(ctx context.Context, p Price) error
+	FindAll(ctx context.Context) (Prices, error)
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+// CapacityResources holds amounts of CPU, in thousandths of a core, memory
+// and ephemeral storage, in bytes.
+type CapacityResources struct {
+	MilliCPU         int64 `json:"milliCPU"`
+	Memory           int64 `json:"memory"`
+	EphemeralStorage int64 `json:"ephemeralStorage"`
+}
+
+func (r CapacityResources) Add(other CapacityResources) CapacityResources {
+	return CapacityResources{
+		MilliCPU:         r.MilliCPU + other.MilliCPU,
+		Memory:           r.Memory + other.Memory,
+		EphemeralStorage: r.EphemeralStorage + other.EphemeralStorage,
+	}
+}
+
+// PodsCapacity is the number of pods running compared to the maximum number
+// of pods allowed.
+type PodsCapacity struct {
+	Count int64 `json:"count"`
+	Limit int64 `json:"limit"`
+}
+
+// CapacityFactors are the factors applied to plans when computing the
+// requests and limits of units.
+type CapacityFactors struct {
+	CPUOvercommit    float64 `json:"cpuOvercommit"`
+	MemoryOvercommit float64 `json:"memoryOvercommit"`
+	CPUBurst         float64 `json:"cpuBurst"`
+}
+
+// NodeCapacity is the capacity of a node and how it's allocated. Used is
+// only set when resource usage metrics are available.
+type NodeCapacity struct {
+	Name        string             `json:"name"`
+	Allocatable CapacityResources  `json:"allocatable"`
+	Requested   CapacityResources  `json:"requested"`
+	Limits      CapacityResources  `json:"limits"`
+	Used        *CapacityResources `json:"used,omitempty"`
+	Pods        PodsCapacity       `json:"pods"`
+}
+
+// AppCapacity is the share of the capacity of a pool taken by an app.
+type AppCapacity struct {
+	App       string             `json:"app"`
+	Units     int                `json:"units"`
+	Requested CapacityResources  `json:"requested"`
+	Used      *CapacityResources `json:"used,omitempty"`
+}
+
+// PoolCapacity is the capacity of the nodes of a pool and how it's
+// allocated. PlanCapacity is the allocatable capacity scaled by the
+// overcommit factors, the sum of plans the pool is able to run.
+type PoolCapacity struct {
+	Pool         string             `json:"pool"`
+	Factors      CapacityFactors    `json:"factors"`
+	Allocatable  CapacityResources  `json:"allocatable"`
+	PlanCapacity CapacityResources  `json:"planCapacity"`
+	Requested    CapacityResources  `json:"requested"`
+	Limits       CapacityResources  `json:"limits"`
+	Used         *CapacityResources `json:"used,omitempty"`
+	Pods         PodsCapacity       `json:"pods"`
+	Nodes        []NodeCapacity     `json:"nodes"`
+	TopApps      []AppCapacity      `json:"topApps"`
+}
+
+type ClusterCapacity struct {
+	Cluster string         `json:"cluster"`
+	Pools   []PoolCapacity `json:"pools"`
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// NetworkPolicyOpen allows all traffic to and from the units of apps,
+	// unless the app declares its own peers.
+	NetworkPolicyOpen = "open"
+	// NetworkPolicyTeamIsolated only allows traffic to the units of apps
+	// from apps of the same team owner and from the declared peers.
+	NetworkPolicyTeamIsolated = "team-isolated"
+	// NetworkPolicyDenyAll only allows traffic to and from the declared
+	// peers.
+	NetworkPolicyDenyAll = "deny-all"
+)
+
+// NetworkPolicy holds the peers allowed to communicate with the units of an
+// app.
+type NetworkPolicy struct {
+	Ingress []NetworkPolicyPeer `json:"ingress,omitempty"`
+	Egress  []NetworkPolicyPeer `json:"egress,omitempty"`
+}
+
+// NetworkPolicyPeer is a source or destination of traffic, only one of app,
+// team, service instance or CIDR may be set. A process without an app refers
+// to a process of the app declaring the peer.
+type NetworkPolicyPeer struct {
+	App             string              `json:"app,omitempty"`
+	Process         string              `json:"process,omitempty"`
+	Team            string              `json:"team,omitempty"`
+	Service         string              `json:"service,omitempty"`
+	ServiceInstance string              `json:"service_instance,omitempty" bson:"service_instance,omitempty"`
+	CIDR            string              `json:"cidr,omitempty"`
+	Ports           []NetworkPolicyPort `json:"ports,omitempty"`
+}
+
+type NetworkPolicyPort struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// NetworkPolicyRules are the peers allowed in one direction of traffic.
+type NetworkPolicyRules struct {
+	AllowAll bool                `json:"allowAll"`
+	Peers    []NetworkPolicyPeer `json:"peers,omitempty"`
+}
+
+// EffectiveNetworkPolicy is the network policy enforced for the units of an
+// app, combining the default of its pool with the peers declared for the app.
+type EffectiveNetworkPolicy struct {
+	Mode    string             `json:"mode"`
+	Ingress NetworkPolicyRules `json:"ingress"`
+	Egress  NetworkPolicyRules `json:"egress"`
+}
+
+func ValidNetworkPolicyMode(mode string) bool {
+	switch mode {
+	case NetworkPolicyOpen, NetworkPolicyTeamIsolated, NetworkPolicyDenyAll:
+		return true
+	}
+	return false
+}
+
+func (p NetworkPolicyPeer) Validate() error {
+	var targets int
+	for _, v := range []string{p.App, p.Team, p.ServiceInstance, p.CIDR} {
+		if v != "" {
+			targets++
+		}
+	}
+	if p.App == "" && p.Process != "" {
+		targets++
+	}
+	if targets != 1 {
+		return errors.New("network policy peer must have exactly one of app, process, team, service_instance or cidr")
+	}
+	if p.Process != "" && (p.Team != "" || p.ServiceInstance != "" || p.CIDR != "") {
+		return errors.New("network policy peer process may only be used with app")
+	}
+	if (p.Service == "") != (p.ServiceInstance == "") {
+		return errors.New("network policy peer service and service_instance must be used together")
+	}
+	if p.CIDR != "" {
+		if _, _, err := net.ParseCIDR(p.CIDR); err != nil {
+			return errors.Errorf("invalid network policy peer cidr %q", p.CIDR)
+		}
+	}
+	for _, port := range p.Ports {
+		if port.Port <= 0 || port.Port > 65535 {
+			return errors.Errorf("invalid network policy peer port %d", port.Port)
+		}
+		switch strings.ToUpper(port.Protocol) {
+		case "", "TCP", "UDP":
+		default:
+			return errors.Errorf("invalid network policy peer protocol %q, must be either TCP or UDP", port.Protocol)
+		}
+	}
+	return nil
+}
+
+func (p *NetworkPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, peer := range append(append([]NetworkPolicyPeer{}, p.Ingress...), p.Egress...) {
+		if err := peer.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateMode checks the declared peers against the mode of the pool. Apps in
+// deny-all pools may only send traffic to their own processes, to the apps of
+// their team owner and to service instances, other egress peers would lift the
+// pool isolation. Callers must check that the app is bound to the service
+// instances.
+func (p *NetworkPolicy) ValidateMode(mode, teamOwner string) error {
+	if p == nil || mode != NetworkPolicyDenyAll {
+		return nil
+	}
+	for _, peer := range p.Egress {
+		if peer.App == "" && peer.Process != "" {
+			continue
+		}
+		if peer.Team != "" && peer.Team == teamOwner {
+			continue
+		}
+		if peer.ServiceInstance != "" {
+			continue
+		}
+		return errors.Errorf("apps in %s pools may only declare egress peers for their own processes, their team owner or their service instances", NetworkPolicyDenyAll)
+	}
+	return nil
+}
+
+// Effective returns the network policy enforced for an app owned by
+// teamOwner, running in a pool using the received mode. Declaring peers in one
+// direction restricts the traffic in that direction to the declared peers.
+func (p *NetworkPolicy) Effective(mode, teamOwner string) EffectiveNetworkPolicy {
+	if mode == "" {
+		mode = NetworkPolicyOpen
+	}
+	var declared NetworkPolicy
+	if p != nil {
+		declared = *p
+	}
+	result := EffectiveNetworkPolicy{
+		Mode: mode,
+		Ingress: NetworkPolicyRules{
+			AllowAll: mode == NetworkPolicyOpen && len(declared.Ingress) == 0,
+		},
+		Egress: NetworkPolicyRules{
+			AllowAll: mode != NetworkPolicyDenyAll && len(declared.Egress) == 0,
+		},
+	}
+	if mode == NetworkPolicyTeamIsolated {
+		result.Ingress.Peers = append(result.Ingress.Peers, NetworkPolicyPeer{Team: teamOwner})
+	}
+	result.Ingress.Peers = append(result.Ingress.Peers, declared.Ingress...)
+	result.Egress.Peers = append(result.Egress.Peers, declared.Egress...)
+	return result
+}
@@ -64,7 +64,135 @@ func (in *TsuruYamlKubernetesConfig) DeepCopy() *TsuruYamlKubernetesConfig {
 type TsuruYamlKubernetesGroup map[string]TsuruYamlKubernetesProcessConfig
 
 type TsuruYamlKubernetesProcessConfig struct {
-	Ports []TsuruYamlKubernetesProcessPortConfig `json:"ports"`
+	Ports            []TsuruYamlKubernetesProcessPortConfig `json:"ports"`
+	Resources        *TsuruYamlKubernetesProcessResources   `json:"resources,omitempty"`
+	Sidecars         []TsuruYamlKubernetesContainer         `json:"sidecars,omitempty"`
+	InitContainers   []TsuruYamlKubernetesContainer         `json:"init_containers,omitempty"`
+	VolumeMounts     []TsuruYamlKubernetesVolumeMount       `json:"volume_mounts,omitempty"`
+	Rollout          *TsuruYamlKubernetesRollout            `json:"rollout,omitempty"`
+	Liveness         *TsuruYamlKubernetesProbe              `json:"liveness,omitempty"`
+	Readiness        *TsuruYamlKubernetesProbe              `json:"readiness,omitempty"`
+	Startup          *TsuruYamlKubernetesProbe              `json:"startup,omitempty"`
+	Spread           *TsuruYamlKubernetesSpread             `json:"spread,omitempty"`
+	DisruptionBudget *TsuruYamlKubernetesDisruptionBudget   `json:"disruption_budget,omitempty"`
+}
+
+// TsuruYamlKubernetesDisruptionBudget configures the PodDisruptionBudget of a
+// process. At most one of MinAvailable and MaxUnavailable may be set, either
+// as a number of units or as a percentage like "50%".
+type TsuruYamlKubernetesDisruptionBudget struct {
+	MinAvailable   string `json:"min_available,omitempty" bson:"min_available,omitempty"`
+	MaxUnavailable string `json:"max_unavailable,omitempty" bson:"max_unavailable,omitempty"`
+	Disabled       bool   `json:"disabled,omitempty" bson:",omitempty"`
+}
+
+const (
+	SpreadTopologyZone = "zone"
+	SpreadTopologyNode = "node"
+
+	AntiAffinityRequired  = "required"
+	AntiAffinityPreferred = "preferred"
+)
+
+// TsuruYamlKubernetesSpread controls how the units of a process are spread
+// across the cluster. Topologies may be either "zone", "node" or a node label
+// name.
+type TsuruYamlKubernetesSpread struct {
+	TopologySpread       []TsuruYamlKubernetesTopologySpread `json:"topology_spread,omitempty" bson:"topology_spread,omitempty"`
+	AntiAffinity         string                              `json:"anti_affinity,omitempty" bson:"anti_affinity,omitempty"`
+	AntiAffinityTopology string                              `json:"anti_affinity_topology,omitempty" bson:"anti_affinity_topology,omitempty"`
+}
+
+type TsuruYamlKubernetesTopologySpread struct {
+	Topology string `json:"topology"`
+	MaxSkew  int    `json:"max_skew,omitempty" bson:"max_skew,omitempty"`
+	Required bool   `json:"required,omitempty" bson:",omitempty"`
+}
+
+// TsuruYamlKubernetesProbe is a check executed on the units of a process,
+// exactly one of HTTP, TCP, Exec or GRPC must be set. Unset thresholds use the
+// kubernetes defaults.
+type TsuruYamlKubernetesProbe struct {
+	HTTP                *TsuruYamlKubernetesHTTPProbe `json:"http,omitempty" bson:",omitempty"`
+	TCP                 *TsuruYamlKubernetesTCPProbe  `json:"tcp,omitempty" bson:",omitempty"`
+	Exec                *TsuruYamlKubernetesExecProbe `json:"exec,omitempty" bson:",omitempty"`
+	GRPC                *TsuruYamlKubernetesGRPCProbe `json:"grpc,omitempty" bson:",omitempty"`
+	InitialDelaySeconds int                           `json:"initial_delay_seconds,omitempty" bson:"initial_delay_seconds,omitempty"`
+	PeriodSeconds       int                           `json:"period_seconds,omitempty" bson:"period_seconds,omitempty"`
+	TimeoutSeconds      int                           `json:"timeout_seconds,omitempty" bson:"timeout_seconds,omitempty"`
+	SuccessThreshold    int                           `json:"success_threshold,omitempty" bson:"success_threshold,omitempty"`
+	FailureThreshold    int                           `json:"failure_threshold,omitempty" bson:"failure_threshold,omitempty"`
+}
+
+type TsuruYamlKubernetesHTTPProbe struct {
+	Path    string            `json:"path"`
+	Port    int               `json:"port,omitempty" bson:",omitempty"`
+	Scheme  string            `json:"scheme,omitempty" bson:",omitempty"`
+	Headers map[string]string `json:"headers,omitempty" bson:",omitempty"`
+}
+
+type TsuruYamlKubernetesTCPProbe struct {
+	Port int `json:"port,omitempty" bson:",omitempty"`
+}
+
+type TsuruYamlKubernetesExecProbe struct {
+	Command []string `json:"command"`
+}
+
+type TsuruYamlKubernetesGRPCProbe struct {
+	Port    int    `json:"port,omitempty" bson:",omitempty"`
+	Service string `json:"service,omitempty" bson:",omitempty"`
+}
+
+// TsuruYamlKubernetesRollout configures how the units of a process are
+// replaced during rollouts and how they are stopped, unset values are taken
+// from the pool configuration.
+type TsuruYamlKubernetesRollout struct {
+	MaxSurge                      string   `json:"max_surge,omitempty" bson:"max_surge,omitempty"`
+	MaxUnavailable                string   `json:"max_unavailable,omitempty" bson:"max_unavailable,omitempty"`
+	TerminationGracePeriodSeconds *int     `json:"termination_grace_period_seconds,omitempty" bson:"termination_grace_period_seconds,omitempty"`
+	PreStopSleepSeconds           *int     `json:"pre_stop_sleep_seconds,omitempty" bson:"pre_stop_sleep_seconds,omitempty"`
+	PreStop                       []string `json:"pre_stop,omitempty" bson:"pre_stop,omitempty"`
+}
+
+// TsuruYamlKubernetesContainer is an additional container running in the
+// units of a process, either alongside the process as a sidecar or before it
+// as an init container.
+type TsuruYamlKubernetesContainer struct {
+	Name         string                               `json:"name"`
+	Image        string                               `json:"image"`
+	Command      []string                             `json:"command,omitempty" bson:",omitempty"`
+	Env          []TsuruYamlKubernetesEnvVar          `json:"env,omitempty" bson:",omitempty"`
+	Ports        []TsuruYamlKubernetesContainerPort   `json:"ports,omitempty" bson:",omitempty"`
+	Resources    *TsuruYamlKubernetesProcessResources `json:"resources,omitempty" bson:",omitempty"`
+	VolumeMounts []TsuruYamlKubernetesVolumeMount     `json:"volume_mounts,omitempty" bson:"volume_mounts,omitempty"`
+}
+
+type TsuruYamlKubernetesEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type TsuruYamlKubernetesContainerPort struct {
+	Name     string `json:"name,omitempty" bson:",omitempty"`
+	Protocol string `json:"protocol,omitempty" bson:",omitempty"`
+	Port     int    `json:"port"`
+}
+
+// TsuruYamlKubernetesVolumeMount mounts a volume shared by the containers of
+// a unit, the volume is created empty on each unit.
+type TsuruYamlKubernetesVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mount_path" bson:"mount_path"`
+	ReadOnly  bool   `json:"read_only,omitempty" bson:"read_only,omitempty"`
+}
+
+// TsuruYamlKubernetesProcessResources are the resources of a process, or of a
+// sidecar or init container, values are kubernetes quantities like "512Mi" or
+// "250m".
+type TsuruYamlKubernetesProcessResources struct {
+	Memory string `json:"memory,omitempty"`
+	CPU    string `json:"cpu,omitempty"`
 }
 
 type TsuruYamlKubernetesProcessPortConfig struct {
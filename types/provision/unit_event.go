@@ -0,0 +1,69 @@
+// Copyright 2022 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// UnitEventReady is recorded when a unit starts receiving traffic.
+	UnitEventReady = "ready"
+	// UnitEventNotReady is recorded when a unit stops receiving traffic.
+	UnitEventNotReady = "not-ready"
+	// UnitEventRestarted is recorded when a container of a unit restarts
+	// for reasons other than running out of memory.
+	UnitEventRestarted = "restarted"
+	// UnitEventOOMKilled is recorded when a container of a unit is killed
+	// for exceeding its memory limit.
+	UnitEventOOMKilled = "oom-killed"
+	// UnitEventCrashLoop is recorded when restarts of a container of a unit
+	// are being delayed as it keeps failing.
+	UnitEventCrashLoop = "crash-loop"
+	// UnitEventEvicted is recorded when a unit is evicted from its node.
+	UnitEventEvicted = "evicted"
+	// UnitEventImagePullFailed is recorded when the image of a container
+	// of a unit cannot be pulled.
+	UnitEventImagePullFailed = "image-pull-failed"
+	// UnitEventDeleted is recorded when a unit is removed.
+	UnitEventDeleted = "deleted"
+)
+
+// UnitEvent is an entry in the lifecycle history of a unit.
+type UnitEvent struct {
+	App          string    `json:"app"`
+	Unit         string    `json:"unit"`
+	Process      string    `json:"process,omitempty"`
+	Version      int       `json:"version,omitempty"`
+	Kind         string    `json:"kind"`
+	Reason       string    `json:"reason,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	RestartCount int       `json:"restartCount,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// UnitEventFilter selects unit events, empty fields match every event.
+// Events are returned from the most recent, up to Limit events.
+type UnitEventFilter struct {
+	App   string
+	Unit  string
+	Kinds []string
+	Since time.Time
+	Limit int
+}
+
+type UnitEventService interface {
+	Add(ctx context.Context, evt UnitEvent) error
+	List(ctx context.Context, filter UnitEventFilter) ([]UnitEvent, error)
+	// Retention returns how long unit events are kept for.
+	Retention(ctx context.Context) (time.Duration, error)
+}
+
+type UnitEventStorage interface {
+	Insert(ctx context.Context, evt UnitEvent) error
+	Find(ctx context.Context, filter UnitEventFilter) ([]UnitEvent, error)
+	Retention(ctx context.Context) (time.Duration, error)
+}
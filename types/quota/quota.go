@@ -44,6 +44,49 @@ type QuotaStorage interface {
 	Set(ctx context.Context, name string, quantity int) error
 }
 
+// ResourceQuota limits the CPU and memory, summed over all units, that apps
+// of a team may allocate in a pool. Negative values mean unlimited.
+type ResourceQuota struct {
+	Pool     string `json:"pool"`
+	MilliCPU int64  `json:"milliCPU"`
+	Memory   int64  `json:"memory"`
+}
+
+func (q *ResourceQuota) IsUnlimited() bool {
+	return q.MilliCPU < 0 && q.Memory < 0
+}
+
+// Resources holds amounts of CPU, in thousandths of a core, and memory, in
+// bytes.
+type Resources struct {
+	MilliCPU int64 `json:"milliCPU"`
+	Memory   int64 `json:"memory"`
+}
+
+func (r Resources) Add(other Resources) Resources {
+	return Resources{MilliCPU: r.MilliCPU + other.MilliCPU, Memory: r.Memory + other.Memory}
+}
+
+// ResourceQuotaUsage is the usage of a resource quota. Allocated is the sum
+// of the plans of the team units, which is what the quota is enforced
+// against, and Requested is what the provisioner actually reserves for them.
+type ResourceQuotaUsage struct {
+	ResourceQuota
+	Allocated Resources `json:"allocated"`
+	Requested Resources `json:"requested"`
+}
+
+type ResourceQuotaExceededError struct {
+	Pool      string
+	Resource  string
+	Requested int64
+	Available int64
+}
+
+func (err *ResourceQuotaExceededError) Error() string {
+	return fmt.Sprintf("Team %s quota exceeded in pool %s. Available: %d, Requested: %d.", err.Resource, err.Pool, err.Available, err.Requested)
+}
+
 type QuotaExceededError struct {
 	Requested uint
 	Available uint